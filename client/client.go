@@ -0,0 +1,329 @@
+// Package client is a Go client for the policies and roles of the ORY Access Control Policy engines.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/keto/storage"
+)
+
+// DefaultBackoff waits 100ms before the first retry and doubles the delay for every further retry.
+func DefaultBackoff(attempt int) time.Duration {
+	return 100 * time.Millisecond << uint(attempt)
+}
+
+// Client talks to the policies and roles of a single flavor of the ORY Access Control Policy engines. It is safe for
+// concurrent use.
+type Client struct {
+	endpoint *url.URL
+	flavor   string
+	c        *http.Client
+
+	retries int
+	backoff func(attempt int) time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client which sends the requests. Defaults to http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.c = c
+	}
+}
+
+// WithRetries retries requests which failed with a status code of 500 or above, or which could not be sent at all,
+// up to retries times. The backoff returns how long to wait before the given retry, starting at 0, and defaults to
+// DefaultBackoff. Requests are not retried by default.
+func WithRetries(retries int, backoff func(attempt int) time.Duration) Option {
+	return func(client *Client) {
+		client.retries = retries
+		if backoff != nil {
+			client.backoff = backoff
+		}
+	}
+}
+
+// New returns a client for the server at the endpoint, for example "http://localhost:4466", and the flavor, which is
+// "regex", "glob", or "exact".
+func New(endpoint, flavor string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c := &Client{endpoint: u, flavor: flavor, c: http.DefaultClient, backoff: DefaultBackoff}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// PolicyFilter restricts ListPolicies like the query parameters of the list endpoint. Empty fields are ignored.
+type PolicyFilter struct {
+	Subjects  []string
+	Resources []string
+	Actions   []string
+
+	// Effect is "allow" or "deny".
+	Effect string
+
+	// Match is "all", the default, or "any".
+	Match string
+}
+
+func (f PolicyFilter) query() url.Values {
+	q := url.Values{}
+	setAll(q, "subject", f.Subjects)
+	setAll(q, "resource", f.Resources)
+	setAll(q, "action", f.Actions)
+	setNonEmpty(q, "effect", f.Effect)
+	setNonEmpty(q, "match", f.Match)
+	return q
+}
+
+// RoleFilter restricts ListRoles like the query parameters of the list endpoint. Empty fields are ignored.
+type RoleFilter struct {
+	Members  []string
+	IDPrefix string
+
+	// Match is "all", the default, or "any".
+	Match string
+}
+
+func (f RoleFilter) query() url.Values {
+	q := url.Values{}
+	setAll(q, "member", f.Members)
+	setNonEmpty(q, "id_prefix", f.IDPrefix)
+	setNonEmpty(q, "match", f.Match)
+	return q
+}
+
+// GetPolicy returns the policy with the ID.
+func (c *Client) GetPolicy(ctx context.Context, id string) (*storage.Policy, error) {
+	var p storage.Policy
+	if _, err := c.do(ctx, "GET", c.path("policies", id), nil, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPolicies returns all policies matching the filter, following the pages of the response.
+func (c *Client) ListPolicies(ctx context.Context, filter PolicyFilter) (storage.Policies, error) {
+	res := storage.Policies{}
+	if err := c.list(ctx, c.path("policies"), filter.query(), func() interface{} {
+		return new(storage.Policies)
+	}, func(page interface{}) {
+		res = append(res, *page.(*storage.Policies)...)
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpsertPolicy writes the policy and returns it as stored.
+func (c *Client) UpsertPolicy(ctx context.Context, p *storage.Policy) (*storage.Policy, error) {
+	var stored storage.Policy
+	if _, err := c.do(ctx, "PUT", c.path("policies"), nil, p, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// DeletePolicy removes the policy with the ID.
+func (c *Client) DeletePolicy(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", c.path("policies", id), nil, nil, nil)
+	return err
+}
+
+// GetRole returns the role with the ID.
+func (c *Client) GetRole(ctx context.Context, id string) (*storage.Role, error) {
+	var r storage.Role
+	if _, err := c.do(ctx, "GET", c.path("roles", id), nil, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListRoles returns all roles matching the filter, following the pages of the response.
+func (c *Client) ListRoles(ctx context.Context, filter RoleFilter) (storage.Roles, error) {
+	res := storage.Roles{}
+	if err := c.list(ctx, c.path("roles"), filter.query(), func() interface{} {
+		return new(storage.Roles)
+	}, func(page interface{}) {
+		res = append(res, *page.(*storage.Roles)...)
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpsertRole writes the role and returns it as stored.
+func (c *Client) UpsertRole(ctx context.Context, r *storage.Role) (*storage.Role, error) {
+	var stored storage.Role
+	if _, err := c.do(ctx, "PUT", c.path("roles"), nil, r, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// DeleteRole removes the role with the ID.
+func (c *Client) DeleteRole(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", c.path("roles", id), nil, nil, nil)
+	return err
+}
+
+// path returns the path of the elements below the flavor, escaping each element.
+func (c *Client) path(elements ...string) string {
+	p := "/engines/acp/ory/" + url.PathEscape(c.flavor)
+	for _, e := range elements {
+		p += "/" + url.PathEscape(e)
+	}
+	return p
+}
+
+var nextLink = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="next"`)
+
+// list requests the first page and every page linked as next by the Link header of the previous one.
+func (c *Client) list(ctx context.Context, p string, query url.Values, newPage func() interface{}, add func(page interface{})) error {
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(c.endpoint.Path, p), RawQuery: query.Encode()})
+	for {
+		page := newPage()
+		res, err := c.doURL(ctx, "GET", u, nil, page)
+		if err != nil {
+			return err
+		}
+		add(page)
+
+		m := nextLink.FindStringSubmatch(res.Header.Get("Link"))
+		if m == nil {
+			return nil
+		}
+		next, err := url.Parse(m[1])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		u = c.endpoint.ResolveReference(next)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, p string, query url.Values, body, out interface{}) (*http.Response, error) {
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(c.endpoint.Path, p), RawQuery: query.Encode()})
+	return c.doURL(ctx, method, u, body, out)
+}
+
+// doURL sends the request, retrying it if configured, and decodes the response into out. Responses with a status code
+// of 400 or above are returned as *herodot.DefaultError.
+func (c *Client) doURL(ctx context.Context, method string, u *url.URL, body, out interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, method, u, payload)
+		retry := err != nil || res.StatusCode >= http.StatusInternalServerError
+		if !retry || attempt >= c.retries || ctx.Err() != nil {
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			return res, decode(res, out)
+		}
+
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method string, u *url.URL, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.c.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+func decode(res *http.Response, out interface{}) error {
+	if res.StatusCode >= http.StatusBadRequest {
+		var e struct {
+			Error *herodot.DefaultError `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Error == nil {
+			return errors.WithStack(&herodot.DefaultError{
+				CodeField:   res.StatusCode,
+				StatusField: http.StatusText(res.StatusCode),
+				ErrorField:  fmt.Sprintf("unexpected response with status code %d", res.StatusCode),
+			})
+		}
+		if e.Error.CodeField == 0 {
+			e.Error.CodeField = res.StatusCode
+		}
+		return errors.WithStack(e.Error)
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// setAll adds the values, escaping their commas so that the server does not split them.
+func setAll(q url.Values, key string, values []string) {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			q.Add(key, strings.Replace(v, ",", `\,`, -1))
+		}
+	}
+}
+
+func setNonEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+
+	"github.com/ory/keto/engine/ladon"
+	"github.com/ory/keto/storage"
+)
+
+func newServer() *httptest.Server {
+	s := storage.NewMemoryManager()
+	sh := storage.NewHandler(s, herodot.NewJSONWriter(nil))
+	e := ladon.NewEngine(s, sh, nil, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	e.Register(r)
+	return httptest.NewServer(r)
+}
+
+func TestClient(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+	c, err := New(ts.URL, "exact")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("case=policies", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			p, err := c.UpsertPolicy(ctx, &storage.Policy{
+				ID:        fmt.Sprintf("policy-%d", i),
+				Subjects:  []string{"alice"},
+				Resources: []string{"articles"},
+				Actions:   []string{"read"},
+				Effect:    "allow",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("policy-%d", i), p.ID)
+		}
+
+		p, err := c.GetPolicy(ctx, "policy-3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, []string(p.Subjects))
+
+		ps, err := c.ListPolicies(ctx, PolicyFilter{Subjects: []string{"alice"}})
+		require.NoError(t, err)
+		assert.Len(t, ps, 5)
+
+		ps, err = c.ListPolicies(ctx, PolicyFilter{Subjects: []string{"bob"}})
+		require.NoError(t, err)
+		assert.Len(t, ps, 0)
+
+		ps, err = c.ListPolicies(ctx, PolicyFilter{Subjects: []string{"alice,bob"}, Match: "any"})
+		require.NoError(t, err)
+		assert.Len(t, ps, 0)
+
+		require.NoError(t, c.DeletePolicy(ctx, "policy-3"))
+		_, err = c.GetPolicy(ctx, "policy-3")
+		var herr *herodot.DefaultError
+		require.True(t, errors.As(err, &herr), "%+v", err)
+		assert.Equal(t, http.StatusNotFound, herr.StatusCode())
+	})
+
+	t.Run("case=roles", func(t *testing.T) {
+		_, err := c.UpsertRole(ctx, &storage.Role{ID: "admins", Members: []string{"alice"}})
+		require.NoError(t, err)
+		_, err = c.UpsertRole(ctx, &storage.Role{ID: "editors", Members: []string{"bob"}})
+		require.NoError(t, err)
+
+		r, err := c.GetRole(ctx, "admins")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alice"}, r.Members)
+
+		rs, err := c.ListRoles(ctx, RoleFilter{Members: []string{"bob"}})
+		require.NoError(t, err)
+		require.Len(t, rs, 1)
+		assert.Equal(t, "editors", rs[0].ID)
+
+		require.NoError(t, c.DeleteRole(ctx, "admins"))
+		_, err = c.GetRole(ctx, "admins")
+		var herr *herodot.DefaultError
+		require.True(t, errors.As(err, &herr), "%+v", err)
+		assert.Equal(t, http.StatusNotFound, herr.StatusCode())
+	})
+}
+
+func TestClientFollowsNextLinks(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+	c, err := New(ts.URL, "exact")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := c.UpsertRole(ctx, &storage.Role{ID: fmt.Sprintf("role-%d", i)})
+		require.NoError(t, err)
+	}
+
+	var pages int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pages, 1)
+		if r.URL.Query().Get("limit") == "" {
+			q := r.URL.Query()
+			q.Set("limit", "2")
+			r.URL.RawQuery = q.Encode()
+		}
+		res, err := http.Get(ts.URL + r.URL.RequestURI())
+		require.NoError(t, err)
+		defer res.Body.Close()
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		_, _ = io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+
+	c, err = New(proxy.URL, "exact")
+	require.NoError(t, err)
+	rs, err := c.ListRoles(ctx, RoleFilter{})
+	require.NoError(t, err)
+	assert.Len(t, rs, 5)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&pages))
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			herodot.NewJSONWriter(nil).WriteError(w, r, errors.WithStack(herodot.ErrInternalServerError))
+			return
+		}
+		herodot.NewJSONWriter(nil).Write(w, r, &storage.Role{ID: "admins"})
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	noWait := func(int) time.Duration { return 0 }
+
+	t.Run("case=without retries", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		c, err := New(ts.URL, "exact")
+		require.NoError(t, err)
+		_, err = c.GetRole(ctx, "admins")
+		var herr *herodot.DefaultError
+		require.True(t, errors.As(err, &herr), "%+v", err)
+		assert.Equal(t, http.StatusInternalServerError, herr.StatusCode())
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=retries until success", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		c, err := New(ts.URL, "exact", WithRetries(2, noWait))
+		require.NoError(t, err)
+		r, err := c.GetRole(ctx, "admins")
+		require.NoError(t, err)
+		assert.Equal(t, "admins", r.ID)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=gives up after the retries", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		c, err := New(ts.URL, "exact", WithRetries(1, noWait))
+		require.NoError(t, err)
+		_, err = c.GetRole(ctx, "admins")
+		require.Error(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=stops waiting when the context is canceled", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		c, err := New(ts.URL, "exact", WithRetries(5, func(int) time.Duration { return time.Hour }))
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = c.GetRole(ctx, "admins")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "%+v", err)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	})
+}
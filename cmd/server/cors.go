@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rs/cors"
+
+	"github.com/ory/x/corsx"
+	"github.com/ory/x/logrusx"
+	"github.com/ory/x/viperx"
+
+	"github.com/ory/keto/storage"
+)
+
+// withCORS answers preflight requests and adds the CORS headers to the responses of the handler if "serve.cors.enabled"
+// is true, see corsx. The request and response headers of the storage handlers are allowed and exposed in addition
+// to the configured ones, so that browser clients can send conditional requests and idempotency keys and read entity
+// tags and pagination headers, and so are the extra request headers which are not empty. Credentials are only allowed
+// if "serve.cors.allow_credentials" is true.
+func withCORS(h http.Handler, logger *logrusx.Logger, extraRequestHeaders ...string) http.Handler {
+	if !corsx.IsEnabled(logger, "serve") {
+		return h
+	}
+
+	opts := corsx.ParseOptions(logger, "serve")
+	opts.AllowedHeaders = append(opts.AllowedHeaders, storage.CORSRequestHeaders...)
+	for _, header := range extraRequestHeaders {
+		if header != "" {
+			opts.AllowedHeaders = append(opts.AllowedHeaders, header)
+		}
+	}
+	opts.ExposedHeaders = append(opts.ExposedHeaders, storage.CORSResponseHeaders...)
+	opts.AllowCredentials = viperx.GetBool(logger, "serve.cors.allow_credentials", false, "CORS_ALLOWED_CREDENTIALS")
+	return cors.New(opts).Handler(h)
+}
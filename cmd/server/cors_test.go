@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/logrusx"
+)
+
+func TestCORS(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"tag"`)
+		w.Header().Set("X-Total-Count", "1")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(t *testing.T, h http.Handler, method, origin string, headers map[string]string) *http.Response {
+		ts := httptest.NewServer(h)
+		defer ts.Close()
+
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact/policies", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("case=disabled", func(t *testing.T) {
+		viper.Reset()
+		defer viper.Reset()
+
+		res := do(t, withCORS(h, logrusx.New("", "")), "GET", "https://admin.example.com", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("serve.cors.enabled", true)
+	viper.Set("serve.cors.allowed_origins", []string{"https://admin.example.com"})
+	c := withCORS(h, logrusx.New("", ""), "X-Subject", "")
+
+	t.Run("case=preflight", func(t *testing.T) {
+		res := do(t, c, "OPTIONS", "https://admin.example.com", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "Content-Type, If-Match, Idempotency-Key, X-Subject",
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "https://admin.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "PUT", res.Header.Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, If-Match, Idempotency-Key, X-Subject", res.Header.Get("Access-Control-Allow-Headers"))
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, res.Header["Vary"], "Origin")
+	})
+
+	t.Run("case=preflight with disallowed header", func(t *testing.T) {
+		res := do(t, c, "OPTIONS", "https://admin.example.com", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "X-Unknown",
+		})
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("case=preflight from disallowed origin", func(t *testing.T) {
+		res := do(t, c, "OPTIONS", "https://evil.example.com", map[string]string{"Access-Control-Request-Method": "PUT"})
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("case=actual request", func(t *testing.T) {
+		res := do(t, c, "GET", "https://admin.example.com", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "https://admin.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		exposed := res.Header.Get("Access-Control-Expose-Headers")
+		for _, header := range []string{"Etag", "X-Total-Count", "Link", "Location"} {
+			assert.Contains(t, exposed, header)
+		}
+		assert.Equal(t, `"tag"`, res.Header.Get("ETag"))
+	})
+
+	t.Run("case=actual request from disallowed origin", func(t *testing.T) {
+		res := do(t, c, "GET", "https://evil.example.com", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, res.Header.Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("case=credentials", func(t *testing.T) {
+		viper.Set("serve.cors.allow_credentials", true)
+		res := do(t, withCORS(h, logrusx.New("", "")), "GET", "https://admin.example.com", nil)
+		assert.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+	})
+}
@@ -22,6 +22,7 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"net/http"
 	"time"
@@ -43,9 +44,9 @@ import (
 	"github.com/ory/x/stringslice"
 
 	"github.com/ory/keto/engine/ladon"
+	"github.com/ory/keto/storage"
 
 	"github.com/ory/x/cmdx"
-	"github.com/ory/x/corsx"
 	"github.com/ory/x/healthx"
 	"github.com/ory/x/metricsx"
 	"github.com/ory/x/reqlog"
@@ -55,6 +56,9 @@ import (
 	_ "github.com/ory/keto/engine/ladon/rego"
 )
 
+// MetricsPrometheusPath is the path on which the metrics are served in the Prometheus exposition format.
+const MetricsPrometheusPath = "/metrics/prometheus"
+
 // RunServe runs the Keto API HTTP server
 func RunServe(
 	logger *logrusx.Logger,
@@ -69,9 +73,12 @@ func RunServe(
 		router := httprouter.New()
 		d.Registry().LadonEngine().Register(router)
 		d.Registry().HealthHandler().SetRoutes(router, true)
+		d.Registry().StorageHandler().SetHealthRoutes(router)
+		d.Registry().StorageHandler().SetMaintenanceRoutes(router)
+		router.Handler("GET", MetricsPrometheusPath, d.Registry().MetricsHandler())
 
 		n := negroni.New()
-		n.Use(reqlog.NewMiddlewareFromLogger(logger, "keto").ExcludePaths(healthx.ReadyCheckPath, healthx.AliveCheckPath))
+		n.Use(reqlog.NewMiddlewareFromLogger(logger, "keto").ExcludePaths(healthx.ReadyCheckPath, healthx.AliveCheckPath, storage.ReadyCheckPath, storage.AliveCheckPath, MetricsPrometheusPath))
 
 		if tracer := d.Registry().Tracer(); tracer.IsLoaded() {
 			n.Use(tracer)
@@ -102,7 +109,7 @@ func RunServe(
 		n.Use(metrics)
 
 		n.UseHandler(router)
-		c := corsx.Initialize(n, logger, "serve")
+		c := withCORS(n, logger, d.Configuration().StorageRateLimitHeader())
 
 		server := graceful.WithDefaults(&http.Server{
 			Addr:    d.Configuration().ListenOn(),
@@ -127,6 +134,14 @@ func RunServe(
 			server.RegisterOnShutdown(d.Registry().Tracer().Close)
 		}
 
+		if d.Configuration().StorageExpiredPolicySweep() && d.Configuration().StorageReadOnly() {
+			logger.Printf("Not sweeping expired policies because the storage is read-only")
+		} else if d.Configuration().StorageExpiredPolicySweep() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go d.Registry().ExpiredPolicySweeper().Run(ctx, d.Configuration().StorageExpiredPolicySweepInterval())
+		}
+
 		if err := graceful.Graceful(func() error {
 			if cert != nil {
 				logger.Printf("Listening on https://%s", d.Configuration().ListenOn())
@@ -1,6 +1,8 @@
 package configuration
 
 import (
+	"time"
+
 	"github.com/rs/cors"
 
 	"github.com/ory/x/logrusx"
@@ -15,6 +17,42 @@ type Provider interface {
 	TracingServiceName() string
 	TracingProvider() string
 	TracingJaegerConfig() *tracing.JaegerConfig
+	StorageCacheSize() int
+	StorageCacheTTL() time.Duration
+	StorageTimeout() time.Duration
+	StorageSlowQueryThreshold() time.Duration
+	StorageAuditEnabled() bool
+	StorageAuditReads() bool
+	StorageStrictPagination() bool
+	StoragePaginationLimits(collectionType string) (defaultLimit, defaultOffset, maxLimit int)
+	StorageSoftDelete() bool
+	StorageTombstoneRetention() time.Duration
+	StorageTimestamps() bool
+	StorageCreatedStatus() bool
+	StorageNaming() string
+	StorageCodec() string
+	StorageReadOnly() bool
+	StorageReadOnlyCollections() []string
+	StorageAllowDestructiveOperations() bool
+	StorageDefaultDecision() string
+	StoragePrecedence() string
+	StorageMaxBatchSize() int
+	StorageMaxBodySize() int64
+	StorageIdempotencyTTL() time.Duration
+	StorageLockTTL() time.Duration
+	StorageWebhookURL() string
+	StorageWebhookRetries() int
+	StorageRateLimit() float64
+	StorageRateLimitBurst() int
+	StorageRateLimitHeader() string
+	StorageRoleMemberFormat() string
+	StorageRoleMaxExpansionDepth() int
+	StorageRoleReferentialIntegrity() bool
+	StorageExpiredPolicySweep() bool
+	StorageExpiredPolicyRetention() time.Duration
+	StorageExpiredPolicySweepInterval() time.Duration
+	StoragePolicySchema() string
+	StorageRoleSchema() string
 }
 
 func MustValidate(l *logrusx.Logger, p Provider) {
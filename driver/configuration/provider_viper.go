@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/rs/cors"
 
@@ -12,9 +13,60 @@ import (
 )
 
 const (
-	ViperKeyDSN  = "dsn"
-	ViperKeyHost = "serve.host"
-	ViperKeyPort = "serve.port"
+	ViperKeyDSN              = "dsn"
+	ViperKeyHost             = "serve.host"
+	ViperKeyPort             = "serve.port"
+	ViperKeyStorageCacheSize = "storage.cache.size"
+	ViperKeyStorageCacheTTL  = "storage.cache.ttl"
+	ViperKeyStorageTimeout   = "storage.timeout"
+
+	ViperKeyStorageSlowQueryThreshold = "storage.slow_query_threshold"
+
+	ViperKeyStorageAuditEnabled = "storage.audit.enabled"
+	ViperKeyStorageAuditReads   = "storage.audit.reads"
+
+	ViperKeyStorageStrictPagination   = "storage.strict_pagination"
+	ViperKeyStorageSoftDelete         = "storage.soft_delete"
+	ViperKeyStorageTombstoneRetention = "storage.tombstone_retention"
+	ViperKeyStorageTimestamps         = "storage.timestamps"
+	ViperKeyStorageCreatedStatus      = "storage.created_status"
+	ViperKeyStorageNaming             = "storage.naming"
+	ViperKeyStorageCodec              = "storage.codec"
+
+	ViperKeyStorageReadOnly            = "storage.read_only.enabled"
+	ViperKeyStorageReadOnlyCollections = "storage.read_only.collections"
+	ViperKeyStorageMaxBodySize         = "storage.max_body_size"
+
+	// ViperKeyStoragePagination is followed by the collection type and one of "default_limit", "default_offset", or
+	// "max_limit", for example "storage.pagination.policies.max_limit".
+	ViperKeyStoragePagination = "storage.pagination"
+
+	ViperKeyStorageAllowDestructiveOperations = "storage.allow_destructive_operations"
+
+	ViperKeyStorageDefaultDecision = "storage.default_decision"
+	ViperKeyStoragePrecedence      = "storage.precedence"
+	ViperKeyStorageMaxBatchSize    = "storage.max_batch_size"
+
+	ViperKeyStorageIdempotencyTTL = "storage.idempotency.ttl"
+	ViperKeyStorageLockTTL        = "storage.lock_ttl"
+
+	ViperKeyStorageWebhookURL     = "storage.webhook.url"
+	ViperKeyStorageWebhookRetries = "storage.webhook.retries"
+
+	ViperKeyStorageRateLimit       = "storage.rate_limit.rate"
+	ViperKeyStorageRateLimitBurst  = "storage.rate_limit.burst"
+	ViperKeyStorageRateLimitHeader = "storage.rate_limit.header"
+
+	ViperKeyStorageRoleMemberFormat         = "storage.roles.member_format"
+	ViperKeyStorageRoleMaxExpansionDepth    = "storage.roles.max_expansion_depth"
+	ViperKeyStorageRoleReferentialIntegrity = "storage.roles.referential_integrity"
+
+	ViperKeyStorageExpiredPolicySweep         = "storage.expired_policies.sweep"
+	ViperKeyStorageExpiredPolicyRetention     = "storage.expired_policies.retention"
+	ViperKeyStorageExpiredPolicySweepInterval = "storage.expired_policies.interval"
+
+	ViperKeyStoragePolicySchema = "storage.schemas.policy"
+	ViperKeyStorageRoleSchema   = "storage.schemas.role"
 )
 
 type ViperProvider struct {
@@ -62,3 +114,150 @@ func (v *ViperProvider) TracingJaegerConfig() *tracing.JaegerConfig {
 		Propagation:        viperx.GetString(v.l, "tracing.providers.jaeger.propagation", "", "TRACING_PROVIDER_JAEGER_PROPAGATION"),
 	}
 }
+
+func (v *ViperProvider) StorageCacheSize() int {
+	return viperx.GetInt(v.l, ViperKeyStorageCacheSize, 0)
+}
+
+func (v *ViperProvider) StorageCacheTTL() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageCacheTTL, time.Minute)
+}
+
+func (v *ViperProvider) StorageTimeout() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageTimeout, 0)
+}
+
+func (v *ViperProvider) StorageSlowQueryThreshold() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageSlowQueryThreshold, 500*time.Millisecond)
+}
+
+func (v *ViperProvider) StorageTimestamps() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageTimestamps, false)
+}
+
+func (v *ViperProvider) StorageCreatedStatus() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageCreatedStatus, false)
+}
+
+func (v *ViperProvider) StorageNaming() string {
+	return viperx.GetString(v.l, ViperKeyStorageNaming, "snake_case")
+}
+
+func (v *ViperProvider) StorageCodec() string {
+	return viperx.GetString(v.l, ViperKeyStorageCodec, "json")
+}
+
+func (v *ViperProvider) StorageLockTTL() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageLockTTL, 10*time.Second)
+}
+
+func (v *ViperProvider) StorageAuditEnabled() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageAuditEnabled, true)
+}
+
+func (v *ViperProvider) StorageAuditReads() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageAuditReads, false)
+}
+
+func (v *ViperProvider) StorageStrictPagination() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageStrictPagination, false)
+}
+
+func (v *ViperProvider) StoragePaginationLimits(collectionType string) (defaultLimit, defaultOffset, maxLimit int) {
+	key := ViperKeyStoragePagination + "." + collectionType + "."
+	return viperx.GetInt(v.l, key+"default_limit", 100),
+		viperx.GetInt(v.l, key+"default_offset", 0),
+		viperx.GetInt(v.l, key+"max_limit", 500)
+}
+
+func (v *ViperProvider) StorageSoftDelete() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageSoftDelete, false)
+}
+
+func (v *ViperProvider) StorageTombstoneRetention() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageTombstoneRetention, 30*24*time.Hour)
+}
+
+func (v *ViperProvider) StorageReadOnly() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageReadOnly, false)
+}
+
+func (v *ViperProvider) StorageReadOnlyCollections() []string {
+	return viperx.GetStringSlice(v.l, ViperKeyStorageReadOnlyCollections, []string{})
+}
+
+func (v *ViperProvider) StorageAllowDestructiveOperations() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageAllowDestructiveOperations, false)
+}
+
+func (v *ViperProvider) StorageDefaultDecision() string {
+	return viperx.GetString(v.l, ViperKeyStorageDefaultDecision, "deny")
+}
+
+func (v *ViperProvider) StoragePrecedence() string {
+	return viperx.GetString(v.l, ViperKeyStoragePrecedence, "deny")
+}
+
+func (v *ViperProvider) StorageMaxBatchSize() int {
+	return viperx.GetInt(v.l, ViperKeyStorageMaxBatchSize, 100)
+}
+
+func (v *ViperProvider) StorageMaxBodySize() int64 {
+	return int64(viperx.GetInt(v.l, ViperKeyStorageMaxBodySize, 4<<20))
+}
+
+func (v *ViperProvider) StorageIdempotencyTTL() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageIdempotencyTTL, 24*time.Hour)
+}
+
+func (v *ViperProvider) StorageWebhookURL() string {
+	return viperx.GetString(v.l, ViperKeyStorageWebhookURL, "")
+}
+
+func (v *ViperProvider) StorageWebhookRetries() int {
+	return viperx.GetInt(v.l, ViperKeyStorageWebhookRetries, 3)
+}
+
+func (v *ViperProvider) StorageRateLimit() float64 {
+	return viperx.GetFloat64(v.l, ViperKeyStorageRateLimit, 0)
+}
+
+func (v *ViperProvider) StorageRateLimitBurst() int {
+	return viperx.GetInt(v.l, ViperKeyStorageRateLimitBurst, 10)
+}
+
+func (v *ViperProvider) StorageRateLimitHeader() string {
+	return viperx.GetString(v.l, ViperKeyStorageRateLimitHeader, "")
+}
+
+func (v *ViperProvider) StorageRoleMemberFormat() string {
+	return viperx.GetString(v.l, ViperKeyStorageRoleMemberFormat, "")
+}
+
+func (v *ViperProvider) StorageRoleMaxExpansionDepth() int {
+	return viperx.GetInt(v.l, ViperKeyStorageRoleMaxExpansionDepth, 32)
+}
+
+func (v *ViperProvider) StorageRoleReferentialIntegrity() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageRoleReferentialIntegrity, false)
+}
+
+func (v *ViperProvider) StorageExpiredPolicySweep() bool {
+	return viperx.GetBool(v.l, ViperKeyStorageExpiredPolicySweep, false)
+}
+
+func (v *ViperProvider) StorageExpiredPolicyRetention() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageExpiredPolicyRetention, 24*time.Hour)
+}
+
+func (v *ViperProvider) StorageExpiredPolicySweepInterval() time.Duration {
+	return viperx.GetDuration(v.l, ViperKeyStorageExpiredPolicySweepInterval, time.Hour)
+}
+
+func (v *ViperProvider) StoragePolicySchema() string {
+	return viperx.GetString(v.l, ViperKeyStoragePolicySchema, "")
+}
+
+func (v *ViperProvider) StorageRoleSchema() string {
+	return viperx.GetString(v.l, ViperKeyStorageRoleSchema, "")
+}
@@ -1,6 +1,8 @@
 package driver
 
 import (
+	"net/http"
+
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/pkg/errors"
 
@@ -35,7 +37,9 @@ type Registry interface {
 	StorageHandler() *storage.Handler
 	HealthHandler() *healthx.Handler
 	LadonEngine() *ladon.Engine
+	ExpiredPolicySweeper() *storage.ExpiredPolicySweeper
 	Tracer() *tracing.Tracer
+	MetricsHandler() http.Handler
 }
 
 func NewRegistry(c configuration.Provider) (Registry, error) {
@@ -1,12 +1,19 @@
 package driver
 
 import (
+	"net/http"
+	"regexp"
+
 	"github.com/gobuffalo/packr"
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/ory/herodot"
 	"github.com/ory/x/healthx"
 	"github.com/ory/x/logrusx"
+	"github.com/ory/x/stringslice"
 	"github.com/ory/x/tracing"
 
 	"github.com/ory/keto/driver/configuration"
@@ -24,6 +31,7 @@ type RegistryBase struct {
 	buildDate    string
 	r            Registry
 	trc          *tracing.Tracer
+	pr           *prometheus.Registry
 
 	hh *healthx.Handler
 	ac *ast.Compiler
@@ -102,14 +110,118 @@ func (m *RegistryBase) Engine() *engine.Engine {
 
 func (m *RegistryBase) LadonEngine() *ladon.Engine {
 	if m.le == nil {
-		m.le = ladon.NewEngine(m.r.StorageManager(), m.StorageHandler(), m.Engine(), m.Writer())
+		var opts []ladon.EngineOption
+		if f := m.c.StorageRoleMemberFormat(); f != "" {
+			format, err := regexp.Compile(f)
+			if err != nil {
+				m.Logger().WithError(err).Fatalf("Unable to compile the format of role members.")
+			}
+			opts = append(opts, ladon.WithMemberFormat(format))
+		}
+		if u := m.c.StoragePolicySchema(); u != "" {
+			v, err := storage.NewSchemaValidator(u)
+			if err != nil {
+				m.Logger().WithError(err).Fatalf("Unable to compile the schema of policies.")
+			}
+			opts = append(opts, ladon.WithPolicyValidator(v))
+		}
+		if u := m.c.StorageRoleSchema(); u != "" {
+			v, err := storage.NewSchemaValidator(u)
+			if err != nil {
+				m.Logger().WithError(err).Fatalf("Unable to compile the schema of roles.")
+			}
+			opts = append(opts, ladon.WithRoleValidator(v))
+		}
+		m.le = ladon.NewEngine(m.r.StorageManager(), m.StorageHandler(), m.Engine(), m.Writer(), opts...)
 	}
 	return m.le
 }
 
+// ExpiredPolicySweeper deletes the expired policies of all flavors. It sweeps no collection if the storage or its
+// policies are read-only, because the storage handler would reject these deletions as well.
+func (m *RegistryBase) ExpiredPolicySweeper() *storage.ExpiredPolicySweeper {
+	collections := ladon.PolicyCollections()
+	if m.c.StorageReadOnly() || stringslice.Has(m.c.StorageReadOnlyCollections(), "policies") {
+		collections = nil
+	}
+	return storage.NewExpiredPolicySweeper(m.StorageHandler(), collections, m.c.StorageExpiredPolicyRetention(), m.Logger())
+}
+
+// codec returns the codec in which the storage manager stores its documents.
+func (m *RegistryBase) codec() storage.Codec {
+	c, err := storage.NewCodec(m.c.StorageCodec())
+	if err != nil {
+		m.Logger().WithError(err).Fatalf("Unable to initialize storage codec.")
+	}
+	return c
+}
+
+// withCache wraps the storage manager with a list cache if it is enabled.
+func (m *RegistryBase) withCache(s storage.Manager) storage.Manager {
+	if m.c.StorageCacheSize() <= 0 {
+		return s
+	}
+
+	cached, err := storage.NewCachedManager(s, m.c.StorageCacheSize(), m.c.StorageCacheTTL())
+	if err != nil {
+		m.Logger().WithError(err).Fatalf("Unable to initialize storage cache.")
+	}
+	return cached
+}
+
+// withTracing wraps the storage manager so that its operations are traced if tracing is enabled.
+func (m *RegistryBase) withTracing(s storage.Manager) storage.Manager {
+	if !m.Tracer().IsLoaded() {
+		return s
+	}
+	return storage.NewTracedManager(s, opentracing.GlobalTracer())
+}
+
 func (m *RegistryBase) StorageHandler() *storage.Handler {
 	if m.sh == nil {
-		m.sh = storage.NewHandler(m.r.StorageManager(), m.Writer())
+		metrics, err := storage.NewMetrics(m.prometheus())
+		if err != nil {
+			m.Logger().WithError(err).Fatalf("Unable to initialize storage metrics.")
+		}
+
+		filters := storage.NewFilterRegistry()
+		filters.SetMaxExpansionDepth(m.c.StorageRoleMaxExpansionDepth())
+
+		opts := []storage.HandlerOption{storage.WithMetrics(metrics), storage.WithTimeout(m.c.StorageTimeout()),
+			storage.WithFilterRegistry(filters),
+			storage.WithStrictPagination(m.c.StorageStrictPagination()), storage.WithSoftDelete(m.c.StorageSoftDelete()),
+			storage.WithTombstoneRetention(m.c.StorageTombstoneRetention()),
+			storage.WithTimestamps(m.c.StorageTimestamps()), storage.WithNaming(m.c.StorageNaming()),
+			storage.WithCreatedStatus(m.c.StorageCreatedStatus()),
+			storage.WithReferentialIntegrity(m.c.StorageRoleReferentialIntegrity()),
+			storage.WithReadOnly(m.c.StorageReadOnly()), storage.WithReadOnlyCollections(m.c.StorageReadOnlyCollections()...),
+			storage.WithDestructiveOperations(m.c.StorageAllowDestructiveOperations()),
+			storage.WithDefaultDecision(m.c.StorageDefaultDecision()),
+			storage.WithPrecedence(m.c.StoragePrecedence()),
+			storage.WithMaxBatchSize(m.c.StorageMaxBatchSize()),
+			storage.WithLogger(m.Logger()), storage.WithSlowQueryThreshold(m.c.StorageSlowQueryThreshold()),
+			storage.WithMaxBodySize(m.c.StorageMaxBodySize()),
+			storage.WithIdempotencyTTL(m.c.StorageIdempotencyTTL()),
+			storage.WithLockTTL(m.c.StorageLockTTL()),
+			storage.WithFilterRateLimit(m.c.StorageRateLimit(), m.c.StorageRateLimitBurst()),
+			storage.WithRateLimitHeader(m.c.StorageRateLimitHeader())}
+		for _, t := range []string{"policies", "roles"} {
+			limit, offset, max := m.c.StoragePaginationLimits(t)
+			opts = append(opts, storage.WithPaginationLimits(t, storage.PaginationLimits{DefaultLimit: limit, DefaultOffset: offset, MaxLimit: max}))
+		}
+		if m.c.StorageAuditEnabled() {
+			opts = append(opts,
+				storage.WithAuditSink(storage.NewLogAuditSink(m.Logger())),
+				storage.WithAuditReads(m.c.StorageAuditReads()))
+		}
+		if u := m.c.StorageWebhookURL(); u != "" {
+			opts = append(opts, storage.WithChangeNotifier(
+				storage.NewWebhookNotifier(u, m.c.StorageWebhookRetries(), storage.DefaultWebhookBackoff, m.Logger())))
+		}
+		if m.Tracer().IsLoaded() {
+			opts = append(opts, storage.WithTracer(opentracing.GlobalTracer()))
+		}
+		m.sh = storage.NewHandler(m.r.StorageManager(), m.Writer(), opts...)
 	}
 	return m.sh
 }
@@ -140,3 +252,15 @@ func (m *RegistryBase) Tracer() *tracing.Tracer {
 
 	return m.trc
 }
+
+func (m *RegistryBase) prometheus() *prometheus.Registry {
+	if m.pr == nil {
+		m.pr = prometheus.NewRegistry()
+	}
+	return m.pr
+}
+
+// MetricsHandler serves the metrics of the registry in the Prometheus exposition format.
+func (m *RegistryBase) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(m.prometheus(), promhttp.HandlerOpts{})
+}
@@ -42,7 +42,9 @@ func (m *RegistryMemory) Ping() error {
 
 func (m *RegistryMemory) StorageManager() storage.Manager {
 	if m.sm == nil {
-		m.sm = storage.NewMemoryManager()
+		s := storage.NewMemoryManager()
+		s.SetCodec(m.codec())
+		m.sm = m.withTracing(m.withCache(s))
 	}
 	return m.sm
 }
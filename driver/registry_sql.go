@@ -69,7 +69,9 @@ func (m *RegistrySQL) Init() error {
 
 func (m *RegistrySQL) StorageManager() storage.Manager {
 	if m.sm == nil {
-		m.sm = storage.NewSQLManager(m.DB())
+		s := storage.NewSQLManager(m.DB())
+		s.SetCodec(m.codec())
+		m.sm = m.withTracing(m.withCache(s))
 	}
 	return m.sm
 }
@@ -1,6 +1,8 @@
 // Package ladon
 package ladon
 
+import "time"
+
 // swagger:parameters doOryAccessControlPoliciesAllow
 type doOryAccessControlPoliciesAllow struct {
 	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
@@ -13,6 +15,24 @@ type doOryAccessControlPoliciesAllow struct {
 	Body oryAccessControlPolicyAllowedInput
 }
 
+// swagger:parameters decideOryAccessControlPolicies
+type decideOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// Set to "true" to add the trace of the decision to the response: how every policy was matched against the
+	// subject, action, resource, validity window, and conditions, and which policies decided the request.
+	//
+	// in: query
+	Explain bool `json:"explain"`
+
+	// in: body
+	Body oryAccessControlPolicyAllowedInput
+}
+
 // Input for checking if a request is allowed or not.
 //
 // swagger:model oryAccessControlPolicyAllowedInput
@@ -30,6 +50,90 @@ type oryAccessControlPolicyAllowedInput struct {
 	Context map[string]interface{} `json:"context"`
 }
 
+// swagger:parameters decideOryAccessControlPoliciesBatch
+type decideOryAccessControlPoliciesBatch struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// in: body
+	// type: array
+	Body []oryAccessControlPolicyAllowedInput
+}
+
+// The decisions of a batch of access requests, in the order of the requests.
+//
+// swagger:response authorizationResults
+type authorizationResults struct {
+	// in: body
+	// type: array
+	Body []struct {
+		// Allowed is true if the request is allowed and false otherwise.
+		Allowed bool `json:"allowed"`
+
+		// Default is true if no policy matched, so the request was decided by the default decision.
+		Default bool `json:"default"`
+
+		// Obligations are the sorted and distinct obligations of the matching allow policies, which the caller must
+		// enforce. They are only set if the request is allowed.
+		Obligations []string `json:"obligations,omitempty"`
+	}
+}
+
+// swagger:parameters testOryAccessControlPolicies
+type testOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// in: body
+	Body oryAccessControlPolicyTestInput
+}
+
+// Input for testing an access request.
+//
+// swagger:model oryAccessControlPolicyTestInput
+type oryAccessControlPolicyTestInput struct {
+	oryAccessControlPolicyAllowedInput
+
+	// Policies are decided instead of the stored policies if they are set.
+	Policies []oryAccessControlPolicy `json:"policies"`
+}
+
+// The decision of a tested access request.
+//
+// swagger:response oryAccessControlPolicyDecision
+type oryAccessControlPolicyDecision struct {
+	// in: body
+	Body struct {
+		// Allowed is true if the request is allowed.
+		Allowed bool `json:"allowed"`
+
+		// Effect is the effect which decided the request: "allow", "deny", or empty if no policy matched.
+		Effect string `json:"effect"`
+
+		// Default is true if no policy matched, so the request was decided by the default decision.
+		Default bool `json:"default"`
+
+		// AllowedBy are the IDs of the matching policies with effect "allow".
+		AllowedBy []string `json:"allowed_by"`
+
+		// DeniedBy are the IDs of the matching policies with effect "deny".
+		DeniedBy []string `json:"denied_by"`
+
+		// Obligations are the sorted and distinct obligations of the matching allow policies, which the caller must
+		// enforce. They are only set if the request is allowed.
+		Obligations []string `json:"obligations,omitempty"`
+
+		// Explanation describes in words how the decision was made.
+		Explanation string `json:"explanation"`
+	}
+}
+
 // swagger:parameters upsertOryAccessControlPolicy
 type upsertOryAccessControlPolicy struct {
 	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
@@ -38,6 +142,69 @@ type upsertOryAccessControlPolicy struct {
 	// required: true
 	Flavor string `json:"flavor"`
 
+	// The secret which allows modifying protected policies and roles, if the server protects any.
+	//
+	// in: header
+	AllowProtected string `json:"X-Allow-Protected"`
+
+	// Set to "true" to store policies without subjects, resources, or actions.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// Only store the policy if its current entity tag, as returned in the ETag header, is one of the given tags.
+	//
+	// in: header
+	IfMatch string `json:"If-Match"`
+
+	// Set to "*" to only store the policy if it does not exist yet.
+	//
+	// in: header
+	IfNoneMatch string `json:"If-None-Match"`
+
+	// Set to "true" to validate the policy without storing it. The response has the header "X-Dry-Run: true".
+	//
+	// in: query
+	DryRun bool `json:"dry_run"`
+
+	// Set to "true" to not store the policy if a policy with another ID has the same content, regardless of the order
+	// and repetition of the subjects, resources, and actions and of the casing of the effect. That policy is returned
+	// instead and its ID is in the header "X-Duplicate-Of".
+	//
+	// in: query
+	Dedupe bool `json:"dedupe"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	Body oryAccessControlPolicy
+}
+
+// swagger:parameters createOryAccessControlPolicy
+type createOryAccessControlPolicy struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// Set to "true" to store policies without subjects, resources, or actions.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
 	// in: body
 	Body oryAccessControlPolicy
 }
@@ -60,20 +227,125 @@ type listOryAccessControlPolicies struct {
 	// in: query
 	Offset int `json:"offset"`
 
+	// Set to "true" to answer a malformed, negative, or too large limit or offset with 400 instead of falling back to
+	// the defaults.
+	//
+	// in: query
+	StrictPagination bool `json:"strict_pagination"`
+
+	// Switches to cursor pagination ordered by ID. Pass an empty value for the first page and the value of the
+	// X-Next-Page-Token header of the previous response for the following pages. The last page has no such header.
+	// Can not be combined with offset, sort, or order.
+	//
+	// in: query
+	PageToken string `json:"page_token"`
+
+	// Set to "true" to include deleted entries which have been kept as tombstones. These have the additional field
+	// "deleted_at" and follow the stored entries. Can not be combined with page_token.
+	//
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+
+	// Comma-separated top-level fields to respond with, for example "id,members". The other fields are left out of
+	// the response. Unknown fields are ignored.
+	//
+	// in: query
+	Fields string `json:"fields"`
+
+	// Set to "true" to respond with 400 if fields contains a field which the response does not have.
+	//
+	// in: query
+	StrictFields bool `json:"strict_fields"`
+
+	// Set to "true" to respond with an object with the fields "items", "total", "limit", and "offset" instead of an
+	// array. With page_token, the object also has the field "next_page_token" unless this is the last page. The
+	// pagination headers are sent either way.
+	//
+	// in: query
+	Envelope bool `json:"envelope"`
+
+	// Set to the ID of a policy to respond with the outcome of every filter of the request for that policy, and
+	// whether it is part of the filtered list, instead of the list.
+	//
+	// in: query
+	Explain string `json:"explain"`
+
+	// Set to "true" to normalize the policies of the response: subjects, resources, and actions are sorted and
+	// deduplicated, and the effect is lower-cased. The stored policies are not changed.
+	//
+	// in: query
+	Canonical bool `json:"canonical"`
+
 	// The subject for whom the policies are to be listed.
+	// Several values can be given by repeating the parameter or separated by commas; escape a literal comma as "\,".
+	// Values prefixed with "!" exclude the policies they match; escape a literal leading "!" as "\!".
 	//
 	// in: query
 	Subject string `json:"subject"`
 
 	// The resource for which the policies are to be listed.
+	// Several values can be given by repeating the parameter or separated by commas; escape a literal comma as "\,".
+	// Values prefixed with "!" exclude the policies they match; escape a literal leading "!" as "\!".
 	//
 	// in: query
 	Resource string `json:"resource"`
 
+	// Only list policies affecting this path or a path below it, for example "projects/1" for
+	// "projects/1/datasets/2" or "projects/<.*>". Paths are split into segments at "/", so siblings like
+	// "projects/10" do not match. Can be repeated to list policies affecting any of the paths.
+	//
+	// in: query
+	ResourcePrefix []string `json:"resource_prefix"`
+
 	// The action for which policies are to be listed.
+	// Several values can be given by repeating the parameter or separated by commas; escape a literal comma as "\,".
+	// Values prefixed with "!" exclude the policies they match; escape a literal leading "!" as "\!".
 	//
 	// in: query
 	Action string `json:"action"`
+
+	// Only list policies with this effect. Can be "allow" or "deny".
+	//
+	// in: query
+	Effect string `json:"effect"`
+
+	// Set to "true" to only list policies with conditions, or to "false" to only list policies without conditions.
+	//
+	// in: query
+	HasCondition bool `json:"has_condition"`
+
+	// Only list policies with a condition under this key. Can be repeated to list policies with a condition under
+	// any of the keys.
+	//
+	// in: query
+	ConditionKey []string `json:"condition_key"`
+
+	// Set to "true" to only list policies which apply now, so neither before their "not_before" time nor from their
+	// "not_after" time on.
+	//
+	// in: query
+	ActiveOnly bool `json:"active_only"`
+
+	// Controls how filter values are combined. With "all" (default) a policy must match every given subject,
+	// resource, and action. With "any" it must match at least one of them.
+	//
+	// in: query
+	Match string `json:"match"`
+
+	// Set to "insensitive" to ignore the casing when comparing filter values. Defaults to "sensitive".
+	//
+	// in: query
+	Case string `json:"case"`
+
+	// The field to sort the policies by. Can be "id" (default), "effect", "created_at", or "updated_at".
+	//
+	// in: query
+	Sort string `json:"sort"`
+
+	// The sort direction. Can be "asc" (default) or "desc".
+	//
+	// in: query
+	Order string `json:"order"`
 }
 
 // swagger:parameters getOryAccessControlPolicy
@@ -89,6 +361,33 @@ type getOryAccessControlPolicy struct {
 	// in: path
 	// required: true
 	ID string `json:"id"`
+
+	// Set to "true" to respond with the tombstone of a deleted entry. It has the additional field "deleted_at".
+	//
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+
+	// Comma-separated top-level fields to respond with, for example "id,members". The other fields are left out of
+	// the response. Unknown fields are ignored.
+	//
+	// in: query
+	Fields string `json:"fields"`
+
+	// Set to "true" to respond with 400 if fields contains a field which the response does not have.
+	//
+	// in: query
+	StrictFields bool `json:"strict_fields"`
+
+	// Responds with 304 and without a body if the current entity tag of the policy is one of the given tags.
+	//
+	// in: header
+	IfNoneMatch string `json:"If-None-Match"`
+
+	// Set to "true" to normalize the policies of the response: subjects, resources, and actions are sorted and
+	// deduplicated, and the effect is lower-cased. The stored policies are not changed.
+	//
+	// in: query
+	Canonical bool `json:"canonical"`
 }
 
 // swagger:parameters deleteOryAccessControlPolicy
@@ -104,6 +403,11 @@ type deleteOryAccessControlPolicy struct {
 	// in: path
 	// required: true
 	ID string `json:"id"`
+
+	// Set to "true" to remove the entry and its tombstone for good even if soft deletion is enabled.
+	//
+	// in: query
+	Purge bool `json:"purge"`
 }
 
 // swagger:parameters getOryAccessControlPolicyRole
@@ -119,6 +423,33 @@ type getOryAccessControlPolicyRole struct {
 	// in: path
 	// required: true
 	ID string `json:"id"`
+
+	// Set to "true" to respond with the tombstone of a deleted entry. It has the additional field "deleted_at".
+	//
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+
+	// Comma-separated top-level fields to respond with, for example "id,members". The other fields are left out of
+	// the response. Unknown fields are ignored.
+	//
+	// in: query
+	Fields string `json:"fields"`
+
+	// Set to "true" to respond with 400 if fields contains a field which the response does not have.
+	//
+	// in: query
+	StrictFields bool `json:"strict_fields"`
+
+	// Set to "count" to respond with the number of members in the field "member_count" instead of the members. Defaults
+	// to "full".
+	//
+	// in: query
+	Members string `json:"members"`
+
+	// Responds with 304 and without a body if the current entity tag of the role is one of the given tags.
+	//
+	// in: header
+	IfNoneMatch string `json:"If-None-Match"`
 }
 
 // swagger:parameters deleteOryAccessControlPolicyRole
@@ -133,6 +464,35 @@ type deleteOryAccessControlPolicyRole struct {
 	// in: path
 	// required: true
 	ID string `json:"id"`
+
+	// Set to "true" to remove the entry and its tombstone for good even if soft deletion is enabled.
+	//
+	// in: query
+	Purge bool `json:"purge"`
+
+	// Set to "true" to delete the role even if policies still reference it.
+	//
+	// in: query
+	Force bool `json:"force"`
+}
+
+// swagger:parameters createOryAccessControlPolicyRole
+type createOryAccessControlPolicyRole struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	Body oryAccessControlPolicyRole
 }
 
 // swagger:parameters upsertOryAccessControlPolicyRole
@@ -143,6 +503,33 @@ type upsertOryAccessControlPolicyRole struct {
 	// required: true
 	Flavor string `json:"flavor"`
 
+	// The secret which allows modifying protected policies and roles, if the server protects any.
+	//
+	// in: header
+	AllowProtected string `json:"X-Allow-Protected"`
+
+	// Only store the role if its current entity tag, as returned in the ETag header, is one of the given tags.
+	//
+	// in: header
+	IfMatch string `json:"If-Match"`
+
+	// Set to "*" to only store the role if it does not exist yet.
+	//
+	// in: header
+	IfNoneMatch string `json:"If-None-Match"`
+
+	// Set to "true" to validate the role without storing it. The response has the header "X-Dry-Run: true".
+	//
+	// in: query
+	DryRun bool `json:"dry_run"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
 	// in: body
 	Body oryAccessControlPolicyRole
 }
@@ -171,7 +558,7 @@ type addOryAccessControlPolicyRoleMembers struct {
 	Body addOryAccessControlPolicyRoleMembersBody
 }
 
-// swagger:parameters removeOryAccessControlPolicyRoleMembers
+// swagger:parameters removeOryAccessControlPolicyRoleMembers addOryAccessControlPolicyRoleMember
 type removeOryAccessControlPolicyRoleMembers struct {
 	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
 	//
@@ -214,6 +601,17 @@ type oryAccessControlPolicyRoles struct {
 	Body []oryAccessControlPolicyRole
 }
 
+// RoleIDs is a sorted array of role IDs.
+//
+// swagger:response oryAccessControlPolicyRoleIDs
+type oryAccessControlPolicyRoleIDs struct {
+	// The request body.
+	//
+	// in: body
+	// type: array
+	Body []string
+}
+
 // oryAccessControlPolicyRole represents a group of users that share the same role. A role could be an administrator, a moderator, a regular
 // user or some other sort of role.
 //
@@ -227,6 +625,25 @@ type oryAccessControlPolicyRole struct {
 
 	// Members is who belongs to the role.
 	Members []string `json:"members"`
+
+	// Scope limits the role to the resources which match it, for example "projects:1". Its members only hold the
+	// role for requests on such resources. The scope may be a pattern of the flavor. Roles without a scope are
+	// global.
+	Scope string `json:"scope,omitempty"`
+
+	// EffectiveMembers is the flattened set of members including the members of nested roles. It is only set if
+	// the roles are listed with "expand=true".
+	EffectiveMembers []string `json:"effective_members,omitempty"`
+
+	// MemberCount is the number of members. It is only set, instead of the members, if the role is requested with
+	// "members=count".
+	MemberCount *int `json:"member_count,omitempty"`
+
+	// CreatedAt is the time at which the role was first stored. It is only set if timestamps are enabled.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UpdatedAt is the time at which the role was last changed. It is only set if timestamps are enabled.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 // oryAccessControlPolicy specifies an ORY Access Policy document.
@@ -253,6 +670,23 @@ type oryAccessControlPolicy struct {
 
 	// Conditions represents a keyed object of conditions under which this ORY Access Policy is active.
 	Conditions map[string]interface{} `json:"conditions"`
+
+	// Obligations are requirements the caller must enforce if this ORY Access Policy allows a request, for example
+	// "log-access" or "require-mfa". They are ignored for policies with effect "deny".
+	Obligations []string `json:"obligations,omitempty"`
+
+	// NotBefore is the time from which on this ORY Access Policy applies. Policies without it apply as soon as they
+	// are stored.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+
+	// NotAfter is the time from which on this ORY Access Policy no longer applies. Policies without it never expire.
+	NotAfter *time.Time `json:"not_after,omitempty"`
+
+	// CreatedAt is the time at which the policy was first stored. It is only set if timestamps are enabled.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UpdatedAt is the time at which the policy was last changed. It is only set if timestamps are enabled.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
 
 // swagger:parameters listOryAccessControlPolicyRoles
@@ -273,8 +707,786 @@ type listOryAccessControlPolicyRoles struct {
 	// in: query
 	Offset int `json:"offset"`
 
-	// The member for which the roles are to be listed.
+	// Set to "true" to answer a malformed, negative, or too large limit or offset with 400 instead of falling back to
+	// the defaults.
+	//
+	// in: query
+	StrictPagination bool `json:"strict_pagination"`
+
+	// Switches to cursor pagination ordered by ID. Pass an empty value for the first page and the value of the
+	// X-Next-Page-Token header of the previous response for the following pages. The last page has no such header.
+	// Can not be combined with offset, sort, or order.
+	//
+	// in: query
+	PageToken string `json:"page_token"`
+
+	// Set to "true" to include deleted entries which have been kept as tombstones. These have the additional field
+	// "deleted_at" and follow the stored entries. Can not be combined with page_token.
+	//
+	// in: query
+	IncludeDeleted bool `json:"include_deleted"`
+
+	// Comma-separated top-level fields to respond with, for example "id,members". The other fields are left out of
+	// the response. Unknown fields are ignored.
+	//
+	// in: query
+	Fields string `json:"fields"`
+
+	// Set to "true" to respond with 400 if fields contains a field which the response does not have.
+	//
+	// in: query
+	StrictFields bool `json:"strict_fields"`
+
+	// Set to "count" to respond with the number of members in the field "member_count" instead of the members. Defaults
+	// to "full".
+	//
+	// in: query
+	Members string `json:"members"`
+
+	// Set to "true" to respond with an object with the fields "items", "total", "limit", and "offset" instead of an
+	// array. With page_token, the object also has the field "next_page_token" unless this is the last page. The
+	// pagination headers are sent either way.
+	//
+	// in: query
+	Envelope bool `json:"envelope"`
+
+	// The member for which the roles are to be listed. Values prefixed with "!" exclude the roles which contain them.
 	//
 	// in: query
 	Member string `json:"member"`
+
+	// Only list roles whose ID starts with this prefix, for example "tenant:acme:".
+	//
+	// in: query
+	IDPrefix string `json:"id_prefix"`
+
+	// Set to "true" to only list roles without members, or to "false" to only list roles with members.
+	//
+	// in: query
+	Empty string `json:"empty"`
+
+	// Only list roles whose scope is this value or a pattern matching it, for example "projects:1". Values prefixed
+	// with "!" exclude the roles of that scope and keep the global roles.
+	//
+	// in: query
+	Scope string `json:"scope"`
+
+	// Set to the ID of a role to respond with the outcome of every filter of the request for that role, and whether
+	// it is part of the filtered list, instead of the list.
+	//
+	// in: query
+	Explain string `json:"explain"`
+
+	// Controls how filter values are combined. With "all" (default) a role must contain every given member. With
+	// "any" it must contain at least one of them.
+	//
+	// in: query
+	Match string `json:"match"`
+
+	// Set to "insensitive" to ignore the casing when comparing filter values. Defaults to "sensitive".
+	//
+	// in: query
+	Case string `json:"case"`
+
+	// Set to "true" to resolve nested roles into "effective_members". Members which are IDs of other roles are
+	// replaced by the members of those roles, and the member filter is applied to the effective members.
+	//
+	// in: query
+	Expand bool `json:"expand"`
+
+	// The field to sort the roles by. Can be "id" (default), "created_at", or "updated_at".
+	//
+	// in: query
+	Sort string `json:"sort"`
+
+	// The sort direction. Can be "asc" (default) or "desc".
+	//
+	// in: query
+	Order string `json:"order"`
+}
+
+// swagger:parameters countOryAccessControlPolicies
+type countOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact"
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The subject for whom the policies are to be counted.
+	//
+	// in: query
+	Subject string `json:"subject"`
+
+	// The resource for which the policies are to be counted.
+	//
+	// in: query
+	Resource string `json:"resource"`
+
+	// Only count policies affecting this path or a path below it, for example "projects/1" for
+	// "projects/1/datasets/2" or "projects/<.*>". Paths are split into segments at "/", so siblings like
+	// "projects/10" do not match. Can be repeated to count policies affecting any of the paths.
+	//
+	// in: query
+	ResourcePrefix []string `json:"resource_prefix"`
+
+	// The action for which policies are to be counted.
+	//
+	// in: query
+	Action string `json:"action"`
+
+	// Only count policies with this effect. Can be "allow" or "deny".
+	//
+	// in: query
+	Effect string `json:"effect"`
+
+	// Controls how filter values are combined. With "all" (default) a policy must match every given subject,
+	// resource, and action. With "any" it must match at least one of them.
+	//
+	// in: query
+	Match string `json:"match"`
+
+	// Set to "insensitive" to ignore the casing when comparing filter values. Defaults to "sensitive".
+	//
+	// in: query
+	Case string `json:"case"`
+}
+
+// swagger:parameters countOryAccessControlPolicyRoles
+type countOryAccessControlPolicyRoles struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact"
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The member for which the roles are to be counted.
+	//
+	// in: query
+	Member string `json:"member"`
+
+	// Only count roles whose ID starts with this prefix, for example "tenant:acme:".
+	//
+	// in: query
+	IDPrefix string `json:"id_prefix"`
+
+	// Set to "true" to only count roles without members, or to "false" to only count roles with members.
+	//
+	// in: query
+	Empty string `json:"empty"`
+
+	// Only count roles whose scope is this value or a pattern matching it, for example "projects:1". Values prefixed
+	// with "!" exclude the roles of that scope and keep the global roles.
+	//
+	// in: query
+	Scope string `json:"scope"`
+
+	// Controls how filter values are combined. With "all" (default) a role must contain every given member. With
+	// "any" it must contain at least one of them.
+	//
+	// in: query
+	Match string `json:"match"`
+
+	// Set to "insensitive" to ignore the casing when comparing filter values. Defaults to "sensitive".
+	//
+	// in: query
+	Case string `json:"case"`
+}
+
+// collectionCount is the number of entries in a collection.
+//
+// swagger:response collectionCount
+type collectionCount struct {
+	// in: body
+	Body struct {
+		// Count is the number of entries in the collection.
+		Count int `json:"count"`
+	}
+}
+
+// swagger:parameters upsertOryAccessControlPolicies
+type upsertOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// Set to "true" to store policies without subjects, resources, or actions.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// Set to "false" to attempt every entry on its own. The response is then 207 with the result of every entry.
+	// Defaults to "true", which writes either all or none of the entries.
+	//
+	// in: query
+	Atomic bool `json:"atomic"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	// type: array
+	Body []oryAccessControlPolicy
+}
+
+// swagger:parameters upsertOryAccessControlPolicyRoles
+type upsertOryAccessControlPolicyRoles struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// Set to "false" to attempt every entry on its own. The response is then 207 with the result of every entry.
+	// Defaults to "true", which writes either all or none of the entries.
+	//
+	// in: query
+	Atomic bool `json:"atomic"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	// type: array
+	Body []oryAccessControlPolicyRole
+}
+
+// swagger:parameters getOryAccessControlPolicies getOryAccessControlPolicyRoles
+type getOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The IDs to get. Repeat the parameter for several IDs.
+	//
+	// in: query
+	ID []string `json:"id"`
+
+	// Set to "true" to respond with 404 if any of the IDs does not exist instead of leaving it out.
+	//
+	// in: query
+	Strict bool `json:"strict"`
+
+	// Comma-separated top-level fields to respond with, for example "id,members". The other fields are left out of
+	// the response. Unknown fields are ignored.
+	//
+	// in: query
+	Fields string `json:"fields"`
+}
+
+// swagger:parameters deleteOryAccessControlPolicies deleteOryAccessControlPolicyRoles
+type deleteOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// Set to "true" to respond with the number of deleted entries instead of an empty response.
+	//
+	// in: query
+	Report bool `json:"report"`
+
+	// Set to "false" to attempt every entry on its own. The response is then 207 with the result of every entry.
+	// Defaults to "true", which writes either all or none of the entries.
+	//
+	// in: query
+	Atomic bool `json:"atomic"`
+
+	// Set to "true" to remove the entries and their tombstones for good even if soft deletion is enabled.
+	//
+	// in: query
+	Purge bool `json:"purge"`
+
+	// Set to "true" to delete roles even if policies still reference them. Ignored for policies.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// The IDs to delete.
+	//
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	// type: array
+	Body []string
+}
+
+// bulkResults are the results of every entry of a bulk request which is not atomic.
+//
+// swagger:response bulkResults
+type bulkResults struct {
+	// in: body
+	Body []struct {
+		// Index is the position of the entry in the request.
+		Index int `json:"index"`
+
+		// Key is the ID of the entry.
+		Key string `json:"key"`
+
+		// Status is the HTTP status code the entry would have been answered with on its own.
+		Status int `json:"status"`
+
+		// Error describes why the entry failed. It is empty if the entry succeeded.
+		Error string `json:"error,omitempty"`
+	}
+}
+
+// deleteManyReport is the number of entries removed by a bulk delete.
+//
+// swagger:response deleteManyReport
+type deleteManyReport struct {
+	// in: body
+	Body struct {
+		// Deleted is the number of entries which were actually removed.
+		Deleted int `json:"deleted"`
+	}
+}
+
+// swagger:parameters clearOryAccessControlPolicies clearOryAccessControlPolicyRoles
+type clearOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+}
+
+// clearReport is the number of entries removed by clearing a collection.
+//
+// swagger:response clearReport
+type clearReport struct {
+	// in: body
+	Body struct {
+		// Deleted is the number of entries which were removed.
+		Deleted int `json:"deleted"`
+	}
+}
+
+// swagger:parameters exportOryAccessControlPolicies exportOryAccessControlPolicyRoles
+type exportOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// A single byte range of the export, for example "bytes=1024-", to resume an interrupted export. Answered with 206
+	// and only the requested bytes.
+	//
+	// in: header
+	Range string `json:"Range"`
+
+	// The ETag of a previous partial response. If the export changed since, the Range header is ignored and the whole
+	// export is sent.
+	//
+	// in: header
+	IfRange string `json:"If-Range"`
+}
+
+// exportResponse is a newline delimited JSON document with one stored value per line.
+//
+// swagger:response exportResponse
+type exportResponse struct {
+	// Suggests a file name for the export.
+	//
+	// in: header
+	ContentDisposition string `json:"Content-Disposition"`
+
+	// Is always "bytes".
+	//
+	// in: header
+	AcceptRanges string `json:"Accept-Ranges"`
+
+	// in: body
+	Body string
+}
+
+// exportPartialResponse is a byte range of the export.
+//
+// swagger:response exportPartialResponse
+type exportPartialResponse struct {
+	// Suggests a file name for the export.
+	//
+	// in: header
+	ContentDisposition string `json:"Content-Disposition"`
+
+	// The range of the export in the body and the size of the whole export, for example "bytes 1024-2047/4096".
+	//
+	// in: header
+	ContentRange string `json:"Content-Range"`
+
+	// Identifies the export, send it in the If-Range header when requesting the next range.
+	//
+	// in: header
+	ETag string `json:"ETag"`
+
+	// in: body
+	Body string
+}
+
+// swagger:parameters importOryAccessControlPolicies importOryAccessControlPolicyRoles
+type importOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The secret which allows modifying protected policies and roles, if the server protects any.
+	//
+	// in: header
+	AllowProtected string `json:"X-Allow-Protected"`
+
+	// Set to "replace" to remove all entries which are not imported. Defaults to "merge".
+	//
+	// in: query
+	Mode string `json:"mode"`
+
+	// Set to "true" to import policies without subjects, resources, or actions.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	Body string
+}
+
+// swagger:parameters reconcileOryAccessControlPolicies reconcileOryAccessControlPolicyRoles
+type reconcileOryAccessControlPolicies struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The secret which allows modifying protected policies and roles, if the server protects any.
+	//
+	// in: header
+	AllowProtected string `json:"X-Allow-Protected"`
+
+	// Set to "true" to compute the difference without applying it. The response has the header "X-Dry-Run: true".
+	//
+	// in: query
+	DryRun bool `json:"dry_run"`
+
+	// Set to "true" to delete the stored entries which are not part of the request. Without it, a difference which
+	// deletes entries is answered with 403. Deleting every stored entry also requires destructive operations.
+	//
+	// in: query
+	Prune bool `json:"prune"`
+
+	// Set to "true" to remove the pruned entries and their tombstones for good even if soft deletion is enabled.
+	//
+	// in: query
+	Purge bool `json:"purge"`
+
+	// Set to "true" to store policies without subjects, resources, or actions.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// The desired policies or roles.
+	//
+	// in: body
+	// type: array
+	Body []interface{}
+}
+
+// reconcileReport is the difference between the stored and the desired entries.
+//
+// swagger:response reconcileReport
+type reconcileReport struct {
+	// in: body
+	Body struct {
+		// Created are the IDs of the desired entries which were not stored.
+		Created []string `json:"created"`
+
+		// Updated are the IDs of the stored entries whose value differs from the desired one.
+		Updated []string `json:"updated"`
+
+		// Deleted are the IDs of the stored entries which are not desired.
+		Deleted []string `json:"deleted"`
+
+		// Unchanged is the number of stored entries which already have the desired value.
+		Unchanged int `json:"unchanged"`
+
+		// DryRun is true if the difference was not applied.
+		DryRun bool `json:"dry_run"`
+	}
+}
+
+// importReport is the number of entries restored by an import.
+//
+// swagger:response importReport
+type importReport struct {
+	// in: body
+	Body struct {
+		// Imported is the number of entries which were written.
+		Imported int `json:"imported"`
+	}
+}
+
+// swagger:parameters oryAccessControlPolicyExists oryAccessControlPolicyRoleExists listOryAccessControlPolicyRoleAncestors listOryAccessControlPoliciesReferencingRole
+type oryAccessControlPolicyExists struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The ID of the ORY Access Control Policy or Role.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// swagger:parameters patchOryAccessControlPolicy patchOryAccessControlPolicyRole
+type patchOryAccessControlPolicy struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The ID of the ORY Access Control Policy or Role.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+
+	// Set to "true" to store a patched policy without subjects, resources, or actions. Ignored for roles.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// in: body
+	Body map[string]interface{}
+}
+
+// swagger:parameters restoreOryAccessControlPolicy restoreOryAccessControlPolicyRole
+type restoreOryAccessControlPolicy struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The ID of the deleted entry.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// swagger:parameters renameOryAccessControlPolicy renameOryAccessControlPolicyRole
+type renameOryAccessControlPolicy struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The current ID of the entry.
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+
+	// Set to "true" to rename a role which policies still reference although referential integrity is enforced.
+	//
+	// in: query
+	Force bool `json:"force"`
+
+	// A unique key which makes the request safe to retry. The response is kept for a while and repeating the request
+	// with the same key responds with it again instead of writing twice. Reusing the key for a different request
+	// responds with 422.
+	//
+	// in: header
+	IdempotencyKey string `json:"Idempotency-Key"`
+
+	// in: body
+	Body struct {
+		// ID is the new ID of the entry. It must not be empty or begin or end with whitespace.
+		ID string `json:"id"`
+	}
+}
+
+// swagger:parameters getOryAccessControlPolicyEffectivePermissions
+type getOryAccessControlPolicyEffectivePermissions struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The subject whose permissions are to be listed.
+	//
+	// in: query
+	// required: true
+	Subject string `json:"subject"`
+}
+
+// swagger:parameters listOryAccessControlPolicyRolesForMember
+type listOryAccessControlPolicyRolesForMember struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The member whose roles are to be listed.
+	//
+	// in: query
+	// required: true
+	Member string `json:"member"`
+
+	// Only list the global roles and the roles whose scope matches this resource, for example "projects:1". Roles of
+	// every scope are listed if it is not set.
+	//
+	// in: query
+	Scope string `json:"scope"`
+}
+
+// swagger:parameters countOryAccessControlPolicyMatches
+type countOryAccessControlPolicyMatches struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The subject of the access request.
+	//
+	// in: query
+	// required: true
+	Subject string `json:"subject"`
+
+	// The action of the access request.
+	//
+	// in: query
+	// required: true
+	Action string `json:"action"`
+
+	// The resource of the access request.
+	//
+	// in: query
+	// required: true
+	Resource string `json:"resource"`
+
+	// If true, the IDs of the matching policies are included.
+	//
+	// in: query
+	Verbose bool `json:"verbose"`
+}
+
+// The number of policies matching an access request.
+//
+// swagger:response oryAccessControlPolicyMatchCount
+type oryAccessControlPolicyMatchCount struct {
+	// in: body
+	Body struct {
+		// Allow is the number of matching allow policies.
+		Allow int `json:"allow"`
+
+		// Deny is the number of matching deny policies.
+		Deny int `json:"deny"`
+
+		// AllowedBy are the IDs of the matching allow policies. Only set if verbose is true.
+		AllowedBy []string `json:"allowed_by,omitempty"`
+
+		// DeniedBy are the IDs of the matching deny policies. Only set if verbose is true.
+		DeniedBy []string `json:"denied_by,omitempty"`
+	}
+}
+
+// The effective permissions of a subject.
+//
+// swagger:response oryAccessControlPolicyEffectivePermissions
+type oryAccessControlPolicyEffectivePermissions struct {
+	// in: body
+	Body struct {
+		// Subject is the subject of the request.
+		Subject string `json:"subject"`
+
+		// Roles are the IDs of the roles the subject belongs to, directly or through other roles, closest first.
+		Roles []string `json:"roles"`
+
+		// Permissions maps each resource to its actions, as written in the allow policies of the subject.
+		Permissions map[string]map[string]struct {
+			// Allowed is false if a deny policy overrides the allow policies.
+			Allowed bool `json:"allowed"`
+
+			// AllowedBy are the IDs of the allow policies which grant the action on the resource.
+			AllowedBy []string `json:"allowed_by"`
+
+			// DeniedBy are the IDs of the deny policies which override the grant.
+			DeniedBy []string `json:"denied_by"`
+		} `json:"permissions"`
+	}
+}
+
+// swagger:parameters listOryAccessControlPolicyDistinctValues
+type listOryAccessControlPolicyDistinctValues struct {
+	// The ORY Access Control Policy flavor. Can be "regex", "glob", and "exact".
+	//
+	// in: path
+	// required: true
+	Flavor string `json:"flavor"`
+
+	// The field whose values are to be listed. Can be "action", "resource", or "subject".
+	//
+	// in: query
+	// required: true
+	Field string `json:"field"`
+
+	// The maximum amount of values returned.
+	//
+	// in: query
+	Limit int `json:"limit"`
+
+	// The offset from where to start looking.
+	//
+	// in: query
+	Offset int `json:"offset"`
+}
+
+// The distinct values of a field of ORY Access Control Policies.
+//
+// swagger:response oryAccessControlPolicyDistinctValues
+type oryAccessControlPolicyDistinctValues struct {
+	// in: body
+	Body []string
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -25,6 +27,36 @@ type Engine struct {
 	engine *engine.Engine
 	s      kstorage.Manager
 	h      herodot.Writer
+
+	memberFormat    *regexp.Regexp
+	policyValidator kstorage.Validator
+	roleValidator   kstorage.Validator
+}
+
+// EngineOption configures an Engine.
+type EngineOption func(*Engine)
+
+// WithPolicyValidator sets the validator of the policies in upserts and imports. Defaults to
+// kstorage.DefaultPolicyValidator, nil disables the validation.
+func WithPolicyValidator(v kstorage.Validator) EngineOption {
+	return func(e *Engine) {
+		e.policyValidator = v
+	}
+}
+
+// WithRoleValidator sets the validator of the roles in upserts and imports. Defaults to
+// kstorage.DefaultRoleValidator, nil disables the validation.
+func WithRoleValidator(v kstorage.Validator) EngineOption {
+	return func(e *Engine) {
+		e.roleValidator = v
+	}
+}
+
+// WithMemberFormat rejects role members which do not match the format. Members are not restricted by default.
+func WithMemberFormat(format *regexp.Regexp) EngineOption {
+	return func(e *Engine) {
+		e.memberFormat = format
+	}
 }
 
 var EnabledFlavors = []string{"exact", "glob", "regex"}
@@ -69,17 +101,32 @@ func policyCollection(f string) string {
 	return fmt.Sprintf("/store/ory/%s/policies", f)
 }
 
+// PolicyCollections returns the collections of the policies of all enabled flavors.
+func PolicyCollections() []string {
+	collections := make([]string, len(EnabledFlavors))
+	for k, f := range EnabledFlavors {
+		collections[k] = policyCollection(f)
+	}
+	return collections
+}
+
 func roleCollection(f string) string {
 	return fmt.Sprintf("/store/ory/%s/roles", f)
 }
 
-func NewEngine(store kstorage.Manager, sh *kstorage.Handler, e *engine.Engine, h herodot.Writer) *Engine {
-	return &Engine{
-		s:      store,
-		h:      h,
-		sh:     sh,
-		engine: e,
+func NewEngine(store kstorage.Manager, sh *kstorage.Handler, e *engine.Engine, h herodot.Writer, opts ...EngineOption) *Engine {
+	le := &Engine{
+		s:               store,
+		h:               h,
+		sh:              sh,
+		engine:          e,
+		policyValidator: kstorage.DefaultPolicyValidator(),
+		roleValidator:   kstorage.DefaultRoleValidator(),
 	}
+	for _, opt := range opts {
+		opt(le)
+	}
+	return le
 }
 
 func (e *Engine) Register(r *httprouter.Router) {
@@ -89,7 +136,9 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//
 	// Use this endpoint to check if a request is allowed or not. If the request is allowed, a 200 response with
 	// `{"allowed":"true"}` will be sent. If the request is denied, a 403 response with `{"allowed":"false"}` will
-	// be sent instead.
+	// be sent instead. Policies only match within their validity window, from `not_before` until `not_after`.
+	// A policy matches the subject if it names the subject or one of its roles. Roles with a `scope` only count for
+	// requests whose resource matches the scope, global roles count for every request.
 	//
 	//
 	//     Consumes:
@@ -106,13 +155,110 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//       500: genericError
 	r.POST(BasePath+"/allowed", e.engine.Evaluate(e.eval))
 
+	// swagger:route POST /engines/acp/ory/{flavor}/decisions engines decideOryAccessControlPolicies
+	//
+	// Decide an access request against the stored policies
+	//
+	// Unlike the allowed endpoint, this endpoint matches the stored policies directly without the policy engine. A
+	// request is allowed if at least one policy allows and no policy denies it. If both an allow and a deny policy
+	// match, deny overrides allow unless the precedence is configured to be allow; the outcome never depends on the
+	// order in which the policies are stored. If the request is allowed, a 200 response with `{"allowed":true}` will be
+	// sent. If the request is denied, a 403 response with `{"allowed":false}` will be sent instead. Requests which no
+	// policy matches are decided by the configured default decision, which denies unless configured otherwise, and the
+	// response has `"default":true`. A policy only matches if the context of the request fulfills its conditions. The
+	// condition types StringEqualCondition, CIDRCondition, and ResourceContainsCondition are supported; other types
+	// fail closed, so that an allow policy does not match and a deny policy does. Policies outside of their validity
+	// window, from `not_before` until `not_after`, do not match either. An allowed response lists the obligations of
+	// the matching allow policies, which the caller must enforce.
+	//
+	// The subjects, resources, and actions of the policies are matched in the syntax of the flavor: `exact` compares
+	// them literally, `glob` only matches wildcards, and `regex` only matches regular expressions. A policy matches the
+	// subject if it names the subject or one of the roles the subject belongs to, directly or through other roles.
+	// Roles with a `scope` only count for requests whose resource matches the scope, global roles count for every
+	// request.
+	//
+	// If the query parameter `explain` is `true`, the response has a `trace` of the decision. It lists every policy
+	// with whether its subjects, actions, and resources match the request, whether it is within its validity window,
+	// whether its conditions pass, and its effect, together with the final decision and the policies which decided
+	// it. Explaining evaluates every policy, so it is more expensive and meant for debugging unexpected decisions.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: authorizationResult
+	//       400: genericError
+	//       403: authorizationResult
+	//       500: genericError
+	r.POST(BasePath+"/decisions", e.sh.Allowed(e.policiesAllowed))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/decisions/test engines testOryAccessControlPolicies
+	//
+	// Test an access request
+	//
+	// Decides the access request like the decisions endpoint but always responds with 200 and explains the decision:
+	// which policies allow and deny the request and which effect won. If policies are given in the request, they are
+	// decided instead of the stored policies, so that policies can be tried out before storing them.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyDecision
+	//       400: genericError
+	//       500: genericError
+	r.POST(BasePath+"/decisions/test", e.sh.Test(e.policiesTest))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/decisions/batch engines decideOryAccessControlPoliciesBatch
+	//
+	// Decide several access requests at once
+	//
+	// Decides every access request of the array like the decisions endpoint and responds with 200 and an array of
+	// the decisions in the same order. All requests are decided against the same snapshot of the stored policies.
+	// Arrays with more access requests than the configured maximum batch size are rejected with 400.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: authorizationResults
+	//       400: genericError
+	//       500: genericError
+	r.POST(BasePath+"/decisions/batch", e.sh.AllowedBatch(e.policiesAllowedBatch))
+
 	// swagger:route PUT /engines/acp/ory/{flavor}/policies engines upsertOryAccessControlPolicy
 	//
 	// Upsert an ORY Access Control Policy
 	//
+	// The effect must be "allow" or "deny". Policies without subjects, resources, or actions are rejected because they
+	// never match, unless the query parameter "force" is "true". The policy must satisfy the configured JSON Schema,
+	// the violations are listed in the details of the error otherwise. If the server is configured to tell creates from
+	// updates, a new policy is answered with 201 and its Location. With the query parameter "dedupe" set to "true", a
+	// policy whose content equals that of a policy with another ID is not stored; the response is that policy instead,
+	// with its ID in the header "X-Duplicate-Of".
+	//
 	//
 	//     Consumes:
 	//     - application/json
+	//     - application/x-yaml
 	//
 	//     Produces:
 	//     - application/json
@@ -121,9 +267,64 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//
 	//     Responses:
 	//       200: oryAccessControlPolicy
+	//       201: oryAccessControlPolicy
+	//       400: genericError
+	//       403: genericError
+	//       412: genericError
+	//       413: genericError
 	//       500: genericError
 	r.PUT(BasePath+"/policies", e.sh.Upsert(e.policiesCreate))
 
+	// swagger:route POST /engines/acp/ory/{flavor}/policies engines createOryAccessControlPolicy
+	//
+	// Create an ORY Access Control Policy
+	//
+	// Like upserting a policy, but fails with 409 if a policy with the ID exists already instead of replacing it. The
+	// Location header of the response is the path of the created policy.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       201: oryAccessControlPolicy
+	//       400: genericError
+	//       409: genericError
+	//       413: genericError
+	//       500: genericError
+	r.POST(BasePath+"/policies", e.sh.Create(e.policiesCreate))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/bulk/policies engines upsertOryAccessControlPolicies
+	//
+	// Upsert several ORY Access Control Policies at once
+	//
+	// Either all or none of the policies are written. If a policy can not be written, the error identifies its
+	// index in the request body.
+	// With atomic=false every policy is written on its own and the response is 207 with the result of every policy.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicies
+	//       207: bulkResults
+	//       400: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/bulk/policies", e.sh.UpsertMany(e.policiesUpsertMany))
+
 	// swagger:route GET /engines/acp/ory/{flavor}/policies engines listOryAccessControlPolicies
 	//
 	// List ORY Access Control Policies
@@ -131,34 +332,185 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//
 	//     Produces:
 	//     - application/json
+	//     - application/x-yaml
 	//
 	//     Schemes: http, https
 	//
 	//     Responses:
 	//       200: oryAccessControlPolicies
+	//       429: genericError
 	//       500: genericError
 	r.GET(BasePath+"/policies", e.sh.List(e.policiesList))
 
+	// swagger:route GET /engines/acp/ory/{flavor}/count/policies engines countOryAccessControlPolicies
+	//
+	// Count ORY Access Control Policies
+	//
+	// Returns the number of ORY Access Control Policies. If filters are supplied, only matching policies are counted.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: collectionCount
+	//       500: genericError
+	r.GET(BasePath+"/count/policies", e.sh.Count(e.policiesList))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/effective/policies engines getOryAccessControlPolicyEffectivePermissions
+	//
+	// List the effective permissions of a subject
+	//
+	// Answers "what can this subject do?". Lists every resource and action granted by the allow policies which apply to
+	// the subject, either directly or through the roles it belongs to, including patterns. Each entry names the allow
+	// policies granting it and the deny policies overriding it. Roles with a `scope` only count for the resources
+	// which match the scope. Conditions are not evaluated, and policies outside of their validity window, from
+	// `not_before` until `not_after`, are left out.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyEffectivePermissions
+	//       400: genericError
+	//       500: genericError
+	r.GET(BasePath+"/effective/policies", e.sh.EffectivePolicies(e.policiesEffective))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/matches/policies engines countOryAccessControlPolicyMatches
+	//
+	// Count the ORY Access Control Policies matching an access request
+	//
+	// Counts the allow and deny policies whose subjects, resources, and actions match the subject, action, and
+	// resource of the query, as the decision of the request would. Helps to find resources guarded by suspiciously
+	// many or no policies. Set verbose to true to include the IDs of the matching policies.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyMatchCount
+	//       400: genericError
+	//       500: genericError
+	r.GET(BasePath+"/matches/policies", e.sh.MatchCount(e.policiesMatchCount))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/distinct/policies engines listOryAccessControlPolicyDistinctValues
+	//
+	// List the distinct values of a field of ORY Access Control Policies
+	//
+	// Returns the sorted distinct actions, resources, or subjects of all policies, for example to suggest values
+	// while editing a policy. Patterns are listed as they are stored.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyDistinctValues
+	//       400: genericError
+	//       500: genericError
+	r.GET(BasePath+"/distinct/policies", e.sh.Distinct(e.policiesDistinct))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/bulk/policies engines getOryAccessControlPolicies
+	//
+	// Get several ORY Access Control Policies at once
+	//
+	// Responds with the policies whose IDs are given by the query parameter "id", which can be repeated, in the order
+	// of the IDs. IDs which do not exist are left out unless the query parameter "strict" is "true", in which case the
+	// response is 404 and names the missing IDs.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicies
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	r.GET(BasePath+"/bulk/policies", e.sh.GetMany(e.policiesGetMany))
+
 	// swagger:route GET /engines/acp/ory/{flavor}/policies/{id} engines getOryAccessControlPolicy
 	//
 	// Get an ORY Access Control Policy
 	//
+	// A HEAD request responds with the same status code and headers, including the ETag, but without a body. If the
+	// If-None-Match header contains the current ETag, the response is 304 without a body.
+	//
 	//
 	//     Produces:
 	//     - application/json
+	//     - application/x-yaml
 	//
 	//     Schemes: http, https
 	//
 	//     Responses:
 	//       200: oryAccessControlPolicy
+	//       304: emptyResponse
 	//       404: genericError
 	//       500: genericError
 	r.GET(BasePath+"/policies/:id", e.sh.Get(e.policiesGet))
+	r.HEAD(BasePath+"/policies/:id", e.sh.Get(e.policiesGet))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/policies/{id}/exists engines oryAccessControlPolicyExists
+	//
+	// Check if an ORY Access Control Policy exists
+	//
+	// Responds with 204 if the policy exists and with 404 otherwise. The response has no body.
+	//
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       204: emptyResponse
+	//       404: emptyResponse
+	//       500: genericError
+	r.GET(BasePath+"/policies/:id/exists", e.sh.Exists(e.policiesExists))
+
+	// swagger:route PATCH /engines/acp/ory/{flavor}/policies/{id} engines patchOryAccessControlPolicy
+	//
+	// Patch an ORY Access Control Policy
+	//
+	// The body is a JSON Merge Patch (RFC 7386). Instead of replacing them, values can be added to or removed from
+	// the subjects, resources, and actions by using an object like `{"actions": {"add": ["create"], "remove": ["delete"]}}`.
+	//
+	//
+	//     Consumes:
+	//     - application/merge-patch+json
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicy
+	//       400: genericError
+	//       404: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PATCH(BasePath+"/policies/:id", e.sh.Patch(e.policiesPatch))
 
 	// swagger:route DELETE /engines/acp/ory/{flavor}/policies/{id} engines deleteOryAccessControlPolicy
 	//
 	// Delete an ORY Access Control Policy
 	//
+	// If soft deletion is enabled, the policy is kept as a tombstone which can be restored, unless the query parameter
+	// "purge" is "true".
+	//
 	//
 	//     Produces:
 	//     - application/json
@@ -170,12 +522,12 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//       500: genericError
 	r.DELETE(BasePath+"/policies/:id", e.sh.Delete(e.policiesDelete))
 
-	// swagger:route GET /engines/acp/ory/{flavor}/roles engines listOryAccessControlPolicyRoles
+	// swagger:route POST /engines/acp/ory/{flavor}/policies/{id}/restore engines restoreOryAccessControlPolicy
 	//
-	// List ORY Access Control Policy Roles
+	// Restore a deleted ORY Access Control Policy
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
+	// Brings back a policy which has been deleted while soft deletion was enabled. Responds with 409 if a policy with
+	// the same ID has been created since.
 	//
 	//
 	//     Produces:
@@ -184,17 +536,23 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       200: oryAccessControlPolicyRoles
+	//       200: oryAccessControlPolicy
+	//       404: genericError
+	//       409: genericError
 	//       500: genericError
-	r.GET(BasePath+"/roles", e.sh.List(e.rolesList))
+	r.POST(BasePath+"/policies/:id/restore", e.sh.Restore(e.policiesRestore))
 
-	// swagger:route GET /engines/acp/ory/{flavor}/roles/{id} engines getOryAccessControlPolicyRole
+	// swagger:route POST /engines/acp/ory/{flavor}/policies/{id}/rename engines renameOryAccessControlPolicy
 	//
-	// Get an ORY Access Control Policy Role
+	// Rename an ORY Access Control Policy
+	//
+	// Changes the ID of a policy to the ID in the body in one step, so that there is no moment in which the policy
+	// is missing or stored twice. Responds with 404 if the policy does not exist and with 409 if a policy with the new
+	// ID exists already.
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
 	//
+	//     Consumes:
+	//     - application/json
 	//
 	//     Produces:
 	//     - application/json
@@ -202,17 +560,20 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       200: oryAccessControlPolicyRole
+	//       200: oryAccessControlPolicy
+	//       400: genericError
 	//       404: genericError
+	//       409: genericError
 	//       500: genericError
-	r.GET(BasePath+"/roles/:id", e.sh.Get(e.rolesGet))
+	r.POST(BasePath+"/policies/:id/rename", e.sh.Rename(e.policiesRename))
 
-	// swagger:route PUT /engines/acp/ory/{flavor}/roles engines upsertOryAccessControlPolicyRole
+	// swagger:route DELETE /engines/acp/ory/{flavor}/bulk/policies engines deleteOryAccessControlPolicies
 	//
-	// Upsert an ORY Access Control Policy Role
+	// Delete several ORY Access Control Policies at once
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
+	// The body is a JSON array of IDs which are deleted in one transaction. IDs which do not exist are ignored. If
+	// the query parameter "report" is "true", the number of deleted entries is returned.
+	// With atomic=false every ID is deleted on its own and the response is 207 with the result of every ID.
 	//
 	//
 	//     Consumes:
@@ -224,16 +585,20 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       200: oryAccessControlPolicyRole
+	//       200: deleteManyReport
+	//       204: emptyResponse
+	//       207: bulkResults
+	//       400: genericError
+	//       413: genericError
 	//       500: genericError
-	r.PUT(BasePath+"/roles", e.sh.Upsert(e.rolesUpsert))
+	r.DELETE(BasePath+"/bulk/policies", e.sh.DeleteMany(e.policiesDeleteMany))
 
-	// swagger:route DELETE /engines/acp/ory/{flavor}/roles/{id} engines deleteOryAccessControlPolicyRole
+	// swagger:route DELETE /engines/acp/ory/{flavor}/clear/policies engines clearOryAccessControlPolicies
 	//
-	// Delete an ORY Access Control Policy Role
+	// Delete all ORY Access Control Policies
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
+	// Removes all policies and their tombstones at once and returns the number of removed policies. This is meant for test
+	// environments and responds with 403 unless destructive operations are allowed in the configuration.
 	//
 	//
 	//     Produces:
@@ -242,20 +607,45 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       204: emptyResponse
+	//       200: clearReport
+	//       403: genericError
 	//       500: genericError
-	r.DELETE(BasePath+"/roles/:id", e.sh.Delete(e.rolesDelete))
+	r.DELETE(BasePath+"/clear/policies", e.sh.Clear(e.policiesClear))
 
-	// swagger:route PUT /engines/acp/ory/{flavor}/roles/{id}/members engines addOryAccessControlPolicyRoleMembers
+	// swagger:route GET /engines/acp/ory/{flavor}/export/policies engines exportOryAccessControlPolicies
 	//
-	// Add a Member to an ORY Access Control Policy Role
+	// Export ORY Access Control Policies
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
+	// Streams all stored policies as newline delimited JSON, one policy per line, or as a stream of YAML documents if the
+	// Accept header prefers application/x-yaml. The response is sent as an attachment. A single byte range can be
+	// requested with the Range header to resume an interrupted export. The export is sent in a stable order, so that
+	// byte offsets stay valid as long as no policies are written.
+	//
+	//
+	//     Produces:
+	//     - application/x-ndjson
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: exportResponse
+	//       206: exportPartialResponse
+	//       416: genericError
+	//       500: genericError
+	r.GET(BasePath+"/export/policies", e.sh.Export(e.policiesExport))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/import/policies engines importOryAccessControlPolicies
+	//
+	// Import ORY Access Control Policies
+	//
+	// Restores policies from newline delimited JSON, one policy per line, as written by the export endpoint. With
+	// mode "merge" (default) the policies are upserted, with mode "replace" all other policies are removed. If a line is
+	// invalid, nothing is imported.
 	//
 	//
 	//     Consumes:
-	//     - application/json
+	//     - application/x-ndjson
 	//
 	//     Produces:
 	//     - application/json
@@ -263,16 +653,21 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       200: oryAccessControlPolicyRole
+	//       200: importReport
+	//       400: genericError
+	//       403: genericError
+	//       413: genericError
 	//       500: genericError
-	r.PUT(BasePath+"/roles/:id/members", e.sh.Upsert(e.rolesMembersAdd))
+	r.POST(BasePath+"/import/policies", e.sh.Import(e.policiesImport))
 
-	// swagger:route DELETE /engines/acp/ory/{flavor}/roles/{id}/members/{member} engines removeOryAccessControlPolicyRoleMembers
+	// swagger:route PUT /engines/acp/ory/{flavor}/reconcile/policies engines reconcileOryAccessControlPolicies
 	//
-	// Remove a Member From an ORY Access Control Policy Role
+	// Reconcile ORY Access Control Policies
 	//
-	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
-	// as subject in the OACP.
+	// Creates, updates and deletes policies until the stored policies match the request body exactly, and responds with
+	// the difference. Either the whole difference or nothing is applied. With dry_run=true the difference is computed
+	// but not applied. Stored policies missing from the body are only deleted with prune=true, and deleting all of
+	// them also requires destructive operations to be allowed.
 	//
 	//
 	//     Consumes:
@@ -284,69 +679,865 @@ func (e *Engine) Register(r *httprouter.Router) {
 	//     Schemes: http, https
 	//
 	//     Responses:
-	//       200: emptyResponse
+	//       200: reconcileReport
+	//       400: genericError
+	//       403: genericError
+	//       413: genericError
 	//       500: genericError
-	r.DELETE(BasePath+"/roles/:id/members/:member", e.sh.Upsert(e.rolesMembersRemove))
-}
-
-func (e *Engine) rolesList(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ListRequest, error) {
-	p := make(kstorage.Roles, 0)
-	f, err := flavor(ps)
-	if err != nil {
-		return nil, err
-	}
-
-	return &kstorage.ListRequest{
-		Collection: roleCollection(f),
-		Value:      &p,
-		FilterFunc: kstorage.ListByQuery,
-	}, nil
-}
-
-func (e *Engine) rolesGet(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.GetRequest, error) {
-	var p kstorage.Role
+	r.PUT(BasePath+"/reconcile/policies", e.sh.Reconcile(e.policiesReconcile))
 
-	f, err := flavor(ps)
-	if err != nil {
-		return nil, err
+	// swagger:route GET /engines/acp/ory/{flavor}/roles engines listOryAccessControlPolicyRoles
+	//
+	// List ORY Access Control Policy Roles
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRoles
+	//       429: genericError
+	//       500: genericError
+	r.GET(BasePath+"/roles", e.sh.List(e.rolesList))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/count/roles engines countOryAccessControlPolicyRoles
+	//
+	// Count ORY Access Control Policy Roles
+	//
+	// Returns the number of ORY Access Control Policy Roles. If filters are supplied, only matching roles are counted.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: collectionCount
+	//       500: genericError
+	r.GET(BasePath+"/count/roles", e.sh.Count(e.rolesList))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/export/roles engines exportOryAccessControlPolicyRoles
+	//
+	// Export ORY Access Control Policy Roles
+	//
+	// Streams all stored roles as newline delimited JSON, one role per line, or as a stream of YAML documents if the
+	// Accept header prefers application/x-yaml. The response is sent as an attachment. A single byte range can be
+	// requested with the Range header to resume an interrupted export. The export is sent in a stable order, so that
+	// byte offsets stay valid as long as no roles are written.
+	//
+	//
+	//     Produces:
+	//     - application/x-ndjson
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: exportResponse
+	//       206: exportPartialResponse
+	//       416: genericError
+	//       500: genericError
+	r.GET(BasePath+"/export/roles", e.sh.Export(e.rolesExport))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/import/roles engines importOryAccessControlPolicyRoles
+	//
+	// Import ORY Access Control Policy Roles
+	//
+	// Restores roles from newline delimited JSON, one role per line, as written by the export endpoint. With
+	// mode "merge" (default) the roles are upserted, with mode "replace" all other roles are removed. If a line is
+	// invalid, nothing is imported.
+	//
+	//
+	//     Consumes:
+	//     - application/x-ndjson
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: importReport
+	//       400: genericError
+	//       403: genericError
+	//       413: genericError
+	//       500: genericError
+	r.POST(BasePath+"/import/roles", e.sh.Import(e.rolesImport))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/reconcile/roles engines reconcileOryAccessControlPolicyRoles
+	//
+	// Reconcile ORY Access Control Policy Roles
+	//
+	// Creates, updates and deletes roles until the stored roles match the request body exactly, and responds with
+	// the difference. Either the whole difference or nothing is applied. With dry_run=true the difference is computed
+	// but not applied. Stored roles missing from the body are only deleted with prune=true, and deleting all of
+	// them also requires destructive operations to be allowed.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: reconcileReport
+	//       400: genericError
+	//       403: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/reconcile/roles", e.sh.Reconcile(e.rolesReconcile))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/bulk/roles engines getOryAccessControlPolicyRoles
+	//
+	// Get several ORY Access Control Policy Roles at once
+	//
+	// Responds with the roles whose IDs are given by the query parameter "id", which can be repeated, in the order
+	// of the IDs. IDs which do not exist are left out unless the query parameter "strict" is "true", in which case the
+	// response is 404 and names the missing IDs.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRoles
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	r.GET(BasePath+"/bulk/roles", e.sh.GetMany(e.rolesGetMany))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/roles/{id} engines getOryAccessControlPolicyRole
+	//
+	// Get an ORY Access Control Policy Role
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP. A HEAD request responds with the same status code and headers, including the ETag, but
+	// without a body. If the If-None-Match header contains the current ETag, the response is 304 without a body.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       304: emptyResponse
+	//       404: genericError
+	//       500: genericError
+	r.GET(BasePath+"/roles/:id", e.sh.Get(e.rolesGet))
+	r.HEAD(BasePath+"/roles/:id", e.sh.Get(e.rolesGet))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/roles/{id}/exists engines oryAccessControlPolicyRoleExists
+	//
+	// Check if an ORY Access Control Policy Role exists
+	//
+	// Responds with 204 if the role exists and with 404 otherwise. The response has no body.
+	//
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       204: emptyResponse
+	//       404: emptyResponse
+	//       500: genericError
+	r.GET(BasePath+"/roles/:id/exists", e.sh.Exists(e.rolesExists))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/roles/{id}/ancestors engines listOryAccessControlPolicyRoleAncestors
+	//
+	// List the ancestors of an ORY Access Control Policy Role
+	//
+	// Lists the roles which contain the role, either directly as a member or through other roles, ordered from the
+	// closest parent outward. Cycles are detected and every ancestor is listed once. Responds with 404 if the role does
+	// not exist.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRoles
+	//       404: genericError
+	//       500: genericError
+	r.GET(BasePath+"/roles/:id/ancestors", e.sh.Ancestors(e.rolesAncestors))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/roles/{id}/policies engines listOryAccessControlPoliciesReferencingRole
+	//
+	// List the ORY Access Control Policies which reference a role
+	//
+	// Lists the policies whose subjects match the role, either because they list its ID or because one of their
+	// subject patterns matches it. Use it to find the policies which are orphaned by deleting or renaming the role.
+	// The role does not have to exist.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicies
+	//       500: genericError
+	r.GET(BasePath+"/roles/:id/policies", e.sh.PoliciesReferencingRole(e.rolesPolicies))
+
+	// swagger:route GET /engines/acp/ory/{flavor}/effective/roles engines listOryAccessControlPolicyRolesForMember
+	//
+	// List the roles of a member
+	//
+	// Answers "which roles does this member have?". Lists the sorted IDs of the roles which contain the member, either
+	// directly or through other roles. Responds with an empty list if the member belongs to no role. With the query
+	// parameter `scope` set to a resource, only the global roles and the roles whose scope matches the resource are
+	// considered, which answers "which roles does this member have on this resource?".
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRoleIDs
+	//       400: genericError
+	//       500: genericError
+	r.GET(BasePath+"/effective/roles", e.sh.RolesForMember(e.rolesForMember))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/roles engines upsertOryAccessControlPolicyRole
+	//
+	// Upsert an ORY Access Control Policy Role
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP. Whitespace around members is trimmed and duplicate members are stored once. Members which
+	// are empty, or which do not match the configured member format, are rejected with 400, as are roles which do not
+	// satisfy the configured JSON Schema. If the server is configured to tell creates from updates, a new role is
+	// answered with 201 and its Location.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       201: oryAccessControlPolicyRole
+	//       400: genericError
+	//       403: genericError
+	//       412: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/roles", e.sh.Upsert(e.rolesUpsert))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/roles engines createOryAccessControlPolicyRole
+	//
+	// Create an ORY Access Control Policy Role
+	//
+	// Like upserting a role, but fails with 409 if a role with the ID exists already instead of replacing it. The
+	// Location header of the response is the path of the created role.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//     - application/x-yaml
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       201: oryAccessControlPolicyRole
+	//       400: genericError
+	//       409: genericError
+	//       413: genericError
+	//       500: genericError
+	r.POST(BasePath+"/roles", e.sh.Create(e.rolesUpsert))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/bulk/roles engines upsertOryAccessControlPolicyRoles
+	//
+	// Upsert several ORY Access Control Policy Roles at once
+	//
+	// Either all or none of the roles are written. If a role can not be written, the error identifies its
+	// index in the request body.
+	// With atomic=false every role is written on its own and the response is 207 with the result of every role.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRoles
+	//       207: bulkResults
+	//       400: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/bulk/roles", e.sh.UpsertMany(e.rolesUpsertMany))
+
+	// swagger:route PATCH /engines/acp/ory/{flavor}/roles/{id} engines patchOryAccessControlPolicyRole
+	//
+	// Patch an ORY Access Control Policy Role
+	//
+	// The body is a JSON Merge Patch (RFC 7386). Instead of replacing them, members can be added or removed by using
+	// an object like `{"members": {"add": ["alice"], "remove": ["bob"]}}`.
+	//
+	//
+	//     Consumes:
+	//     - application/merge-patch+json
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       400: genericError
+	//       404: genericError
+	//       413: genericError
+	//       500: genericError
+	r.PATCH(BasePath+"/roles/:id", e.sh.Patch(e.rolesPatch))
+
+	// swagger:route DELETE /engines/acp/ory/{flavor}/roles/{id} engines deleteOryAccessControlPolicyRole
+	//
+	// Delete an ORY Access Control Policy Role
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP.
+	//
+	// If soft deletion is enabled, the role is kept as a tombstone which can be restored, unless the query parameter
+	// "purge" is "true".
+	//
+	// If policies still reference the role, the response carries a Warning header naming them. If the server
+	// enforces referential integrity, the delete is refused with 409 instead unless the query parameter "force" is
+	// "true".
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       204: emptyResponse
+	//       409: genericError
+	//       500: genericError
+	r.DELETE(BasePath+"/roles/:id", e.sh.Delete(e.rolesDelete))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/roles/{id}/restore engines restoreOryAccessControlPolicyRole
+	//
+	// Restore a deleted ORY Access Control Policy Role
+	//
+	// Brings back a role which has been deleted while soft deletion was enabled. Responds with 409 if a role with the
+	// same ID has been created since.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       404: genericError
+	//       409: genericError
+	//       500: genericError
+	r.POST(BasePath+"/roles/:id/restore", e.sh.Restore(e.rolesRestore))
+
+	// swagger:route POST /engines/acp/ory/{flavor}/roles/{id}/rename engines renameOryAccessControlPolicyRole
+	//
+	// Rename an ORY Access Control Policy Role
+	//
+	// Changes the ID of a role to the ID in the body in one step, so that there is no moment in which the role is
+	// missing or stored twice. Responds with 404 if the role does not exist and with 409 if a role with the new ID
+	// exists already. Policies which reference the role are not changed, they are reported like for deletes.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       400: genericError
+	//       404: genericError
+	//       409: genericError
+	//       500: genericError
+	r.POST(BasePath+"/roles/:id/rename", e.sh.Rename(e.rolesRename))
+
+	// swagger:route DELETE /engines/acp/ory/{flavor}/bulk/roles engines deleteOryAccessControlPolicyRoles
+	//
+	// Delete several ORY Access Control Policy Roles at once
+	//
+	// The body is a JSON array of IDs which are deleted in one transaction. IDs which do not exist are ignored. If
+	// the query parameter "report" is "true", the number of deleted entries is returned.
+	// With atomic=false every ID is deleted on its own and the response is 207 with the result of every ID.
+	//
+	// If policies still reference a role, the response carries a Warning header naming them. If the server enforces
+	// referential integrity, the delete is refused with 409 instead unless the query parameter "force" is "true".
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: deleteManyReport
+	//       204: emptyResponse
+	//       207: bulkResults
+	//       400: genericError
+	//       409: genericError
+	//       413: genericError
+	//       500: genericError
+	r.DELETE(BasePath+"/bulk/roles", e.sh.DeleteMany(e.rolesDeleteMany))
+
+	// swagger:route DELETE /engines/acp/ory/{flavor}/clear/roles engines clearOryAccessControlPolicyRoles
+	//
+	// Delete all ORY Access Control Policy Roles
+	//
+	// Removes all roles and their tombstones at once and returns the number of removed roles. This is meant for test
+	// environments and responds with 403 unless destructive operations are allowed in the configuration.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: clearReport
+	//       403: genericError
+	//       500: genericError
+	r.DELETE(BasePath+"/clear/roles", e.sh.Clear(e.rolesClear))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/roles/{id}/members engines addOryAccessControlPolicyRoleMembers
+	//
+	// Add a Member to an ORY Access Control Policy Role
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP. Concurrent requests for the same role are serialized, so that none of the added members
+	// is lost. The role is created if it does not exist, which is answered with 201 and the Location of the role if
+	// the server is configured to tell creates from updates.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       201: oryAccessControlPolicyRole
+	//       400: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/roles/:id/members", e.sh.Locked(e.roleLock, e.sh.Upsert(e.rolesMembersAdd)))
+
+	// swagger:route PUT /engines/acp/ory/{flavor}/roles/{id}/members/{member} engines addOryAccessControlPolicyRoleMember
+	//
+	// Add a Single Member to an ORY Access Control Policy Role
+	//
+	// The member is added atomically. Adding an existing member does nothing. Responds with 404 if the role does not
+	// exist. The member is trimmed like the members of an upserted role, and responds with 400 if it is empty or does
+	// not match the member format.
+	//
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	r.PUT(BasePath+"/roles/:id/members/:member", e.sh.AddMember(e.rolesMember))
+
+	// swagger:route DELETE /engines/acp/ory/{flavor}/roles/{id}/members/{member} engines removeOryAccessControlPolicyRoleMembers
+	//
+	// Remove a Member From an ORY Access Control Policy Role
+	//
+	// Roles group several subjects into one. Rules can be assigned to ORY Access Control Policy (OACP) by using the Role ID
+	// as subject in the OACP. The member is removed atomically. Responds with 404 if the role does not exist or if the
+	// member is not part of it.
+	//
+	//
+	//     Consumes:
+	//     - application/json
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Schemes: http, https
+	//
+	//     Responses:
+	//       200: oryAccessControlPolicyRole
+	//       404: genericError
+	//       500: genericError
+	r.DELETE(BasePath+"/roles/:id/members/:member", e.sh.RemoveMember(e.rolesMember))
+}
+
+func (e *Engine) rolesList(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ListRequest, error) {
+	p := make(kstorage.Roles, 0)
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ListRequest{
+		Collection: roleCollection(f),
+		Value:      &p,
+		FilterFunc: kstorage.ListByQuery,
+	}, nil
+}
+
+func (e *Engine) rolesGetMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.GetManyRequest, error) {
+	p := make(kstorage.Roles, 0)
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.GetManyRequest{
+		Collection: roleCollection(f),
+		Keys:       r.URL.Query()["id"],
+		Value:      &p,
+	}, nil
+}
+
+func (e *Engine) rolesGet(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.GetRequest, error) {
+	var p kstorage.Role
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.GetRequest{
+		Collection: roleCollection(f),
+		Key:        ps.ByName("id"),
+		Value:      &p,
+	}, nil
+}
+
+func (e *Engine) rolesExists(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ExistsRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ExistsRequest{
+		Collection: roleCollection(f),
+		Key:        ps.ByName("id"),
+	}, nil
+}
+
+func (e *Engine) rolesAncestors(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.AncestorsRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.AncestorsRequest{
+		Collection: roleCollection(f),
+		Key:        ps.ByName("id"),
+	}, nil
+}
+
+func (e *Engine) rolesForMember(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.RolesForMemberRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.RolesForMemberRequest{
+		Collection: roleCollection(f),
+		Member:     r.URL.Query().Get("member"),
+		Scope:      r.URL.Query().Get("scope"),
+	}, nil
+}
+
+func (e *Engine) rolesUpsert(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertRequest, error) {
+	var p kstorage.Role
+	if err := decodeValidBody(r, &p, "role", false, e.roleValidator, false); err != nil {
+		return nil, err
+	}
+
+	if p.ID == "" {
+		p.ID = uuid.New()
+	}
+	// effective members are computed when listing and must not be stored.
+	p.EffectiveMembers = nil
+
+	if err := p.Validate(e.memberFormat); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("Role is invalid: %s", err).
+			WithDetail("key", p.ID))
+	}
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.UpsertRequest{
+		Collection: roleCollection(f),
+		Key:        p.ID,
+		Value:      &p,
+	}, nil
+}
+
+func (e *Engine) rolesUpsertMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertManyRequest, error) {
+	var p kstorage.Roles
+	if err := decodeValidBody(r, &p, "roles", false, e.roleValidator, true); err != nil {
+		return nil, err
+	}
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]kstorage.UpsertEntry, len(p))
+	for k := range p {
+		if p[k].ID == "" {
+			p[k].ID = uuid.New()
+		}
+		p[k].EffectiveMembers = nil
+		entries[k] = kstorage.UpsertEntry{Key: p[k].ID, Value: &p[k]}
+		if err := p[k].Validate(e.memberFormat); err != nil {
+			entries[k].Err = errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("Role at index %d is invalid: %s", k, err).
+				WithDetail("index", k).
+				WithDetail("key", p[k].ID))
+		}
+	}
+
+	return &kstorage.UpsertManyRequest{
+		Collection: roleCollection(f),
+		Entries:    entries,
+	}, nil
+}
+
+func (e *Engine) rolesReconcile(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ReconcileRequest, error) {
+	u, err := e.rolesUpsertMany(ctx, r, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ReconcileRequest{
+		Collection: u.Collection,
+		Entries:    u.Entries,
+		Current:    &kstorage.Roles{},
+	}, nil
+}
+
+func (e *Engine) rolesPatch(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.PatchRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := decodePatch(r, ps.ByName("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.PatchRequest{
+		Collection: roleCollection(f),
+		Key:        ps.ByName("id"),
+		Patch:      patch,
+		Value:      new(kstorage.Role),
+		Validate: func(document []byte) error {
+			var p kstorage.Role
+			if err := decodeValidDocument(document, &p, "role", e.roleValidator); err != nil {
+				return err
+			}
+			if err := p.Validate(e.memberFormat); err != nil {
+				return errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Role is invalid: %s", err).
+					WithDetail("key", p.ID))
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (e *Engine) rolesDelete(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DeleteRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.DeleteRequest{
+		Collection:       roleCollection(f),
+		Key:              ps.ByName("id"),
+		PolicyCollection: policyCollection(f),
+	}, nil
+}
+
+func (e *Engine) rolesPolicies(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.PoliciesReferencingRoleRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.PoliciesReferencingRoleRequest{
+		PolicyCollection: policyCollection(f),
+		Role:             ps.ByName("id"),
+	}, nil
+}
+
+func (e *Engine) rolesRestore(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.RestoreRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.RestoreRequest{
+		Collection: roleCollection(f),
+		Key:        ps.ByName("id"),
+		Value:      new(kstorage.Role),
+	}, nil
+}
+
+func (e *Engine) rolesRename(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.RenameRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeNewKey(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.validateNewKey(ctx, roleCollection(f), ps.ByName("id"), key, "role", e.roleValidator); err != nil {
+		return nil, err
+	}
+
+	return &kstorage.RenameRequest{
+		Collection:       roleCollection(f),
+		Key:              ps.ByName("id"),
+		NewKey:           key,
+		Value:            new(kstorage.Role),
+		PolicyCollection: policyCollection(f),
+	}, nil
+}
+
+func (e *Engine) rolesExport(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ExportRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
 	}
 
-	return &kstorage.GetRequest{
+	return &kstorage.ExportRequest{
 		Collection: roleCollection(f),
-		Key:        ps.ByName("id"),
-		Value:      &p,
+		Filename:   f + "-roles.jsonl",
 	}, nil
 }
 
-func (e *Engine) rolesUpsert(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertRequest, error) {
-	var p kstorage.Role
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		return nil, errors.WithStack(err)
+func (e *Engine) rolesImport(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ImportRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
 	}
 
-	if p.ID == "" {
-		p.ID = uuid.New()
+	return &kstorage.ImportRequest{
+		Collection: roleCollection(f),
+		Mode:       importMode(r),
+		Body:       r.Body,
+		Decode: func(line json.RawMessage) (string, interface{}, error) {
+			var p kstorage.Role
+			if err := decodeLine(line, &p); err != nil {
+				return "", nil, err
+			}
+			if err := validateLine(e.roleValidator, line); err != nil {
+				return "", nil, err
+			}
+			if p.ID == "" {
+				return "", nil, errMissingID
+			}
+			// effective members are computed when listing and must not be stored.
+			p.EffectiveMembers = nil
+			if err := p.Validate(e.memberFormat); err != nil {
+				return "", nil, err
+			}
+			return p.ID, &p, nil
+		},
+	}, nil
+}
+
+func (e *Engine) rolesClear(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ClearRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
 	}
 
+	return &kstorage.ClearRequest{Collection: roleCollection(f)}, nil
+}
+
+func (e *Engine) rolesDeleteMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DeleteManyRequest, error) {
 	f, err := flavor(ps)
 	if err != nil {
 		return nil, err
 	}
 
-	return &kstorage.UpsertRequest{
-		Collection: roleCollection(f),
-		Key:        p.ID,
-		Value:      &p,
+	keys, err := decodeKeys(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.DeleteManyRequest{
+		Collection:       roleCollection(f),
+		Keys:             keys,
+		PolicyCollection: policyCollection(f),
 	}, nil
 }
 
-func (e *Engine) rolesDelete(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DeleteRequest, error) {
+// roleLock locks the role while its members are read and written back, so that concurrent additions are all kept.
+func (e *Engine) roleLock(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.LockRequest, error) {
 	f, err := flavor(ps)
 	if err != nil {
 		return nil, err
 	}
 
-	return &kstorage.DeleteRequest{
+	return &kstorage.LockRequest{
 		Collection: roleCollection(f),
 		Key:        ps.ByName("id"),
 	}, nil
@@ -359,61 +1550,81 @@ func (e *Engine) rolesMembersAdd(ctx context.Context, r *http.Request, ps httpro
 	}
 
 	var i kstorage.Role
-	if err := json.NewDecoder(r.Body).Decode(&i); err != nil {
-		return nil, errors.WithStack(err)
+	if err := decodeValidBody(r, &i, "members", false, e.roleValidator, false); err != nil {
+		return nil, err
 	}
 
 	var ro kstorage.Role
-	if err := e.s.Get(ctx, roleCollection(f), ps.ByName("id"), &ro); errors.Cause(err) == &herodot.ErrNotFound {
+	if err := e.s.Get(ctx, roleCollection(f), ps.ByName("id"), &ro); errors.Is(err, kstorage.ErrNotFound) {
 		i.ID = ps.ByName("id")
 		ro = i
 	} else if err != nil {
 		return nil, err
 	} else {
-		ro.Members = stringslice.Unique(append(ro.Members, i.Members...))
+		ro.Members = append(ro.Members, i.Members...)
+	}
+
+	if err := ro.Validate(e.memberFormat); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("Role is invalid: %s", err).
+			WithDetail("key", ro.ID))
 	}
 
 	return &kstorage.UpsertRequest{
 		Collection: roleCollection(f),
 		Key:        ro.ID,
 		Value:      &ro,
+		Location:   path.Dir(r.URL.Path),
 	}, nil
 
 }
 
-func (e *Engine) rolesMembersRemove(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertRequest, error) {
+func (e *Engine) rolesMember(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.MemberRequest, error) {
 	f, err := flavor(ps)
 	if err != nil {
 		return nil, err
 	}
 
-	var ro kstorage.Role
-	if err := e.s.Get(ctx, roleCollection(f), ps.ByName("id"), &ro); err != nil {
-		return nil, err
+	// the member is checked like the members of an upserted role, see Role.Validate.
+	member := strings.TrimSpace(ps.ByName("member"))
+	if member == "" {
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Role "%s" can not have an empty member.`, ps.ByName("id")).
+			WithDetail("key", ps.ByName("id")))
+	}
+	if e.memberFormat != nil && !e.memberFormat.MatchString(member) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Member "%s" of role "%s" does not match the format "%s".`, member, ps.ByName("id"), e.memberFormat).
+			WithDetail("key", ps.ByName("id")))
 	}
 
-	ro.Members = stringslice.Filter(ro.Members, func(s string) bool {
-		return s == ps.ByName("member")
-	})
-
-	return &kstorage.UpsertRequest{
+	return &kstorage.MemberRequest{
 		Collection: roleCollection(f),
-		Key:        ro.ID,
-		Value:      &ro,
+		Key:        ps.ByName("id"),
+		Member:     member,
+		Value:      new(kstorage.Role),
 	}, nil
 }
 
 func (e *Engine) policiesCreate(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertRequest, error) {
 	var p kstorage.Policy
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		return nil, errors.WithStack(err)
+	if err := decodeValidBody(r, &p, "policy", false, e.policyValidator, false); err != nil {
+		return nil, err
 	}
 
-	p, err := validatePolicy(p)
+	force, err := forceParam(r)
 	if err != nil {
 		return nil, err
 	}
 
+	vp, err := validatePolicy(p, force)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("Policy is invalid: %s", err).
+			WithDetail("key", p.ID))
+	}
+	p = vp
+
 	f, err := flavor(ps)
 	if err != nil {
 		return nil, err
@@ -426,6 +1637,55 @@ func (e *Engine) policiesCreate(ctx context.Context, r *http.Request, ps httprou
 	}, nil
 }
 
+func (e *Engine) policiesUpsertMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.UpsertManyRequest, error) {
+	var p kstorage.Policies
+	if err := decodeValidBody(r, &p, "policies", false, e.policyValidator, true); err != nil {
+		return nil, err
+	}
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	force, err := forceParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]kstorage.UpsertEntry, len(p))
+	for k := range p {
+		vp, err := validatePolicy(p[k], force)
+		if err != nil {
+			entries[k] = kstorage.UpsertEntry{Key: p[k].ID, Value: &p[k], Err: errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("Policy at index %d is invalid: %s", k, err).
+				WithDetail("index", k).
+				WithDetail("key", p[k].ID))}
+			continue
+		}
+		p[k] = vp
+		entries[k] = kstorage.UpsertEntry{Key: p[k].ID, Value: &p[k]}
+	}
+
+	return &kstorage.UpsertManyRequest{
+		Collection: policyCollection(f),
+		Entries:    entries,
+	}, nil
+}
+
+func (e *Engine) policiesReconcile(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ReconcileRequest, error) {
+	u, err := e.policiesUpsertMany(ctx, r, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ReconcileRequest{
+		Collection: u.Collection,
+		Entries:    u.Entries,
+		Current:    &kstorage.Policies{},
+	}, nil
+}
+
 func (e *Engine) policiesList(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ListRequest, error) {
 
 	p := make(kstorage.Policies, 0)
@@ -441,6 +1701,46 @@ func (e *Engine) policiesList(ctx context.Context, r *http.Request, ps httproute
 	}, nil
 }
 
+func (e *Engine) policiesPatch(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.PatchRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := decodePatch(r, ps.ByName("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if effect, ok := patch["effect"]; ok && effect != Allow && effect != Deny {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Invalid policy effect %v, only allow and deny are supported.", effect))
+	}
+
+	force, err := forceParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.PatchRequest{
+		Collection: policyCollection(f),
+		Key:        ps.ByName("id"),
+		Patch:      patch,
+		Value:      new(kstorage.Policy),
+		Validate: func(document []byte) error {
+			var p kstorage.Policy
+			if err := decodeValidDocument(document, &p, "policy", e.policyValidator); err != nil {
+				return err
+			}
+			if _, err := validatePolicy(p, force); err != nil {
+				return errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Policy is invalid: %s", err).
+					WithDetail("key", p.ID))
+			}
+			return nil
+		},
+	}, nil
+}
+
 func (e *Engine) policiesDelete(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DeleteRequest, error) {
 	f, err := flavor(ps)
 	if err != nil {
@@ -453,6 +1753,166 @@ func (e *Engine) policiesDelete(ctx context.Context, r *http.Request, ps httprou
 	}, nil
 }
 
+func (e *Engine) policiesRestore(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.RestoreRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.RestoreRequest{
+		Collection: policyCollection(f),
+		Key:        ps.ByName("id"),
+		Value:      new(kstorage.Policy),
+	}, nil
+}
+
+func (e *Engine) policiesRename(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.RenameRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeNewKey(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.validateNewKey(ctx, policyCollection(f), ps.ByName("id"), key, "policy", e.policyValidator); err != nil {
+		return nil, err
+	}
+
+	return &kstorage.RenameRequest{
+		Collection: policyCollection(f),
+		Key:        ps.ByName("id"),
+		NewKey:     key,
+		Value:      new(kstorage.Policy),
+	}, nil
+}
+
+func (e *Engine) policiesExport(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ExportRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ExportRequest{
+		Collection: policyCollection(f),
+		Filename:   f + "-policies.jsonl",
+	}, nil
+}
+
+func (e *Engine) policiesImport(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ImportRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	force, err := forceParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ImportRequest{
+		Collection: policyCollection(f),
+		Mode:       importMode(r),
+		Body:       r.Body,
+		Decode: func(line json.RawMessage) (string, interface{}, error) {
+			var p kstorage.Policy
+			if err := decodeLine(line, &p); err != nil {
+				return "", nil, err
+			}
+			if err := validateLine(e.policyValidator, line); err != nil {
+				return "", nil, err
+			}
+			if p.ID == "" {
+				return "", nil, errMissingID
+			}
+			if err := p.Validate(force); err != nil {
+				return "", nil, err
+			}
+			return p.ID, &p, nil
+		},
+	}, nil
+}
+
+func (e *Engine) policiesClear(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ClearRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ClearRequest{Collection: policyCollection(f)}, nil
+}
+
+func (e *Engine) policiesDeleteMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DeleteManyRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := decodeKeys(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.DeleteManyRequest{
+		Collection: policyCollection(f),
+		Keys:       keys,
+	}, nil
+}
+
+func (e *Engine) policiesEffective(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.EffectivePoliciesRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.EffectivePoliciesRequest{
+		PolicyCollection: policyCollection(f),
+		RoleCollection:   roleCollection(f),
+		Subject:          r.URL.Query().Get("subject"),
+	}, nil
+}
+
+func (e *Engine) policiesMatchCount(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.MatchCountRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	q := r.URL.Query()
+	return &kstorage.MatchCountRequest{
+		Collection: policyCollection(f),
+		Subject:    q.Get("subject"),
+		Action:     q.Get("action"),
+		Resource:   q.Get("resource"),
+		Flavor:     f,
+	}, nil
+}
+
+func (e *Engine) policiesDistinct(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.DistinctRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.DistinctRequest{Collection: policyCollection(f)}, nil
+}
+
+func (e *Engine) policiesGetMany(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.GetManyRequest, error) {
+	p := make(kstorage.Policies, 0)
+
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.GetManyRequest{
+		Collection: policyCollection(f),
+		Keys:       r.URL.Query()["id"],
+		Value:      &p,
+	}, nil
+}
+
 func (e *Engine) policiesGet(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.GetRequest, error) {
 	var p kstorage.Policy
 
@@ -468,6 +1928,18 @@ func (e *Engine) policiesGet(ctx context.Context, r *http.Request, ps httprouter
 	}, nil
 }
 
+func (e *Engine) policiesExists(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.ExistsRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kstorage.ExistsRequest{
+		Collection: policyCollection(f),
+		Key:        ps.ByName("id"),
+	}, nil
+}
+
 func flavor(ps httprouter.Params) (string, error) {
 	t := ps.ByName("flavor")
 	if !stringslice.Has(EnabledFlavors, t) {
@@ -477,6 +1949,86 @@ func flavor(ps httprouter.Params) (string, error) {
 	return t, nil
 }
 
+func (e *Engine) policiesAllowed(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.AllowedRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	var i Input
+	if err := decodeBody(r, &i, "access request", true); err != nil {
+		return nil, err
+	}
+
+	return &kstorage.AllowedRequest{
+		Collection:     policyCollection(f),
+		Subject:        i.Subject,
+		Action:         i.Action,
+		Resource:       i.Resource,
+		Context:        i.Context,
+		RoleCollection: roleCollection(f),
+		Flavor:         f,
+	}, nil
+}
+
+func (e *Engine) policiesAllowedBatch(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.AllowedBatchRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	var is []Input
+	if err := decodeBody(r, &is, "access requests", true); err != nil {
+		return nil, err
+	}
+
+	requests := make([]kstorage.AccessRequest, len(is))
+	for k, i := range is {
+		requests[k] = kstorage.AccessRequest{Subject: i.Subject, Action: i.Action, Resource: i.Resource, Context: i.Context}
+	}
+
+	return &kstorage.AllowedBatchRequest{
+		Collection:     policyCollection(f),
+		Requests:       requests,
+		RoleCollection: roleCollection(f),
+		Flavor:         f,
+	}, nil
+}
+
+func (e *Engine) policiesTest(ctx context.Context, r *http.Request, ps httprouter.Params) (*kstorage.TestRequest, error) {
+	f, err := flavor(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	var i TestInput
+	if err := decodeBody(r, &i, "access request", true); err != nil {
+		return nil, err
+	}
+
+	for k := range i.Policies {
+		vp, err := validatePolicy(i.Policies[k], true)
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("Policy at index %d is invalid: %s", k, err).
+				WithDetail("index", k).
+				WithDetail("key", i.Policies[k].ID))
+		}
+		i.Policies[k] = vp
+	}
+
+	return &kstorage.TestRequest{
+		Collection:     policyCollection(f),
+		Subject:        i.Subject,
+		Action:         i.Action,
+		Resource:       i.Resource,
+		Context:        i.Context,
+		Policies:       i.Policies,
+		RoleCollection: roleCollection(f),
+		Flavor:         f,
+	}, nil
+}
+
 func (e *Engine) eval(ctx context.Context, r *http.Request, ps httprouter.Params) ([]func(*rego.Rego), error) {
 	f, err := flavor(ps)
 	if err != nil {
@@ -1,20 +1,274 @@
 package ladon
 
 import (
-	"github.com/go-errors/errors"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
 
 	kstorage "github.com/ory/keto/storage"
 )
 
-func validatePolicy(p kstorage.Policy) (kstorage.Policy, error) {
+func validatePolicy(p kstorage.Policy, force bool) (kstorage.Policy, error) {
 	if len(p.ID) == 0 {
 		p.ID = uuid.New()
 	}
 
-	if p.Effect != "allow" && p.Effect != "deny" {
-		return kstorage.Policy{}, errors.Errorf("invalid policy effect %s, only allow and deny are supported", p.Effect)
+	if err := p.Validate(force); err != nil {
+		return kstorage.Policy{}, err
 	}
 
 	return p, nil
 }
+
+// forceParam parses the query parameter "force" which allows to store policies that would never match.
+func forceParam(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("force")
+	if v == "" {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "force" must be a boolean but got "%s".`, v))
+	}
+	return force, nil
+}
+
+// decodeBody decodes the JSON request body into v. If strict is true, unknown fields are rejected. A malformed body
+// results in a bad request error whose reason and details name the byte offset and, for a value of the wrong type or
+// an unknown field, the path of the field. name describes the body in the reason, for example "role".
+func decodeBody(r *http.Request, v interface{}, name string, strict bool) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return decodeError(name, err, len(b))
+	}
+	return nil
+}
+
+// decodeValidBody is like decodeBody but also checks the body against the validator, unless it is nil. If many is
+// true, the body is an array and each element is checked on its own. Violations result in a bad request error whose
+// details list them, and for an array, the index of the first violating element.
+func decodeValidBody(r *http.Request, v interface{}, name string, strict bool, validator kstorage.Validator, many bool) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err := decodeBody(r, v, name, strict); err != nil || validator == nil {
+		return err
+	}
+
+	if !many {
+		return validateDocument(validator, name, b, nil)
+	}
+
+	var docs []json.RawMessage
+	if err := json.Unmarshal(b, &docs); err != nil {
+		return errors.WithStack(err)
+	}
+	for k := range docs {
+		index := k
+		if err := validateDocument(validator, name, docs[k], &index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeValidDocument checks a document which was not read from the request body, like the result of a patch, against
+// the validator, unless it is nil, and decodes it into v. Unknown fields are rejected because the document is stored
+// as it is rather than re-encoded from v.
+func decodeValidDocument(doc []byte, v interface{}, name string, validator kstorage.Validator) error {
+	if validator != nil {
+		if err := validateDocument(validator, name, doc, nil); err != nil {
+			return err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(name, err, len(doc))
+	}
+	return nil
+}
+
+// validateDocument checks the document against the validator. index is the position of the document in a bulk
+// request, if any.
+func validateDocument(validator kstorage.Validator, name string, doc []byte, index *int) error {
+	violations, err := validator.Validate(doc)
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+
+	e := herodot.ErrBadRequest.WithDetail("violations", violations)
+	if index != nil {
+		e = e.WithReasonf("The entry at index %d of the %s violates the schema: %s", *index, name, describeViolations(violations)).
+			WithDetail("index", *index)
+	} else {
+		e = e.WithReasonf("The %s violates the schema: %s", name, describeViolations(violations))
+	}
+	return errors.WithStack(e)
+}
+
+// validateLine checks a line of an import against the validator, unless it is nil.
+func validateLine(validator kstorage.Validator, line json.RawMessage) error {
+	if validator == nil {
+		return nil
+	}
+
+	violations, err := validator.Validate(line)
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+	return errors.Errorf("the entry violates the schema: %s", describeViolations(violations))
+}
+
+func describeViolations(violations []kstorage.Violation) string {
+	messages := make([]string, len(violations))
+	for k, v := range violations {
+		messages[k] = fmt.Sprintf(`"%s": %s`, v.Path, v.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeError converts an error of decoding a body of the given length into a bad request error.
+func decodeError(name string, err error, length int) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == io.EOF:
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode %s: the body is empty.", name))
+	case err == io.ErrUnexpectedEOF:
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("Unable to decode %s: the body ends unexpectedly at byte %d.", name, length).
+			WithDetail("offset", length))
+	case errors.As(err, &syntaxErr):
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf("Unable to decode %s: %s at byte %d.", name, syntaxErr, syntaxErr.Offset).
+			WithDetail("offset", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("Unable to decode %s: the body must be of type %s but got %s at byte %d.", name, typeErr.Type, typeErr.Value, typeErr.Offset).
+				WithDetail("offset", typeErr.Offset))
+		}
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Unable to decode %s: field "%s" must be of type %s but got %s at byte %d.`, name, typeErr.Field, typeErr.Type, typeErr.Value, typeErr.Offset).
+			WithDetail("offset", typeErr.Offset).
+			WithDetail("field", typeErr.Field))
+	case strings.HasPrefix(err.Error(), `json: unknown field "`):
+		// the decoder has no error type for unknown fields, so the field is taken from the message.
+		field := strings.TrimSuffix(strings.TrimPrefix(err.Error(), `json: unknown field "`), `"`)
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Unable to decode %s: field "%s" is unknown.`, name, field).
+			WithDetail("field", field))
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode %s: %s", name, err))
+}
+
+// decodePatch decodes a JSON Merge Patch from the request body. The patch must not change the ID.
+func decodePatch(r *http.Request, id string) (map[string]interface{}, error) {
+	var patch map[string]interface{}
+	if err := decodeBody(r, &patch, "JSON Merge Patch", false); err != nil {
+		return nil, err
+	}
+
+	if v, ok := patch["id"]; ok && v != id {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The ID can not be changed by a patch."))
+	}
+
+	return patch, nil
+}
+
+// decodeKeys decodes a JSON array of IDs from the request body. An empty body is an empty list.
+func decodeKeys(r *http.Request) ([]string, error) {
+	var keys []string
+	if err := json.NewDecoder(r.Body).Decode(&keys); err != nil && err != io.EOF {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode IDs: %s", err))
+	}
+	return keys, nil
+}
+
+// validateNewKey checks the new ID of a rename like the ID of an upserted entry. It must not be empty or begin or end
+// with whitespace, and the stored entry with the new ID must pass the validator, unless it is nil, so that a schema
+// which restricts the IDs applies to renames as well. A missing entry is left to the rename, which responds with 404.
+func (e *Engine) validateNewKey(ctx context.Context, collection, key, newKey, name string, validator kstorage.Validator) error {
+	if strings.TrimSpace(newKey) == "" {
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`The %s "%s" can not be renamed to an empty ID.`, name, key).
+			WithDetail("key", key))
+	}
+	if strings.TrimSpace(newKey) != newKey {
+		return errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`The %s "%s" can not be renamed to "%s" because the ID begins or ends with whitespace.`, name, key, newKey).
+			WithDetail("key", key))
+	}
+	if validator == nil {
+		return nil
+	}
+
+	var doc map[string]interface{}
+	if err := e.s.Get(ctx, collection, key, &doc); errors.Is(err, kstorage.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	doc["id"] = newKey
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return validateDocument(validator, name, b, nil)
+}
+
+// decodeNewKey decodes the new ID of a rename from a body like {"id": "new-id"}.
+func decodeNewKey(r *http.Request) (string, error) {
+	var body struct {
+		ID string `json:"id"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the new ID: %s", err))
+	}
+	return body.ID, nil
+}
+
+// importMode returns the query parameter "mode" of an import, which defaults to merging.
+func importMode(r *http.Request) string {
+	if mode := r.URL.Query().Get("mode"); mode != "" {
+		return mode
+	}
+	return kstorage.ImportModeMerge
+}
+
+// decodeLine decodes a single line of an import. Unknown fields are rejected.
+func decodeLine(line json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	return errors.WithStack(dec.Decode(v))
+}
+
+// errMissingID is returned for imported entries without an ID, as they could not be matched with their original.
+var errMissingID = errors.New("the ID is missing")
@@ -1,10 +1,20 @@
 package ladon
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ory/x/logrusx"
 
@@ -90,17 +100,26 @@ func TestAllowed(t *testing.T) {
 }
 
 func TestValidatePolicy(t *testing.T) {
-	_, err := validatePolicy(kstorage.Policy{})
+	_, err := validatePolicy(kstorage.Policy{}, false)
 	require.Error(t, err)
 
-	_, err = validatePolicy(kstorage.Policy{Effect: "bar"})
+	_, err = validatePolicy(kstorage.Policy{Effect: "bar"}, false)
 	require.Error(t, err)
 
-	p, err := validatePolicy(kstorage.Policy{Effect: "allow"})
+	_, err = validatePolicy(kstorage.Policy{Effect: "alow", Subjects: []string{"s"}, Resources: []string{"r"}, Actions: []string{"a"}}, true)
+	require.Error(t, err)
+
+	_, err = validatePolicy(kstorage.Policy{Effect: "allow"}, false)
+	require.Error(t, err)
+
+	_, err = validatePolicy(kstorage.Policy{Effect: "allow", Subjects: []string{"s"}, Resources: []string{"r"}}, false)
+	require.Error(t, err)
+
+	p, err := validatePolicy(kstorage.Policy{Effect: "allow"}, true)
 	require.NoError(t, err)
 	assert.NotEmpty(t, p.ID)
 
-	p, err = validatePolicy(kstorage.Policy{Effect: "deny", ID: "foo"})
+	p, err = validatePolicy(kstorage.Policy{Effect: "deny", ID: "foo", Subjects: []string{"s"}, Resources: []string{"r"}, Actions: []string{"a"}}, false)
 	require.NoError(t, err)
 	assert.Equal(t, "foo", p.ID)
 }
@@ -235,7 +254,12 @@ func TestPolicyCRUD(t *testing.T) {
 			}
 
 			if len(policies[f]) > 0 {
-				assert.Equal(t, ps, kstorage.Policies{policies[f][0]})
+				expected := kstorage.Policies{policies[f][0]}
+				if f == "regex" {
+					// the resource pattern "<.*>" of the second policy matches any resource.
+					expected = append(expected, policies[f][1])
+				}
+				assert.Equal(t, expected, ps)
 			}
 		}
 
@@ -324,3 +348,2030 @@ func TestRoleCRUD(t *testing.T) {
 		}
 	}
 }
+
+func TestBulkUpsert(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, f := range EnabledFlavors {
+		t.Run(fmt.Sprintf("flavor=%s", f), func(t *testing.T) {
+			var body bytes.Buffer
+			require.NoError(t, json.NewEncoder(&body).Encode(policies[f]))
+			req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/"+f+"/bulk/policies", &body)
+			require.NoError(t, err)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			limit, offset := int64(100), int64(0)
+			os, err := c.Engines.ListOryAccessControlPolicies(engines.NewListOryAccessControlPoliciesParams().WithFlavor(f).WithLimit(&limit).WithOffset(&offset))
+			require.NoError(t, err)
+			assert.Len(t, os.Payload, len(policies[f]))
+
+			req, err = http.NewRequest("PUT", ts.URL+"/engines/acp/ory/"+f+"/bulk/policies", bytes.NewBufferString(`[{"id":"new","effect":"allow"},{"id":"invalid","effect":"maybe"}]`))
+			require.NoError(t, err)
+			res, err = ts.Client().Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			_, err = c.Engines.GetOryAccessControlPolicy(engines.NewGetOryAccessControlPolicyParams().WithFlavor(f).WithID("new"))
+			require.Error(t, err)
+
+			req, err = http.NewRequest("PUT", ts.URL+"/engines/acp/ory/"+f+"/bulk/roles", bytes.NewBufferString(`[{"id":"bulk-role","members":["ken"]}]`))
+			require.NoError(t, err)
+			res, err = ts.Client().Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			o, err := c.Engines.GetOryAccessControlPolicyRole(engines.NewGetOryAccessControlPolicyRoleParams().WithFlavor(f).WithID("bulk-role"))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ken"}, o.Payload.Members)
+		})
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	do := func(t *testing.T, path, body string) (*http.Response, string) {
+		req, err := http.NewRequest("DELETE", ts.URL+"/engines/acp/ory/exact/bulk/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+
+	for _, id := range []string{"bulk-delete-1", "bulk-delete-2", "bulk-delete-3"} {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{ID: id})))
+		require.NoError(t, err)
+	}
+
+	res, _ := do(t, "roles", `[]`)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res, _ = do(t, "roles", `{}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, body := do(t, "roles?report=true", `["bulk-delete-1","bulk-delete-2","unknown"]`)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"deleted":2}`, body)
+
+	res, _ = do(t, "roles", `["bulk-delete-1","bulk-delete-3"]`)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	limit, offset := int64(100), int64(0)
+	rs, err := c.Engines.ListOryAccessControlPolicyRoles(engines.NewListOryAccessControlPolicyRolesParams().WithFlavor("exact").WithLimit(&limit).WithOffset(&offset))
+	require.NoError(t, err)
+	assert.Len(t, rs.Payload, 0)
+
+	res, body = do(t, "policies?report=true", `["unknown"]`)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"deleted":0}`, body)
+}
+
+func TestClear(t *testing.T) {
+	do := func(t *testing.T, ts *httptest.Server, path string) (*http.Response, string) {
+		req, err := http.NewRequest("DELETE", ts.URL+"/engines/acp/ory/exact/clear/"+path, nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+
+	s := kstorage.NewMemoryManager()
+	ctx := context.Background()
+	for _, id := range []string{"clear-1", "clear-2"} {
+		require.NoError(t, s.Upsert(ctx, roleCollection("exact"), id, &kstorage.Role{ID: id}))
+	}
+	require.NoError(t, s.Upsert(ctx, roleCollection("glob"), "clear-glob", &kstorage.Role{ID: "clear-glob"}))
+
+	t.Run("case=disabled by default", func(t *testing.T) {
+		ts := crudts()
+		defer ts.Close()
+
+		res, _ := do(t, ts, "roles")
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("case=enabled", func(t *testing.T) {
+		sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), kstorage.WithDestructiveOperations(true))
+		r := httprouter.New()
+		NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		res, body := do(t, ts, "roles")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.JSONEq(t, `{"deleted":2}`, body)
+
+		n, err := s.Count(ctx, roleCollection("exact"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		n, err = s.Count(ctx, roleCollection("glob"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		res, body = do(t, ts, "policies")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.JSONEq(t, `{"deleted":0}`, body)
+	})
+}
+
+func TestExport(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	export := func(t *testing.T, path string) (*http.Response, []string) {
+		res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/glob/export/" + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var lines []string
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		require.NoError(t, s.Err())
+		return res, lines
+	}
+
+	res, lines := export(t, "roles")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, lines)
+
+	roles := kstorage.Roles{{ID: "export-1", Members: []string{"a"}}, {ID: "export-2", Members: []string{"export-1"}}}
+	for _, r := range roles {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("glob").WithBody(toSwaggerRole(r)))
+		require.NoError(t, err)
+	}
+	p := kstorage.Policy{ID: "export", Subjects: []string{"export-2"}, Resources: []string{"r"}, Actions: []string{"a"}, Effect: "allow"}
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("glob").WithBody(toSwaggerPolicy(p)))
+	require.NoError(t, err)
+
+	res, lines = export(t, "roles")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=glob-roles.jsonl`, res.Header.Get("Content-Disposition"))
+	require.Len(t, lines, 2)
+	for k, l := range lines {
+		var r kstorage.Role
+		require.NoError(t, json.Unmarshal([]byte(l), &r))
+		assert.Equal(t, roles[k], r)
+	}
+
+	res, lines = export(t, "policies")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Len(t, lines, 1)
+	var exported kstorage.Policy
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &exported))
+	assert.Equal(t, p, exported)
+}
+
+func TestImport(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	imp := func(t *testing.T, path, body string) (*http.Response, string) {
+		res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/import/"+path, "application/x-ndjson", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+	list := func(t *testing.T) []string {
+		limit, offset := int64(100), int64(0)
+		rs, err := c.Engines.ListOryAccessControlPolicyRoles(engines.NewListOryAccessControlPolicyRolesParams().WithFlavor("exact").WithLimit(&limit).WithOffset(&offset))
+		require.NoError(t, err)
+		var ids []string
+		for _, r := range rs.Payload {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{ID: "import-0"})))
+	require.NoError(t, err)
+
+	res, body := imp(t, "roles", "{\"id\":\"import-1\",\"members\":[\"a\"]}\n\n{\"id\":\"import-2\"}\n")
+	require.Equal(t, http.StatusOK, res.StatusCode, body)
+	assert.JSONEq(t, `{"imported":2}`, body)
+	assert.Equal(t, []string{"import-0", "import-1", "import-2"}, list(t))
+
+	for k, tc := range []struct {
+		path, body string
+		line       int
+	}{
+		{path: "roles", body: "{\"id\":\"import-3\"}\n{\"id\":", line: 2},
+		{path: "roles", body: "{\"id\":\"import-3\"}\n{\"members\":[]}", line: 2},
+		{path: "roles", body: "{\"id\":\"import-3\",\"unknown\":1}", line: 1},
+		{path: "roles", body: "{\"id\":\"import-3\"}\n\n{\"id\":\"import-3\"}", line: 3},
+		{path: "policies", body: `{"id":"import","effect":"maybe"}`, line: 1},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, body := imp(t, tc.path+"?mode=replace", tc.body)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+
+			var e struct {
+				Error struct {
+					Details map[string]interface{} `json:"details"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(body), &e))
+			assert.EqualValues(t, tc.line, e.Error.Details["line"])
+		})
+	}
+	assert.Equal(t, []string{"import-0", "import-1", "import-2"}, list(t))
+
+	res, body = imp(t, "roles?mode=unknown", `{"id":"import-3"}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+
+	res, body = imp(t, "roles?mode=replace", `{"id":"import-3"}`)
+	require.Equal(t, http.StatusOK, res.StatusCode, body)
+	assert.Equal(t, []string{"import-3"}, list(t))
+}
+
+func TestPatch(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	patch := func(t *testing.T, path, body string) *http.Response {
+		req, err := http.NewRequest("PATCH", ts.URL+"/engines/acp/ory/exact"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := patch(t, "/policies/patch", `{"description":"foo"}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(kstorage.Policy{
+		ID:        "patch",
+		Subjects:  []string{"alice"},
+		Resources: []string{"articles"},
+		Actions:   []string{"read", "delete"},
+		Effect:    Allow,
+	})))
+	require.NoError(t, err)
+
+	res = patch(t, "/policies/patch", `{"description":"patched","actions":{"add":["write"],"remove":["delete"]},"subjects":["bob"]}`)
+	var p kstorage.Policy
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, kstorage.Policy{
+		ID:          "patch",
+		Description: "patched",
+		Subjects:    []string{"bob"},
+		Resources:   []string{"articles"},
+		Actions:     []string{"read", "write"},
+		Effect:      Allow,
+	}, p)
+
+	// the merged policy is validated like an upserted one.
+	for _, body := range []string{`{"effect":"maybe"}`, `{"id":"other"}`, `{`, `{"subjects":"bob"}`, `{"subjects":[]}`, `{"unknown":true}`} {
+		res = patch(t, "/policies/patch", body)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+	stored, err := c.Engines.GetOryAccessControlPolicy(engines.NewGetOryAccessControlPolicyParams().WithFlavor("exact").WithID("patch"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, stored.Payload.Subjects)
+
+	res = patch(t, "/policies/patch?force=true", `{"subjects":[]}`)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{
+		ID:      "patch",
+		Members: []string{"alice", "bob"},
+	})))
+	require.NoError(t, err)
+
+	res = patch(t, "/roles/patch", `{"members":{"add":["carol"],"remove":["alice"]}}`)
+	var r kstorage.Role
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&r))
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"bob", "carol"}, r.Members)
+
+	for _, body := range []string{`{"members":"bob"}`, `{"members":["bob",""]}`} {
+		res = patch(t, "/roles/patch", body)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+func TestRoleMembers(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	do := func(t *testing.T, method, path string) (*http.Response, kstorage.Role) {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact/roles"+path, nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var r kstorage.Role
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&r))
+		}
+		return res, r
+	}
+
+	res, _ := do(t, "PUT", "/members-role/members/alice")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{
+		ID:      "members-role",
+		Members: []string{"alice"},
+	})))
+	require.NoError(t, err)
+
+	res, r := do(t, "PUT", "/members-role/members/bob")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"alice", "bob"}, r.Members)
+
+	res, r = do(t, "PUT", "/members-role/members/bob")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"alice", "bob"}, r.Members)
+
+	res, r = do(t, "DELETE", "/members-role/members/alice")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"bob"}, r.Members)
+
+	res, _ = do(t, "DELETE", "/members-role/members/alice")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestRoleAncestors(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, r := range []kstorage.Role{
+		{ID: "ancestors-owners", Members: []string{"ancestors-admins"}},
+		{ID: "ancestors-admins", Members: []string{"ancestors-editors"}},
+		{ID: "ancestors-editors", Members: []string{"ancestors-writers", "ancestors-owners"}},
+		{ID: "ancestors-writers", Members: []string{"alice"}},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(r)))
+		require.NoError(t, err)
+	}
+
+	get := func(t *testing.T, id string) (*http.Response, []string) {
+		res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/exact/roles/" + id + "/ancestors")
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var roles kstorage.Roles
+		ids := []string{}
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&roles))
+			for _, r := range roles {
+				ids = append(ids, r.ID)
+			}
+		}
+		return res, ids
+	}
+
+	res, ids := get(t, "ancestors-writers")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"ancestors-editors", "ancestors-admins", "ancestors-owners"}, ids)
+
+	res, ids = get(t, "ancestors-owners")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"ancestors-editors", "ancestors-admins"}, ids)
+
+	res, _ = get(t, "ancestors-unknown")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestListByID(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, id := range []string{"list-id-a", "list-id-b", "list-id-c", "list-id-d"} {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{ID: id, Members: []string{"alice"}})))
+		require.NoError(t, err)
+		_, err = c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(kstorage.Policy{ID: id, Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"})))
+		require.NoError(t, err)
+	}
+
+	for _, collection := range []string{"roles", "policies"} {
+		for _, tc := range []struct {
+			query string
+			total string
+			ids   []string
+		}{
+			{query: "id=list-id-c&id=list-id-a", total: "2", ids: []string{"list-id-a", "list-id-c"}},
+			{query: "id=list-id-b,list-id-d,list-id-unknown", total: "2", ids: []string{"list-id-b", "list-id-d"}},
+			{query: "id=list-id-d&id=list-id-a&id=list-id-b&limit=2", total: "3", ids: []string{"list-id-a", "list-id-b"}},
+			{query: "id=list-id-unknown", total: "0", ids: []string{}},
+		} {
+			t.Run(collection+"?"+tc.query, func(t *testing.T) {
+				res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/exact/" + collection + "?" + tc.query)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				assert.Equal(t, tc.total, res.Header.Get("X-Total-Count"))
+
+				var entries []struct {
+					ID string `json:"id"`
+				}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&entries))
+				ids := []string{}
+				for _, e := range entries {
+					ids = append(ids, e.ID)
+				}
+				assert.Equal(t, tc.ids, ids)
+			})
+		}
+	}
+}
+
+func TestRolesForMember(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, r := range []kstorage.Role{
+		{ID: "member-of-owners", Members: []string{"member-of-admins"}},
+		{ID: "member-of-admins", Members: []string{"member-of-editors", "alice"}},
+		{ID: "member-of-editors", Members: []string{"member-of-writers", "member-of-owners"}},
+		{ID: "member-of-writers", Members: []string{"alice"}},
+		{ID: "member-of-readers", Members: []string{"bob"}},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(r)))
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		member string
+		code   int
+		ids    []string
+	}{
+		{member: "alice", code: http.StatusOK, ids: []string{"member-of-admins", "member-of-editors", "member-of-owners", "member-of-writers"}},
+		{member: "member-of-owners", code: http.StatusOK, ids: []string{"member-of-admins", "member-of-editors"}},
+		{member: "bob", code: http.StatusOK, ids: []string{"member-of-readers"}},
+		{member: "carol", code: http.StatusOK, ids: []string{}},
+		{member: "", code: http.StatusBadRequest},
+	} {
+		t.Run("member="+tc.member, func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/exact/effective/roles?member=" + tc.member)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			if tc.code == http.StatusOK {
+				var ids []string
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&ids))
+				assert.Equal(t, tc.ids, ids)
+			}
+		})
+	}
+}
+
+func TestEffectivePolicies(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("regex").WithBody(toSwaggerRole(kstorage.Role{
+		ID:      "effective-editors",
+		Members: []string{"effective-alice"},
+	})))
+	require.NoError(t, err)
+	for _, p := range []kstorage.Policy{
+		{ID: "effective-allow", Subjects: []string{"effective-editors"}, Resources: []string{"articles"}, Actions: []string{"read", "delete"}, Effect: "allow"},
+		{ID: "effective-deny", Subjects: []string{"effective-<.*>"}, Resources: []string{"articles"}, Actions: []string{"delete"}, Effect: "deny"},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("regex").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/regex/effective/policies?subject=effective-alice")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var e kstorage.EffectivePolicies
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+	assert.Equal(t, []string{"effective-editors"}, e.Roles)
+	assert.True(t, e.Permissions["articles"]["read"].Allowed)
+	assert.False(t, e.Permissions["articles"]["delete"].Allowed)
+	assert.Equal(t, []string{"effective-deny"}, e.Permissions["articles"]["delete"].DeniedBy)
+
+	res, err = ts.Client().Get(ts.URL + "/engines/acp/ory/regex/effective/policies")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestMatchCount(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, p := range []kstorage.Policy{
+		{ID: "match-allow", Subjects: []string{"match-alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow},
+		{ID: "match-deny", Subjects: []string{"match-<.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Deny},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("regex").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/regex/matches/policies?subject=match-alice&action=read&resource=articles&verbose=true")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var m kstorage.MatchCount
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&m))
+	assert.Equal(t, kstorage.MatchCount{Allow: 1, Deny: 1, AllowedBy: []string{"match-allow"}, DeniedBy: []string{"match-deny"}}, m)
+
+	res, err = ts.Client().Get(ts.URL + "/engines/acp/ory/regex/matches/policies?subject=match-alice")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestDistinct(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, p := range []kstorage.Policy{
+		{ID: "distinct-1", Subjects: []string{"bob", "alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow},
+		{ID: "distinct-2", Subjects: []string{"alice"}, Resources: []string{"articles:*"}, Actions: []string{"read", "write"}, Effect: Deny},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("glob").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	for k, tc := range []struct {
+		query  string
+		code   int
+		values []string
+	}{
+		{query: "?field=subject", code: http.StatusOK, values: []string{"alice", "bob"}},
+		{query: "?field=resource", code: http.StatusOK, values: []string{"articles", "articles:*"}},
+		{query: "?field=action&limit=1&offset=1", code: http.StatusOK, values: []string{"write"}},
+		{query: "?field=effect", code: http.StatusBadRequest},
+		{query: "", code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/glob/distinct/policies" + tc.query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var values []string
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&values))
+			assert.Equal(t, tc.values, values)
+		})
+	}
+}
+
+func TestDecisions(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, p := range []kstorage.Policy{
+		{ID: "decisions-allow", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow},
+		{ID: "decisions-deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Deny},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	for k, tc := range []struct {
+		body     string
+		code     int
+		allowed  bool
+		fallback bool
+	}{
+		{body: `{"subject":"alice","action":"read","resource":"articles"}`, code: http.StatusOK, allowed: true},
+		{body: `{"subject":"bob","action":"read","resource":"articles"}`, code: http.StatusForbidden},
+		{body: `{"subject":"carol","action":"read","resource":"articles"}`, code: http.StatusForbidden, fallback: true},
+		{body: `{"subject":"alice","action":"read","resource":"articles","foo":"bar"}`, code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/decisions", "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			if tc.code != http.StatusBadRequest {
+				var d kstorage.AllowedResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+				assert.Equal(t, tc.allowed, d.Allowed)
+				assert.Equal(t, tc.fallback, d.Default)
+			}
+		})
+	}
+}
+
+func TestDecisionsExplain(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, p := range []kstorage.Policy{
+		{ID: "explain-allow", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow},
+		{ID: "explain-deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Deny},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("glob").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	for k, tc := range []struct {
+		query     string
+		body      string
+		code      int
+		decidedBy []string
+		matched   []string
+	}{
+		{query: "?explain=true", body: `{"subject":"alice","action":"read","resource":"articles"}`, code: http.StatusOK, decidedBy: []string{"explain-allow"}, matched: []string{"explain-allow"}},
+		{query: "?explain=true", body: `{"subject":"bob","action":"read","resource":"articles"}`, code: http.StatusForbidden, decidedBy: []string{"explain-deny"}, matched: []string{"explain-allow", "explain-deny"}},
+		{query: "?explain=true", body: `{"subject":"carol","action":"read","resource":"articles"}`, code: http.StatusForbidden, decidedBy: []string{}, matched: []string{}},
+		{query: "?explain=false", body: `{"subject":"alice","action":"read","resource":"articles"}`, code: http.StatusOK},
+		{query: "", body: `{"subject":"bob","action":"read","resource":"articles"}`, code: http.StatusForbidden},
+		{query: "?explain=maybe", body: `{"subject":"alice","action":"read","resource":"articles"}`, code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/glob/decisions"+tc.query, "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code == http.StatusBadRequest {
+				return
+			}
+
+			var d kstorage.AllowedResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+			if tc.decidedBy == nil {
+				assert.Nil(t, d.Trace)
+				return
+			}
+
+			require.NotNil(t, d.Trace)
+			assert.Equal(t, d.Allowed, d.Trace.Allowed)
+			assert.Equal(t, tc.decidedBy, d.Trace.DecidedBy)
+			assert.Len(t, d.Trace.Policies, 2)
+			matched := []string{}
+			for _, p := range d.Trace.Policies {
+				if p.Matched {
+					matched = append(matched, p.ID)
+				}
+			}
+			assert.Equal(t, tc.matched, matched)
+		})
+	}
+}
+
+func TestDecisionsConditions(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(
+		kstorage.Policy{ID: "office", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow,
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}}})))
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		body string
+		code int
+	}{
+		{body: `{"subject":"alice","action":"read","resource":"articles","context":{"ip":"10.0.0.1"}}`, code: http.StatusOK},
+		{body: `{"subject":"alice","action":"read","resource":"articles","context":{"ip":"192.168.0.1"}}`, code: http.StatusForbidden},
+		{body: `{"subject":"alice","action":"read","resource":"articles"}`, code: http.StatusForbidden},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/decisions", "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.code, res.StatusCode)
+		})
+	}
+}
+
+func TestDecisionsObligations(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	for _, body := range []string{
+		`{"id":"obligations-log","subjects":["<.*>"],"resources":["reports"],"actions":["read"],"effect":"allow","obligations":["log-access"]}`,
+		`{"id":"obligations-mfa","subjects":["bob"],"resources":["reports"],"actions":["read"],"effect":"allow","obligations":["require-mfa","log-access"]}`,
+		`{"id":"obligations-deny","subjects":["carol"],"resources":["reports"],"actions":["read"],"effect":"deny","obligations":["alert"]}`,
+	} {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/regex/policies", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/regex/policies/obligations-mfa")
+	require.NoError(t, err)
+	var p kstorage.Policy
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+	res.Body.Close()
+	assert.Equal(t, []string{"require-mfa", "log-access"}, p.Obligations)
+
+	for _, tc := range []struct {
+		subject  string
+		code     int
+		expected kstorage.AllowedResponse
+	}{
+		{subject: "alice", code: http.StatusOK, expected: kstorage.AllowedResponse{Allowed: true, Obligations: []string{"log-access"}}},
+		{subject: "bob", code: http.StatusOK, expected: kstorage.AllowedResponse{Allowed: true, Obligations: []string{"log-access", "require-mfa"}}},
+		{subject: "carol", code: http.StatusForbidden},
+	} {
+		t.Run("subject="+tc.subject, func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/regex/decisions", "application/json",
+				bytes.NewBufferString(`{"subject":"`+tc.subject+`","action":"read","resource":"reports"}`))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			var d kstorage.AllowedResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+			assert.Equal(t, tc.expected, d)
+		})
+	}
+}
+
+func TestDecisionsFlavors(t *testing.T) {
+	box := packr.NewBox("./rego")
+	compiler, err := engine.NewCompiler(box, logrusx.New("", ""))
+	require.NoError(t, err)
+
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	NewEngine(s, sh, engine.NewEngine(compiler, herodot.NewJSONWriter(nil)), herodot.NewJSONWriter(nil)).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) int {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for _, tc := range []struct {
+		flavor, action, resource string
+		allowed                  bool
+	}{
+		{flavor: "exact", action: "glob", resource: "articles:1"},
+		{flavor: "exact", action: "glob", resource: "articles:*", allowed: true},
+		{flavor: "exact", action: "regex", resource: "articles:1"},
+		{flavor: "exact", action: "regex", resource: "articles:<.*>", allowed: true},
+		{flavor: "glob", action: "glob", resource: "articles:1", allowed: true},
+		{flavor: "glob", action: "regex", resource: "articles:1"},
+		{flavor: "regex", action: "glob", resource: "articles:1"},
+		{flavor: "regex", action: "regex", resource: "articles:1", allowed: true},
+	} {
+		t.Run(fmt.Sprintf("flavor=%s/action=%s/resource=%s", tc.flavor, tc.action, tc.resource), func(t *testing.T) {
+			for _, body := range []string{
+				`{"id":"glob","subjects":["alice"],"resources":["articles:*"],"actions":["glob"],"effect":"allow"}`,
+				`{"id":"regex","subjects":["alice"],"resources":["articles:<.*>"],"actions":["regex"],"effect":"allow"}`,
+			} {
+				require.Equal(t, http.StatusOK, do(t, "PUT", "/engines/acp/ory/"+tc.flavor+"/policies", body))
+			}
+
+			expected := http.StatusForbidden
+			if tc.allowed {
+				expected = http.StatusOK
+			}
+
+			// the decisions match the patterns like the policy engine of the flavor does.
+			body := fmt.Sprintf(`{"subject":"alice","action":"%s","resource":"%s"}`, tc.action, tc.resource)
+			for _, path := range []string{"/allowed", "/decisions"} {
+				assert.Equal(t, expected, do(t, "POST", "/engines/acp/ory/"+tc.flavor+path, body), path)
+			}
+		})
+	}
+}
+
+func TestDecisionsDefaultAllow(t *testing.T) {
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), kstorage.WithDefaultDecision("allow"))
+	r := httprouter.New()
+	NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, s.Upsert(context.Background(), policyCollection("exact"), "deny",
+		&kstorage.Policy{ID: "deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Deny}))
+
+	for k, tc := range []struct {
+		subject  string
+		code     int
+		allowed  bool
+		fallback bool
+	}{
+		{subject: "bob", code: http.StatusForbidden},
+		{subject: "carol", code: http.StatusOK, allowed: true, fallback: true},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/decisions", "application/json",
+				bytes.NewBufferString(`{"subject":"`+tc.subject+`","action":"read","resource":"articles"}`))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			var d kstorage.AllowedResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+			assert.Equal(t, kstorage.AllowedResponse{Allowed: tc.allowed, Default: tc.fallback}, d)
+		})
+	}
+}
+
+func TestDecisionsBatch(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("glob").WithBody(toSwaggerPolicy(
+		kstorage.Policy{ID: "batch", Subjects: []string{"alice"}, Resources: []string{"articles:*"}, Actions: []string{"read"}, Effect: Allow})))
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		body     string
+		code     int
+		expected []kstorage.AllowedResponse
+	}{
+		{
+			body: `[{"subject":"alice","action":"read","resource":"articles:1"},{"subject":"alice","action":"write","resource":"articles:1"}]`,
+			code: http.StatusOK,
+			expected: []kstorage.AllowedResponse{
+				{Allowed: true},
+				{Default: true},
+			},
+		},
+		{body: `[{"subject":"alice","action":"read","resource":"articles:1","foo":"bar"}]`, code: http.StatusBadRequest},
+		{body: `{"subject":"alice","action":"read","resource":"articles:1"}`, code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/glob/decisions/batch", "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var d []kstorage.AllowedResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+			assert.Equal(t, tc.expected, d)
+		})
+	}
+}
+
+func TestDecisionsTest(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(
+		kstorage.Policy{ID: "stored", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow})))
+	require.NoError(t, err)
+
+	for k, tc := range []struct {
+		body     string
+		code     int
+		expected kstorage.Decision
+	}{
+		{
+			body:     `{"subject":"alice","action":"read","resource":"articles"}`,
+			code:     http.StatusOK,
+			expected: kstorage.Decision{Allowed: true, Effect: Allow, AllowedBy: []string{"stored"}, DeniedBy: []string{}, Explanation: "Allowed by stored."},
+		},
+		{
+			body:     `{"subject":"alice","action":"read","resource":"articles","policies":[{"id":"inline","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"deny"}]}`,
+			code:     http.StatusOK,
+			expected: kstorage.Decision{Effect: Deny, AllowedBy: []string{}, DeniedBy: []string{"inline"}, Explanation: "Denied by inline."},
+		},
+		{body: `{"subject":"alice","action":"read","resource":"articles","policies":[{"id":"inline","effect":"maybe"}]}`, code: http.StatusBadRequest},
+		{body: `{"subject":"alice","foo":"bar"}`, code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/decisions/test", "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			if tc.code == http.StatusOK {
+				var d kstorage.Decision
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+				assert.Equal(t, tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestUpsertValidation(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	do := func(t *testing.T, path, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var e struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if res.StatusCode != http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+		}
+		return res.StatusCode, e.Error
+	}
+
+	code, e := do(t, "policies", `{"id":"typo","effect":"alow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, e["reason"], `policy "typo" has invalid effect "alow"`)
+	assert.Equal(t, map[string]interface{}{"key": "typo"}, e["details"])
+
+	code, e = do(t, "policies", `{"id":"empty","effect":"allow","subjects":["s"],"resources":["r"]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, e["reason"], `policy "empty" has no actions`)
+
+	code, _ = do(t, "policies?force=true", `{"id":"empty","effect":"allow","subjects":["s"],"resources":["r"]}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = do(t, "policies?force=true", `{"id":"typo","effect":"alow"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(t, "policies?force=maybe", `{"id":"empty","effect":"allow"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, e = do(t, "bulk/policies", `[{"id":"ok","effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]},{"id":"empty","effect":"deny"}]`)
+	require.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, map[string]interface{}{"index": float64(1), "key": "empty"}, e["details"])
+
+	code, _ = do(t, "bulk/policies?force=true", `[{"id":"ok","effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]},{"id":"empty","effect":"deny"}]`)
+	assert.Equal(t, http.StatusOK, code)
+
+	req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/regex/policies?force=true", bytes.NewBufferString(`{"id":"malformed","effect":"allow","subjects":["<[>"],"resources":["r"],"actions":["a"]}`))
+	require.NoError(t, err)
+	res, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "malformed patterns are rejected even if forced")
+}
+
+func TestSchemaValidation(t *testing.T) {
+	newServer := func(opts ...EngineOption) *httptest.Server {
+		s := kstorage.NewMemoryManager()
+		sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+		r := httprouter.New()
+		NewEngine(s, sh, nil, herodot.NewJSONWriter(nil), opts...).Register(r)
+		return httptest.NewServer(r)
+	}
+
+	do := func(t *testing.T, ts *httptest.Server, method, path, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var e struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if res.StatusCode != http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+		}
+		return res.StatusCode, e.Error
+	}
+
+	t.Run("case=default schemas", func(t *testing.T) {
+		ts := newServer()
+		defer ts.Close()
+
+		code, e := do(t, ts, "PUT", "policies", `{"id":"p","subjects":["alice",null],"resources":["r"],"actions":["a"],"effect":"allow","conditions":{"ip":{"options":{}}}}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], "The policy violates the schema")
+		assert.Contains(t, e["reason"], `"/subjects/1"`)
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"path": "/conditions/ip", "message": "missing properties: \"type\""},
+			map[string]interface{}{"path": "/subjects/1", "message": "expected string, but got null"},
+		}, e["details"].(map[string]interface{})["violations"])
+
+		code, e = do(t, ts, "PUT", "bulk/policies", `[{"id":"ok","subjects":["s"],"resources":["r"],"actions":["a"],"effect":"allow"},{"id":"bad","subjects":["s"],"resources":["r"],"actions":["a"],"effect":"allow","conditions":{"ip":"x"}}]`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], "The entry at index 1 of the policies violates the schema")
+		assert.Equal(t, float64(1), e["details"].(map[string]interface{})["index"])
+
+		code, _ = do(t, ts, "PUT", "roles", `{"id":"r","members":["alice",null]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, e = do(t, ts, "POST", "import/roles", "{\"id\":\"a\"}\n{\"id\":\"b\",\"members\":[null]}\n")
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], "Unable to import line 2: the entry violates the schema")
+
+		code, _ = do(t, ts, "PUT", "policies", `{"id":"p","subjects":["alice"],"resources":["r"],"actions":["a"],"effect":"allow","conditions":{"ip":{"type":"CIDRCondition","options":{"cidr":"10.0.0.0/8"}}}}`)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("case=custom schema", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "role.schema.*.json")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(`{"type":"object","properties":{"id":{"type":"string","pattern":"^team:"}}}`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		v, err := kstorage.NewSchemaValidator(f.Name())
+		require.NoError(t, err)
+		ts := newServer(WithRoleValidator(v))
+		defer ts.Close()
+
+		code, e := do(t, ts, "PUT", "roles", `{"id":"admins","members":["alice"]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], `"/id"`)
+
+		code, _ = do(t, ts, "PUT", "roles", `{"id":"team:admins","members":["alice"]}`)
+		assert.Equal(t, http.StatusOK, code)
+
+		// renames are checked against the schema as well.
+		code, e = do(t, ts, "POST", "roles/team:admins/rename", `{"id":"admins"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], `"/id"`)
+		code, _ = do(t, ts, "POST", "roles/team:admins/rename", `{"id":"team:owners"}`)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("case=disabled", func(t *testing.T) {
+		ts := newServer(WithPolicyValidator(nil))
+		defer ts.Close()
+
+		code, _ := do(t, ts, "PUT", "policies", `{"id":"p","subjects":["alice"],"resources":["r"],"actions":["a"],"effect":"allow","conditions":{"ip":"x"}}`)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestRoleMemberValidation(t *testing.T) {
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	NewEngine(s, sh, nil, herodot.NewJSONWriter(nil), WithMemberFormat(regexp.MustCompile(`^[a-z:]+$`))).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, path, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var e struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if res.StatusCode != http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+		}
+		return res.StatusCode, e.Error
+	}
+
+	members := func(t *testing.T, id string) []string {
+		var ro kstorage.Role
+		require.NoError(t, s.Get(context.Background(), roleCollection("exact"), id, &ro))
+		return ro.Members
+	}
+
+	t.Run("case=members are trimmed and deduplicated", func(t *testing.T) {
+		code, _ := do(t, "roles", `{"id":"trimmed","members":[" alice","bob\t","alice","user:carol "]}`)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"alice", "bob", "user:carol"}, members(t, "trimmed"))
+
+		code, _ = do(t, "roles/trimmed/members", `{"members":["bob"," dave"]}`)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"alice", "bob", "user:carol", "dave"}, members(t, "trimmed"))
+	})
+
+	t.Run("case=empty members are rejected", func(t *testing.T) {
+		for _, body := range []string{`{"id":"empty","members":["alice",""]}`, `{"id":"empty","members":["alice","  "]}`} {
+			code, e := do(t, "roles", body)
+			require.Equal(t, http.StatusBadRequest, code)
+			assert.Contains(t, e["reason"], `role "empty" has the empty member`)
+			assert.Contains(t, e["reason"], `at index 1`)
+			assert.Equal(t, map[string]interface{}{"key": "empty"}, e["details"])
+		}
+
+		code, e := do(t, "bulk/roles", `[{"id":"ok","members":["alice"]},{"id":"empty","members":[" "]}]`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, map[string]interface{}{"index": float64(1), "key": "empty"}, e["details"])
+
+		code, _ = do(t, "roles/trimmed/members", `{"members":[""]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, []string{"alice", "bob", "user:carol", "dave"}, members(t, "trimmed"))
+	})
+
+	t.Run("case=members must match the format", func(t *testing.T) {
+		code, e := do(t, "roles", `{"id":"format","members":["alice","Bob"]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, e["reason"], `role "format" has the member "Bob" at index 1 which does not match the format`)
+	})
+
+	t.Run("case=single members are validated", func(t *testing.T) {
+		code, _ := do(t, "roles/trimmed/members/%20erin%20", "")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"alice", "bob", "user:carol", "dave", "erin"}, members(t, "trimmed"))
+
+		for _, member := range []string{"%20", "Frank"} {
+			code, e := do(t, "roles/trimmed/members/"+member, "")
+			require.Equal(t, http.StatusBadRequest, code, member)
+			assert.Equal(t, map[string]interface{}{"key": "trimmed"}, e["details"])
+		}
+		assert.Equal(t, []string{"alice", "bob", "user:carol", "dave", "erin"}, members(t, "trimmed"))
+	})
+}
+
+// slowManager delays the return of reads, so that concurrent read-modify-writes overlap.
+type slowManager struct {
+	kstorage.Manager
+}
+
+func (m *slowManager) Get(ctx context.Context, collection string, key string, value interface{}) error {
+	err := m.Manager.Get(ctx, collection, key, value)
+	time.Sleep(10 * time.Millisecond)
+	return err
+}
+
+func TestConcurrentRoleMembersAdd(t *testing.T) {
+	s := &slowManager{Manager: kstorage.NewMemoryManager()}
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, s.Upsert(context.Background(), roleCollection("exact"), "concurrent", &kstorage.Role{ID: "concurrent"}))
+
+	// every request reads the role and writes it back with its member added, without the lock the writes would race.
+	var wg sync.WaitGroup
+	var expected []string
+	for k := 0; k < 20; k++ {
+		member := fmt.Sprintf("user:%d", k)
+		expected = append(expected, member)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/roles/concurrent/members", bytes.NewBufferString(`{"members":["`+member+`"]}`))
+			require.NoError(t, err)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}()
+	}
+	wg.Wait()
+
+	var ro kstorage.Role
+	require.NoError(t, s.Get(context.Background(), roleCollection("exact"), "concurrent", &ro))
+	assert.ElementsMatch(t, expected, ro.Members)
+}
+
+func TestUpsertDryRun(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, b
+	}
+
+	res, body := do(t, "PUT", "policies?dry_run=true", `{"effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	assert.Equal(t, "true", res.Header.Get("X-Dry-Run"))
+
+	var p kstorage.Policy
+	require.NoError(t, json.Unmarshal(body, &p))
+	assert.NotEmpty(t, p.ID)
+
+	res, _ = do(t, "GET", "policies/"+p.ID, "")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, _ = do(t, "PUT", "roles?dry_run=true", `{"id":"dry","members":["m"]}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = do(t, "GET", "roles/dry", "")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, _ = do(t, "PUT", "policies?dry_run=true", `{"id":"typo","effect":"alow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Dry-Run"))
+
+	res, _ = do(t, "PUT", "policies?dry_run=maybe", `{"effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = do(t, "PUT", "policies", `{"id":"stored","effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get("X-Dry-Run"))
+}
+
+func TestCreate(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact/"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, b
+	}
+
+	t.Run("case=policy", func(t *testing.T) {
+		res, body := do(t, "POST", "policies", `{"id":"create-policy","effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+		require.Equal(t, http.StatusCreated, res.StatusCode, string(body))
+		assert.Equal(t, "/engines/acp/ory/exact/policies/create-policy", res.Header.Get("Location"))
+		assert.NotEmpty(t, res.Header.Get("ETag"))
+
+		res, body = do(t, "POST", "policies", `{"id":"create-policy","effect":"deny","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+		require.Equal(t, http.StatusConflict, res.StatusCode, string(body))
+
+		res, body = do(t, "GET", "policies/create-policy", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var p kstorage.Policy
+		require.NoError(t, json.Unmarshal(body, &p))
+		assert.Equal(t, Allow, p.Effect)
+
+		res, _ = do(t, "PUT", "policies", `{"id":"create-policy","effect":"deny","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, _ = do(t, "POST", "policies", `{"id":"create-invalid","effect":"alow","subjects":["s"],"resources":["r"],"actions":["a"]}`)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("case=role", func(t *testing.T) {
+		res, body := do(t, "POST", "roles", `{"id":"create-role","members":["m"]}`)
+		require.Equal(t, http.StatusCreated, res.StatusCode, string(body))
+		assert.Equal(t, "/engines/acp/ory/exact/roles/create-role", res.Header.Get("Location"))
+
+		res, _ = do(t, "POST", "roles", `{"id":"create-role","members":["n"]}`)
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+		res, body = do(t, "GET", "roles/create-role", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var r kstorage.Role
+		require.NoError(t, json.Unmarshal(body, &r))
+		assert.Equal(t, []string{"m"}, r.Members)
+	})
+}
+
+func TestCreatedStatus(t *testing.T) {
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), kstorage.WithCreatedStatus(true))
+	r := httprouter.New()
+	NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		path, body, location string
+		code                 int
+	}{
+		{path: "policies", body: `{"id":"created-policy","effect":"allow","subjects":["s"],"resources":["r"],"actions":["a"]}`, code: http.StatusCreated, location: "/engines/acp/ory/exact/policies/created-policy"},
+		{path: "policies", body: `{"id":"created-policy","effect":"deny","subjects":["s"],"resources":["r"],"actions":["a"]}`, code: http.StatusOK},
+		{path: "roles", body: `{"id":"created-role","members":["m"]}`, code: http.StatusCreated, location: "/engines/acp/ory/exact/roles/created-role"},
+		{path: "roles", body: `{"id":"created-role","members":["n"]}`, code: http.StatusOK},
+		{path: "roles/created-members/members", body: `{"members":["m"]}`, code: http.StatusCreated, location: "/engines/acp/ory/exact/roles/created-members"},
+		{path: "roles/created-members/members", body: `{"members":["n"]}`, code: http.StatusOK},
+	} {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/"+tc.path, bytes.NewBufferString(tc.body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, tc.code, res.StatusCode, "%s %s: %s", tc.path, tc.body, body)
+		assert.Equal(t, tc.location, res.Header.Get("Location"), "%s %s", tc.path, tc.body)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		method  string
+		path    string
+		body    string
+		reason  string
+		details map[string]interface{}
+	}{
+		{
+			method:  "PUT",
+			path:    "policies",
+			body:    `{"id":"p1","subjects":["alice"`,
+			reason:  "Unable to decode policy: the body ends unexpectedly at byte 30.",
+			details: map[string]interface{}{"offset": float64(30)},
+		},
+		{
+			method:  "PUT",
+			path:    "roles",
+			body:    `{"id":"r1",}`,
+			reason:  "Unable to decode role: invalid character '}' looking for beginning of object key string at byte 12.",
+			details: map[string]interface{}{"offset": float64(12)},
+		},
+		{
+			method:  "PUT",
+			path:    "roles",
+			body:    `{"id":"r1","members":"alice"}`,
+			reason:  `Unable to decode role: field "members" must be of type []string but got string at byte 28.`,
+			details: map[string]interface{}{"offset": float64(28), "field": "members"},
+		},
+		{
+			method:  "PUT",
+			path:    "bulk/policies",
+			body:    `[{"id":"p1"},{"id":"p2","subjects":[1]}]`,
+			reason:  `Unable to decode policies: field "1.subjects.0" must be of type string but got number at byte 37.`,
+			details: map[string]interface{}{"offset": float64(37), "field": "1.subjects.0"},
+		},
+		{
+			method:  "PUT",
+			path:    "policies",
+			body:    `"p1"`,
+			reason:  "Unable to decode policy: the body must be of type storage.Policy but got string at byte 4.",
+			details: map[string]interface{}{"offset": float64(4)},
+		},
+		{
+			method: "PUT",
+			path:   "roles",
+			body:   ``,
+			reason: "Unable to decode role: the body is empty.",
+		},
+		{
+			method:  "POST",
+			path:    "decisions",
+			body:    `{"subject":"alice","verb":"read"}`,
+			reason:  `Unable to decode access request: field "verb" is unknown.`,
+			details: map[string]interface{}{"field": "verb"},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+"/engines/acp/ory/exact/"+tc.path, bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			var body struct {
+				Error struct {
+					Reason  string                 `json:"reason"`
+					Details map[string]interface{} `json:"details"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, tc.reason, body.Error.Reason)
+			assert.Equal(t, tc.details, body.Error.Details)
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	const (
+		policy = `{"id":"p","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow"}`
+		role   = `{"id":"r","members":["alice"]}`
+	)
+
+	newServer := func(opts ...kstorage.HandlerOption) (*httptest.Server, kstorage.Manager) {
+		s := kstorage.NewMemoryManager()
+		sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), append(opts, kstorage.WithDestructiveOperations(true))...)
+		r := httprouter.New()
+		NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+		return httptest.NewServer(r), s
+	}
+
+	do := func(t *testing.T, ts *httptest.Server, method, path, contentType, body string) int {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	type request struct{ method, path, contentType, body string }
+	policyWrites := []request{
+		{method: "PUT", path: "/policies", body: policy},
+		{method: "POST", path: "/policies", body: policy},
+		{method: "PUT", path: "/bulk/policies", body: "[" + policy + "]"},
+		{method: "PATCH", path: "/policies/p", body: `{"description":"foo"}`},
+		{method: "DELETE", path: "/policies/p"},
+		{method: "DELETE", path: "/bulk/policies", body: `["p"]`},
+		{method: "DELETE", path: "/clear/policies"},
+		{method: "POST", path: "/import/policies", body: "[" + policy + "]"},
+		{method: "POST", path: "/policies/p/restore"},
+	}
+	roleWrites := []request{
+		{method: "PUT", path: "/roles", body: role},
+		{method: "PUT", path: "/bulk/roles", body: "[" + role + "]"},
+		{method: "PUT", path: "/roles/r/members/bob"},
+		{method: "DELETE", path: "/roles/r/members/alice"},
+		{method: "DELETE", path: "/roles/r"},
+	}
+	reads := []request{
+		{method: "GET", path: "/policies/p"},
+		{method: "GET", path: "/policies"},
+		{method: "GET", path: "/roles/r"},
+		{method: "GET", path: "/roles"},
+		{method: "POST", path: "/decisions", body: `{"subject":"alice","action":"read","resource":"articles"}`},
+	}
+
+	seed := func(t *testing.T, s kstorage.Manager) {
+		require.NoError(t, s.Upsert(context.Background(), policyCollection("exact"), "p", &kstorage.Policy{ID: "p", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: Allow}))
+		require.NoError(t, s.Upsert(context.Background(), roleCollection("exact"), "r", &kstorage.Role{ID: "r", Members: []string{"alice"}}))
+	}
+
+	t.Run("case=read-only server", func(t *testing.T) {
+		ts, s := newServer(kstorage.WithReadOnly(true))
+		defer ts.Close()
+		seed(t, s)
+
+		for _, w := range append(policyWrites, roleWrites...) {
+			assert.Equal(t, http.StatusMethodNotAllowed, do(t, ts, w.method, w.path, w.contentType, w.body), "%s %s", w.method, w.path)
+		}
+		for _, rd := range reads {
+			assert.Equal(t, http.StatusOK, do(t, ts, rd.method, rd.path, rd.contentType, rd.body), "%s %s", rd.method, rd.path)
+		}
+	})
+
+	t.Run("case=read-only roles", func(t *testing.T) {
+		ts, s := newServer(kstorage.WithReadOnlyCollections("roles"))
+		defer ts.Close()
+		seed(t, s)
+
+		for _, w := range roleWrites {
+			assert.Equal(t, http.StatusMethodNotAllowed, do(t, ts, w.method, w.path, w.contentType, w.body), "%s %s", w.method, w.path)
+		}
+		assert.Equal(t, http.StatusOK, do(t, ts, "PUT", "/policies", "", policy))
+		for _, rd := range reads {
+			assert.Equal(t, http.StatusOK, do(t, ts, rd.method, rd.path, rd.contentType, rd.body), "%s %s", rd.method, rd.path)
+		}
+	})
+}
+
+func TestTimestamps(t *testing.T) {
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), kstorage.WithTimestamps(true))
+	r := httprouter.New()
+	NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string, v interface{}) {
+		req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact"+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		if v != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+		}
+	}
+
+	const policy = `{"id":"%s","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow","description":"%s"}`
+	do(t, "PUT", "/policies", fmt.Sprintf(policy, "a", "first"), nil)
+
+	var first kstorage.Policy
+	do(t, "GET", "/policies/a", "", &first)
+	require.NotNil(t, first.CreatedAt)
+	require.NotNil(t, first.UpdatedAt)
+	assert.Equal(t, *first.CreatedAt, *first.UpdatedAt)
+
+	time.Sleep(10 * time.Millisecond)
+	do(t, "PUT", "/policies", fmt.Sprintf(policy, "b", "other"), nil)
+	// timestamps sent by clients are ignored.
+	do(t, "PUT", "/policies", `{"id":"a","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow","created_at":"2000-01-01T00:00:00Z"}`, nil)
+
+	var second kstorage.Policy
+	do(t, "GET", "/policies/a", "", &second)
+	require.NotNil(t, second.CreatedAt)
+	require.NotNil(t, second.UpdatedAt)
+	assert.True(t, second.CreatedAt.Equal(*first.CreatedAt), "%s != %s", second.CreatedAt, first.CreatedAt)
+	assert.True(t, second.UpdatedAt.After(*first.UpdatedAt), "%s <= %s", second.UpdatedAt, first.UpdatedAt)
+
+	var ps kstorage.Policies
+	do(t, "GET", "/policies?sort=updated_at", "", &ps)
+	require.Len(t, ps, 2)
+	assert.Equal(t, []string{"b", "a"}, []string{ps[0].ID, ps[1].ID})
+	assert.True(t, ps[1].UpdatedAt.Equal(*second.UpdatedAt))
+
+	do(t, "GET", "/policies?sort=created_at", "", &ps)
+	assert.Equal(t, []string{"a", "b"}, []string{ps[0].ID, ps[1].ID})
+
+	var stored map[string]interface{}
+	require.NoError(t, s.Get(context.Background(), policyCollection("exact"), "a", &stored))
+	assert.NotContains(t, stored, "created_at")
+	assert.NotContains(t, stored, "updated_at")
+}
+
+func TestNaming(t *testing.T) {
+	for _, tc := range []struct {
+		naming               string
+		createdAt, effective string
+	}{
+		{naming: kstorage.NamingSnakeCase, createdAt: "created_at", effective: "effective_members"},
+		{naming: kstorage.NamingCamelCase, createdAt: "createdAt", effective: "effectiveMembers"},
+	} {
+		t.Run("naming="+tc.naming, func(t *testing.T) {
+			s := kstorage.NewMemoryManager()
+			sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil), kstorage.WithTimestamps(true), kstorage.WithNaming(tc.naming))
+			r := httprouter.New()
+			NewEngine(s, sh, nil, herodot.NewJSONWriter(nil)).Register(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			do := func(t *testing.T, method, path, body string) []byte {
+				req, err := http.NewRequest(method, ts.URL+"/engines/acp/ory/exact"+path, bytes.NewBufferString(body))
+				require.NoError(t, err)
+				res, err := ts.Client().Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				b, err := ioutil.ReadAll(res.Body)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, res.StatusCode, "%s", b)
+				return b
+			}
+
+			do(t, "PUT", "/roles", `{"id":"r","members":["alice"]}`)
+			got := do(t, "GET", "/roles/r", "")
+
+			var role map[string]interface{}
+			require.NoError(t, json.Unmarshal(got, &role))
+			assert.Contains(t, role, tc.createdAt)
+
+			// the response can be written back as it is, in either convention.
+			role["members"] = []string{"alice", "bob"}
+			b, err := json.Marshal(role)
+			require.NoError(t, err)
+			do(t, "PUT", "/roles", string(b))
+
+			var roles []map[string]interface{}
+			require.NoError(t, json.Unmarshal(do(t, "GET", "/roles?expand=true", ""), &roles))
+			require.Len(t, roles, 1)
+			assert.Equal(t, []interface{}{"alice", "bob"}, roles[0][tc.effective])
+			assert.Equal(t, role[tc.createdAt], roles[0][tc.createdAt])
+
+			const policy = `{"id":"p","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow","conditions":{"remote_ip":{"type":"CIDRCondition","options":{"cidr":"10.0.0.0/8"}}}}`
+			do(t, "PUT", "/policies", policy)
+			var p map[string]interface{}
+			require.NoError(t, json.Unmarshal(do(t, "GET", "/policies/p", ""), &p))
+			assert.Contains(t, p["conditions"], "remote_ip", "the names of conditions are never renamed")
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, id := range []string{"reconcile-a", "reconcile-b", "reconcile-c"} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(kstorage.Policy{ID: id, Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"})))
+		require.NoError(t, err)
+	}
+
+	desired := `[
+		{"id":"reconcile-a","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow"},
+		{"id":"reconcile-b","subjects":["bob"],"resources":["articles"],"actions":["read"],"effect":"allow"},
+		{"id":"reconcile-d","subjects":["dave"],"resources":["articles"],"actions":["read"],"effect":"deny"}
+	]`
+
+	reconcile := func(t *testing.T, query string) (*http.Response, kstorage.ReconcileResponse) {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/reconcile/policies"+query, bytes.NewBufferString(desired))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var rr kstorage.ReconcileResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&rr))
+		return res, rr
+	}
+
+	ids := func(t *testing.T) []string {
+		res, err := c.Engines.ListOryAccessControlPolicies(engines.NewListOryAccessControlPoliciesParams().WithFlavor("exact"))
+		require.NoError(t, err)
+		var ids []string
+		for _, p := range res.Payload {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	res, rr := reconcile(t, "?dry_run=true")
+	assert.Equal(t, "true", res.Header.Get("X-Dry-Run"))
+	assert.Equal(t, kstorage.ReconcileResponse{Created: []string{"reconcile-d"}, Updated: []string{"reconcile-b"}, Deleted: []string{"reconcile-c"}, Unchanged: 1, DryRun: true}, rr)
+	assert.Equal(t, []string{"reconcile-a", "reconcile-b", "reconcile-c"}, ids(t))
+
+	_, rr = reconcile(t, "?prune=true")
+	assert.Equal(t, kstorage.ReconcileResponse{Created: []string{"reconcile-d"}, Updated: []string{"reconcile-b"}, Deleted: []string{"reconcile-c"}, Unchanged: 1}, rr)
+	assert.Equal(t, []string{"reconcile-a", "reconcile-b", "reconcile-d"}, ids(t))
+
+	_, rr = reconcile(t, "")
+	assert.Equal(t, kstorage.ReconcileResponse{Created: []string{}, Updated: []string{}, Deleted: []string{}, Unchanged: 3}, rr)
+}
+
+func TestBulkNotAtomic(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	body := `[
+		{"id":"bulk-valid-a","subjects":["alice"],"resources":["articles"],"actions":["read"],"effect":"allow"},
+		{"id":"bulk-invalid","subjects":["bob"],"resources":["articles"],"actions":["read"],"effect":"maybe"},
+		{"id":"bulk-valid-b","subjects":["carol"],"resources":["articles"],"actions":["read"],"effect":"deny"}
+	]`
+
+	upsert := func(t *testing.T, query string) *http.Response {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/bulk/policies"+query, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := upsert(t, "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = upsert(t, "?atomic=false")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusMultiStatus, res.StatusCode)
+
+	var results []kstorage.BulkResult
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&results))
+	require.Len(t, results, 3)
+	assert.Equal(t, kstorage.BulkResult{Index: 0, Key: "bulk-valid-a", Status: http.StatusOK}, results[0])
+	assert.Equal(t, http.StatusBadRequest, results[1].Status)
+	assert.Contains(t, results[1].Error, "Policy at index 1 is invalid")
+	assert.Equal(t, kstorage.BulkResult{Index: 2, Key: "bulk-valid-b", Status: http.StatusOK}, results[2])
+
+	c := nc(t, ts.URL)
+	for id, code := range map[string]int{"bulk-valid-a": http.StatusOK, "bulk-valid-b": http.StatusOK, "bulk-invalid": http.StatusNotFound} {
+		_, err := c.Engines.GetOryAccessControlPolicy(engines.NewGetOryAccessControlPolicyParams().WithFlavor("exact").WithID(id))
+		if code == http.StatusOK {
+			assert.NoError(t, err, id)
+		} else {
+			assert.Error(t, err, id)
+		}
+	}
+}
+
+func TestPoliciesReferencingRole(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("regex").WithBody(toSwaggerRole(kstorage.Role{ID: "referenced-editors", Members: []string{"alice"}})))
+	require.NoError(t, err)
+	for _, p := range []kstorage.Policy{
+		{ID: "referencing-direct", Subjects: []string{"referenced-editors"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "referencing-pattern", Subjects: []string{"referenced-<.*>"}, Resources: []string{"articles"}, Actions: []string{"update"}, Effect: "allow"},
+		{ID: "referencing-none", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+	} {
+		_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("regex").WithBody(toSwaggerPolicy(p)))
+		require.NoError(t, err)
+	}
+
+	res, err := ts.Client().Get(ts.URL + "/engines/acp/ory/regex/roles/referenced-editors/policies")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var policies kstorage.Policies
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&policies))
+	var ids []string
+	for _, p := range policies {
+		ids = append(ids, p.ID)
+	}
+	assert.ElementsMatch(t, []string{"referencing-direct", "referencing-pattern"}, ids)
+}
+
+func TestRename(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	c := nc(t, ts.URL)
+	for _, id := range []string{"rename-editors", "rename-admins"} {
+		_, err := c.Engines.UpsertOryAccessControlPolicyRole(engines.NewUpsertOryAccessControlPolicyRoleParams().WithFlavor("exact").WithBody(toSwaggerRole(kstorage.Role{ID: id, Members: []string{"alice"}})))
+		require.NoError(t, err)
+	}
+	_, err := c.Engines.UpsertOryAccessControlPolicy(engines.NewUpsertOryAccessControlPolicyParams().WithFlavor("exact").WithBody(toSwaggerPolicy(kstorage.Policy{ID: "rename-policy", Subjects: []string{"rename-editors"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"})))
+	require.NoError(t, err)
+
+	rename := func(t *testing.T, path, id string) *http.Response {
+		res, err := ts.Client().Post(ts.URL+"/engines/acp/ory/exact/"+path+"/rename", "application/json", bytes.NewBufferString(`{"id":"`+id+`"}`))
+		require.NoError(t, err)
+		return res
+	}
+
+	res := rename(t, "roles/rename-editors", "rename-writers")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Warning"), "rename-policy")
+	var role kstorage.Role
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&role))
+	assert.Equal(t, "rename-writers", role.ID)
+	assert.Equal(t, []string{"alice"}, role.Members)
+
+	_, err = c.Engines.GetOryAccessControlPolicyRole(engines.NewGetOryAccessControlPolicyRoleParams().WithFlavor("exact").WithID("rename-editors"))
+	require.Error(t, err)
+
+	res = rename(t, "policies/rename-policy", "renamed-policy")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	p, err := c.Engines.GetOryAccessControlPolicy(engines.NewGetOryAccessControlPolicyParams().WithFlavor("exact").WithID("renamed-policy"))
+	require.NoError(t, err)
+	assert.Equal(t, "renamed-policy", p.Payload.ID)
+
+	res = rename(t, "roles/rename-writers", "rename-admins")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+	res = rename(t, "roles/rename-editors", "rename-readers")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	for _, id := range []string{"", "  ", " rename-padded", "rename-padded\t"} {
+		res = rename(t, "roles/rename-writers", id)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, id)
+		res = rename(t, "policies/renamed-policy", id)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, id)
+	}
+
+	// repeating a rename with the same idempotency key responds like the first one.
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", ts.URL+"/engines/acp/ory/exact/roles/rename-writers/rename", bytes.NewBufferString(`{"id":"rename-owners"}`))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", "rename")
+		res, err = ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		if i > 0 {
+			assert.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+		}
+	}
+}
+
+func TestPolicyValidity(t *testing.T) {
+	box := packr.NewBox("./rego")
+	compiler, err := engine.NewCompiler(box, logrusx.New("", ""))
+	require.NoError(t, err)
+
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+	le := NewEngine(s, sh, engine.NewEngine(compiler, herodot.NewJSONWriter(nil)), herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	le.Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	past, future := time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	do := func(t *testing.T, method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	for _, f := range EnabledFlavors {
+		t.Run("flavor="+f, func(t *testing.T) {
+			for _, p := range []string{
+				fmt.Sprintf(`{"id":"expired","subjects":["alice"],"resources":["expired"],"actions":["read"],"effect":"allow","not_after":"%s"}`, past),
+				fmt.Sprintf(`{"id":"pending","subjects":["alice"],"resources":["pending"],"actions":["read"],"effect":"allow","not_before":"%s"}`, future),
+				fmt.Sprintf(`{"id":"current","subjects":["alice"],"resources":["current"],"actions":["read"],"effect":"allow","not_before":"%s","not_after":"%s"}`, past, future),
+			} {
+				res := do(t, "PUT", "/engines/acp/ory/"+f+"/policies", p)
+				res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+			}
+
+			for resource, allowed := range map[string]bool{"expired": false, "pending": false, "current": true} {
+				t.Run("resource="+resource, func(t *testing.T) {
+					body := fmt.Sprintf(`{"subject":"alice","action":"read","resource":"%s"}`, resource)
+					for _, path := range []string{"/allowed", "/decisions"} {
+						res := do(t, "POST", "/engines/acp/ory/"+f+path, body)
+						res.Body.Close()
+						if allowed {
+							assert.Equal(t, http.StatusOK, res.StatusCode, path)
+						} else {
+							assert.Equal(t, http.StatusForbidden, res.StatusCode, path)
+						}
+					}
+				})
+			}
+
+			res := do(t, "GET", "/engines/acp/ory/"+f+"/policies?active_only=true", "")
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			var policies kstorage.Policies
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&policies))
+			require.Len(t, policies, 1)
+			assert.Equal(t, "current", policies[0].ID)
+			require.NotNil(t, policies[0].NotBefore)
+			require.NotNil(t, policies[0].NotAfter)
+		})
+	}
+
+	res := do(t, "PUT", "/engines/acp/ory/exact/policies",
+		fmt.Sprintf(`{"id":"inverted","subjects":["alice"],"resources":["inverted"],"actions":["read"],"effect":"allow","not_before":"%s","not_after":"%s"}`, future, past))
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestUpsertDedupe(t *testing.T) {
+	ts := crudts()
+	defer ts.Close()
+
+	for k, body := range []string{
+		`{"id":"dedupe-a","subjects":["alice","bob"],"resources":["articles"],"actions":["read"],"effect":"allow"}`,
+		`{"id":"dedupe-b","subjects":["bob","alice"],"resources":["articles"],"actions":["read","read"],"effect":"allow"}`,
+	} {
+		req, err := http.NewRequest("PUT", ts.URL+"/engines/acp/ory/exact/policies?dedupe=true", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		if k > 0 {
+			assert.Equal(t, "dedupe-a", res.Header.Get("X-Duplicate-Of"))
+		}
+	}
+
+	c := nc(t, ts.URL)
+	res, err := c.Engines.ListOryAccessControlPolicies(engines.NewListOryAccessControlPoliciesParams().WithFlavor("exact"))
+	require.NoError(t, err)
+	require.Len(t, res.Payload, 1)
+	assert.Equal(t, "dedupe-a", res.Payload[0].ID)
+}
+
+func TestScopedRoles(t *testing.T) {
+	box := packr.NewBox("./rego")
+	compiler, err := engine.NewCompiler(box, logrusx.New("", ""))
+	require.NoError(t, err)
+
+	s := kstorage.NewMemoryManager()
+	sh := kstorage.NewHandler(s, herodot.NewJSONWriter(nil))
+	le := NewEngine(s, sh, engine.NewEngine(compiler, herodot.NewJSONWriter(nil)), herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	le.Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	resources := map[string]string{"exact": `"projects:1","projects:2"`, "glob": `"projects:*"`, "regex": `"projects:<.*>"`}
+	for _, f := range EnabledFlavors {
+		t.Run("flavor="+f, func(t *testing.T) {
+			// alice is an editor of project 1 only, while bob is a global editor.
+			for _, u := range []struct{ path, body string }{
+				{path: "/roles", body: `{"id":"editors","members":["bob"]}`},
+				{path: "/roles", body: `{"id":"project-1-editors","members":["alice"],"scope":" projects:1 "}`},
+				{path: "/policies", body: fmt.Sprintf(`{"id":"edit-projects","subjects":["editors","project-1-editors"],"resources":[%s],"actions":["edit"],"effect":"allow"}`, resources[f])},
+			} {
+				res := do(t, "PUT", "/engines/acp/ory/"+f+u.path, u.body)
+				res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode, u.body)
+			}
+
+			for _, tc := range []struct {
+				subject, resource string
+				allowed           bool
+			}{
+				{subject: "alice", resource: "projects:1", allowed: true},
+				{subject: "alice", resource: "projects:2"},
+				{subject: "bob", resource: "projects:1", allowed: true},
+				{subject: "bob", resource: "projects:2", allowed: true},
+			} {
+				t.Run(fmt.Sprintf("subject=%s/resource=%s", tc.subject, tc.resource), func(t *testing.T) {
+					body := fmt.Sprintf(`{"subject":"%s","action":"edit","resource":"%s"}`, tc.subject, tc.resource)
+					expected := http.StatusForbidden
+					if tc.allowed {
+						expected = http.StatusOK
+					}
+
+					// the policy engine and the decisions agree on scoped and global roles.
+					for _, path := range []string{"/allowed", "/decisions"} {
+						res := do(t, "POST", "/engines/acp/ory/"+f+path, body)
+						res.Body.Close()
+						assert.Equal(t, expected, res.StatusCode, path)
+					}
+
+					res := do(t, "POST", "/engines/acp/ory/"+f+"/decisions/batch", "["+body+"]")
+					defer res.Body.Close()
+					require.Equal(t, http.StatusOK, res.StatusCode)
+					var batch []kstorage.AllowedResponse
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&batch))
+					require.Len(t, batch, 1)
+					assert.Equal(t, tc.allowed, batch[0].Allowed)
+
+					res = do(t, "POST", "/engines/acp/ory/"+f+"/decisions/test", body)
+					defer res.Body.Close()
+					require.Equal(t, http.StatusOK, res.StatusCode)
+					var d kstorage.Decision
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&d))
+					assert.Equal(t, tc.allowed, d.Allowed)
+				})
+			}
+
+			for query, expected := range map[string][]string{
+				"member=alice":                  {"project-1-editors"},
+				"member=alice&scope=projects:1": {"project-1-editors"},
+				"member=alice&scope=projects:2": {},
+				"member=bob&scope=projects:2":   {"editors"},
+				"member=carol&scope=projects:1": {},
+			} {
+				t.Run("query="+query, func(t *testing.T) {
+					res := do(t, "GET", "/engines/acp/ory/"+f+"/effective/roles?"+query, "")
+					defer res.Body.Close()
+					require.Equal(t, http.StatusOK, res.StatusCode)
+
+					var ids []string
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&ids))
+					assert.Equal(t, expected, ids)
+				})
+			}
+
+			res := do(t, "GET", "/engines/acp/ory/"+f+"/roles?scope=projects:1", "")
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			var roles kstorage.Roles
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&roles))
+			require.Len(t, roles, 1)
+			assert.Equal(t, "project-1-editors", roles[0].ID)
+			assert.Equal(t, "projects:1", roles[0].Scope)
+		})
+	}
+}
@@ -1,7 +1,23 @@
 package ory.core
 
+# role_ids are the IDs of the global roles which the subject is a member of. Roles with a scope are left out, see
+# scoped_roles.
 role_ids(roles, subject) = r {
     r := [role | role := roles[i].id
         roles[i].members[_] == subject
+        not scoped(roles[i])
     ]
 }
+
+# scoped_roles are the roles with a scope which the subject is a member of. They only count for requests whose
+# resource matches the scope, which every flavor compares with its own matcher.
+scoped_roles(roles, subject) = r {
+    r := [role | role := roles[i]
+        roles[i].members[_] == subject
+        scoped(roles[i])
+    ]
+}
+
+scoped(role) {
+    role.scope != ""
+}
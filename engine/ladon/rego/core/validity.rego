@@ -0,0 +1,18 @@
+package ory.core
+
+# A policy applies from its not_before time, inclusive, until its not_after time, exclusive. Either bound is optional.
+active(policy) {
+    now := time.now_ns()
+    not not_yet_active(policy, now)
+    not expired(policy, now)
+}
+
+not_yet_active(policy, now) {
+    t := time.parse_rfc3339_ns(policy.not_before)
+    now < t
+}
+
+expired(policy, now) {
+    t := time.parse_rfc3339_ns(policy.not_after)
+    now >= t
+}
@@ -17,6 +17,7 @@ decide_allow(policies, roles) {
 			match_subjects(policies[i].subjects, roles, request.subject)
 			policies[i].actions[_] == request.action
 			condition.all_conditions_true(policies[i])
+			core.active(policies[i])
 		]
 
     count(effects, c)
@@ -30,4 +31,9 @@ match_subjects(matches, roles, subject) {
 } {
     r := core.role_ids(roles, subject)
     matches[_] == r[_]
+} {
+    r := core.scoped_roles(roles, subject)
+    role := r[_]
+    role.scope == request.resource
+    matches[_] == role.id
 }
@@ -221,3 +221,56 @@ test_allow_combinations_exactly_one_alternative {
     not decide_allow([combination_policy], []) with input as {"resource": "articles:foobar:9", "subject": "subjects:catdog:9", "action": "actions:cat:9"}
     not decide_allow([combination_policy], []) with input as {"resource": "articles:foobar:9", "subject": "subjects:cat:9", "action": "actions:catdog:9"}
 }
+
+validity_policies = [
+    {
+    	"id": "expired",
+        "resources": [`articles:7`],
+        "subjects": [`subjects:7`],
+        "actions": [`actions:7`],
+        "effect": "allow",
+        "not_after": "2000-01-01T00:00:00Z",
+    },
+    {
+    	"id": "pending",
+        "resources": [`articles:8`],
+        "subjects": [`subjects:8`],
+        "actions": [`actions:8`],
+        "effect": "allow",
+        "not_before": "2200-01-01T00:00:00Z",
+    },
+    {
+    	"id": "current",
+        "resources": [`articles:9`],
+        "subjects": [`subjects:9`],
+        "actions": [`actions:9`],
+        "effect": "allow",
+        "not_before": "2000-01-01T00:00:00Z",
+        "not_after": "2200-01-01T00:00:00Z",
+    },
+]
+
+test_validity {
+    not decide_allow(validity_policies, []) with input as {"resource": "articles:7", "subject": "subjects:7", "action": "actions:7"}
+    not decide_allow(validity_policies, []) with input as {"resource": "articles:8", "subject": "subjects:8", "action": "actions:8"}
+    decide_allow(validity_policies, []) with input as {"resource": "articles:9", "subject": "subjects:9", "action": "actions:9"}
+}
+
+scoped_policy = {
+    "id": "scoped",
+    "resources": [`projects:*`],
+    "subjects": [`editors`],
+    "actions": [`edit`],
+    "effect": "allow",
+}
+
+test_allow_scoped_role {
+    decide_allow([scoped_policy], [{"id": "editors", "scope": "projects:1", "members": ["alice"]}]) with input as {"resource": "projects:1", "subject": "alice", "action": "edit"}
+    decide_allow([scoped_policy], [{"id": "editors", "scope": "projects:{1,2}", "members": ["alice"]}]) with input as {"resource": "projects:2", "subject": "alice", "action": "edit"}
+    not decide_allow([scoped_policy], [{"id": "editors", "scope": "projects:1", "members": ["alice"]}]) with input as {"resource": "projects:2", "subject": "alice", "action": "edit"}
+}
+
+test_allow_global_role {
+    decide_allow([scoped_policy], [{"id": "editors", "members": ["alice"]}]) with input as {"resource": "projects:2", "subject": "alice", "action": "edit"}
+    decide_allow([scoped_policy], [{"id": "editors", "scope": "", "members": ["alice"]}]) with input as {"resource": "projects:2", "subject": "alice", "action": "edit"}
+}
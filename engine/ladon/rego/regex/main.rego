@@ -17,6 +17,7 @@ decide_allow(policies, roles) {
 	        match_subjects(policies[i].subjects, roles, request.subject)
 	        matcher(policies[i].actions, request.action)
 			condition.all_conditions_true(policies[i])
+			core.active(policies[i])
 		]
 
     count(effects, c)
@@ -37,4 +38,9 @@ match_subjects(matches, roles, subject) {
     r := core.role_ids(roles, subject)
     rr := r[_]
     matcher(matches, rr)
+} {
+    r := core.scoped_roles(roles, subject)
+    role := r[_]
+    matcher([role.scope], request.resource)
+    matcher(matches, role.id)
 }
@@ -1,5 +1,9 @@
 package ladon
 
+import (
+	kstorage "github.com/ory/keto/storage"
+)
+
 type Context map[string]interface{}
 
 const (
@@ -23,3 +27,13 @@ type Input struct {
 	// Context is the request's environmental context.
 	Context map[string]interface{} `json:"context"`
 }
+
+// TestInput is an access request together with the policies it is decided against.
+//
+// swagger:ignore
+type TestInput struct {
+	Input
+
+	// Policies are decided instead of the stored policies if they are set.
+	Policies kstorage.Policies `json:"policies"`
+}
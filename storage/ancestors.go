@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// AncestorsRequest is a request for the ancestors of the role stored under the key.
+type AncestorsRequest struct {
+	Collection string
+	Key        string
+}
+
+// Ancestors responds with the roles which contain the role stored under the key, directly or through other roles,
+// ordered from the closest parent outward. It is the reverse of expanding the members of a role. Cycles are detected
+// and every ancestor is listed once. Responds with 404 if the role does not exist.
+func (h *Handler) Ancestors(factory func(context.Context, *http.Request, httprouter.Params) (*AncestorsRequest, error)) httprouter.Handle {
+	return h.instrument("ancestors", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		a, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, a.Collection)
+
+		if err := validateCollection(a.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var roles Roles
+		if err := h.s.ListAll(ctx, a.Collection, &roles); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var found bool
+		for _, role := range roles {
+			if role.ID == a.Key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.h.WriteError(w, r, withKey(errors.WithStack(ErrNotFound), a.Collection, a.Key))
+			return
+		}
+
+		h.auditRead(ctx, a.Key)
+		h.h.Write(w, r, roles.ancestors(a.Key))
+	})
+}
+
+// RolesForMemberRequest is a request for the roles the member belongs to.
+type RolesForMemberRequest struct {
+	Collection string
+	Member     string
+
+	// Scope limits the roles to those which apply to the resource, see Role.Scope. All roles are considered if it is
+	// empty.
+	Scope string
+}
+
+// RolesForMember responds with the sorted IDs of the roles which contain the member, directly or through other roles,
+// see Manager.RolesForMember. Unlike listing the roles filtered by member it also follows nested roles and leaves out
+// everything but the IDs. Responds with an empty list if the member belongs to no role.
+//
+// If the request has a scope, only the global roles and the roles whose scope matches it count, so a role which only
+// contains the member through a role of another scope is left out as well. Scoped lookups list the whole collection
+// instead of using Manager.RolesForMember, because scopes may be patterns.
+func (h *Handler) RolesForMember(factory func(context.Context, *http.Request, httprouter.Params) (*RolesForMemberRequest, error)) httprouter.Handle {
+	return h.instrument("roles_for_member", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		m, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, m.Collection)
+
+		if err := validateCollection(m.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if m.Member == "" {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason(`Query parameter "member" must be set.`)))
+			return
+		}
+
+		ids, err := h.rolesForMember(ctx, m.Collection, m.Member, m.Scope)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx, ids...)
+		h.h.Write(w, r, ids)
+	})
+}
+
+// rolesForMember returns the sorted IDs of the roles in the collection which contain the member and which apply to the
+// scope, or to every scope if it is empty.
+func (h *Handler) rolesForMember(ctx context.Context, collection, member, scope string) ([]string, error) {
+	if scope == "" {
+		return h.s.RolesForMember(ctx, collection, member)
+	}
+
+	var roles Roles
+	if err := h.s.ListAll(ctx, collection, &roles); err != nil {
+		return nil, err
+	}
+
+	o := &filterOptions{match: MatchAny, literal: true}
+	ids := roles.inScope(scope, o).memberOf(member)
+	if o.err != nil {
+		return nil, o.err
+	}
+	return ids, nil
+}
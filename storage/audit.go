@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ory/x/logrusx"
+)
+
+// AuditEvent describes a request served by a Handler.
+type AuditEvent struct {
+	Time       time.Time
+	Operation  string
+	Collection string
+	Keys       []string
+
+	// Subject is the authenticated subject which sent the request, see ContextWithSubject. It is empty if the
+	// request was not authenticated.
+	Subject string
+
+	// Rejected is true if the request was refused because it tried to modify protected keys, see WithProtectedKeys.
+	// Keys are the protected keys of the request.
+	Rejected bool
+}
+
+// AuditSink receives the audit events of a Handler. Events are only sent after the storage operation succeeded, except
+// for rejected writes to protected keys.
+type AuditSink interface {
+	Audit(ctx context.Context, e AuditEvent)
+}
+
+// LogAuditSink writes every audit event as a structured log line.
+type LogAuditSink struct {
+	l *logrusx.Logger
+}
+
+// NewLogAuditSink creates an AuditSink which writes to the logger.
+func NewLogAuditSink(l *logrusx.Logger) *LogAuditSink {
+	return &LogAuditSink{l: l}
+}
+
+func (s *LogAuditSink) Audit(_ context.Context, e AuditEvent) {
+	l := s.l.
+		WithField("audience", "audit").
+		WithField("operation", e.Operation).
+		WithField("collection", e.Collection).
+		WithField("keys", e.Keys).
+		WithField("subject", e.Subject)
+	if e.Rejected {
+		l.WithField("rejected", true).Warn("Storage operation was rejected because it modifies protected keys.")
+		return
+	}
+	l.Info("Storage operation succeeded.")
+}
+
+// WithAuditSink sets the sink which receives an event for every successful write. Nothing is audited by default.
+func WithAuditSink(s AuditSink) HandlerOption {
+	return func(h *Handler) {
+		h.auditSink = s
+	}
+}
+
+// WithAuditReads makes the handler audit successful reads as well as writes.
+func WithAuditReads(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.auditReads = enabled
+	}
+}
+
+type subjectKey struct{}
+
+// ContextWithSubject stores the authenticated subject of a request in its context, for example in a middleware in
+// front of the handler. The subject is recorded in the audit events.
+func ContextWithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the subject stored by ContextWithSubject or an empty string.
+func SubjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
+
+// audit sends an event for a successful write of the keys to the audit sink. The operation and the collection are
+// taken from the annotations of the request. Because every write passes through it, it also drops the cached distinct
+// values of the collection and notifies the change notifier.
+func (h *Handler) audit(ctx context.Context, keys ...string) {
+	if o, ok := ctx.Value(operationKey{}).(*operation); ok {
+		h.distinct.invalidate(o.collection)
+		h.notify(o, keys)
+	}
+	h.sendAudit(ctx, keys)
+}
+
+// auditRead is like audit but only sends the event if reads are audited.
+func (h *Handler) auditRead(ctx context.Context, keys ...string) {
+	if h.auditReads {
+		h.sendAudit(ctx, keys)
+	}
+}
+
+// auditRejected sends an event for a write which was rejected because it modifies the protected keys.
+func (h *Handler) auditRejected(ctx context.Context, keys ...string) {
+	h.sendEvent(ctx, keys, true)
+}
+
+func (h *Handler) sendAudit(ctx context.Context, keys []string) {
+	h.sendEvent(ctx, keys, false)
+}
+
+func (h *Handler) sendEvent(ctx context.Context, keys []string, rejected bool) {
+	if h.auditSink == nil {
+		return
+	}
+
+	e := AuditEvent{Time: time.Now().UTC(), Keys: keys, Subject: SubjectFromContext(ctx), Rejected: rejected}
+	if o, ok := ctx.Value(operationKey{}).(*operation); ok {
+		e.Operation, e.Collection = o.name, o.collection
+	}
+	h.auditSink.Audit(ctx, e)
+}
+
+// keysOf returns the sorted keys of the map.
+func keysOf(kv map[string]interface{}) []string {
+	keys := make([]string, 0, len(kv))
+	for key := range kv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
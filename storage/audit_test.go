@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type recordingAuditSink struct {
+	sync.Mutex
+	events []AuditEvent
+}
+
+func (s *recordingAuditSink) Audit(_ context.Context, e AuditEvent) {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, e)
+}
+
+// reset returns the recorded events without their time and forgets them.
+func (s *recordingAuditSink) reset(t *testing.T) []AuditEvent {
+	s.Lock()
+	defer s.Unlock()
+	events := s.events
+	for k := range events {
+		assert.False(t, events[k].Time.IsZero())
+		events[k].Time = time.Time{}
+	}
+	s.events = nil
+	return events
+}
+
+func TestAudit(t *testing.T) {
+	for _, reads := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reads=%v", reads), func(t *testing.T) {
+			sink := new(recordingAuditSink)
+			h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil), WithAuditSink(sink), WithAuditReads(reads))
+			i := &mockHandler{c: "tests-audit", sh: h}
+			r := httprouter.New()
+			i.Register(r)
+			r.DELETE("/", h.DeleteMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteManyRequest, error) {
+				return &DeleteManyRequest{Collection: "tests-audit", Keys: r.URL.Query()["key"]}, nil
+			}))
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				r.ServeHTTP(w, req.WithContext(ContextWithSubject(req.Context(), req.Header.Get("X-Subject"))))
+			}))
+			defer ts.Close()
+
+			do := func(t *testing.T, method, path string) int {
+				req, err := http.NewRequest(method, ts.URL+path, nil)
+				require.NoError(t, err)
+				req.Header.Set("X-Subject", "alice")
+				req.Header.Set("If-None-Match", "*")
+				res, err := ts.Client().Do(req)
+				require.NoError(t, err)
+				res.Body.Close()
+				return res.StatusCode
+			}
+
+			t.Run("case=writes are audited", func(t *testing.T) {
+				require.Equal(t, http.StatusOK, do(t, "POST", "/?key=foo&value=bar"))
+				require.Equal(t, http.StatusNoContent, do(t, "DELETE", "/foo"))
+
+				e := sink.reset(t)
+				require.Len(t, e, 2)
+				assert.Equal(t, AuditEvent{Operation: "upsert", Collection: "tests-audit", Keys: []string{"foo"}, Subject: "alice"}, e[0])
+				assert.Equal(t, AuditEvent{Operation: "delete", Collection: "tests-audit", Keys: []string{"foo"}, Subject: "alice"}, e[1])
+			})
+
+			t.Run("case=bulk deletes audit the removed keys", func(t *testing.T) {
+				for _, atomic := range []string{"true", "false"} {
+					require.Equal(t, http.StatusOK, do(t, "POST", "/?key=a&value=1"))
+					require.Equal(t, http.StatusOK, do(t, "POST", "/?key=b&value=2"))
+					sink.reset(t)
+
+					do(t, "DELETE", "/?key=a&key=missing&key=b&key=a&atomic="+atomic)
+					e := sink.reset(t)
+					require.Len(t, e, 1, atomic)
+					assert.Equal(t, []string{"a", "b"}, e[0].Keys, atomic)
+				}
+			})
+
+			t.Run("case=failed writes are not audited", func(t *testing.T) {
+				require.Equal(t, http.StatusOK, do(t, "POST", "/?key=foo&value=bar"))
+				sink.reset(t)
+
+				require.Equal(t, http.StatusPreconditionFailed, do(t, "POST", "/?key=foo&value=baz"))
+				assert.Empty(t, sink.reset(t))
+			})
+
+			t.Run("case=reads are audited if enabled", func(t *testing.T) {
+				require.Equal(t, http.StatusOK, do(t, "GET", "/foo"))
+				require.Equal(t, http.StatusOK, do(t, "GET", "/"))
+				require.Equal(t, http.StatusNotFound, do(t, "GET", "/unknown"))
+
+				e := sink.reset(t)
+				if !reads {
+					assert.Empty(t, e)
+					return
+				}
+				require.Len(t, e, 2)
+				assert.Equal(t, "get", e[0].Operation)
+				assert.Equal(t, []string{"foo"}, e[0].Keys)
+				assert.Equal(t, "list", e[1].Operation)
+				assert.Empty(t, e[1].Keys)
+			})
+
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// DefaultMaxBatchSize is the number of access requests which AllowedBatch decides at most by default.
+const DefaultMaxBatchSize = 100
+
+// WithMaxBatchSize sets the number of access requests which AllowedBatch decides at most. Larger batches are answered
+// with 400. Defaults to DefaultMaxBatchSize, which is also used if n is zero or less.
+func WithMaxBatchSize(n int) HandlerOption {
+	return func(h *Handler) {
+		h.maxBatchSize = n
+	}
+}
+
+// AccessRequest is a single access request of an AllowedBatchRequest.
+type AccessRequest struct {
+	Subject  string
+	Action   string
+	Resource string
+	Context  map[string]interface{}
+}
+
+// AllowedBatchRequest is a request to decide several access requests against the policies of a collection at once.
+type AllowedBatchRequest struct {
+	Collection string
+	Requests   []AccessRequest
+
+	// RoleCollection is the collection from which the roles of the subjects are resolved, see AllowedRequest.
+	RoleCollection string
+
+	// Flavor is the pattern syntax of the policies and of the scopes of the roles, see AllowedRequest.
+	Flavor string
+}
+
+// AllowedBatch decides every access request like Allowed and responds with 200 and their AllowedResponses in the order
+// of the requests. The policies and roles are listed once and all requests are decided against that snapshot, so a
+// batch is consistent even if they change meanwhile. Batches with more requests than the maximum batch size are answered
+// with 400, see WithMaxBatchSize.
+func (h *Handler) AllowedBatch(factory func(context.Context, *http.Request, httprouter.Params) (*AllowedBatchRequest, error)) httprouter.Handle {
+	return h.instrument("allowed_batch", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		b, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, b.Collection)
+
+		if err := validateCollection(b.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		max := h.maxBatchSize
+		if max <= 0 {
+			max = DefaultMaxBatchSize
+		}
+		if len(b.Requests) > max {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("The batch contains %d access requests but must not contain more than %d.", len(b.Requests), max)))
+			return
+		}
+
+		var policies Policies
+		var roles Roles
+		if len(b.Requests) > 0 {
+			if err := h.s.ListAll(ctx, b.Collection, &policies); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if b.RoleCollection != "" {
+				if err := h.s.ListAll(ctx, b.RoleCollection, &roles); err != nil {
+					h.h.WriteError(w, r, err)
+					return
+				}
+			}
+		}
+		// non-nil slices make decide use the snapshots instead of listing the policies and roles again.
+		if policies == nil {
+			policies = Policies{}
+		}
+		if roles == nil {
+			roles = Roles{}
+		}
+
+		e := h.evaluator(b.Collection, b.RoleCollection, b.Flavor)
+		e.roles = roles
+		res := make([]AllowedResponse, len(b.Requests))
+		for k, a := range b.Requests {
+			d, err := e.decide(ctx, a.Subject, a.Action, a.Resource, a.Context, policies, false)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			res[k] = AllowedResponse{Allowed: d.Allowed, Default: d.Default, Obligations: d.Obligations}
+		}
+
+		h.h.Write(w, r, res)
+	})
+}
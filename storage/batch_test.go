@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type listCountingManager struct {
+	*MemoryManager
+	lists int32
+}
+
+func (m *listCountingManager) ListAll(ctx context.Context, collection string, value interface{}) error {
+	atomic.AddInt32(&m.lists, 1)
+	return m.MemoryManager.ListAll(ctx, collection, value)
+}
+
+func TestAllowedBatch(t *testing.T) {
+	const collection = "/tests/batch/policies"
+
+	m := &listCountingManager{MemoryManager: NewMemoryManager()}
+	require.NoError(t, m.UpsertMany(context.Background(), collection, map[string]interface{}{
+		"allow-read": &Policy{ID: "allow-read", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		"deny-bob":   &Policy{ID: "deny-bob", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+	}))
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithMaxBatchSize(3))
+	r := httprouter.New()
+	r.POST("/batch", h.AllowedBatch(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*AllowedBatchRequest, error) {
+		var requests []AccessRequest
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			return nil, err
+		}
+		return &AllowedBatchRequest{Collection: collection, Requests: requests}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		body     string
+		code     int
+		lists    int32
+		expected []AllowedResponse
+	}{
+		{
+			body:  `[{"subject":"alice","action":"read","resource":"articles"},{"subject":"bob","action":"read","resource":"articles"},{"subject":"carol","action":"read","resource":"articles"}]`,
+			code:  http.StatusOK,
+			lists: 1,
+			expected: []AllowedResponse{
+				{Allowed: true},
+				{Allowed: false},
+				{Allowed: false, Default: true},
+			},
+		},
+		{body: `[]`, code: http.StatusOK, expected: []AllowedResponse{}},
+		{body: `[{},{},{},{}]`, code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			atomic.StoreInt32(&m.lists, 0)
+			res, err := ts.Client().Post(ts.URL+"/batch", "application/json", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			assert.Equal(t, tc.lists, atomic.LoadInt32(&m.lists))
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var decisions []AllowedResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&decisions))
+			assert.Equal(t, tc.expected, decisions)
+		})
+	}
+}
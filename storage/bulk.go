@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// atomicParam is the query parameter which makes bulk writes attempt every entry on its own if set to "false".
+const atomicParam = "atomic"
+
+// BulkResult is the outcome of a single entry of a bulk write which is not atomic.
+type BulkResult struct {
+	// Index is the position of the entry in the request.
+	Index int `json:"index"`
+
+	// Key is the key of the entry.
+	Key string `json:"key"`
+
+	// Status is the HTTP status code the entry would have been answered with on its own.
+	Status int `json:"status"`
+
+	// Error describes why the entry failed. It is empty if the entry succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// isAtomic parses the query parameter "atomic", which defaults to true.
+func isAtomic(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get(atomicParam)
+	if v == "" {
+		return true, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" must be a boolean but got "%s".`, atomicParam, v))
+	}
+	return b, nil
+}
+
+// bulkResult returns the result of the entry, which succeeded with the status if err is nil.
+func bulkResult(index int, key string, status int, err error) BulkResult {
+	if err == nil {
+		return BulkResult{Index: index, Key: key, Status: status}
+	}
+
+	e := herodot.ToDefaultError(httpError(err), "")
+	msg := e.Reason()
+	if msg == "" {
+		msg = e.Error()
+	}
+	return BulkResult{Index: index, Key: key, Status: e.StatusCode(), Error: msg}
+}
+
+// succeeded returns the keys of the results which have no error.
+func succeeded(results []BulkResult) []string {
+	keys := make([]string, 0, len(results))
+	for _, res := range results {
+		if res.Error == "" {
+			keys = append(keys, res.Key)
+		}
+	}
+	return keys
+}
+
+// upsertEach writes every entry on its own, so that failing entries do not prevent the others from being written.
+func (h *Handler) upsertEach(ctx context.Context, r *http.Request, u *UpsertManyRequest) []BulkResult {
+	results := make([]BulkResult, len(u.Entries))
+	index := make(map[string]int, len(u.Entries))
+	for k, e := range u.Entries {
+		err := e.Err
+		if i, ok := index[e.Key]; ok && err == nil {
+			err = errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf("Entry %d uses key %s which is already used by entry %d.", k, e.Key, i))
+		}
+		if err == nil {
+			index[e.Key] = k
+			clearTimestamps(e.Value)
+			err = h.checkProtected(ctx, r, e.Key)
+		}
+		if err == nil {
+			err = h.s.Upsert(ctx, u.Collection, e.Key, e.Value)
+		}
+		results[k] = bulkResult(k, e.Key, http.StatusOK, err)
+	}
+	return results
+}
+
+// deleteEach removes every key on its own, so that failing keys do not prevent the others from being removed. Like for
+// an atomic bulk delete, keys which do not exist are ignored. It also returns the keys which existed and were removed.
+func (h *Handler) deleteEach(ctx context.Context, w http.ResponseWriter, r *http.Request, d *DeleteManyRequest, purge bool) ([]BulkResult, []string) {
+	results := make([]BulkResult, len(d.Keys))
+	deleted := []string{}
+	for k, key := range d.Keys {
+		var exists bool
+		err := h.checkProtected(ctx, r, key)
+		if err == nil && d.PolicyCollection != "" {
+			err = h.checkReferences(ctx, w, r, d.PolicyCollection, key)
+		}
+		if err == nil {
+			exists, err = h.s.Exists(ctx, d.Collection, key)
+		}
+		if err == nil && (exists || purge) {
+			if err = h.delete(ctx, d.Collection, key, purge); err == nil && exists {
+				deleted = append(deleted, key)
+			}
+		}
+		results[k] = bulkResult(k, key, http.StatusNoContent, err)
+	}
+	return results, deleted
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestBulkNotAtomic(t *testing.T) {
+	const collection = "tests-bulk-not-atomic"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithProtectedKeys("protected"))
+	r := httprouter.New()
+	r.PUT("/bulk", h.UpsertMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertManyRequest, error) {
+		var values []string
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			return nil, err
+		}
+		entries := make([]UpsertEntry, len(values))
+		for k, v := range values {
+			entries[k] = UpsertEntry{Key: v, Value: v}
+			if v == "invalid" {
+				entries[k].Err = errors.WithStack(herodot.ErrBadRequest.WithReason("The entry is invalid."))
+			}
+		}
+		return &UpsertManyRequest{Collection: collection, Entries: entries}, nil
+	}))
+	r.DELETE("/bulk", h.DeleteMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteManyRequest, error) {
+		var keys []string
+		if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+			return nil, err
+		}
+		return &DeleteManyRequest{Collection: collection, Keys: keys}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, query, body string) (int, []BulkResult) {
+		req, err := http.NewRequest(method, ts.URL+"/bulk"+query, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var results []BulkResult
+		if res.StatusCode == http.StatusMultiStatus {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&results))
+		}
+		return res.StatusCode, results
+	}
+
+	stored := func(t *testing.T) []string {
+		var vs []string
+		require.NoError(t, m.ListAll(context.Background(), collection, &vs))
+		return vs
+	}
+
+	t.Run("case=atomic by default", func(t *testing.T) {
+		code, _ := do(t, "PUT", "", `["a","invalid","b"]`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Empty(t, stored(t))
+	})
+
+	t.Run("case=invalid atomic", func(t *testing.T) {
+		code, _ := do(t, "PUT", "?atomic=maybe", `["a"]`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("case=upsert", func(t *testing.T) {
+		code, results := do(t, "PUT", "?atomic=false", `["a","invalid","protected","b","a"]`)
+		require.Equal(t, http.StatusMultiStatus, code)
+		assert.Equal(t, []BulkResult{
+			{Index: 0, Key: "a", Status: http.StatusOK},
+			{Index: 1, Key: "invalid", Status: http.StatusBadRequest, Error: "The entry is invalid."},
+			{Index: 2, Key: "protected", Status: http.StatusForbidden, Error: "Keys protected are protected and can only be modified with the X-Allow-Protected header."},
+			{Index: 3, Key: "b", Status: http.StatusOK},
+			{Index: 4, Key: "a", Status: http.StatusBadRequest, Error: "Entry 4 uses key a which is already used by entry 0."},
+		}, results)
+		assert.Equal(t, []string{"a", "b"}, stored(t))
+	})
+
+	t.Run("case=delete", func(t *testing.T) {
+		code, results := do(t, "DELETE", "?atomic=false", `["a","protected","unknown"]`)
+		require.Equal(t, http.StatusMultiStatus, code)
+		assert.Equal(t, []BulkResult{
+			{Index: 0, Key: "a", Status: http.StatusNoContent},
+			{Index: 1, Key: "protected", Status: http.StatusForbidden, Error: "Keys protected are protected and can only be modified with the X-Allow-Protected header."},
+			{Index: 2, Key: "unknown", Status: http.StatusNoContent},
+		}, results)
+		assert.Equal(t, []string{"b"}, stored(t))
+	})
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// canonicalParam is the query parameter which normalizes the policies in the responses of Get and List.
+const canonicalParam = "canonical"
+
+// canonicalFields are the fields of policies which list values in no particular order.
+var canonicalFields = map[string]bool{"subjects": true, "resources": true, "actions": true}
+
+// canonicalize normalizes the policies of the encoded value if the query parameter "canonical" is "true", so that
+// policies which only differ in the order or the repetition of their subjects, resources, and actions, or in the casing
+// of their effect, are written identically. Their subjects, resources, and actions are sorted and deduplicated, a
+// missing list becomes an empty one, and the effect is lower-cased. Lists are normalized element by element and
+// other values are left as they are. Only the response is normalized, the stored value is not changed.
+func canonicalize(r *http.Request, e interface{}) (interface{}, error) {
+	canonical, err := boolQuery(r, canonicalParam)
+	if err != nil {
+		return nil, err
+	} else if !canonical {
+		return e, nil
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return mapValues(b, func(v json.RawMessage) (json.RawMessage, error) {
+		res, _, err := mapObject(v, canonicalField)
+		return res, err
+	})
+}
+
+func canonicalField(key string, v json.RawMessage) (json.RawMessage, bool, error) {
+	var res interface{}
+	switch {
+	case canonicalFields[key]:
+		var values []string
+		if err := json.Unmarshal(v, &values); err != nil {
+			return v, true, nil
+		}
+
+		sort.Strings(values)
+		unique := []string{}
+		for k, value := range values {
+			if k == 0 || values[k-1] != value {
+				unique = append(unique, value)
+			}
+		}
+		res = unique
+	case key == "effect":
+		var effect string
+		if err := json.Unmarshal(v, &effect); err != nil {
+			return v, true, nil
+		}
+		res = strings.ToLower(effect)
+	default:
+		return v, true, nil
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return b, true, nil
+}
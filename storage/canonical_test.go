@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestCanonical(t *testing.T) {
+	const collection = "/tests/canonical/policies"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/policies/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Policy)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx := context.Background()
+	require.NoError(t, m.Upsert(ctx, collection, "p", &Policy{
+		ID: "p", Subjects: []string{"bob", "alice", "bob"}, Resources: []string{"b", "a"}, Actions: []string{"write", "read"}, Effect: "Allow",
+	}))
+	require.NoError(t, m.Upsert(ctx, collection, "q", &Policy{
+		ID: "q", Subjects: []string{"alice", "bob"}, Resources: []string{"a", "b", "a"}, Actions: []string{"read", "write"}, Effect: "allow",
+	}))
+	require.NoError(t, m.Upsert(ctx, collection, "r", &Policy{ID: "r", Effect: "deny"}))
+
+	get := func(t *testing.T, path string) string {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		return string(body)
+	}
+
+	t.Run("case=orderings canonicalize identically", func(t *testing.T) {
+		p := get(t, "/policies/p?canonical=true")
+		q := get(t, "/policies/q?canonical=true")
+		assert.JSONEq(t, `{"id":"p","description":"","subjects":["alice","bob"],"resources":["a","b"],"actions":["read","write"],"effect":"allow","conditions":null}`, p)
+		assert.Equal(t, p, `{"id":"p"`+q[len(`{"id":"q"`):])
+	})
+
+	t.Run("case=missing lists become empty", func(t *testing.T) {
+		assert.JSONEq(t, `{"id":"r","description":"","subjects":[],"resources":[],"actions":[],"effect":"deny","conditions":null}`, get(t, "/policies/r?canonical=true"))
+	})
+
+	t.Run("case=list", func(t *testing.T) {
+		assert.JSONEq(t, `[
+			{"id":"p","description":"","subjects":["alice","bob"],"resources":["a","b"],"actions":["read","write"],"effect":"allow","conditions":null},
+			{"id":"q","description":"","subjects":["alice","bob"],"resources":["a","b"],"actions":["read","write"],"effect":"allow","conditions":null},
+			{"id":"r","description":"","subjects":[],"resources":[],"actions":[],"effect":"deny","conditions":null}
+		]`, get(t, "/policies?canonical=true"))
+		assert.JSONEq(t, `[{"id":"p","subjects":["alice","bob"]}]`, get(t, "/policies?canonical=true&fields=id,subjects&id=p"))
+	})
+
+	t.Run("case=stored form is untouched", func(t *testing.T) {
+		assert.JSONEq(t, `{"id":"p","description":"","subjects":["bob","alice","bob"],"resources":["b","a"],"actions":["write","read"],"effect":"Allow","conditions":null}`, get(t, "/policies/p"))
+	})
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// WithDestructiveOperations enables Clear, which removes whole collections at once, and Compact. Clear is meant for
+// test environments which reset their state between cases. Disabled by default.
+func WithDestructiveOperations(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.destructive = enabled
+	}
+}
+
+// ClearRequest is a request to remove all entries of a collection.
+type ClearRequest struct {
+	Collection string
+}
+
+// ClearResponse is the response of Clear.
+type ClearResponse struct {
+	// Deleted is the number of entries which were removed.
+	Deleted int `json:"deleted"`
+}
+
+// Clear removes all entries and tombstones of the collection and responds with the number of removed entries.
+// Responds with 403 unless destructive operations are enabled, see WithDestructiveOperations. The change notifier
+// receives a single event with an empty key.
+func (h *Handler) Clear(factory func(context.Context, *http.Request, httprouter.Params) (*ClearRequest, error)) httprouter.Handle {
+	return h.instrument("clear", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		if !h.destructive {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrForbidden.
+				WithReason("Clearing collections is disabled because destructive operations are not allowed.")))
+			return
+		}
+
+		c, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, c.Collection)
+
+		if err := validateCollection(c.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(c.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtectedCollection(ctx, r); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		deleted, err := h.s.Clear(ctx, c.Collection)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		h.audit(ctx)
+		h.notifyCleared(ctx)
+
+		h.h.Write(w, r, &ClearResponse{Deleted: deleted})
+	})
+}
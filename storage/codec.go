@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CodecJSON stores values as plain JSON.
+	CodecJSON = "json"
+	// CodecGzip stores values as gzip compressed JSON.
+	CodecGzip = "gzip"
+)
+
+// Codec converts the JSON documents of a manager to the encoding they are stored in and back. Only the encoding at
+// rest changes, values are still passed to and returned by the manager as JSON. Codecs must be safe for concurrent
+// use.
+type Codec interface {
+	// Name identifies the codec, for example in the documents of backends which tag their encoding.
+	Name() string
+
+	// Encode converts the JSON document to its stored form.
+	Encode(doc json.RawMessage) ([]byte, error)
+
+	// Decode converts the stored form back to the JSON document.
+	Decode(b []byte) (json.RawMessage, error)
+}
+
+// NewCodec returns the codec with the name, CodecJSON or CodecGzip.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case "", CodecJSON:
+		return JSONCodec{}, nil
+	case CodecGzip:
+		return NewGzipCodec(gzip.DefaultCompression), nil
+	}
+	return nil, errors.Errorf(`storage codec must be "%s" or "%s" but got "%s"`, CodecJSON, CodecGzip, name)
+}
+
+// JSONCodec stores the documents as they are. It is the default codec of all managers.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Encode(doc json.RawMessage) ([]byte, error) {
+	return doc, nil
+}
+
+func (JSONCodec) Decode(b []byte) (json.RawMessage, error) {
+	return b, nil
+}
+
+// GzipCodec compresses the documents with gzip. Documents which are not compressed, such as those written before the
+// codec was configured, are decoded as plain JSON. Writers and readers are pooled because their state is much larger
+// than a typical document.
+type GzipCodec struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewGzipCodec returns a GzipCodec which compresses with the level, see compress/gzip. Invalid levels fall back to
+// gzip.DefaultCompression.
+func NewGzipCodec(level int) *GzipCodec {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	return &GzipCodec{level: level}
+}
+
+func (c *GzipCodec) Name() string {
+	return CodecGzip
+}
+
+func (c *GzipCodec) Encode(doc json.RawMessage) ([]byte, error) {
+	var b bytes.Buffer
+	w, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&b)
+	} else {
+		// the level was validated by NewGzipCodec.
+		w, _ = gzip.NewWriterLevel(&b, c.level)
+	}
+	defer c.writers.Put(w)
+
+	if _, err := w.Write(doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b.Bytes(), nil
+}
+
+func (c *GzipCodec) Decode(b []byte) (json.RawMessage, error) {
+	if !isGzip(b) {
+		return b, nil
+	}
+
+	var err error
+	r, ok := c.readers.Get().(*gzip.Reader)
+	if ok {
+		err = r.Reset(bytes.NewReader(b))
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer c.readers.Put(r)
+
+	doc, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return doc, nil
+}
+
+// isGzip reports whether b starts with the magic number of gzip, which no JSON document starts with.
+func isGzip(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// isPlainJSON reports whether the codec stores the documents as they are.
+func isPlainJSON(c Codec) bool {
+	_, ok := c.(JSONCodec)
+	return c == nil || ok
+}
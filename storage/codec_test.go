@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGzipMemoryManager() *MemoryManager {
+	m := NewMemoryManager()
+	m.SetCodec(NewGzipCodec(gzip.BestSpeed))
+	return m
+}
+
+func TestCodec(t *testing.T) {
+	doc := json.RawMessage(`{"id":"foo","subjects":["alice"]}`)
+
+	for _, name := range []string{CodecJSON, CodecGzip} {
+		t.Run("codec="+name, func(t *testing.T) {
+			c, err := NewCodec(name)
+			require.NoError(t, err)
+			assert.Equal(t, name, c.Name())
+
+			b, err := c.Encode(doc)
+			require.NoError(t, err)
+			decoded, err := c.Decode(b)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(doc), string(decoded))
+
+			plain, err := c.Decode(doc)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(doc), string(plain))
+		})
+	}
+
+	t.Run("case=unknown", func(t *testing.T) {
+		_, err := NewCodec("xml")
+		require.Error(t, err)
+	})
+
+	t.Run("case=gzip is not json", func(t *testing.T) {
+		b, err := NewGzipCodec(gzip.DefaultCompression).Encode(doc)
+		require.NoError(t, err)
+		assert.False(t, json.Valid(b))
+	})
+}
+
+func TestSQLManager_Codec(t *testing.T) {
+	plain := NewSQLManager(nil)
+	compressed := NewSQLManager(nil)
+	compressed.SetCodec(NewGzipCodec(gzip.DefaultCompression))
+
+	doc := `{"id":"foo","members":["alice"]}`
+
+	stored, err := plain.encodeDocument([]byte(doc))
+	require.NoError(t, err)
+	assert.Equal(t, doc, stored)
+
+	tagged, err := compressed.encodeDocument([]byte(doc))
+	require.NoError(t, err)
+	assert.True(t, json.Valid([]byte(tagged)), "documents must fit into a JSON column")
+	assert.True(t, strings.HasPrefix(tagged, `"keto+gzip:`), tagged)
+
+	for _, m := range []*SQLManager{plain, compressed} {
+		for _, item := range []string{stored, tagged} {
+			decoded, err := m.decode(item)
+			require.NoError(t, err)
+			assert.JSONEq(t, doc, string(decoded))
+		}
+	}
+
+	decoded, err := compressed.decode(`"just a string"`)
+	require.NoError(t, err)
+	assert.Equal(t, `"just a string"`, string(decoded))
+}
+
+func TestMemoryManager_Codec(t *testing.T) {
+	ctx := context.Background()
+	m := newGzipMemoryManager()
+	require.NoError(t, m.Upsert(ctx, "tests-codec", "foo", &Policy{ID: "foo", Subjects: []string{"alice"}}))
+
+	m.mu.RLock()
+	stored := m.items["tests-codec"][0].Data
+	m.mu.RUnlock()
+	assert.True(t, isGzip(stored))
+
+	var p Policy
+	require.NoError(t, m.Get(ctx, "tests-codec", "foo", &p))
+	assert.Equal(t, []string{"alice"}, p.Subjects)
+}
+
+// BenchmarkCodec reports the size of a large policy set at rest and the time to decode all of its documents.
+func BenchmarkCodec(b *testing.B) {
+	docs := make([]json.RawMessage, 10000)
+	for k := range docs {
+		doc, err := json.Marshal(&Policy{
+			ID:          fmt.Sprintf("policy-%d", k),
+			Description: "Allows the members of the group to read and update the articles of their team.",
+			Subjects:    []string{fmt.Sprintf("groups:%d", k), "users:admin"},
+			Resources:   []string{fmt.Sprintf("<articles:team-%d:.*>", k)},
+			Actions:     []string{"read", "update"},
+			Effect:      "allow",
+			Conditions:  map[string]interface{}{"ip": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}},
+		})
+		require.NoError(b, err)
+		docs[k] = doc
+	}
+
+	for name, c := range map[string]Codec{
+		"json":         JSONCodec{},
+		"gzip-speed":   NewGzipCodec(gzip.BestSpeed),
+		"gzip-default": NewGzipCodec(gzip.DefaultCompression),
+	} {
+		c := c
+		stored := make([][]byte, len(docs))
+		var size int
+		for k, doc := range docs {
+			s, err := c.Encode(doc)
+			require.NoError(b, err)
+			stored[k] = s
+			size += len(s)
+		}
+
+		b.Run("codec="+name, func(b *testing.B) {
+			b.ReportMetric(float64(size), "bytes")
+			for n := 0; n < b.N; n++ {
+				for _, s := range stored {
+					if _, err := c.Decode(s); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
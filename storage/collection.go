@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// collectionPattern is what a collection must look like: segments of lower case letters, digits, underscores, and
+// dashes, separated by slashes and optionally starting with one. Empty segments and dot segments such as ".." are
+// rejected so that a collection can neither reach other backends' data nor end in an empty type.
+var collectionPattern = regexp.MustCompile(`^/?[a-z0-9_-]+(/[a-z0-9_-]+)*$`)
+
+// validateCollection responds with 400 unless every collection matches collectionPattern. It guards every Manager call
+// of the handler because factories may build collections from path segments of the request.
+func validateCollection(collections ...string) error {
+	for _, c := range collections {
+		if !collectionPattern.MatchString(c) {
+			return errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf(`Collection "%s" is invalid, it must consist of segments matching [a-z0-9_-]+ separated by slashes.`, c).
+				WithDetail("collection", c))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestValidateCollection(t *testing.T) {
+	for _, tc := range []struct {
+		collection string
+		valid      bool
+	}{
+		{collection: "/engines/acp/ory/exact/roles", valid: true},
+		{collection: "engines/acp/ory/glob/policies", valid: true},
+		{collection: "tests-audit", valid: true},
+		{collection: "filter_test", valid: true},
+		{collection: ""},
+		{collection: "/"},
+		{collection: "/engines/acp/ory/../roles"},
+		{collection: "../roles"},
+		{collection: "/engines/acp/ory/exact/roles/.."},
+		{collection: "/engines//roles"},
+		{collection: "/engines/acp/ory/exact/"},
+		{collection: "//roles"},
+		{collection: "/engines/acp/ory/Exact/roles"},
+		{collection: "/engines/acp/ory/exact/roles; DROP TABLE rego_data"},
+		{collection: "/engines/acp/ory/exact/roles\n"},
+		{collection: `\engines\roles`},
+	} {
+		t.Run("collection="+tc.collection, func(t *testing.T) {
+			err := validateCollection(tc.collection)
+			if tc.valid {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, herodot.ToDefaultError(err, "").StatusCode())
+		})
+	}
+
+	require.Error(t, validateCollection("/engines/acp/ory/exact/policies", "/engines/acp/ory/exact/.."))
+}
+
+func TestHandler_InvalidCollection(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Upsert(context.Background(), "/tests/collection/roles", "alice", &Role{ID: "alice"}))
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		var p Roles
+		return &ListRequest{Collection: "/tests/" + r.URL.Query().Get("collection") + "/roles", Value: &p}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for collection, code := range map[string]int{
+		"collection":     http.StatusOK,
+		"../collection":  http.StatusBadRequest,
+		"":               http.StatusBadRequest,
+		"collection/../": http.StatusBadRequest,
+	} {
+		res, err := ts.Client().Get(ts.URL + "/roles?collection=" + url.QueryEscape(collection))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, code, res.StatusCode, "%s", collection)
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// CompactPath is the path of Compact as registered by SetMaintenanceRoutes.
+	CompactPath = "/storage/compact"
+
+	// DefaultTombstoneRetention is how long Compact keeps tombstones by default.
+	DefaultTombstoneRetention = 30 * 24 * time.Hour
+
+	// compactLockKey is the lock which keeps compactions of several instances from running at the same time.
+	compactLockKey = "/keto/compact"
+
+	// compactBatchSize is the number of idempotency records Compact deletes at once.
+	compactBatchSize = 100
+)
+
+// WithTombstoneRetention sets how long tombstones are kept before Compact removes them. Defaults to
+// DefaultTombstoneRetention. Zero or less removes all tombstones.
+func WithTombstoneRetention(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.tombstoneRetention = d
+	}
+}
+
+// CompactResponse is the response of Compact.
+//
+// swagger:ignore
+type CompactResponse struct {
+	// Tombstones is the number of tombstones which were removed.
+	Tombstones int `json:"tombstones"`
+
+	// IdempotencyRecords is the number of expired idempotency records which were removed.
+	IdempotencyRecords int `json:"idempotency_records"`
+}
+
+// SetMaintenanceRoutes registers Compact at CompactPath.
+func (h *Handler) SetMaintenanceRoutes(r *httprouter.Router) {
+	r.POST(CompactPath, h.Compact())
+}
+
+// Compact removes the expired idempotency records and the tombstones older than the tombstone retention, see
+// WithTombstoneRetention, and reclaims their space where the backend supports it, see Manager.Compact. It responds
+// with the number of removed entries. Responds with 403 unless destructive operations are enabled, see
+// WithDestructiveOperations.
+//
+// Compaction only removes entries which no request can use anymore, so it is safe alongside other requests. Every
+// step is committed on its own and an interrupted compaction continues where it stopped when it is repeated. A
+// lock keeps compactions of several instances from running at the same time.
+func (h *Handler) Compact() httprouter.Handle {
+	return h.instrument("compact", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		if !h.destructive {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrForbidden.
+				WithReason("Compacting the backend is disabled because destructive operations are not allowed.")))
+			return
+		}
+		if err := h.checkWritable(idempotencyCollection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		unlock, err := h.s.Lock(ctx, compactLockKey, h.lockTTL)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		defer unlock()
+
+		now := time.Now()
+		records, err := h.compactIdempotency(ctx, now)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		retention := h.tombstoneRetention
+		if retention < 0 {
+			retention = 0
+		}
+		tombstones, err := h.s.Compact(ctx, now.Add(-retention))
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		// compaction changes no entry which can be read, so there is no change to notify about.
+		h.sendAudit(ctx, nil)
+		h.h.Write(w, r, &CompactResponse{Tombstones: tombstones, IdempotencyRecords: records})
+	})
+}
+
+// compactIdempotency deletes the idempotency records which expired before the time in batches and returns how many
+// were deleted. Records whose key is used by a write in progress are kept, and so are records written before their
+// key was recorded, which are replaced once their key is used again.
+func (h *Handler) compactIdempotency(ctx context.Context, now time.Time) (int, error) {
+	var records []idempotencyRecord
+	if err := h.s.ListAll(ctx, idempotencyCollection, &records); err != nil {
+		return 0, err
+	}
+
+	var expired []string
+	for _, record := range records {
+		if record.Key != "" && !now.Before(record.Expires) && h.idempotencyKeys.acquire(record.Key) {
+			expired = append(expired, record.Key)
+		}
+	}
+	defer func() {
+		for _, key := range expired {
+			h.idempotencyKeys.release(key)
+		}
+	}()
+
+	var deleted int
+	for start := 0; start < len(expired); start += compactBatchSize {
+		end := start + compactBatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+
+		n, err := h.s.DeleteMany(ctx, idempotencyCollection, expired[start:end])
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
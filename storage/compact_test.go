@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestCompact(t *testing.T) {
+	const collection = "/tests/compact/roles"
+	ctx := context.Background()
+
+	setup := func(opts ...HandlerOption) (*MemoryManager, *httptest.Server) {
+		m := NewMemoryManager()
+		h := NewHandler(m, herodot.NewJSONWriter(nil), append([]HandlerOption{WithSoftDelete(true)}, opts...)...)
+		r := httprouter.New()
+		h.SetMaintenanceRoutes(r)
+		return m, httptest.NewServer(r)
+	}
+
+	compact := func(t *testing.T, ts *httptest.Server) (int, *CompactResponse) {
+		res, err := ts.Client().Post(ts.URL+CompactPath, "application/json", nil)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body CompactResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res.StatusCode, &body
+	}
+
+	t.Run("case=requires destructive operations", func(t *testing.T) {
+		_, ts := setup()
+		defer ts.Close()
+		code, _ := compact(t, ts)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("case=read-only", func(t *testing.T) {
+		_, ts := setup(WithDestructiveOperations(true), WithReadOnly(true))
+		defer ts.Close()
+		code, _ := compact(t, ts)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+
+	t.Run("case=compacts", func(t *testing.T) {
+		m, ts := setup(WithDestructiveOperations(true), WithTombstoneRetention(24*time.Hour))
+		defer ts.Close()
+
+		for _, id := range []string{"old", "recent", "live"} {
+			require.NoError(t, m.Upsert(ctx, collection, id, &Role{ID: id}))
+		}
+		require.NoError(t, m.SoftDelete(ctx, collection, "old"))
+		require.NoError(t, m.SoftDelete(ctx, collection, "recent"))
+		m.tombstones[collection][0].DeletedAt = time.Now().Add(-48 * time.Hour)
+
+		now := time.Now()
+		for key, expires := range map[string]time.Time{"expired": now.Add(-time.Minute), "valid": now.Add(time.Hour)} {
+			require.NoError(t, m.Upsert(ctx, idempotencyCollection, key, &idempotencyRecord{Key: key, Code: http.StatusOK, Expires: expires}))
+		}
+		// records kept before their key was recorded can not be deleted by key.
+		require.NoError(t, m.Upsert(ctx, idempotencyCollection, "unkeyed", &idempotencyRecord{Code: http.StatusOK, Expires: now.Add(-time.Minute)}))
+
+		code, res := compact(t, ts)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, &CompactResponse{Tombstones: 1, IdempotencyRecords: 1}, res)
+
+		deleted, err := m.ListDeleted(ctx, collection)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, "recent", deleted[0].Key)
+
+		for key, exists := range map[string]bool{"expired": false, "valid": true, "unkeyed": true} {
+			found, err := m.Exists(ctx, idempotencyCollection, key)
+			require.NoError(t, err)
+			assert.Equal(t, exists, found, key)
+		}
+		found, err := m.Exists(ctx, collection, "live")
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		// repeating the compaction finds nothing left to remove.
+		code, res = compact(t, ts)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, &CompactResponse{}, res)
+	})
+
+	t.Run("case=skips keys in use", func(t *testing.T) {
+		m := NewMemoryManager()
+		h := NewHandler(m, herodot.NewJSONWriter(nil), WithDestructiveOperations(true))
+		require.NoError(t, m.Upsert(ctx, idempotencyCollection, "busy", &idempotencyRecord{Key: "busy", Expires: time.Now().Add(-time.Minute)}))
+
+		require.True(t, h.idempotencyKeys.acquire("busy"))
+		n, err := h.compactIdempotency(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		h.idempotencyKeys.release("busy")
+		n, err = h.compactIdempotency(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+}
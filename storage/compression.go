@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ory/herodot"
+)
+
+// DefaultCompressionThreshold is the size in bytes above which a response body is compressed.
+const DefaultCompressionThreshold = 1024
+
+// WithCompressionThreshold sets the size in bytes above which responses are gzip compressed if the client accepts it.
+// Smaller responses are not worth the CPU time and are written as they are. A negative threshold disables compression.
+// Defaults to DefaultCompressionThreshold.
+func WithCompressionThreshold(n int) HandlerOption {
+	return func(h *Handler) {
+		h.compressionThreshold = n
+	}
+}
+
+// compressWriter compresses the successful responses of the wrapped writer, see compress. Errors are small and are
+// never compressed.
+type compressWriter struct {
+	herodot.Writer
+	threshold int
+}
+
+func (c *compressWriter) Write(w http.ResponseWriter, r *http.Request, e interface{}) {
+	cw, done := compress(w, r, c.threshold)
+	defer done()
+	c.Writer.Write(cw, r, e)
+}
+
+func (c *compressWriter) WriteCode(w http.ResponseWriter, r *http.Request, code int, e interface{}) {
+	cw, done := compress(w, r, c.threshold)
+	defer done()
+	c.Writer.WriteCode(cw, r, code, e)
+}
+
+func (c *compressWriter) WriteCreated(w http.ResponseWriter, r *http.Request, location string, e interface{}) {
+	cw, done := compress(w, r, c.threshold)
+	defer done()
+	c.Writer.WriteCreated(cw, r, location, e)
+}
+
+// compress returns a response writer which gzip compresses the body once more than threshold bytes have been written,
+// provided that the client accepts gzip. done must be called after the body has been written completely.
+func compress(w http.ResponseWriter, r *http.Request, threshold int) (cw http.ResponseWriter, done func()) {
+	if threshold < 0 || !acceptsGzip(r) {
+		return w, func() {}
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	c := &compressResponseWriter{ResponseWriter: w, threshold: threshold}
+	return c, c.close
+}
+
+// acceptsGzip checks if the Accept-Encoding header of the request allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			parts := strings.Split(coding, ";")
+			if name := strings.TrimSpace(parts[0]); name != "gzip" && name != "*" {
+				continue
+			}
+
+			accepted := true
+			for _, p := range parts[1:] {
+				if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+					weight, err := strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64)
+					accepted = err == nil && weight > 0
+				}
+			}
+			if accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compressResponseWriter holds back the status code and the body until either more than threshold bytes have been
+// written, in which case the body is compressed, or until close is called, in which case it is written as it is.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	threshold int
+
+	code  int
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	plain bool
+}
+
+func (c *compressResponseWriter) WriteHeader(code int) {
+	if c.code == 0 {
+		c.code = code
+	}
+}
+
+func (c *compressResponseWriter) Write(p []byte) (int, error) {
+	if c.gz != nil {
+		return c.gz.Write(p)
+	} else if c.plain {
+		return c.ResponseWriter.Write(p)
+	}
+
+	c.buf.Write(p)
+	if c.buf.Len() <= c.threshold {
+		return len(p), nil
+	}
+
+	if c.Header().Get("Content-Encoding") != "" || !bodyAllowed(c.status()) {
+		// the body is already encoded or must be empty anyway.
+		c.flush()
+		return len(p), nil
+	}
+
+	c.Header().Set("Content-Encoding", "gzip")
+	c.Header().Del("Content-Length")
+	c.ResponseWriter.WriteHeader(c.status())
+	c.gz = gzip.NewWriter(c.ResponseWriter)
+	if _, err := c.gz.Write(c.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	c.buf.Reset()
+	return len(p), nil
+}
+
+func (c *compressResponseWriter) status() int {
+	if c.code == 0 {
+		return http.StatusOK
+	}
+	return c.code
+}
+
+// flush writes the held back status code and body as they are. Later writes are passed through.
+func (c *compressResponseWriter) flush() {
+	c.plain = true
+	c.ResponseWriter.WriteHeader(c.status())
+	if c.buf.Len() > 0 {
+		_, _ = c.ResponseWriter.Write(c.buf.Bytes())
+		c.buf.Reset()
+	}
+}
+
+func (c *compressResponseWriter) close() {
+	if c.gz != nil {
+		_ = c.gz.Close()
+	} else if !c.plain {
+		c.flush()
+	}
+}
+
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestCompression(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/list/:collection", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/compression/" + ps.ByName("collection"), Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/get/:collection/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "/tests/compression/" + ps.ByName("collection"), Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	r.GET("/export/:collection", h.Export(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ExportRequest, error) {
+		return &ExportRequest{Collection: "/tests/compression/" + ps.ByName("collection"), Filename: "roles.jsonl"}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, m.Upsert(context.Background(), "/tests/compression/small", "small", &Role{ID: "small"}))
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("large-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/compression/large", id, &Role{ID: id, Members: []string{"alice", "bob"}}))
+	}
+	require.NoError(t, m.Upsert(context.Background(), "/tests/compression/large", "huge", &Role{ID: "huge", Description: strings.Repeat("a", 2*DefaultCompressionThreshold)}))
+
+	// the default client transparently decompresses responses, so the raw responses are inspected instead.
+	c := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	for k, tc := range []struct {
+		path       string
+		encoding   string
+		compressed bool
+	}{
+		{path: "/list/large", encoding: "gzip", compressed: true},
+		{path: "/list/large", encoding: "deflate, gzip;q=0.5", compressed: true},
+		{path: "/list/large", encoding: "gzip;q=0"},
+		{path: "/list/large", encoding: ""},
+		{path: "/list/small", encoding: "gzip"},
+		{path: "/get/large/huge", encoding: "gzip", compressed: true},
+		{path: "/get/small/small", encoding: "gzip"},
+		{path: "/export/large", encoding: "gzip", compressed: true},
+		{path: "/export/small", encoding: "gzip"},
+		{path: "/get/large/missing", encoding: "gzip"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+tc.path, nil)
+			require.NoError(t, err)
+			if tc.encoding != "" {
+				req.Header.Set("Accept-Encoding", tc.encoding)
+			}
+
+			res, err := c.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			var body io.Reader = res.Body
+			if tc.compressed {
+				assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+				gz, err := gzip.NewReader(res.Body)
+				require.NoError(t, err)
+				body = gz
+			} else {
+				assert.Empty(t, res.Header.Get("Content-Encoding"))
+			}
+
+			b, err := ioutil.ReadAll(body)
+			require.NoError(t, err)
+
+			plain, err := ts.Client().Get(ts.URL + tc.path)
+			require.NoError(t, err)
+			defer plain.Body.Close()
+			expected, err := ioutil.ReadAll(plain.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, plain.StatusCode, res.StatusCode)
+			assert.Equal(t, string(expected), string(b))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/logrusx"
+)
+
+// ConditionRequest is the access request against which the conditions of a policy are evaluated.
+type ConditionRequest struct {
+	Subject  string
+	Action   string
+	Resource string
+
+	// Context is the environment of the request, for example the IP address of the client.
+	Context map[string]interface{}
+}
+
+// Condition restricts a policy to the access requests whose context fulfills it. Conditions are stored in the
+// conditions of a policy as an object with the fields "type" and "options", keyed by the context key which they
+// examine, as in ORY Ladon.
+type Condition interface {
+	// Fulfills checks if the request fulfills the condition which is stored under the key.
+	Fulfills(key string, r *ConditionRequest) bool
+}
+
+// conditionTypes are the known condition types. Each function returns an empty condition of the type into which the
+// options are decoded.
+var conditionTypes = map[string]func() Condition{
+	"StringEqualCondition":      func() Condition { return new(StringEqualCondition) },
+	"CIDRCondition":             func() Condition { return new(CIDRCondition) },
+	"ResourceContainsCondition": func() Condition { return new(ResourceContainsCondition) },
+}
+
+// StringEqualCondition is fulfilled if the context value is the string Equals.
+type StringEqualCondition struct {
+	Equals string `json:"equals"`
+}
+
+func (c *StringEqualCondition) Fulfills(key string, r *ConditionRequest) bool {
+	s, ok := r.Context[key].(string)
+	return ok && s == c.Equals
+}
+
+// CIDRCondition is fulfilled if the context value is an IP address within the network CIDR, or a network which
+// overlaps it.
+type CIDRCondition struct {
+	CIDR string `json:"cidr"`
+}
+
+func (c *CIDRCondition) Fulfills(key string, r *ConditionRequest) bool {
+	s, ok := r.Context[key].(string)
+	if !ok {
+		return false
+	}
+
+	_, network, err := net.ParseCIDR(c.CIDR)
+	if err != nil {
+		return false
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return network.Contains(ip)
+	}
+	_, other, err := net.ParseCIDR(s)
+	return err == nil && (network.Contains(other.IP) || other.Contains(network.IP))
+}
+
+// ResourceContainsCondition is fulfilled if the resource of the request contains Value as a whole part, that is
+// surrounded by Delimiter or at either end of the resource. Without a delimiter, any substring matches.
+type ResourceContainsCondition struct {
+	Value     string `json:"value"`
+	Delimiter string `json:"delimiter"`
+}
+
+func (c *ResourceContainsCondition) Fulfills(_ string, r *ConditionRequest) bool {
+	return strings.Contains(c.Delimiter+r.Resource+c.Delimiter, c.Delimiter+c.Value+c.Delimiter)
+}
+
+// parseCondition decodes a condition as stored in a policy. It fails if the type is unknown or the options are
+// malformed.
+func parseCondition(stored interface{}) (Condition, error) {
+	b, err := json.Marshal(stored)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var c struct {
+		Type    string          `json:"type"`
+		Options json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	newCondition, ok := conditionTypes[c.Type]
+	if !ok {
+		return nil, errors.Errorf(`condition type "%s" is unknown`, c.Type)
+	}
+
+	condition := newCondition()
+	if len(c.Options) > 0 && string(c.Options) != "null" {
+		if err := json.Unmarshal(c.Options, condition); err != nil {
+			return nil, errors.Wrapf(err, `options of condition type "%s" are malformed`, c.Type)
+		}
+	}
+	return condition, nil
+}
+
+// fulfillsConditions checks if the request fulfills every condition of the policy. A condition which can not be
+// parsed fails closed: it is fulfilled for a deny policy and not for an allow policy, so that it never grants access
+// by mistake. Such conditions are logged as a warning if the logger is not nil.
+func (p *Policy) fulfillsConditions(r *ConditionRequest, l *logrusx.Logger) bool {
+	for key, stored := range p.Conditions {
+		c, err := parseCondition(stored)
+		if err != nil {
+			outcome := "does not match"
+			if p.Effect == effectDeny {
+				outcome = "matches"
+			}
+			if l != nil {
+				l.WithError(err).
+					WithField("policy", p.ID).
+					WithField("condition", key).
+					Warnf("Unable to evaluate the condition, so the policy is treated as if it %s.", outcome)
+			}
+			if p.Effect == effectDeny {
+				continue
+			}
+			return false
+		}
+
+		if !c.Fulfills(key, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/logrusx"
+)
+
+func TestConditions(t *testing.T) {
+	for k, tc := range []struct {
+		condition map[string]interface{}
+		key       string
+		request   ConditionRequest
+		fulfilled bool
+	}{
+		{
+			condition: map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "acme"}},
+			key:       "tenant", request: ConditionRequest{Context: map[string]interface{}{"tenant": "acme"}}, fulfilled: true,
+		},
+		{
+			condition: map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "acme"}},
+			key:       "tenant", request: ConditionRequest{Context: map[string]interface{}{"tenant": "other"}},
+		},
+		{
+			condition: map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "1"}},
+			key:       "tenant", request: ConditionRequest{Context: map[string]interface{}{"tenant": 1}},
+		},
+		{
+			condition: map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "acme"}},
+			key:       "tenant", request: ConditionRequest{},
+		},
+		{
+			condition: map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "192.168.0.0/16"}},
+			key:       "ip", request: ConditionRequest{Context: map[string]interface{}{"ip": "192.168.178.1"}}, fulfilled: true,
+		},
+		{
+			condition: map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "192.168.0.0/16"}},
+			key:       "ip", request: ConditionRequest{Context: map[string]interface{}{"ip": "192.168.178.0/24"}}, fulfilled: true,
+		},
+		{
+			condition: map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "192.168.0.0/16"}},
+			key:       "ip", request: ConditionRequest{Context: map[string]interface{}{"ip": "92.168.178.1"}},
+		},
+		{
+			condition: map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "192.168.0.0/16"}},
+			key:       "ip", request: ConditionRequest{Context: map[string]interface{}{"ip": "not an ip"}},
+		},
+		{
+			condition: map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "malformed"}},
+			key:       "ip", request: ConditionRequest{Context: map[string]interface{}{"ip": "192.168.178.1"}},
+		},
+		{
+			condition: map[string]interface{}{"type": "ResourceContainsCondition", "options": map[string]interface{}{"value": "foo:bar", "delimiter": ":"}},
+			request:   ConditionRequest{Resource: "foo:bar:baz"}, fulfilled: true,
+		},
+		{
+			condition: map[string]interface{}{"type": "ResourceContainsCondition", "options": map[string]interface{}{"value": "foo:ba", "delimiter": ":"}},
+			request:   ConditionRequest{Resource: "foo:bar"},
+		},
+		{
+			condition: map[string]interface{}{"type": "ResourceContainsCondition", "options": map[string]interface{}{"value": "foo:ba"}},
+			request:   ConditionRequest{Resource: "foo:bar"}, fulfilled: true,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			c, err := parseCondition(tc.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tc.fulfilled, c.Fulfills(tc.key, &tc.request))
+		})
+	}
+
+	for k, stored := range []interface{}{
+		map[string]interface{}{"type": "UnknownCondition"},
+		map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": 1}},
+		"not an object",
+	} {
+		t.Run(fmt.Sprintf("case=malformed-%d", k), func(t *testing.T) {
+			_, err := parseCondition(stored)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEvaluator_Conditions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(ctx, "conditions", map[string]interface{}{
+		"allow-office": &Policy{ID: "allow-office", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow",
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}}},
+		"deny-tenant": &Policy{ID: "deny-tenant", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny",
+			Conditions: map[string]interface{}{"tenant": map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "blocked"}}}},
+		"allow-unknown": &Policy{ID: "allow-unknown", Subjects: []string{"carol"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow",
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "UnknownCondition"}}},
+		"deny-unknown": &Policy{ID: "deny-unknown", Subjects: []string{"dave"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny",
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "UnknownCondition"}}},
+		"allow-dave": &Policy{ID: "allow-dave", Subjects: []string{"dave"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+	}))
+
+	hook := new(test.Hook)
+	e := NewEvaluator(m, "conditions", WithEvaluatorLogger(logrusx.New("", "", logrusx.WithHook(hook), logrusx.ForceLevel(logrus.WarnLevel))))
+	for k, tc := range []struct {
+		subject   string
+		env       map[string]interface{}
+		allowedBy []string
+		deniedBy  []string
+		warnings  int
+	}{
+		{subject: "alice", env: map[string]interface{}{"ip": "10.1.2.3"}, allowedBy: []string{"allow-office"}, deniedBy: []string{}},
+		{subject: "alice", env: map[string]interface{}{"ip": "192.168.1.1"}, allowedBy: []string{}, deniedBy: []string{}},
+		{subject: "alice", allowedBy: []string{}, deniedBy: []string{}},
+		{subject: "bob", env: map[string]interface{}{"ip": "10.1.2.3", "tenant": "acme"}, allowedBy: []string{"allow-office"}, deniedBy: []string{}},
+		{subject: "bob", env: map[string]interface{}{"ip": "10.1.2.3", "tenant": "blocked"}, allowedBy: []string{"allow-office"}, deniedBy: []string{"deny-tenant"}},
+		{subject: "carol", env: map[string]interface{}{"ip": "10.1.2.3"}, allowedBy: []string{}, deniedBy: []string{}, warnings: 1},
+		{subject: "dave", allowedBy: []string{"allow-dave"}, deniedBy: []string{"deny-unknown"}, warnings: 1},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			hook.Reset()
+			d, err := e.Decide(ctx, tc.subject, "read", "articles", tc.env, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.allowedBy, d.AllowedBy)
+			assert.Equal(t, tc.deniedBy, d.DeniedBy)
+			assert.Equal(t, len(tc.allowedBy) > 0 && len(tc.deniedBy) == 0, d.Allowed)
+
+			require.Len(t, hook.AllEntries(), tc.warnings)
+			for _, entry := range hook.AllEntries() {
+				assert.Equal(t, logrus.WarnLevel, entry.Level)
+				assert.Equal(t, "ip", entry.Data["condition"])
+			}
+		})
+	}
+}
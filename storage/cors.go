@@ -0,0 +1,14 @@
+package storage
+
+var (
+	// CORSRequestHeaders are the request headers besides the CORS-safelisted ones which the handler reads. Browser
+	// clients can only send them to another origin if the CORS configuration allows them.
+	CORSRequestHeaders = []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Range", "Range",
+		IdempotencyKeyHeader, allowProtectedHeader}
+
+	// CORSResponseHeaders are the response headers besides the CORS-safelisted ones which the handler writes. Browser
+	// clients can only read them from another origin if the CORS configuration exposes them.
+	CORSResponseHeaders = []string{"ETag", "Location", "Content-Location", "Content-Disposition", "Content-Range",
+		"Accept-Ranges", "Link", "Warning", "Retry-After", "Idempotent-Replayed", "X-Dry-Run", "X-Duplicate-Of",
+		"X-Max-Limit", "X-Next-Page-Token", "X-Total-Count"}
+)
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// pageTokenParam is the query parameter which switches a list request to cursor pagination.
+const pageTokenParam = "page_token"
+
+// cursorUnsupportedKeys are query parameters which contradict the ID order of cursor pagination.
+var cursorUnsupportedKeys = []string{"offset", "sort", "order"}
+
+func encodePageToken(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodePageToken(token string) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" is malformed.`, pageTokenParam))
+	}
+	return string(id), nil
+}
+
+// listCursor lists the page after the ID in the page token, ordered by ID. An empty page token starts at the first
+// ID. It returns the number of all matching entries and the page token of the next page, which is empty on the last
+// page. Unlike offsets, the page token stays valid if entries before it are added or removed.
+func (h *Handler) listCursor(ctx context.Context, l *ListRequest, m url.Values, limit int) (int, string, error) {
+	for _, k := range cursorUnsupportedKeys {
+		if _, ok := m[k]; ok {
+			return 0, "", errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" can not be combined with "%s".`, k, pageTokenParam))
+		}
+	}
+
+	after, err := decodePageToken(m.Get(pageTokenParam))
+	if err != nil {
+		return 0, "", err
+	}
+
+	if h.filters.isFilter(l.Collection, m) {
+		return h.listCursorFiltered(ctx, l, m, after, limit)
+	}
+
+	if err := h.s.ListAfter(ctx, l.Collection, after, limit, l.Value); err != nil {
+		return 0, "", err
+	}
+
+	// the next page starts after the last entry of the backend, even if the remaining filters remove that entry.
+	ids, err := elementIDs(l.Value)
+	if err != nil {
+		return 0, "", err
+	}
+	var next string
+	if len(ids) > 0 && len(ids) == limit {
+		next = encodePageToken(ids[len(ids)-1])
+	}
+
+	total, err := h.s.Count(ctx, l.Collection)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := h.filter(l, m, 0, limit); err != nil {
+		return 0, "", err
+	}
+	return total, next, nil
+}
+
+// listCursorFiltered applies the filters to the whole collection, which sorts it by ID, and then pages through it.
+func (h *Handler) listCursorFiltered(ctx context.Context, l *ListRequest, m url.Values, after string, limit int) (int, string, error) {
+	if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
+		return 0, "", err
+	}
+	before := length(l.Value)
+	if err := h.filter(l, m, 0, math.MaxInt32); err != nil {
+		return 0, "", err
+	}
+
+	ids, err := elementIDs(l.Value)
+	if err != nil {
+		return 0, "", err
+	}
+
+	start := len(ids)
+	for k, id := range ids {
+		if id > after {
+			start = k
+			break
+		}
+	}
+	end := start + limit
+	if end > len(ids) || limit < 0 {
+		end = len(ids)
+	}
+
+	var next string
+	if end < len(ids) && end > start {
+		next = encodePageToken(ids[end-1])
+	}
+	h.debugFilter(ctx, l.Collection, m, before, len(ids), start, end)
+
+	v := reflect.ValueOf(l.Value).Elem()
+	v.Set(v.Slice(start, end))
+	return len(ids), next, nil
+}
+
+// elementIDs returns the "id" of every element of the slice value points to.
+func elementIDs(value interface{}) ([]string, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to page through list request of type %T.", value))
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var elements []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &elements); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to page through list request of type %T: %s", value, err))
+	}
+
+	ids := make([]string, len(elements))
+	for k, e := range elements {
+		ids[k] = e.ID
+	}
+	return ids, nil
+}
+
+// cursorHeader sets the X-Total-Count header and, unless this is the last page, the X-Next-Page-Token header and an
+// RFC 5988 Link header to the next page.
+func cursorHeader(w http.ResponseWriter, u *url.URL, total, limit int, next string) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	links := []string{cursorLink(u, "first", limit, "")}
+	if next != "" {
+		w.Header().Set("X-Next-Page-Token", next)
+		links = append(links, cursorLink(u, "next", limit, next))
+	}
+	w.Header().Set("Link", strings.Join(links, ","))
+}
+
+func cursorLink(u *url.URL, rel string, limit int, token string) string {
+	uu := *u
+	q := uu.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set(pageTokenParam, token)
+	uu.RawQuery = q.Encode()
+	return fmt.Sprintf("<%s>; rel=\"%s\"", uu.String(), rel)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// dedupeParam is the query parameter which makes Upsert return an existing entry with the same content instead of
+// writing a duplicate.
+const dedupeParam = "dedupe"
+
+// contentFields are the fields which identify an entry rather than describe it, so they are ignored when comparing
+// the content of entries.
+var contentFields = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+// contentHash returns the hash of the canonical form of the value, see canonicalize, without its ID and timestamps.
+// Values which only differ in these or in the order, the repetition, or the casing normalized by canonicalize have the
+// same hash.
+func contentHash(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	b, _, err = mapObject(b, func(key string, v json.RawMessage) (json.RawMessage, bool, error) {
+		if contentFields[key] {
+			return nil, false, nil
+		}
+		return canonicalField(key, v)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Encoding the decoded object sorts its fields, so that their order does not matter either.
+	var content interface{}
+	if err := json.Unmarshal(b, &content); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if b, err = json.Marshal(content); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// duplicateOf returns the key and the value of an entry of the collection other than key whose content equals that
+// of the value. The key is empty if there is none.
+func (h *Handler) duplicateOf(ctx context.Context, collection, key string, value interface{}) (string, json.RawMessage, error) {
+	hash, err := contentHash(value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var entries []json.RawMessage
+	if err := h.s.ListAll(ctx, collection, &entries); err != nil {
+		return "", nil, err
+	}
+
+	for _, e := range entries {
+		var id struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(e, &id); err != nil || id.ID == "" || id.ID == key {
+			continue
+		}
+
+		other, err := contentHash(e)
+		if err != nil {
+			return "", nil, err
+		}
+		if other == hash {
+			return id.ID, e, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// writeDuplicate responds with the stored entry which the upsert duplicates. The Content-Location header is the path
+// of the duplicated entry.
+func (h *Handler) writeDuplicate(w http.ResponseWriter, r *http.Request, key string, value json.RawMessage) {
+	tag, err := etag(value)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Content-Location", path.Join(r.URL.Path, url.PathEscape(key)))
+	w.Header().Set("X-Duplicate-Of", key)
+	h.h.Write(w, r, value)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestUpsertDedupe(t *testing.T) {
+	const collection = "/tests/dedupe/policies"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.PUT("/policies", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+		var p Policy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return nil, err
+		}
+		return &UpsertRequest{Collection: collection, Key: p.ID, Value: &p}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	upsert := func(t *testing.T, query, body string) (*http.Response, Policy) {
+		req, err := http.NewRequest("PUT", ts.URL+"/policies"+query, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var p Policy
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&p))
+		return res, p
+	}
+
+	ids := func(t *testing.T) []string {
+		var ps Policies
+		require.NoError(t, m.ListAll(context.Background(), collection, &ps))
+		var ids []string
+		for _, p := range ps {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	res, p := upsert(t, "?dedupe=true", `{"id":"a","subjects":["bob","alice"],"resources":["articles"],"actions":["read","write"],"effect":"allow"}`)
+	assert.Empty(t, res.Header.Get("X-Duplicate-Of"))
+	assert.Equal(t, "a", p.ID)
+
+	t.Run("case=equal content resolves to the stored entry", func(t *testing.T) {
+		res, p := upsert(t, "?dedupe=true", `{"id":"b","subjects":["alice","bob","alice"],"resources":["articles"],"actions":["write","read"],"effect":"Allow"}`)
+		assert.Equal(t, "a", res.Header.Get("X-Duplicate-Of"))
+		assert.Equal(t, "/policies/a", res.Header.Get("Content-Location"))
+		assert.NotEmpty(t, res.Header.Get("ETag"))
+		assert.Equal(t, "a", p.ID)
+		assert.Equal(t, []string{"bob", "alice"}, p.Subjects)
+		assert.Equal(t, []string{"a"}, ids(t))
+	})
+
+	t.Run("case=same key is written", func(t *testing.T) {
+		res, _ := upsert(t, "?dedupe=true", `{"id":"a","subjects":["alice","bob"],"resources":["articles"],"actions":["read","write"],"effect":"allow"}`)
+		assert.Empty(t, res.Header.Get("X-Duplicate-Of"))
+		assert.Equal(t, []string{"a"}, ids(t))
+	})
+
+	t.Run("case=different content is written", func(t *testing.T) {
+		res, _ := upsert(t, "?dedupe=true", `{"id":"c","subjects":["alice","bob"],"resources":["articles"],"actions":["read"],"effect":"allow"}`)
+		assert.Empty(t, res.Header.Get("X-Duplicate-Of"))
+		assert.Equal(t, []string{"a", "c"}, ids(t))
+	})
+
+	t.Run("case=duplicates are allowed without dedupe", func(t *testing.T) {
+		res, _ := upsert(t, "", `{"id":"d","subjects":["alice","bob"],"resources":["articles"],"actions":["read","write"],"effect":"allow"}`)
+		assert.Empty(t, res.Header.Get("X-Duplicate-Of"))
+		assert.Equal(t, []string{"a", "c", "d"}, ids(t))
+	})
+
+	t.Run("case=invalid parameter", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", ts.URL+"/policies?dedupe=maybe", bytes.NewBufferString(`{"id":"e"}`))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestContentHash(t *testing.T) {
+	a, err := contentHash(&Policy{ID: "a", Subjects: []string{"b", "a"}, Effect: "deny", Conditions: map[string]interface{}{"x": map[string]interface{}{"type": "StringEqualCondition"}}})
+	require.NoError(t, err)
+	b, err := contentHash(&Policy{ID: "b", Subjects: []string{"a", "b", "a"}, Effect: "DENY", Conditions: map[string]interface{}{"x": map[string]interface{}{"type": "StringEqualCondition"}}})
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	c, err := contentHash(&Policy{ID: "a", Subjects: []string{"b", "a"}, Effect: "deny", Description: "other"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// distinctCacheTTL is how long the distinct values of a collection are cached. Writes through the handler drop them
+// at once, the TTL bounds how long writes through other handlers, for example of other instances, go unnoticed.
+const distinctCacheTTL = time.Minute
+
+// distinctFields maps the values of the query parameter "field" of Distinct to the values of a policy.
+var distinctFields = map[string]func(p *Policy) []string{
+	"action":   func(p *Policy) []string { return p.Actions },
+	"resource": func(p *Policy) []string { return p.Resources },
+	"subject":  func(p *Policy) []string { return p.Subjects },
+}
+
+// DistinctRequest is a request for the distinct values of a field of the policies in a collection.
+type DistinctRequest struct {
+	Collection string
+}
+
+// Distinct responds with the sorted distinct values of the field of all policies in the collection, which is chosen
+// by the query parameter "field" set to "action", "resource", or "subject". Values are taken as they are stored, so
+// patterns are listed as patterns. The values are paginated like List. They are cached until the next write to the
+// collection through the handler, and for at most a minute.
+func (h *Handler) Distinct(factory func(context.Context, *http.Request, httprouter.Params) (*DistinctRequest, error)) httprouter.Handle {
+	return h.instrument("distinct", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		d, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		field := r.URL.Query().Get("field")
+		if _, ok := distinctFields[field]; !ok {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf(`Query parameter "field" must be one of "action", "resource", or "subject" but got "%s".`, field)))
+			return
+		}
+
+		limit, offset, err := h.parsePagination(w, r, d.Collection)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		values, err := h.distinctValues(ctx, d.Collection, field)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx)
+		paginationHeader(w, r.URL, len(values), limit, offset)
+		start, end := index(limit, offset, len(values))
+		h.h.Write(w, r, values[start:end])
+	})
+}
+
+// distinctValues returns the cached distinct values of the field or computes them from all policies of the
+// collection. The returned slice is shared and must not be changed.
+func (h *Handler) distinctValues(ctx context.Context, collection, field string) ([]string, error) {
+	key := distinctKey{collection: collection, field: field}
+	if values, ok := h.distinct.get(key); ok {
+		return values, nil
+	}
+
+	version := h.distinct.version(collection)
+	var policies Policies
+	if err := h.s.ListAll(ctx, collection, &policies); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	values := []string{}
+	for k := range policies {
+		for _, v := range distinctFields[field](&policies[k]) {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Strings(values)
+
+	h.distinct.add(key, values, version)
+	return values, nil
+}
+
+type distinctKey struct {
+	collection string
+	field      string
+}
+
+type distinctEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// distinctCache holds the results of Distinct. Like CachedManager, it counts the writes per collection so that a
+// result which raced with a write is not cached. The zero value is an empty cache.
+type distinctCache struct {
+	sync.Mutex
+	entries  map[distinctKey]*distinctEntry
+	versions map[string]uint64
+}
+
+func (c *distinctCache) get(key distinctKey) ([]string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) {
+		return e.values, true
+	}
+	return nil, false
+}
+
+func (c *distinctCache) version(collection string) uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.versions[collection]
+}
+
+func (c *distinctCache) add(key distinctKey, values []string, version uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.versions[key.collection] != version {
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[distinctKey]*distinctEntry{}
+	}
+	c.entries[key] = &distinctEntry{values: values, expires: time.Now().Add(distinctCacheTTL)}
+}
+
+// invalidate drops the cached values of the collection.
+func (c *distinctCache) invalidate(collection string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.versions == nil {
+		c.versions = map[string]uint64{}
+	}
+	c.versions[collection]++
+	for key := range c.entries {
+		if key.collection == collection {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type countingManager struct {
+	*MemoryManager
+	listAll int32
+}
+
+func (m *countingManager) ListAll(ctx context.Context, collection string, value interface{}) error {
+	atomic.AddInt32(&m.listAll, 1)
+	return m.MemoryManager.ListAll(ctx, collection, value)
+}
+
+func TestDistinct(t *testing.T) {
+	const collection = "/tests/distinct/policies"
+
+	m := &countingManager{MemoryManager: NewMemoryManager()}
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/distinct", h.Distinct(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DistinctRequest, error) {
+		return &DistinctRequest{Collection: collection}, nil
+	}))
+	r.PUT("/policies", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+		var p Policy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return nil, err
+		}
+		return &UpsertRequest{Collection: collection, Key: p.ID, Value: &p}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, m.Upsert(context.Background(), collection, "p1", &Policy{ID: "p1", Actions: []string{"write", "read"}}))
+	require.NoError(t, m.Upsert(context.Background(), collection, "p2", &Policy{ID: "p2", Actions: []string{"read", "delete"}}))
+
+	distinct := func(t *testing.T, query string) ([]string, *http.Response) {
+		res, err := ts.Client().Get(ts.URL + "/distinct" + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var values []string
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&values))
+		return values, res
+	}
+
+	values, res := distinct(t, "?field=action")
+	assert.Equal(t, []string{"delete", "read", "write"}, values)
+	assert.Equal(t, "3", res.Header.Get("X-Total-Count"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&m.listAll))
+
+	t.Run("case=pagination", func(t *testing.T) {
+		values, _ := distinct(t, "?field=action&limit=2&offset=1")
+		assert.Equal(t, []string{"read", "write"}, values)
+		values, _ = distinct(t, "?field=action&offset=5")
+		assert.Equal(t, []string{}, values)
+	})
+
+	t.Run("case=cached", func(t *testing.T) {
+		assert.EqualValues(t, 1, atomic.LoadInt32(&m.listAll))
+		values, _ := distinct(t, "?field=subject")
+		assert.Equal(t, []string{}, values)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&m.listAll))
+	})
+
+	t.Run("case=writes invalidate the cache", func(t *testing.T) {
+		req, err := http.NewRequest("PUT", ts.URL+"/policies", strings.NewReader(`{"id":"p3","actions":["audit"]}`))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		values, _ := distinct(t, "?field=action")
+		assert.Equal(t, []string{"audit", "delete", "read", "write"}, values)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&m.listAll))
+	})
+
+	t.Run("case=unknown field", func(t *testing.T) {
+		res, err := ts.Client().Get(ts.URL + "/distinct?field=effect")
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// EffectivePoliciesRequest is a request for the permissions of a subject.
+type EffectivePoliciesRequest struct {
+	// PolicyCollection and RoleCollection are the collections of the policies and of the roles of one flavor.
+	PolicyCollection string
+	RoleCollection   string
+
+	Subject string
+}
+
+// EffectivePolicies are the permissions of a subject, see Handler.EffectivePolicies.
+//
+// swagger:ignore
+type EffectivePolicies struct {
+	// Subject is the subject of the request.
+	Subject string `json:"subject"`
+
+	// Roles are the IDs of the roles the subject belongs to, directly or through other roles, closest first. They
+	// include the roles with a scope, which only count for the resources matching the scope.
+	Roles []string `json:"roles"`
+
+	// Permissions maps each resource to its actions, as written in the allow policies of the subject.
+	Permissions map[string]map[string]*EffectivePermission `json:"permissions"`
+}
+
+// EffectivePermission is the outcome of an action on a resource together with the policies which cause it.
+//
+// swagger:ignore
+type EffectivePermission struct {
+	// Allowed is false if a deny policy overrides the allow policies.
+	Allowed bool `json:"allowed"`
+
+	// AllowedBy are the IDs of the allow policies which grant the action on the resource.
+	AllowedBy []string `json:"allowed_by"`
+
+	// DeniedBy are the IDs of the deny policies which override the grant.
+	DeniedBy []string `json:"denied_by"`
+}
+
+// EffectivePolicies responds with what the subject of the request may do. Policies apply to the subject if one of
+// their subjects matches the subject itself or one of the roles it belongs to, including patterns as in the subject
+// filter of ListByQuery. Every resource and action of the applying allow policies is listed once, together with the
+// applying deny policies whose resources and actions match it and which therefore override it. A role with a scope only
+// counts for the resources of a policy which match the scope, see Role.Scope, so that a policy which only applies
+// through such a role lists just those resources. Conditions are not evaluated, so conditional policies are treated as
+// if their conditions hold. Policies outside of their validity window do not apply, see Policy.NotBefore and
+// Policy.NotAfter.
+func (h *Handler) EffectivePolicies(factory func(context.Context, *http.Request, httprouter.Params) (*EffectivePoliciesRequest, error)) httprouter.Handle {
+	return h.instrument("effective_policies", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		e, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, e.PolicyCollection)
+
+		if err := validateCollection(e.PolicyCollection, e.RoleCollection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if e.Subject == "" {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason(`Query parameter "subject" must be set.`)))
+			return
+		}
+
+		var roles Roles
+		if err := h.s.ListAll(ctx, e.RoleCollection, &roles); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var policies Policies
+		if err := h.s.ListAll(ctx, e.PolicyCollection, &policies); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		res, err := effectivePolicies(e.Subject, roles, policies, time.Now())
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx, e.Subject)
+		h.h.Write(w, r, res)
+	})
+}
+
+// effectivePolicies computes the permissions of the subject from the policies which apply at the time.
+func effectivePolicies(subject string, roles Roles, policies Policies, now time.Time) (*EffectivePolicies, error) {
+	res := &EffectivePolicies{
+		Subject:     subject,
+		Roles:       []string{},
+		Permissions: map[string]map[string]*EffectivePermission{},
+	}
+
+	subjects := []string{subject}
+	for _, r := range roles.ancestors(subject) {
+		res.Roles = append(res.Roles, r.ID)
+		subjects = append(subjects, r.ID)
+	}
+
+	// the roles which count for a resource are the global ones and those whose scope matches it. Roles with a
+	// malformed scope match no resource.
+	o := &filterOptions{match: MatchAny, literal: true}
+	scopes := &filterOptions{match: MatchAny, literal: true}
+	inScope := map[string][]string{}
+	subjectsFor := func(resource string) []string {
+		if s, ok := inScope[resource]; ok {
+			return s
+		}
+		s := append([]string{subject}, roles.inScope(resource, scopes).memberOf(subject)...)
+		inScope[resource] = s
+		return s
+	}
+
+	var allows, denies []*Policy
+	for k := range policies {
+		p := policies[k].withSubjects(subjects, o)
+		if p == nil || !p.activeAt(now) {
+			continue
+		}
+
+		switch p.Effect {
+		case effectAllow:
+			allows = append(allows, p)
+		case effectDeny:
+			denies = append(denies, p)
+		}
+	}
+
+	for _, p := range allows {
+		for _, resource := range p.Resources {
+			if p.withSubjects(subjectsFor(resource), o) == nil {
+				continue
+			}
+			if res.Permissions[resource] == nil {
+				res.Permissions[resource] = map[string]*EffectivePermission{}
+			}
+			for _, action := range p.Actions {
+				perm := res.Permissions[resource][action]
+				if perm == nil {
+					perm = &EffectivePermission{AllowedBy: []string{}, DeniedBy: []string{}}
+					res.Permissions[resource][action] = perm
+				}
+				perm.AllowedBy = appendUnique(perm.AllowedBy, p.ID)
+			}
+		}
+	}
+
+	// a deny overrides a permission if it names the same resource and action or has patterns matching them.
+	all := &filterOptions{match: MatchAll, literal: true}
+	for resource, actions := range res.Permissions {
+		for action, perm := range actions {
+			for _, p := range denies {
+				if p.withSubjects(subjectsFor(resource), o).withResources([]string{resource}, all).withActions([]string{action}, all) != nil {
+					perm.DeniedBy = appendUnique(perm.DeniedBy, p.ID)
+				}
+			}
+			perm.Allowed = len(perm.DeniedBy) == 0
+			sort.Strings(perm.AllowedBy)
+			sort.Strings(perm.DeniedBy)
+		}
+	}
+
+	if o.err != nil {
+		return nil, o.err
+	} else if all.err != nil {
+		return nil, all.err
+	}
+	return res, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	if contains(value, values) {
+		return values
+	}
+	return append(values, value)
+}
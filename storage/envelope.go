@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"net/http"
+)
+
+// envelopeParam is the query parameter which wraps the page of a list response in a ListEnvelope.
+const envelopeParam = "envelope"
+
+// ListEnvelope is the response of List if the query parameter "envelope" is "true". It carries the pagination
+// information of the headers in the body, for clients which can not read response headers.
+//
+// swagger:ignore
+type ListEnvelope struct {
+	// Items is the page of the collection.
+	Items interface{} `json:"items"`
+
+	// Total is the number of entries matching the request, as in the X-Total-Count header.
+	Total int `json:"total"`
+
+	// Limit is the maximum number of items of the page.
+	Limit int `json:"limit"`
+
+	// Offset is the offset of the page. It is always 0 for cursor pagination.
+	Offset int `json:"offset"`
+
+	// NextPageToken is the token of the next page for cursor pagination, as in the X-Next-Page-Token header. It is
+	// left out on the last page and for offset pagination.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// writeList writes the page of a list response, wrapped in a ListEnvelope if the request asks for it. The items are
+// normalized and projected as by write, the envelope itself is not.
+func (h *Handler) writeList(w http.ResponseWriter, r *http.Request, page interface{}, e ListEnvelope) {
+	envelope, err := boolQuery(r, envelopeParam)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	} else if !envelope {
+		h.write(w, r, page)
+		return
+	}
+
+	if e.Items, err = prepare(r, page); err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	}
+	h.writeValue(w, r, &e)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+var (
+	// ErrNotFound is returned by Manager implementations if the key, the tombstone, or the member an operation
+	// requires does not exist. Errors which describe what is missing wrap it and are matched with errors.Is.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned by Manager implementations if an operation fails because a key exists already. Errors
+	// which describe the conflict wrap it and are matched with errors.Is.
+	ErrConflict = errors.New("conflict")
+)
+
+// managerError is an error of a Manager which wraps ErrNotFound or ErrConflict and describes the failed operation.
+type managerError struct {
+	err    error
+	reason string
+}
+
+func (e *managerError) Error() string {
+	return e.err.Error() + ": " + e.reason
+}
+
+func (e *managerError) Unwrap() error {
+	return e.err
+}
+
+func (e *managerError) Reason() string {
+	return e.reason
+}
+
+// notFoundf returns an error wrapping ErrNotFound with the reason.
+func notFoundf(format string, args ...interface{}) error {
+	return errors.WithStack(&managerError{err: ErrNotFound, reason: fmt.Sprintf(format, args...)})
+}
+
+// conflictf returns an error wrapping ErrConflict with the reason.
+func conflictf(format string, args ...interface{}) error {
+	return errors.WithStack(&managerError{err: ErrConflict, reason: fmt.Sprintf(format, args...)})
+}
+
+// isNotFound checks if the error signals a missing key, as opposed to for example a failed connection.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// httpError translates ErrNotFound and ErrConflict to the errors of the responses 404 and 409, keeping the reason of
+// the original error. Errors which already carry a status code and all other errors are returned as they are.
+func httpError(err error) error {
+	var coded interface{ StatusCode() int }
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+
+	var e *herodot.DefaultError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		e = &herodot.ErrNotFound
+	case errors.Is(err, ErrConflict):
+		e = &herodot.ErrConflict
+	default:
+		return err
+	}
+
+	var r interface{ Reason() string }
+	if errors.As(err, &r) && r.Reason() != "" {
+		e = e.WithReason(r.Reason())
+	}
+	return errors.WithStack(e.WithWrap(err))
+}
+
+// errorWriter writes the sentinel errors of the Manager contract with their status codes, see httpError.
+type errorWriter struct {
+	herodot.Writer
+}
+
+func (w *errorWriter) WriteError(rw http.ResponseWriter, r *http.Request, err error, opts ...herodot.Option) {
+	w.Writer.WriteError(rw, r, httpError(err), opts...)
+}
+
+// withKey replaces a not found error by one which names the collection and the key in its details. The reason of the
+// original error is kept if it has one. Other errors are returned as they are.
+func withKey(err error, collection, key string) error {
+	if !isNotFound(err) {
+		return err
+	}
+
+	reason := "Unable to locate key " + key + " in collection " + collection + "."
+	var r interface{ Reason() string }
+	if errors.As(err, &r) && r.Reason() != "" {
+		reason = r.Reason()
+	}
+
+	return errors.WithStack(herodot.ErrNotFound.
+		WithReason(reason).
+		WithDetail("collection", collection).
+		WithDetail("key", key).
+		WithWrap(err))
+}
+
+// withConflictingKey is like withKey for a conflict error, naming the key which exists already.
+func withConflictingKey(err error, collection, key string) error {
+	if !errors.Is(err, ErrConflict) {
+		return err
+	}
+
+	reason := "Key " + key + " exists already in collection " + collection + "."
+	var r interface{ Reason() string }
+	if errors.As(err, &r) && r.Reason() != "" {
+		reason = r.Reason()
+	}
+
+	return errors.WithStack(herodot.ErrConflict.
+		WithReason(reason).
+		WithDetail("collection", collection).
+		WithDetail("key", key).
+		WithWrap(err))
+}
+
+// errPreconditionFailed is returned if a conditional request does not match the stored value.
+var errPreconditionFailed = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusPreconditionFailed),
+	ErrorField:  "The precondition of the request failed",
+	CodeField:   http.StatusPreconditionFailed,
+}
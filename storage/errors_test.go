@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+// sentinelManager fails every read and write of a single key with err, like a backend which only reports the
+// sentinel errors of the Manager contract.
+type sentinelManager struct {
+	Manager
+	err error
+}
+
+func (m sentinelManager) Get(context.Context, string, string, interface{}) error {
+	return m.err
+}
+
+func (m sentinelManager) Upsert(context.Context, string, string, interface{}) error {
+	return m.err
+}
+
+func (m sentinelManager) Delete(context.Context, string, string) error {
+	return m.err
+}
+
+func TestSentinelErrors(t *testing.T) {
+	const collection = "/tests/sentinel/roles"
+
+	for k, tc := range []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{err: errors.WithStack(ErrNotFound), code: http.StatusNotFound},
+		{err: notFoundf("Role %s has no member %s.", "editors", "alice"), code: http.StatusNotFound, reason: "Role editors has no member alice."},
+		{err: errors.WithStack(ErrConflict), code: http.StatusConflict},
+		{err: conflictf(`Key "%s" can not be created because it exists already.`, "editors"), code: http.StatusConflict, reason: `Key "editors" can not be created because it exists already.`},
+		{err: errors.Wrap(ErrConflict, "duplicate key value violates unique constraint"), code: http.StatusConflict},
+		{err: errors.New("connection refused"), code: http.StatusInternalServerError},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			h := NewHandler(sentinelManager{Manager: NewMemoryManager(), err: tc.err}, herodot.NewJSONWriter(nil))
+			r := httprouter.New()
+			r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+				return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+			}))
+			r.PUT("/roles", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+				return &UpsertRequest{Collection: collection, Key: "editors", Value: &Role{ID: "editors"}}, nil
+			}))
+			r.DELETE("/roles/:id", h.Delete(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteRequest, error) {
+				return &DeleteRequest{Collection: collection, Key: ps.ByName("id")}, nil
+			}))
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			for _, method := range []string{"GET", "PUT", "DELETE"} {
+				t.Run("method="+method, func(t *testing.T) {
+					path := "/roles/editors"
+					if method == "PUT" {
+						path = "/roles"
+					}
+					req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString("{}"))
+					require.NoError(t, err)
+					res, err := ts.Client().Do(req)
+					require.NoError(t, err)
+					defer res.Body.Close()
+					assert.Equal(t, tc.code, res.StatusCode)
+
+					var body struct {
+						Error struct {
+							Code   int    `json:"code"`
+							Reason string `json:"reason"`
+						} `json:"error"`
+					}
+					require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+					assert.Equal(t, tc.code, body.Error.Code)
+					if tc.reason != "" {
+						assert.Equal(t, tc.reason, body.Error.Reason)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	assert.Nil(t, httpError(nil))
+
+	err := httpError(notFoundf("Role %s has no member %s.", "editors", "alice"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	e := herodot.ToDefaultError(err, "")
+	assert.Equal(t, http.StatusNotFound, e.StatusCode())
+	assert.Equal(t, "Role editors has no member alice.", e.Reason())
+
+	// errors which carry a status code already are not changed, even if they wrap a sentinel.
+	coded := errors.WithStack(herodot.ErrForbidden.WithWrap(ErrNotFound))
+	assert.Equal(t, coded, httpError(coded))
+
+	assert.True(t, isNotFound(withKey(errors.WithStack(ErrNotFound), "roles", "editors")))
+	assert.False(t, isNotFound(errors.WithStack(ErrConflict)))
+
+	e = herodot.ToDefaultError(withConflictingKey(errRenameTargetExists("editors", "admins"), "roles", "admins"), "")
+	assert.Equal(t, http.StatusConflict, e.StatusCode())
+	assert.Equal(t, `Key "editors" can not be renamed to "admins" because it exists already.`, e.Reason())
+	assert.Equal(t, map[string]interface{}{"collection": "roles", "key": "admins"}, e.Details())
+	assert.Equal(t, notFoundf("missing").Error(), withConflictingKey(notFoundf("missing"), "roles", "admins").Error())
+}
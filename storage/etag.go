@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// etag computes a strong entity tag from the JSON encoding of the value. Struct fields are encoded in their declared
+// order and map keys are sorted, so equal values always have the same tag.
+func etag(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// matchesETag checks if the header value, a comma separated list of entity tags or "*", contains the tag. Weak tags
+// are compared like strong ones.
+func matchesETag(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// isConditional checks if the request carries preconditions.
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != ""
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of an upsert request against the value
+// currently stored under the key. If-Match requires the key to exist with a matching tag, and If-None-Match: *
+// requires the key to not exist yet.
+func (h *Handler) checkPreconditions(ctx context.Context, r *http.Request, u *UpsertRequest) error {
+	if !isConditional(r) {
+		return nil
+	}
+
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+
+	t := reflect.TypeOf(u.Value)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	current := reflect.New(t).Interface()
+	exists := true
+	if err := h.s.Get(ctx, u.Collection, u.Key, current); isNotFound(err) {
+		exists = false
+	} else if err != nil {
+		return err
+	}
+
+	if ifNoneMatch != "" {
+		if strings.TrimSpace(ifNoneMatch) != "*" {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Header If-None-Match must be "*" but got "%s".`, ifNoneMatch))
+		}
+		if exists {
+			return errors.WithStack(errPreconditionFailed.WithReasonf("Key %s already exists in collection %s.", u.Key, u.Collection))
+		}
+	}
+
+	if ifMatch != "" {
+		if !exists {
+			return errors.WithStack(errPreconditionFailed.WithReasonf("Key %s does not exist in collection %s.", u.Key, u.Collection))
+		}
+
+		tag, err := etag(current)
+		if err != nil {
+			return err
+		}
+		if !matchesETag(ifMatch, tag) {
+			return errors.WithStack(errPreconditionFailed.WithReasonf("Key %s in collection %s was modified.", u.Key, u.Collection))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ory/x/logrusx"
+)
+
+const (
+	effectAllow = "allow"
+	effectDeny  = "deny"
+)
+
+// Evaluator decides access requests against the policies stored in a collection.
+type Evaluator struct {
+	s              Manager
+	collection     string
+	roleCollection string
+	flavor         string
+	defaultEffect  string
+	precedence     string
+	now            func() time.Time
+	l              *logrusx.Logger
+
+	// roles is a snapshot of the roles in the role collection which is used instead of listing them if it is not nil.
+	roles Roles
+}
+
+// EvaluatorOption configures an Evaluator.
+type EvaluatorOption func(*Evaluator)
+
+// WithEvaluatorDefaultDecision sets the decision for requests which no policy matches, "allow" or "deny". Anything
+// but "allow" denies. Defaults to "deny".
+func WithEvaluatorDefaultDecision(effect string) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.defaultEffect = effect
+	}
+}
+
+// WithEvaluatorPrecedence sets the effect which wins if both an allow and a deny policy match a request, "allow" or
+// "deny". Anything but "allow" lets deny override allow. Defaults to "deny".
+func WithEvaluatorPrecedence(effect string) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.precedence = effect
+	}
+}
+
+// WithEvaluatorRoles resolves the roles of the subject from the roles stored in the collection, so that a policy also
+// matches a subject which is a member of one of the policy's subjects, directly or through other roles. Roles with a
+// scope only count for requests whose resource matches the scope, see Role.Scope. No roles are resolved by default.
+func WithEvaluatorRoles(collection string) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.roleCollection = collection
+	}
+}
+
+// WithEvaluatorFlavor sets the pattern syntax of the subjects, resources, and actions of the policies and of the
+// scopes of the roles: FlavorExact matches them literally, FlavorGlob only matches glob wildcards, and FlavorRegex
+// only matches regular expressions. Both glob wildcards and regular expressions are matched by default.
+func WithEvaluatorFlavor(flavor string) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.flavor = flavor
+	}
+}
+
+// WithEvaluatorLogger sets the logger which receives a warning for every condition which can not be evaluated.
+// Nothing is logged by default.
+func WithEvaluatorLogger(l *logrusx.Logger) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.l = l
+	}
+}
+
+// NewEvaluator returns an evaluator for the policies stored in the collection.
+func NewEvaluator(s Manager, collection string, opts ...EvaluatorOption) *Evaluator {
+	e := &Evaluator{s: s, collection: collection, defaultEffect: effectDeny, precedence: effectDeny, now: time.Now}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Allowed checks if the subject is allowed to perform the action on the resource. A request is allowed if at least
+// one policy with effect "allow" and no policy with effect "deny" matches the subject, action, and resource, including
+// their patterns. A policy also matches the subject through its roles if they are resolved, see WithEvaluatorRoles. If both match, deny overrides allow unless the precedence is configured to be allow, see
+// WithEvaluatorPrecedence. The outcome never depends on the order of the policies. If no policy matches, the default
+// decision applies, which denies unless configured otherwise.
+//
+// A policy only matches if the environment, which is the request's context, fulfills all of its conditions, see
+// Condition. Conditions of an unknown type or with malformed options fail closed: a deny policy matches regardless and
+// an allow policy does not. Neither matches outside of its validity window, see Policy.NotBefore and Policy.NotAfter.
+// A policy with a malformed subject, resource, or action pattern never matches, so that it does not break the
+// decisions of requests it is unrelated to.
+//
+// Unless allow takes precedence, the policies following the first deny policy which matches, including its
+// conditions, are not evaluated because they can not change the outcome.
+func (e *Evaluator) Allowed(ctx context.Context, subject, action, resource string, env map[string]interface{}) (bool, error) {
+	d, err := e.decide(ctx, subject, action, resource, env, nil, false)
+	if err != nil {
+		return false, err
+	}
+	return d.Allowed, nil
+}
+
+// Decision is the outcome of an access request together with the policies which caused it.
+type Decision struct {
+	// Allowed is true if the request is allowed.
+	Allowed bool `json:"allowed"`
+
+	// Effect is the effect which decided the request: "allow", "deny", or empty if no policy matched.
+	Effect string `json:"effect"`
+
+	// Default is true if no policy matched, so the request was decided by the default decision.
+	Default bool `json:"default"`
+
+	// AllowedBy are the IDs of the matching policies with effect "allow".
+	AllowedBy []string `json:"allowed_by"`
+
+	// DeniedBy are the IDs of the matching policies with effect "deny".
+	DeniedBy []string `json:"denied_by"`
+
+	// Obligations are the sorted and distinct obligations of the matching allow policies, which the caller must
+	// enforce. They are only set if the request is allowed.
+	Obligations []string `json:"obligations,omitempty"`
+
+	// Malformed are the IDs of the evaluated policies which were skipped because one of their subject, resource, or
+	// action patterns is malformed.
+	Malformed []string `json:"malformed,omitempty"`
+
+	// Explanation describes in words how the decision was made.
+	Explanation string `json:"explanation"`
+}
+
+// Decide is like Allowed but also reports which policies matched. If policies is not nil, the request is decided
+// against those policies instead of the stored ones.
+func (e *Evaluator) Decide(ctx context.Context, subject, action, resource string, env map[string]interface{}, policies Policies) (*Decision, error) {
+	return e.decide(ctx, subject, action, resource, env, policies, true)
+}
+
+// decide decides the request. Unless all is true or allow takes precedence, it stops at the first matching deny
+// policy, which decides the request regardless of the remaining policies. The decision then only names that policy
+// and the allow policies matched before it.
+func (e *Evaluator) decide(ctx context.Context, subject, action, resource string, env map[string]interface{}, policies Policies, all bool) (*Decision, error) {
+	return e.decideTraced(ctx, subject, action, resource, env, policies, all, nil)
+}
+
+// decideTraced is like decide but also appends how every policy was matched to trace if it is not nil, see
+// evaluate.
+func (e *Evaluator) decideTraced(ctx context.Context, subject, action, resource string, env map[string]interface{}, policies Policies, all bool, trace *[]PolicyTrace) (*Decision, error) {
+	if policies == nil {
+		if err := e.s.ListAll(ctx, e.collection, &policies); err != nil {
+			return nil, err
+		}
+	}
+
+	subjects := []string{subject}
+	if e.roleCollection != "" {
+		roles := e.roles
+		if roles == nil {
+			if err := e.s.ListAll(ctx, e.roleCollection, &roles); err != nil {
+				return nil, err
+			}
+		}
+		// roles with a malformed scope do not match the resource and are left out.
+		subjects = append(subjects, roles.inScope(resource, &filterOptions{match: MatchAny, literal: true, flavor: e.flavor}).memberOf(subject)...)
+	}
+
+	r := &ConditionRequest{Subject: subject, Action: action, Resource: resource, Context: env}
+	d := evaluate(policies, subjects, action, resource, e.flavor, e.now(), func(p *Policy) bool {
+		return p.fulfillsConditions(r, e.l)
+	}, !all && e.precedence != effectAllow, trace)
+	if len(d.Malformed) > 0 && e.l != nil {
+		e.l.WithField("policies", d.Malformed).
+			Warn("Unable to match policies with malformed patterns, so they are treated as if they do not match.")
+	}
+	if e.precedence == effectAllow && len(d.AllowedBy) > 0 && len(d.DeniedBy) > 0 {
+		d.Allowed = true
+		d.Effect = effectAllow
+		d.Explanation = fmt.Sprintf("Allowed by %s, which overrides the deny of %s.", strings.Join(d.AllowedBy, ", "), strings.Join(d.DeniedBy, ", "))
+	}
+	if d.Default && e.defaultEffect == effectAllow {
+		d.Allowed = true
+		d.Explanation = "Allowed because no policy matches the request and the default decision is allow."
+	}
+	if !d.Allowed {
+		d.Obligations = nil
+	}
+	return d, nil
+}
+
+// evaluate decides the request against the policies which match one of the subjects, the action, and the resource and
+// which apply at the time, letting deny override allow. The patterns of the policies are matched in the syntax of the
+// flavor, see compilePatternOf. If applies is not nil, only the matching policies for which it returns true are
+// considered. The IDs of the matching policies are sorted so that the decision does not depend on the order of the
+// policies, and so are the obligations of the matching allow policies, which are kept regardless of the outcome. If
+// stopAtDeny is true, the remaining policies are skipped once a deny policy matches and applies, because it decides the
+// request anyway. Policies with a malformed pattern never match and are reported in Decision.Malformed. If trace is not
+// nil, how every evaluated policy was matched is appended to it, see tracePolicy.
+func evaluate(policies Policies, subjects []string, action, resource, flavor string, now time.Time, applies func(*Policy) bool, stopAtDeny bool, trace *[]PolicyTrace) *Decision {
+	o := &filterOptions{match: MatchAll, literal: true, flavor: flavor}
+	anyOf := &filterOptions{match: MatchAny, literal: true, flavor: flavor}
+
+	d := &Decision{AllowedBy: []string{}, DeniedBy: []string{}}
+	for k := range policies {
+		p := &policies[k]
+		if err := p.validatePatterns(flavor); err != nil {
+			d.Malformed = append(d.Malformed, p.ID)
+			if trace != nil {
+				*trace = append(*trace, PolicyTrace{ID: p.ID, Effect: p.Effect, Error: err.Error()})
+			}
+			continue
+		}
+
+		if trace != nil {
+			t := tracePolicy(p, subjects, action, resource, now, applies, o, anyOf)
+			*trace = append(*trace, t)
+			if !t.Matched {
+				continue
+			}
+		} else if p.withSubjects(subjects, anyOf).withResources([]string{resource}, o).withActions([]string{action}, o) == nil ||
+			!p.activeAt(now) || (applies != nil && !applies(p)) {
+			continue
+		}
+
+		switch p.Effect {
+		case effectDeny:
+			d.DeniedBy = append(d.DeniedBy, p.ID)
+		case effectAllow:
+			d.AllowedBy = append(d.AllowedBy, p.ID)
+			for _, o := range p.Obligations {
+				d.Obligations = appendUnique(d.Obligations, o)
+			}
+		}
+		if stopAtDeny && len(d.DeniedBy) > 0 {
+			break
+		}
+	}
+	sort.Strings(d.AllowedBy)
+	sort.Strings(d.DeniedBy)
+	sort.Strings(d.Obligations)
+	sort.Strings(d.Malformed)
+
+	switch {
+	case len(d.DeniedBy) > 0:
+		d.Effect = effectDeny
+		d.Explanation = fmt.Sprintf("Denied by %s.", strings.Join(d.DeniedBy, ", "))
+		if len(d.AllowedBy) > 0 {
+			d.Explanation = fmt.Sprintf("Denied by %s, which overrides the allow of %s.", strings.Join(d.DeniedBy, ", "), strings.Join(d.AllowedBy, ", "))
+		}
+	case len(d.AllowedBy) > 0:
+		d.Allowed = true
+		d.Effect = effectAllow
+		d.Explanation = fmt.Sprintf("Allowed by %s.", strings.Join(d.AllowedBy, ", "))
+	default:
+		d.Default = true
+		d.Explanation = "Denied because no policy matches the request."
+	}
+	return d
+}
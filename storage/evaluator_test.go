@@ -0,0 +1,436 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluator_Allowed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(ctx, "evaluator", map[string]interface{}{
+		"allow-read":  &Policy{ID: "allow-read", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		"allow-write": &Policy{ID: "allow-write", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow"},
+		"deny-write":  &Policy{ID: "deny-write", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "deny"},
+		"bang":        &Policy{ID: "bang", Subjects: []string{"!root"}, Resources: []string{"articles"}, Actions: []string{"!publish"}, Effect: "allow"},
+	}))
+
+	e := NewEvaluator(m, "evaluator")
+	for k, tc := range []struct {
+		subject, action, resource string
+		allowed                   bool
+	}{
+		{subject: "alice", action: "read", resource: "articles", allowed: true},
+		{subject: "alice", action: "write", resource: "articles", allowed: true},
+		{subject: "bob", action: "read", resource: "articles", allowed: true},
+		{subject: "bob", action: "write", resource: "articles", allowed: false},
+		{subject: "alice", action: "delete", resource: "articles", allowed: false},
+		{subject: "carol", action: "read", resource: "articles", allowed: false},
+		{subject: "alice", action: "read", resource: "comments", allowed: false},
+		{subject: "", action: "", resource: "", allowed: false},
+		// access requests are matched literally, a leading "!" does not negate them like a filter value.
+		{subject: "!root", action: "!publish", resource: "articles", allowed: true},
+		{subject: "!alice", action: "!publish", resource: "articles", allowed: false},
+		{subject: "alice", action: "!write", resource: "articles", allowed: false},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			allowed, err := e.Allowed(ctx, tc.subject, tc.action, tc.resource, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.allowed, allowed)
+		})
+	}
+}
+
+func TestEvaluator_Decide(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.Upsert(ctx, "decide", "stored", &Policy{ID: "stored", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"}))
+
+	inline := Policies{
+		{ID: "allow-1", Subjects: []string{"<.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "allow-2", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+	}
+
+	e := NewEvaluator(m, "decide")
+	for k, tc := range []struct {
+		subject  string
+		policies Policies
+		expected Decision
+	}{
+		{subject: "alice", expected: Decision{Allowed: true, Effect: "allow", AllowedBy: []string{"stored"}, DeniedBy: []string{}, Explanation: "Allowed by stored."}},
+		{subject: "bob", expected: Decision{Default: true, AllowedBy: []string{}, DeniedBy: []string{}, Explanation: "Denied because no policy matches the request."}},
+		{subject: "alice", policies: Policies{}, expected: Decision{Default: true, AllowedBy: []string{}, DeniedBy: []string{}, Explanation: "Denied because no policy matches the request."}},
+		{subject: "alice", policies: inline, expected: Decision{Allowed: true, Effect: "allow", AllowedBy: []string{"allow-1"}, DeniedBy: []string{}, Explanation: "Allowed by allow-1."}},
+		{subject: "bob", policies: inline, expected: Decision{Effect: "deny", AllowedBy: []string{"allow-1", "allow-2"}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny, which overrides the allow of allow-1, allow-2."}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			d, err := e.Decide(ctx, tc.subject, "read", "articles", nil, tc.policies)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, *d)
+		})
+	}
+}
+
+func TestEvaluator_DefaultDecision(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(ctx, "default", map[string]interface{}{
+		"allow": &Policy{ID: "allow", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		"deny":  &Policy{ID: "deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+	}))
+
+	for _, tc := range []struct {
+		effect   string
+		expected map[string]Decision
+	}{
+		{effect: "", expected: map[string]Decision{
+			"alice": {Allowed: true, Effect: "allow", AllowedBy: []string{"allow"}, DeniedBy: []string{}, Explanation: "Allowed by allow."},
+			"bob":   {Effect: "deny", AllowedBy: []string{}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny."},
+			"carol": {Default: true, AllowedBy: []string{}, DeniedBy: []string{}, Explanation: "Denied because no policy matches the request."},
+		}},
+		{effect: "deny", expected: map[string]Decision{
+			"carol": {Default: true, AllowedBy: []string{}, DeniedBy: []string{}, Explanation: "Denied because no policy matches the request."},
+		}},
+		{effect: "allow", expected: map[string]Decision{
+			"alice": {Allowed: true, Effect: "allow", AllowedBy: []string{"allow"}, DeniedBy: []string{}, Explanation: "Allowed by allow."},
+			"bob":   {Effect: "deny", AllowedBy: []string{}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny."},
+			"carol": {Allowed: true, Default: true, AllowedBy: []string{}, DeniedBy: []string{}, Explanation: "Allowed because no policy matches the request and the default decision is allow."},
+		}},
+	} {
+		t.Run("effect="+tc.effect, func(t *testing.T) {
+			e := NewEvaluator(m, "default", WithEvaluatorDefaultDecision(tc.effect))
+			for subject, expected := range tc.expected {
+				d, err := e.Decide(ctx, subject, "read", "articles", nil, nil)
+				require.NoError(t, err)
+				assert.Equal(t, expected, *d, subject)
+
+				allowed, err := e.Allowed(ctx, subject, "read", "articles", nil)
+				require.NoError(t, err)
+				assert.Equal(t, expected.Allowed, allowed, subject)
+			}
+		})
+	}
+}
+
+func TestEvaluator_Precedence(t *testing.T) {
+	allow := Policy{ID: "allow", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"}
+	deny := Policy{ID: "deny", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"}
+
+	for _, tc := range []struct {
+		precedence string
+		expected   Decision
+	}{
+		{precedence: "", expected: Decision{Effect: "deny", AllowedBy: []string{"allow"}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny, which overrides the allow of allow."}},
+		{precedence: "deny", expected: Decision{Effect: "deny", AllowedBy: []string{"allow"}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny, which overrides the allow of allow."}},
+		{precedence: "allow", expected: Decision{Allowed: true, Effect: "allow", AllowedBy: []string{"allow"}, DeniedBy: []string{"deny"}, Explanation: "Allowed by allow, which overrides the deny of deny."}},
+	} {
+		t.Run("precedence="+tc.precedence, func(t *testing.T) {
+			for k, policies := range []Policies{{allow, deny}, {deny, allow}} {
+				ctx := context.Background()
+				m := NewMemoryManager()
+				for _, p := range policies {
+					p := p
+					require.NoError(t, m.Upsert(ctx, "precedence", p.ID, &p))
+				}
+
+				e := NewEvaluator(m, "precedence", WithEvaluatorPrecedence(tc.precedence))
+				d, err := e.Decide(ctx, "alice", "read", "articles", nil, nil)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, *d, "order=%d", k)
+
+				d, err = e.Decide(ctx, "alice", "read", "articles", nil, policies)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, *d, "order=%d", k)
+			}
+		})
+	}
+}
+
+func TestEffectivePolicies(t *testing.T) {
+	roles := Roles{
+		{ID: "editors", Members: []string{"alice"}},
+		{ID: "staff", Members: []string{"editors"}},
+	}
+	policies := Policies{
+		{ID: "allow-read", Subjects: []string{"staff"}, Resources: []string{"articles", "comments"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "allow-read-again", Subjects: []string{"<users:.*>", "alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "allow-write", Subjects: []string{"editors"}, Resources: []string{"articles"}, Actions: []string{"write", "delete"}, Effect: "allow"},
+		{ID: "deny-delete", Subjects: []string{"<.*>"}, Resources: []string{"<art.*>"}, Actions: []string{"delete"}, Effect: "deny"},
+		{ID: "deny-other", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+		{ID: "allow-other", Subjects: []string{"bob"}, Resources: []string{"secrets"}, Actions: []string{"read"}, Effect: "allow"},
+	}
+
+	res, err := effectivePolicies("alice", roles, policies, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "alice", res.Subject)
+	assert.Equal(t, []string{"editors", "staff"}, res.Roles)
+	assert.Equal(t, map[string]map[string]*EffectivePermission{
+		"articles": {
+			"read":   {Allowed: true, AllowedBy: []string{"allow-read", "allow-read-again"}, DeniedBy: []string{}},
+			"write":  {Allowed: true, AllowedBy: []string{"allow-write"}, DeniedBy: []string{}},
+			"delete": {Allowed: false, AllowedBy: []string{"allow-write"}, DeniedBy: []string{"deny-delete"}},
+		},
+		"comments": {
+			"read": {Allowed: true, AllowedBy: []string{"allow-read"}, DeniedBy: []string{}},
+		},
+	}, res.Permissions)
+
+	res, err = effectivePolicies("carol", roles, policies, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, res.Roles)
+	assert.Empty(t, res.Permissions)
+
+	_, err = effectivePolicies("alice", roles, Policies{{ID: "malformed", Subjects: []string{"<[>"}, Effect: "allow"}}, time.Now())
+	require.Error(t, err)
+
+	t.Run("case=scoped roles", func(t *testing.T) {
+		roles := Roles{
+			{ID: "editors", Members: []string{"bob"}},
+			{ID: "project-1-editors", Members: []string{"alice"}, Scope: "projects:1"},
+			{ID: "broken", Members: []string{"alice"}, Scope: "projects:<[>"},
+		}
+		policies := Policies{
+			{ID: "allow-edit", Subjects: []string{"editors", "project-1-editors", "broken"}, Resources: []string{"projects:1", "projects:2"}, Actions: []string{"edit"}, Effect: "allow"},
+			{ID: "deny-edit", Subjects: []string{"project-1-editors"}, Resources: []string{"projects:<.*>"}, Actions: []string{"edit"}, Effect: "deny"},
+		}
+
+		res, err := effectivePolicies("alice", roles, policies, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"project-1-editors", "broken"}, res.Roles)
+		assert.Equal(t, map[string]map[string]*EffectivePermission{
+			"projects:1": {"edit": {Allowed: false, AllowedBy: []string{"allow-edit"}, DeniedBy: []string{"deny-edit"}}},
+		}, res.Permissions, "the scoped role only counts for project 1")
+
+		res, err = effectivePolicies("bob", roles, policies, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]map[string]*EffectivePermission{
+			"projects:1": {"edit": {Allowed: true, AllowedBy: []string{"allow-edit"}, DeniedBy: []string{}}},
+			"projects:2": {"edit": {Allowed: true, AllowedBy: []string{"allow-edit"}, DeniedBy: []string{}}},
+		}, res.Permissions, "the global role counts for every project")
+	})
+
+	t.Run("case=validity", func(t *testing.T) {
+		now := time.Now()
+		before, after := now.Add(-time.Minute), now.Add(time.Minute)
+		policies := Policies{
+			{ID: "starts-now", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", NotBefore: &now},
+			{ID: "ends-now", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow", NotAfter: &now},
+			{ID: "starts-later", Subjects: []string{"alice"}, Resources: []string{"comments"}, Actions: []string{"read"}, Effect: "allow", NotBefore: &after},
+			{ID: "ended", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny", NotBefore: &before, NotAfter: &now},
+		}
+
+		res, err := effectivePolicies("alice", nil, policies, now)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]map[string]*EffectivePermission{
+			"articles": {
+				"read": {Allowed: true, AllowedBy: []string{"starts-now"}, DeniedBy: []string{}},
+			},
+		}, res.Permissions)
+	})
+}
+
+func TestEvaluator_StopAtDeny(t *testing.T) {
+	ctx := context.Background()
+	policies := Policies{
+		{ID: "deny-tenant", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny",
+			Conditions: map[string]interface{}{"tenant": map[string]interface{}{"type": "StringEqualCondition", "options": map[string]interface{}{"equals": "blocked"}}}},
+		{ID: "allow", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "deny", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+		{ID: "malformed", Subjects: []string{"<[>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+	}
+
+	e := NewEvaluator(NewMemoryManager(), "stop")
+	d, err := e.decide(ctx, "bob", "read", "articles", map[string]interface{}{"tenant": "acme"}, policies, false)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Effect: "deny", AllowedBy: []string{"allow"}, DeniedBy: []string{"deny"}, Explanation: "Denied by deny, which overrides the allow of allow."}, *d)
+
+	d, err = e.decide(ctx, "bob", "read", "articles", map[string]interface{}{"tenant": "blocked"}, policies, false)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Effect: "deny", AllowedBy: []string{}, DeniedBy: []string{"deny-tenant"}, Explanation: "Denied by deny-tenant."}, *d)
+
+	d, err = e.decide(ctx, "bob", "read", "articles", nil, policies, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"malformed"}, d.Malformed, "all policies are evaluated if the matching policies are reported")
+
+	d, err = NewEvaluator(NewMemoryManager(), "stop", WithEvaluatorPrecedence("allow")).decide(ctx, "bob", "read", "articles", nil, policies, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"malformed"}, d.Malformed, "all policies are evaluated if allow takes precedence")
+}
+
+func TestEvaluator_MalformedPattern(t *testing.T) {
+	ctx := context.Background()
+	for k, policies := range []Policies{
+		{
+			{ID: "malformed", Subjects: []string{"<[>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+			{ID: "allow", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		},
+		{
+			{ID: "allow", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+			{ID: "malformed", Subjects: []string{"alice", "<[>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny"},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			m := NewMemoryManager()
+			for _, p := range policies {
+				p := p
+				require.NoError(t, m.Upsert(ctx, "malformed", p.ID, &p))
+			}
+			e := NewEvaluator(m, "malformed")
+
+			d, err := e.decide(ctx, "alice", "read", "articles", nil, policies, true)
+			require.NoError(t, err)
+			assert.True(t, d.Allowed, "a malformed policy does not match, not even with a literal value")
+			assert.Equal(t, []string{"allow"}, d.AllowedBy)
+			assert.Equal(t, []string{}, d.DeniedBy)
+			assert.Equal(t, []string{"malformed"}, d.Malformed)
+
+			allowed, err := e.Allowed(ctx, "alice", "read", "articles", nil)
+			require.NoError(t, err, "a stored malformed policy does not break the decision")
+			assert.True(t, allowed)
+
+			trace, err := e.Explain(ctx, "alice", "read", "articles", nil, policies)
+			require.NoError(t, err)
+			assert.True(t, trace.Allowed)
+			for _, p := range trace.Policies {
+				if p.ID == "malformed" {
+					assert.False(t, p.Matched)
+					assert.Contains(t, p.Error, "malformed pattern in its subjects")
+				}
+			}
+		})
+	}
+
+	p := &Policy{ID: "malformed", Subjects: []string{"<[>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"}
+	assert.Error(t, p.Validate(false))
+	assert.Error(t, p.Validate(true), "malformed patterns are rejected even if forced")
+}
+
+func TestEvaluator_Obligations(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(ctx, "obligations", map[string]interface{}{
+		"allow-log":   &Policy{ID: "allow-log", Subjects: []string{"<.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", Obligations: []string{"log-access"}},
+		"allow-mfa":   &Policy{ID: "allow-mfa", Subjects: []string{"bob", "carol"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", Obligations: []string{"require-mfa", "log-access"}},
+		"allow-write": &Policy{ID: "allow-write", Subjects: []string{"<.*>"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow", Obligations: []string{"notify-owner"}},
+		"allow-office": &Policy{ID: "allow-office", Subjects: []string{"<.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", Obligations: []string{"watermark"},
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}}},
+		"deny-carol": &Policy{ID: "deny-carol", Subjects: []string{"carol"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny", Obligations: []string{"alert"}},
+		"deny-dave":  &Policy{ID: "deny-dave", Subjects: []string{"dave"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny", Obligations: []string{"alert"}},
+	}))
+
+	for k, tc := range []struct {
+		subject     string
+		env         map[string]interface{}
+		precedence  string
+		obligations []string
+	}{
+		{subject: "alice", obligations: []string{"log-access"}},
+		{subject: "alice", env: map[string]interface{}{"ip": "10.1.2.3"}, obligations: []string{"log-access", "watermark"}},
+		{subject: "bob", obligations: []string{"log-access", "require-mfa"}},
+		{subject: "carol"},
+		{subject: "carol", precedence: "allow", obligations: []string{"log-access", "require-mfa"}},
+		{subject: "dave"},
+		{subject: "dave", precedence: "allow", obligations: []string{"log-access"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			e := NewEvaluator(m, "obligations", WithEvaluatorPrecedence(tc.precedence))
+			for _, all := range []bool{true, false} {
+				d, err := e.decide(ctx, tc.subject, "read", "articles", tc.env, nil, all)
+				require.NoError(t, err)
+				assert.Equal(t, len(tc.obligations) > 0, d.Allowed)
+				assert.Equal(t, tc.obligations, d.Obligations)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluator_Allowed(b *testing.B) {
+	ctx := context.Background()
+	policies := make(Policies, 100000)
+	for k := range policies {
+		policies[k] = Policy{ID: fmt.Sprintf("allow-%d", k), Subjects: []string{fmt.Sprintf("<users:%d|groups:.*>", k)}, Resources: []string{"<articles:.*>"}, Actions: []string{"read"}, Effect: "allow"}
+	}
+	policies[1000] = Policy{ID: "deny", Subjects: []string{"users:blocked"}, Resources: []string{"<articles:.*>"}, Actions: []string{"<.*>"}, Effect: "deny"}
+
+	e := NewEvaluator(NewMemoryManager(), "benchmark")
+	for _, all := range []bool{true, false} {
+		b.Run(fmt.Sprintf("all=%t", all), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				d, err := e.decide(ctx, "users:blocked", "read", "articles:1", nil, policies, all)
+				require.NoError(b, err)
+				require.False(b, d.Allowed)
+			}
+		})
+	}
+}
+
+func TestEvaluator_Roles(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(ctx, "roles", map[string]interface{}{
+		"editors":           &Role{ID: "editors", Members: []string{"bob", "project-1-editors"}},
+		"project-1-editors": &Role{ID: "project-1-editors", Members: []string{"alice"}, Scope: "projects:1"},
+		"project-2-editors": &Role{ID: "project-2-editors", Members: []string{"alice"}, Scope: "projects:<[>"},
+	}))
+	policies := Policies{
+		{ID: "allow-editors", Subjects: []string{"editors"}, Resources: []string{"projects:<.*>"}, Actions: []string{"edit"}, Effect: "allow"},
+	}
+
+	for k, tc := range []struct {
+		subject, resource string
+		allowed           bool
+	}{
+		{subject: "bob", resource: "projects:1", allowed: true},
+		{subject: "bob", resource: "projects:2", allowed: true},
+		{subject: "alice", resource: "projects:1", allowed: true},
+		{subject: "alice", resource: "projects:2"},
+		{subject: "carol", resource: "projects:1"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			d, err := NewEvaluator(m, "policies", WithEvaluatorRoles("roles")).decide(ctx, tc.subject, "edit", tc.resource, nil, policies, false)
+			require.NoError(t, err)
+			assert.Equal(t, tc.allowed, d.Allowed)
+		})
+	}
+
+	d, err := NewEvaluator(m, "policies").decide(ctx, "bob", "edit", "projects:1", nil, policies, false)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed, "roles are not resolved unless enabled")
+}
+
+func TestEvaluator_Flavor(t *testing.T) {
+	ctx := context.Background()
+	policies := Policies{
+		{ID: "glob", Subjects: []string{"users:*"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "regex", Subjects: []string{"<users:.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "malformed", Subjects: []string{"<[>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+	}
+
+	for k, tc := range []struct {
+		flavor, subject string
+		allowedBy       []string
+		malformed       []string
+	}{
+		{flavor: "", subject: "users:alice", allowedBy: []string{"glob", "regex"}, malformed: []string{"malformed"}},
+		{flavor: FlavorExact, subject: "users:alice", allowedBy: []string{}},
+		{flavor: FlavorExact, subject: "users:*", allowedBy: []string{"glob"}},
+		{flavor: FlavorExact, subject: "<[>", allowedBy: []string{"malformed"}},
+		{flavor: FlavorGlob, subject: "users:alice", allowedBy: []string{"glob"}},
+		{flavor: FlavorGlob, subject: "<[>", allowedBy: []string{"malformed"}},
+		{flavor: FlavorRegex, subject: "users:alice", allowedBy: []string{"regex"}, malformed: []string{"malformed"}},
+		{flavor: FlavorRegex, subject: "users:*", allowedBy: []string{"glob", "regex"}, malformed: []string{"malformed"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			d, err := NewEvaluator(NewMemoryManager(), "flavor", WithEvaluatorFlavor(tc.flavor)).Decide(ctx, tc.subject, "read", "articles", nil, policies)
+			require.NoError(t, err)
+			assert.Equal(t, tc.allowedBy, d.AllowedBy)
+			assert.Equal(t, tc.malformed, d.Malformed)
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// explainParam is the query parameter which makes a list request explain why the entry of the given key is part of
+// the result or not.
+const explainParam = "explain"
+
+// ListExplanation tells why an entry is included in a filtered list or not, see Handler.List.
+//
+// swagger:ignore
+type ListExplanation struct {
+	// Key is the key of the explained entry.
+	Key string `json:"key"`
+
+	// Included is true if the entry is part of the filtered list, regardless of the pagination.
+	Included bool `json:"included"`
+
+	// Match is how the filters are combined, "all" or "any".
+	Match string `json:"match"`
+
+	// Filters are the outcomes of the filters of the request.
+	Filters []FilterExplanation `json:"filters"`
+}
+
+// FilterExplanation is the outcome of a single filter of a list request.
+//
+// swagger:ignore
+type FilterExplanation struct {
+	// Filter is the query parameter of the filter, for example "subject".
+	Filter string `json:"filter"`
+
+	// Values are the values of the query parameter.
+	Values []string `json:"values"`
+
+	// Matched is true if the entry passes the filter.
+	Matched bool `json:"matched"`
+
+	// Reason describes which stored values the filter values were compared against.
+	Reason string `json:"reason"`
+}
+
+// explain responds with the ListExplanation of the key given in the explain query parameter instead of the list. Only
+// the roles and policies filtered by ListByQuery can be explained.
+func (h *Handler) explain(w http.ResponseWriter, r *http.Request, l *ListRequest) {
+	ctx := r.Context()
+	key := r.URL.Query().Get(explainParam)
+	m := splitFilterValues(r.URL.Query())
+	if key == "" {
+		h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" must be set to a key.`, explainParam)))
+		return
+	}
+
+	o, err := parseFilterOptions(m)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	}
+
+	var e *ListExplanation
+	switch l.Value.(type) {
+	case *Roles:
+		if err := validateEmptyFilter(m); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var role Role
+		if o.expand {
+			var roles Roles
+			if err := h.s.ListAll(ctx, l.Collection, &roles); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if err := roles.expand(h.filters.expansionDepth()); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+
+			var found bool
+			for k := range roles {
+				if roles[k].ID == key {
+					role, found = roles[k], true
+					break
+				}
+			}
+			if !found {
+				h.h.WriteError(w, r, withKey(errors.WithStack(ErrNotFound), l.Collection, key))
+				return
+			}
+		} else if err := h.s.Get(ctx, l.Collection, key, &role); err != nil {
+			h.h.WriteError(w, r, withKey(err, l.Collection, key))
+			return
+		}
+		e = explainRole(&role, m, o)
+	case *Policies:
+		if err := validateEffect(m); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := validateConditionFilters(m); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := validateActiveOnlyFilter(m); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var policy Policy
+		if err := h.s.Get(ctx, l.Collection, key, &policy); err != nil {
+			h.h.WriteError(w, r, withKey(err, l.Collection, key))
+			return
+		}
+		e = explainPolicy(&policy, m, o)
+	default:
+		h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Query parameter "%s" is only supported for roles and policies.`, explainParam)))
+		return
+	}
+
+	if o.err != nil {
+		h.h.WriteError(w, r, o.err)
+		return
+	}
+
+	e.Key = key
+	h.auditRead(ctx, key)
+	h.h.Write(w, r, e)
+}
+
+func explainRole(r *Role, m map[string][]string, o *filterOptions) *ListExplanation {
+	members := r.Members
+	if o.expand {
+		members = r.EffectiveMembers
+	}
+
+	var filters []FilterExplanation
+	if v := m["member"]; len(v) > 0 {
+		filters = append(filters, o.explainValues("member", v, members, o.contains))
+	}
+	if v := m["id"]; len(v) > 0 {
+		filters = append(filters, FilterExplanation{Filter: "id", Values: v, Matched: r.withIDs(v) != nil, Reason: fmt.Sprintf(`The id is "%s".`, r.ID)})
+	}
+	if v := m["id_prefix"]; len(v) > 0 {
+		filters = append(filters, FilterExplanation{Filter: "id_prefix", Values: v, Matched: r.withIDPrefix(v, o) != nil, Reason: fmt.Sprintf(`The id is "%s".`, r.ID)})
+	}
+	if v := m["empty"]; len(v) > 0 && v[0] != "" {
+		filters = append(filters, FilterExplanation{Filter: "empty", Values: v, Matched: r.withEmpty(v) != nil,
+			Reason: fmt.Sprintf("The role has %d members.", len(r.Members))})
+	}
+	if v := m["scope"]; len(v) > 0 {
+		reason := fmt.Sprintf(`The scope is "%s".`, r.Scope)
+		if r.Scope == "" {
+			reason = "The role is global."
+		}
+		filters = append(filters, FilterExplanation{Filter: "scope", Values: v, Matched: r.withScopes(v, o) != nil, Reason: reason})
+	}
+
+	return &ListExplanation{Included: r.withQuery(m, o) != nil, Match: o.match, Filters: nonNilFilters(filters)}
+}
+
+func explainPolicy(p *Policy, m map[string][]string, o *filterOptions) *ListExplanation {
+	var filters []FilterExplanation
+	for _, f := range []struct {
+		name   string
+		source []string
+	}{
+		{name: "subject", source: p.Subjects},
+		{name: "resource", source: p.Resources},
+		{name: "action", source: p.Actions},
+	} {
+		if v := m[f.name]; len(v) > 0 {
+			filters = append(filters, o.explainValues(f.name, v, f.source, o.containsPattern))
+		}
+	}
+
+	if v := m["resource_prefix"]; len(v) > 0 {
+		filters = append(filters, FilterExplanation{Filter: "resource_prefix", Values: v, Matched: p.withResourcePrefix(v, o) != nil,
+			Reason: fmt.Sprintf("The resources are %s.", quoteAll(p.Resources))})
+	}
+	if v := m["id"]; len(v) > 0 {
+		filters = append(filters, FilterExplanation{Filter: "id", Values: v, Matched: p.withIDs(v) != nil, Reason: fmt.Sprintf(`The id is "%s".`, p.ID)})
+	}
+	if v := m["effect"]; len(v) > 0 && v[0] != "" {
+		filters = append(filters, FilterExplanation{Filter: "effect", Values: v, Matched: p.withEffect(v) != nil, Reason: fmt.Sprintf(`The effect is "%s".`, p.Effect)})
+	}
+	if v := m["has_condition"]; len(v) > 0 && v[0] != "" {
+		filters = append(filters, FilterExplanation{Filter: "has_condition", Values: v, Matched: p.withHasCondition(v) != nil,
+			Reason: fmt.Sprintf("The policy has %d conditions.", len(p.Conditions))})
+	}
+	if v := m["condition_key"]; len(v) > 0 {
+		keys := make([]string, 0, len(p.Conditions))
+		for k := range p.Conditions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		filters = append(filters, FilterExplanation{Filter: "condition_key", Values: v, Matched: p.withConditionKeys(v) != nil,
+			Reason: fmt.Sprintf("The condition keys are %s.", quoteAll(keys))})
+	}
+
+	if v := m["active_only"]; len(v) > 0 && v[0] != "" {
+		filters = append(filters, FilterExplanation{Filter: "active_only", Values: v, Matched: p.withActiveOnly(v, o) != nil, Reason: p.validity()})
+	}
+
+	return &ListExplanation{Included: p.withQuery(m, o) != nil, Match: o.match, Filters: nonNilFilters(filters)}
+}
+
+// explainValues compares every filter value against the stored values like matchesWith and names the stored value
+// which matches it, if any.
+func (o *filterOptions) explainValues(name string, values, source []string, contains func(string, []string) bool) FilterExplanation {
+	reasons := make([]string, len(values))
+	for k, filterValue := range values {
+		v, negated := parseNegation(filterValue)
+		reasons[k] = fmt.Sprintf(`"%s" matches none of %s.`, v, quoteAll(source))
+		if len(source) == 0 {
+			reasons[k] = fmt.Sprintf(`"%s" does not match because there are no values.`, v)
+		}
+		for _, s := range source {
+			if contains(v, []string{s}) {
+				reasons[k] = fmt.Sprintf(`"%s" matches "%s".`, v, s)
+				if negated {
+					reasons[k] = fmt.Sprintf(`"%s" excludes the entry because "%s" matches "%s".`, filterValue, v, s)
+				}
+				break
+			}
+		}
+	}
+
+	return FilterExplanation{
+		Filter:  name,
+		Values:  values,
+		Matched: o.matchesWith(contains, values, source),
+		Reason:  strings.Join(reasons, " "),
+	}
+}
+
+func nonNilFilters(filters []FilterExplanation) []FilterExplanation {
+	if filters == nil {
+		return []FilterExplanation{}
+	}
+	return filters
+}
+
+// quoteAll quotes and joins the values, or returns "none" if there are none.
+func quoteAll(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(values))
+	for k, v := range values {
+		quoted[k] = strconv.Quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestListExplain(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+	require.NoError(t, m.Upsert(ctx, "/tests/explain/policies", "p1", &Policy{ID: "p1", Subjects: []string{"alice", "<users:.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"}))
+	require.NoError(t, m.Upsert(ctx, "/tests/explain/policies", "malformed", &Policy{ID: "malformed", Subjects: []string{"<[>"}, Effect: "allow"}))
+	require.NoError(t, m.Upsert(ctx, "/tests/explain/roles", "editors", &Role{ID: "editors", Members: []string{"alice"}}))
+	require.NoError(t, m.Upsert(ctx, "/tests/explain/roles", "staff", &Role{ID: "staff", Members: []string{"editors"}}))
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: "/tests/explain/policies", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/explain/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/strings", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		var p []string
+		return &ListRequest{Collection: "/tests/explain/strings", Value: &p}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		path     string
+		code     int
+		expected ListExplanation
+	}{
+		{
+			path: "/policies?explain=p1&subject=users:bob&resource=comments&effect=allow",
+			code: http.StatusOK,
+			expected: ListExplanation{Key: "p1", Match: MatchAll, Filters: []FilterExplanation{
+				{Filter: "subject", Values: []string{"users:bob"}, Matched: true, Reason: `"users:bob" matches "<users:.*>".`},
+				{Filter: "resource", Values: []string{"comments"}, Reason: `"comments" matches none of "articles".`},
+				{Filter: "effect", Values: []string{"allow"}, Matched: true, Reason: `The effect is "allow".`},
+			}},
+		},
+		{
+			path: "/policies?explain=p1&subject=alice&resource=comments&match=any",
+			code: http.StatusOK,
+			expected: ListExplanation{Key: "p1", Included: true, Match: MatchAny, Filters: []FilterExplanation{
+				{Filter: "subject", Values: []string{"alice"}, Matched: true, Reason: `"alice" matches "alice".`},
+				{Filter: "resource", Values: []string{"comments"}, Reason: `"comments" matches none of "articles".`},
+			}},
+		},
+		{
+			path: "/policies?explain=p1&action=!read&resource=!comments",
+			code: http.StatusOK,
+			expected: ListExplanation{Key: "p1", Match: MatchAll, Filters: []FilterExplanation{
+				{Filter: "resource", Values: []string{"!comments"}, Matched: true, Reason: `"comments" matches none of "articles".`},
+				{Filter: "action", Values: []string{"!read"}, Reason: `"!read" excludes the entry because "read" matches "read".`},
+			}},
+		},
+		{
+			path:     "/policies?explain=p1",
+			code:     http.StatusOK,
+			expected: ListExplanation{Key: "p1", Included: true, Match: MatchAll, Filters: []FilterExplanation{}},
+		},
+		{
+			path: "/roles?explain=staff&member=alice&member=bob&match=any&expand=true",
+			code: http.StatusOK,
+			expected: ListExplanation{Key: "staff", Included: true, Match: MatchAny, Filters: []FilterExplanation{
+				{Filter: "member", Values: []string{"alice", "bob"}, Matched: true, Reason: `"alice" matches "alice". "bob" matches none of "alice".`},
+			}},
+		},
+		{
+			path: "/roles?explain=staff&member=alice&id_prefix=ed",
+			code: http.StatusOK,
+			expected: ListExplanation{Key: "staff", Match: MatchAll, Filters: []FilterExplanation{
+				{Filter: "member", Values: []string{"alice"}, Reason: `"alice" matches none of "editors".`},
+				{Filter: "id_prefix", Values: []string{"ed"}, Reason: `The id is "staff".`},
+			}},
+		},
+		{path: "/policies?explain=", code: http.StatusBadRequest},
+		{path: "/policies?explain=unknown", code: http.StatusNotFound},
+		{path: "/roles?explain=unknown&expand=true", code: http.StatusNotFound},
+		{path: "/policies?explain=malformed&subject=alice", code: http.StatusBadRequest},
+		{path: "/policies?explain=p1&effect=maybe", code: http.StatusBadRequest},
+		{path: "/strings?explain=a", code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + tc.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var e ListExplanation
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+			assert.Equal(t, tc.expected, e)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+)
+
+// ExportRequest is a request to export a whole collection.
+type ExportRequest struct {
+	Collection string
+
+	// Filename is suggested to the client in the Content-Disposition header.
+	Filename string
+}
+
+// Export streams all stored values of the collection as newline delimited JSON, one value per line, in the order of
+// the backend. The values are exported as they are stored and are not filtered. Nothing but the current line is held
+// in memory, apart from the first bytes of a response which may be compressed, see WithCompressionThreshold. If the
+// backend fails after the first line has been written, the response is aborted so that the client does not mistake
+// the truncated body for a complete export.
+//
+// If the Accept header prefers application/x-yaml, the values are exported as a stream of YAML documents instead,
+// each starting with "---", and the ".jsonl" extension of the filename is replaced by ".yaml".
+//
+// A single byte range of the export can be requested with the Range header, see exportRange, so that clients can
+// resume an interrupted export.
+func (h *Handler) Export(factory func(context.Context, *http.Request, httprouter.Params) (*ExportRequest, error)) httprouter.Handle {
+	return h.instrument("export", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		e, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, e.Collection)
+
+		if err := validateCollection(e.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		asYAML := acceptsYAML(r)
+		contentType, filename := "application/x-ndjson", e.Filename
+		if asYAML {
+			contentType, filename = yamlContentType, strings.TrimSuffix(filename, ".jsonl")+".yaml"
+		}
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		setHeaders := func() {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		}
+
+		if rng, ok := parseRange(r.Header.Get("Range")); ok && h.exportRange(w, r, e.Collection, rng, asYAML, setHeaders) {
+			return
+		}
+
+		// done is not deferred because an aborted export must not be completed by the gzip trailer.
+		w, done := compress(w, r, h.compressionThreshold)
+
+		var written bool
+		writeHeader := func() {
+			setHeaders()
+			w.WriteHeader(http.StatusOK)
+			written = true
+		}
+
+		if err := h.exportLines(ctx, e.Collection, asYAML, func(line []byte) error {
+			if !written {
+				writeHeader()
+			}
+			_, err := w.Write(line)
+			return errors.WithStack(err)
+		}); err != nil {
+			if written {
+				panic(http.ErrAbortHandler)
+			}
+			h.h.WriteError(w, r, err)
+			done()
+			return
+		}
+
+		if !written {
+			writeHeader()
+		}
+		done()
+		h.auditRead(ctx)
+	})
+}
+
+// exportLines encodes every stored value of the collection as a line of the export and passes it to fn. The line is
+// only valid until fn returns.
+func (h *Handler) exportLines(ctx context.Context, collection string, asYAML bool, fn func(line []byte) error) error {
+	var line bytes.Buffer
+	return h.s.Stream(ctx, collection, func(raw json.RawMessage) error {
+		line.Reset()
+		if asYAML {
+			doc, err := jsonToYAML(raw)
+			if err != nil {
+				return err
+			}
+			line.WriteString("---\n")
+			line.Write(doc)
+		} else {
+			if err := json.Compact(&line, raw); err != nil {
+				return errors.WithStack(err)
+			}
+			line.WriteByte('\n')
+		}
+		return fn(line.Bytes())
+	})
+}
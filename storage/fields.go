@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// fieldsParam is the query parameter which projects the responses of Get and List to some of their fields.
+const fieldsParam = "fields"
+
+// projectFields reduces the encoded value to the top-level fields listed in the query parameter "fields", which is
+// comma-separated and may be repeated. Lists are reduced element by element. The fields keep their order. Unknown
+// fields are ignored unless the query parameter "strict_fields" is "true", in which case fields which none of the
+// encoded objects has are answered with 400. Without the parameter, the value is returned as it is.
+func projectFields(r *http.Request, e interface{}) (interface{}, error) {
+	values, ok := r.URL.Query()[fieldsParam]
+	if !ok {
+		return e, nil
+	}
+
+	strict, err := boolQuery(r, "strict_fields")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for _, v := range values {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields[f] = true
+			}
+		}
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	seen := map[string]bool{}
+	var objects int
+	res, err := mapValues(b, func(v json.RawMessage) (json.RawMessage, error) {
+		res, isObject, err := mapObject(v, func(key string, v json.RawMessage) (json.RawMessage, bool, error) {
+			seen[key] = true
+			return v, fields[key], nil
+		})
+		if isObject {
+			objects++
+		}
+		return res, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if strict && objects > 0 {
+		var unknown []string
+		for f := range fields {
+			if !seen[f] {
+				unknown = append(unknown, f)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return nil, errors.WithStack(herodot.ErrBadRequest.
+				WithReasonf(`Query parameter "%s" contains unknown fields: %s`, fieldsParam, strings.Join(unknown, ", ")).
+				WithDetail("fields", unknown))
+		}
+	}
+	return res, nil
+}
+
+// mapValues applies f to the encoded value or, if it is an array, to each of its elements.
+func mapValues(b []byte, f func(json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '[' {
+		return f(b)
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(b, &elements); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k := range elements {
+		var err error
+		if elements[k], err = f(elements[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := json.Marshal(elements)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+// mapObject passes each field of the encoded object to f, which returns the new value of the field and whether the
+// field is kept. The fields keep their order. Values other than objects are returned as they are, and the boolean
+// result is false for them.
+func mapObject(b json.RawMessage, f func(key string, v json.RawMessage) (json.RawMessage, bool, error)) (json.RawMessage, bool, error) {
+	return mapFields(b, func(key string, v json.RawMessage) (string, json.RawMessage, bool, error) {
+		v, keep, err := f(key, v)
+		return key, v, keep, err
+	})
+}
+
+// mapFields is like mapObject but f may rename the fields as well.
+func mapFields(b json.RawMessage, f func(key string, v json.RawMessage) (string, json.RawMessage, bool, error)) (json.RawMessage, bool, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	if t, err := d.Token(); err != nil {
+		return nil, false, errors.WithStack(err)
+	} else if t != json.Delim('{') {
+		return b, false, nil
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+		key, _ := t.(string)
+
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+
+		key, v, keep, err := f(key, v)
+		if err != nil {
+			return nil, false, err
+		} else if !keep {
+			continue
+		}
+
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+		out.Write(k)
+		out.WriteByte(':')
+		out.Write(v)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), true, nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestFields(t *testing.T) {
+	const collection = "/tests/fields/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, m.Upsert(context.Background(), collection, "alice", &Role{ID: "alice", Description: "a", Members: []string{"bob"}}))
+	require.NoError(t, m.Upsert(context.Background(), collection, "carol", &Role{ID: "carol", Members: []string{"dave"}}))
+
+	for _, tc := range []struct {
+		d      string
+		path   string
+		accept string
+		code   int
+		body   string
+	}{
+		{d: "get", path: "/roles/alice?fields=id,members", code: http.StatusOK, body: `{"id":"alice","members":["bob"]}`},
+		{d: "get keeps the field order", path: "/roles/alice?fields=members,%20id", code: http.StatusOK, body: `{"id":"alice","members":["bob"]}`},
+		{d: "get repeated", path: "/roles/alice?fields=id&fields=description", code: http.StatusOK, body: `{"id":"alice","description":"a"}`},
+		{d: "get without fields", path: "/roles/alice", code: http.StatusOK, body: `{"id":"alice","description":"a","members":["bob"]}`},
+		{d: "get unknown", path: "/roles/alice?fields=id,owner", code: http.StatusOK, body: `{"id":"alice"}`},
+		{d: "get unknown strict", path: "/roles/alice?fields=id,owner&strict_fields=true", code: http.StatusBadRequest},
+		{d: "get known strict", path: "/roles/alice?fields=id&strict_fields=true", code: http.StatusOK, body: `{"id":"alice"}`},
+		{d: "get empty", path: "/roles/alice?fields=", code: http.StatusOK, body: `{}`},
+		{d: "list", path: "/roles?fields=id", code: http.StatusOK, body: `[{"id":"alice"},{"id":"carol"}]`},
+		{d: "list filtered", path: "/roles?member=dave&fields=members", code: http.StatusOK, body: `[{"members":["dave"]}]`},
+		{d: "list unknown strict", path: "/roles?fields=owner&strict_fields=true", code: http.StatusBadRequest},
+		{d: "list empty strict", path: "/roles?member=erin&fields=owner&strict_fields=true", code: http.StatusOK, body: `[]`},
+		{d: "list yaml", path: "/roles?fields=id", accept: yamlContentType, code: http.StatusOK, body: "- id: alice\n- id: carol\n"},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+tc.path, nil)
+			require.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.code, res.StatusCode, "%s", body)
+			if tc.code != http.StatusOK {
+				return
+			}
+			if tc.accept == "" {
+				body = bytes.TrimSpace(body)
+			}
+			assert.Equal(t, tc.body, string(body))
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// MatchAll requires every filter value of every filter key to match. This is the default.
+	MatchAll = "all"
+
+	// MatchAny requires at least one filter value of at least one filter key to match.
+	MatchAny = "any"
+
+	// CaseSensitive compares filter values and stored values as they are. This is the default.
+	CaseSensitive = "sensitive"
+
+	// CaseInsensitive compares filter values and stored values regardless of their casing.
+	CaseInsensitive = "insensitive"
+
+	// OrderAsc sorts a list in ascending order. This is the default.
+	OrderAsc = "asc"
+
+	// OrderDesc sorts a list in descending order.
+	OrderDesc = "desc"
+)
+
+// negationPrefix marks a filter value which excludes the entries it matches instead of including them, so that
+// "action=!read" lists the policies which do not grant read. A value which starts with the prefix itself is escaped
+// as "\!".
+const negationPrefix = "!"
+
+// parseNegation returns the filter value without its negation prefix and whether it had one. The escaped prefix "\!"
+// is unescaped.
+func parseNegation(v string) (string, bool) {
+	switch {
+	case strings.HasPrefix(v, negationPrefix):
+		return strings.TrimPrefix(v, negationPrefix), true
+	case strings.HasPrefix(v, `\`+negationPrefix):
+		return strings.TrimPrefix(v, `\`), false
+	}
+	return v, false
+}
+
+// splitNegations separates the filter values into those which include entries and those which exclude them, see
+// parseNegation.
+func splitNegations(values []string) (included, excluded []string) {
+	for _, v := range values {
+		if v, negated := parseNegation(v); negated {
+			excluded = append(excluded, v)
+		} else {
+			included = append(included, v)
+		}
+	}
+	return included, excluded
+}
+
+// filterOptions controls how the filter values of a list request are compared against stored values.
+type filterOptions struct {
+	match           string
+	caseInsensitive bool
+	expand          bool
+	sort            string
+	desc            bool
+
+	// literal disables negation, see negationPrefix, so that the values of access requests and of stored entries
+	// which are matched against the stored patterns are taken as they are.
+	literal bool
+
+	// flavor limits the pattern syntax of the stored values, see compilePatternOf. Both glob wildcards and regular
+	// expressions are matched if it is empty.
+	flavor string
+
+	// now is the time at which the validity of policies is checked, see Policy.activeAt.
+	now time.Time
+
+	// err is the first error which occurred while matching, for example because of a malformed pattern.
+	err error
+}
+
+func parseFilterOptions(m map[string][]string) (*filterOptions, error) {
+	o := &filterOptions{match: MatchAll, sort: "id", now: time.Now()}
+
+	if v := m["match"]; len(v) > 0 && v[0] != "" {
+		switch v[0] {
+		case MatchAll, MatchAny:
+			o.match = v[0]
+		default:
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "match" must be one of "%s" or "%s" but got "%s".`, MatchAll, MatchAny, v[0]))
+		}
+	}
+
+	if v := m["case"]; len(v) > 0 && v[0] != "" {
+		switch v[0] {
+		case CaseSensitive:
+		case CaseInsensitive:
+			o.caseInsensitive = true
+		default:
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "case" must be one of "%s" or "%s" but got "%s".`, CaseSensitive, CaseInsensitive, v[0]))
+		}
+	}
+
+	if v := m["expand"]; len(v) > 0 && v[0] != "" {
+		expand, err := strconv.ParseBool(v[0])
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "expand" must be a boolean but got "%s".`, v[0]))
+		}
+		o.expand = expand
+	}
+
+	if v := m["sort"]; len(v) > 0 && v[0] != "" {
+		o.sort = v[0]
+	}
+
+	if v := m["order"]; len(v) > 0 && v[0] != "" {
+		switch v[0] {
+		case OrderAsc:
+		case OrderDesc:
+			o.desc = true
+		default:
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "order" must be one of "%s" or "%s" but got "%s".`, OrderAsc, OrderDesc, v[0]))
+		}
+	}
+
+	return o, nil
+}
+
+// listFilterKeys are the filter keys of ListByQuery which take several values. Besides repeating the key, a single
+// value may list several values separated by commas, see splitFilterValues.
+var listFilterKeys = []string{"member", "id", "id_prefix", "scope", "subject", "resource", "resource_prefix", "action", "condition_key"}
+
+// splitFilterValues returns a copy of the query in which the values of the list filter keys are split at commas, so
+// that "member=a,b" is the same as "member=a&member=b". Both forms can be mixed. A comma which is part of a value is
+// escaped as "\,". Empty values resulting from the split are dropped, values without commas are kept as they are.
+func splitFilterValues(m map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+
+	for _, k := range listFilterKeys {
+		values, ok := m[k]
+		if !ok {
+			continue
+		}
+
+		split := make([]string, 0, len(values))
+		for _, v := range values {
+			split = append(split, splitFilterValue(v)...)
+		}
+		res[k] = split
+	}
+	return res
+}
+
+// splitFilterValue splits the value at every comma which is not escaped by a backslash and unescapes the escaped ones.
+func splitFilterValue(v string) []string {
+	if !strings.Contains(v, ",") {
+		return []string{v}
+	}
+
+	var values []string
+	var current strings.Builder
+	split := false
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\' && i+1 < len(v) && v[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case v[i] == ',':
+			split = true
+			if current.Len() > 0 {
+				values = append(values, current.String())
+			}
+			current.Reset()
+		default:
+			current.WriteByte(v[i])
+		}
+	}
+	if !split || current.Len() > 0 {
+		values = append(values, current.String())
+	}
+	return values
+}
+
+// validateEffect checks that the query parameter "effect" is empty, "allow", or "deny".
+func validateEffect(m map[string][]string) error {
+	if v := m["effect"]; len(v) > 0 && v[0] != "" && v[0] != effectAllow && v[0] != effectDeny {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "effect" must be one of "%s" or "%s" but got "%s".`, effectAllow, effectDeny, v[0]))
+	}
+	return nil
+}
+
+// validateConditionFilters checks that the query parameter "has_condition" is empty or a boolean.
+func validateConditionFilters(m map[string][]string) error {
+	return validateBoolFilter(m, "has_condition")
+}
+
+// validateActiveOnlyFilter checks that the query parameter "active_only" is empty or a boolean.
+func validateActiveOnlyFilter(m map[string][]string) error {
+	return validateBoolFilter(m, "active_only")
+}
+
+// validateEmptyFilter checks that the query parameter "empty" is empty or a boolean.
+func validateEmptyFilter(m map[string][]string) error {
+	return validateBoolFilter(m, "empty")
+}
+
+func validateBoolFilter(m map[string][]string, key string) error {
+	if v := m[key]; len(v) > 0 && v[0] != "" {
+		if _, err := strconv.ParseBool(v[0]); err != nil {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" must be a boolean but got "%s".`, key, v[0]))
+		}
+	}
+	return nil
+}
+
+// contains checks if target is in source, ignoring the casing if requested.
+func (o *filterOptions) contains(target string, source []string) bool {
+	if !o.caseInsensitive {
+		return contains(target, source)
+	}
+
+	for _, i := range source {
+		if strings.EqualFold(i, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrefix checks if target starts with prefix, ignoring the casing if requested.
+func (o *filterOptions) hasPrefix(target, prefix string) bool {
+	if !o.caseInsensitive {
+		return strings.HasPrefix(target, prefix)
+	}
+	return len(target) >= len(prefix) && strings.EqualFold(target[:len(prefix)], prefix)
+}
+
+// containsPattern checks if target is in source or matches one of the patterns in source. See compilePatternOf for
+// the pattern syntax. A malformed pattern does not match and is recorded in o.err.
+func (o *filterOptions) containsPattern(target string, source []string) bool {
+	if o.contains(target, source) {
+		return true
+	}
+
+	for _, i := range source {
+		if !isPatternOf(i, o.flavor) {
+			continue
+		}
+
+		re, err := compilePatternOf(i, o.flavor, o.caseInsensitive)
+		if err != nil {
+			if o.err == nil {
+				o.err = err
+			}
+			continue
+		}
+
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// under checks if value, a stored value which may be a pattern, matches the path or any path below it. Paths are
+// split into segments at "/". A literal segment must equal the segment of the path, and a segment with patterns must
+// match one or more consecutive segments, so that "projects/1" matches "projects/1/datasets/2" and "projects/<.*>"
+// but neither "projects/10" nor "projects/2/datasets". A pattern spanning several segments, like
+// "projects/<1/datasets/.*>", only matches paths which contain all of them. A malformed pattern does not match and is
+// recorded in o.err.
+func (o *filterOptions) under(value, path string) bool {
+	return o.underSegments(splitPattern(value, '/'), strings.Split(strings.TrimSuffix(path, "/"), "/"))
+}
+
+func (o *filterOptions) underSegments(value, path []string) bool {
+	if len(path) == 0 {
+		return true
+	} else if len(value) == 0 {
+		return false
+	}
+
+	if !isPatternOf(value[0], o.flavor) {
+		return o.equal(value[0], path[0]) && o.underSegments(value[1:], path[1:])
+	}
+
+	re, err := compilePatternOf(value[0], o.flavor, o.caseInsensitive)
+	if err != nil {
+		if o.err == nil {
+			o.err = err
+		}
+		return false
+	}
+
+	for n := 1; n <= len(path); n++ {
+		if re.MatchString(strings.Join(path[:n], "/")) && o.underSegments(value[1:], path[n:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares two values, ignoring the casing if requested.
+func (o *filterOptions) equal(a, b string) bool {
+	if o.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// matches checks the filter values against the source. With MatchAll every value must be contained in source, with
+// MatchAny at least one. Negated values, see negationPrefix, must not be contained in source regardless of the match
+// mode, and only negated values match every source which contains none of them.
+func (o *filterOptions) matches(values []string, source []string) bool {
+	return o.matchesWith(o.contains, values, source)
+}
+
+// matchesPatterns is like matches but also matches the filter values against the patterns in source.
+func (o *filterOptions) matchesPatterns(values []string, source []string) bool {
+	return o.matchesWith(o.containsPattern, values, source)
+}
+
+func (o *filterOptions) matchesWith(contains func(string, []string) bool, values []string, source []string) bool {
+	if o.literal {
+		return o.includes(contains, values, source)
+	}
+	included, excluded := splitNegations(values)
+	return !o.excludes(contains, excluded, source) && (len(included) == 0 || o.includes(contains, included, source))
+}
+
+// excludes checks if one of the excluded values is contained in source.
+func (o *filterOptions) excludes(contains func(string, []string) bool, excluded []string, source []string) bool {
+	for _, v := range excluded {
+		if contains(v, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// includes checks the values, which must not be negated, against the source according to the match mode.
+func (o *filterOptions) includes(contains func(string, []string) bool, values []string, source []string) bool {
+	if o.match == MatchAny {
+		for _, v := range values {
+			if contains(v, source) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, v := range values {
+		if !contains(v, source) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny returns true if no negated filter value matches its source, including its patterns, and if either no
+// other filter values were given at all or the values of at least one filter key match their source.
+func (o *filterOptions) matchesAny(filters ...filter) bool {
+	var applied, matched bool
+	for _, f := range filters {
+		included, excluded := splitNegations(f.values)
+		if o.excludes(o.containsPattern, excluded, f.source) {
+			return false
+		}
+		if len(included) == 0 {
+			continue
+		}
+		applied = true
+		matched = matched || o.includes(o.containsPattern, included, f.source)
+	}
+	return matched || !applied
+}
+
+type filter struct {
+	values []string
+	source []string
+}
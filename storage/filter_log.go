@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// filterParams returns the query parameters which are filter keys of the collection type.
+func (r *FilterRegistry) filterParams(collection string, query url.Values) map[string][]string {
+	r.RLock()
+	f, ok := r.filters[collectionType(collection)]
+	r.RUnlock()
+
+	params := map[string][]string{}
+	if !ok {
+		return params
+	}
+	for _, k := range f.keys {
+		if v, ok := query[k]; ok {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// debugFilter logs at debug level how ListByQuery filtered a list request: the filter parameters, the number of
+// entries before and after filtering, and the bounds of the page within the filtered entries. Nothing is done unless
+// the logger is set and debug logging is enabled.
+func (h *Handler) debugFilter(ctx context.Context, collection string, query url.Values, before, after, start, end int) {
+	if h.l == nil || !h.l.Logrus().IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+
+	h.l.WithContext(ctx).
+		WithField("collection", collection).
+		WithField("filters", h.filters.filterParams(collection, query)).
+		WithField("before", before).
+		WithField("after", after).
+		WithField("page_start", start).
+		WithField("page_end", end).
+		Debug("Filtered the list request.")
+}
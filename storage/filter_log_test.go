@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+func TestFilterDebugLog(t *testing.T) {
+	const collection = "/tests/debug/roles"
+
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(context.Background(), collection, map[string]interface{}{
+		"admins":  &Role{ID: "admins", Members: []string{"alice"}},
+		"editors": &Role{ID: "editors", Members: []string{"alice", "bob"}},
+		"viewers": &Role{ID: "viewers", Members: []string{"bob"}},
+	}))
+
+	newServer := func(level logrus.Level, hook *test.Hook, opts ...HandlerOption) *httptest.Server {
+		opts = append(opts, WithLogger(logrusx.New("", "", logrusx.WithHook(hook), logrusx.ForceLevel(level))))
+		h := NewHandler(m, herodot.NewJSONWriter(nil), opts...)
+		r := httprouter.New()
+		r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			return &ListRequest{Collection: collection, Value: new(Roles), FilterFunc: ListByQuery}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	get := func(t *testing.T, ts *httptest.Server, path string) {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []HandlerOption
+		path string
+	}{
+		{name: "filtered", path: "/roles?member=alice&limit=1&offset=1&fields=id"},
+		{name: "streamed", opts: []HandlerOption{WithStreamThreshold(1)}, path: "/roles?member=alice&limit=1&offset=1"},
+		{name: "cursor", path: "/roles?member=alice&limit=1&page_token=" + encodePageToken("admins")},
+	} {
+		t.Run("case="+tc.name, func(t *testing.T) {
+			hook := new(test.Hook)
+			ts := newServer(logrus.DebugLevel, hook, tc.opts...)
+			defer ts.Close()
+
+			get(t, ts, tc.path)
+			get(t, ts, "/roles?limit=1")
+
+			entries := hook.AllEntries()
+			require.Len(t, entries, 1)
+			assert.Equal(t, logrus.DebugLevel, entries[0].Level)
+			assert.Equal(t, collection, entries[0].Data["collection"])
+			assert.Equal(t, map[string][]string{"member": {"alice"}}, entries[0].Data["filters"])
+			assert.Equal(t, 3, entries[0].Data["before"])
+			assert.Equal(t, 2, entries[0].Data["after"])
+			assert.Equal(t, 1, entries[0].Data["page_start"])
+			assert.Equal(t, 2, entries[0].Data["page_end"])
+		})
+	}
+
+	t.Run("case=not logged above debug level", func(t *testing.T) {
+		hook := new(test.Hook)
+		ts := newServer(logrus.InfoLevel, hook)
+		defer ts.Close()
+
+		get(t, ts, "/roles?member=alice")
+		assert.Empty(t, hook.AllEntries())
+	})
+}
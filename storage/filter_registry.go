@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// FilterFunc filters value, a pointer to a slice as set in ListRequest.Value, by the query parameters and applies
+// the pagination. It returns the remaining page, which is usually a pointer to a slice of the same type.
+type FilterFunc func(value interface{}, params map[string][]string, offset, limit int) (interface{}, error)
+
+// FilterRegistry dispatches ListByQuery to the FilterFunc registered for the collection type of a list request. The
+// collection type is the last path segment of the collection, for example "roles". It is safe for concurrent use.
+type FilterRegistry struct {
+	sync.RWMutex
+	filters map[string]*registeredFilter
+
+	// maxExpansionDepth limits how deeply nested roles are expanded by the pre-registered roles filter.
+	maxExpansionDepth int
+}
+
+type registeredFilter struct {
+	f    FilterFunc
+	keys []string
+
+	// streamable is only set for the pre-registered filters, which Handler.stream knows how to apply.
+	streamable bool
+}
+
+// DefaultFilterRegistry is used by ListByQuery and by every handler which is not configured with
+// WithFilterRegistry.
+var DefaultFilterRegistry = NewFilterRegistry()
+
+// NewFilterRegistry returns a registry with the filters for "roles" and "policies" described in ListByQuery.
+func NewFilterRegistry() *FilterRegistry {
+	r := &FilterRegistry{maxExpansionDepth: DefaultMaxExpansionDepth}
+	r.filters = map[string]*registeredFilter{
+		"roles": {
+			f: func(value interface{}, m map[string][]string, offset, limit int) (interface{}, error) {
+				return filterRoles(value, m, offset, limit, r.expansionDepth())
+			},
+			keys:       []string{"member", "id", "id_prefix", "empty", "scope", "expand", "sort", "order"},
+			streamable: true,
+		},
+		"policies": {
+			f:          filterPolicies,
+			keys:       []string{"id", "action", "subject", "resource", "resource_prefix", "effect", "has_condition", "condition_key", "active_only", "sort", "order"},
+			streamable: true,
+		},
+	}
+	return r
+}
+
+// SetMaxExpansionDepth limits how many levels of nested roles are resolved when roles are listed with "expand=true".
+// Listing roles whose members are nested deeper fails with 422 instead of doing unbounded work. Defaults to
+// DefaultMaxExpansionDepth, which is also used for depths below one.
+func (r *FilterRegistry) SetMaxExpansionDepth(depth int) {
+	if depth < 1 {
+		depth = DefaultMaxExpansionDepth
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.maxExpansionDepth = depth
+}
+
+func (r *FilterRegistry) expansionDepth() int {
+	r.RLock()
+	defer r.RUnlock()
+	return r.maxExpansionDepth
+}
+
+// WithFilterRegistry sets the registry through which the handler dispatches list requests filtered by ListByQuery.
+// Defaults to DefaultFilterRegistry.
+func WithFilterRegistry(r *FilterRegistry) HandlerOption {
+	return func(h *Handler) {
+		h.filters = r
+	}
+}
+
+// Register sets the filter of the collection type, replacing a previous one. The keys are the query parameters
+// handled by f. If a list request contains any of them, f is passed the whole collection. Otherwise it is only passed
+// the page returned by the backend.
+func (r *FilterRegistry) Register(collectionType string, f FilterFunc, keys ...string) {
+	r.Lock()
+	defer r.Unlock()
+	r.filters[collectionType] = &registeredFilter{f: f, keys: keys}
+}
+
+func (r *FilterRegistry) lookup(l *ListRequest) *registeredFilter {
+	r.RLock()
+	defer r.RUnlock()
+
+	if f, ok := r.filters[collectionType(l.Collection)]; ok {
+		return f
+	}
+
+	// list requests of an unregistered collection are dispatched by the type of their value, like ListByQuery
+	// always did.
+	switch l.Value.(type) {
+	case *Roles:
+		return r.filters["roles"]
+	case *Policies:
+		return r.filters["policies"]
+	}
+	return nil
+}
+
+// Filter has the signature of ListRequest.FilterFunc and applies the filter registered for the list request. The
+// comma-separated values of the list filter keys are split before the filter is applied, see splitFilterValues.
+func (r *FilterRegistry) Filter(l *ListRequest, m map[string][]string, offset int, limit int) error {
+	f := r.lookup(l)
+	if f == nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to cast list request of type %T to a known type.", l.Value))
+	}
+
+	v, err := f.f(l.Value, splitFilterValues(m), offset, limit)
+	if err != nil {
+		return err
+	}
+	l.Value = v
+	return nil
+}
+
+// isFilter checks if the query contains any of the filter keys registered for the collection type.
+func (r *FilterRegistry) isFilter(collection string, query url.Values) bool {
+	r.RLock()
+	f, ok := r.filters[collectionType(collection)]
+	r.RUnlock()
+	if !ok {
+		return false
+	}
+
+	for _, k := range f.keys {
+		if _, ok := query[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// streamable checks if the filter of the list request can be applied while streaming.
+func (r *FilterRegistry) streamable(l *ListRequest) bool {
+	f := r.lookup(l)
+	return f != nil && f.streamable
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type group struct {
+	ID string `json:"id"`
+}
+
+func TestFilterRegistry(t *testing.T) {
+	filters := NewFilterRegistry()
+	filters.Register("groups", func(value interface{}, m map[string][]string, offset, limit int) (interface{}, error) {
+		res := make([]group, 0)
+		for _, g := range *value.(*[]group) {
+			if len(m["suffix"]) == 0 || strings.HasSuffix(g.ID, m["suffix"][0]) {
+				res = append(res, g)
+			}
+		}
+		start, end := index(limit, offset, len(res))
+		res = res[start:end]
+		return &res, nil
+	}, "suffix")
+
+	m := NewMemoryManager()
+	for _, id := range []string{"a-admins", "b-users", "c-admins"} {
+		require.NoError(t, m.Upsert(context.Background(), "/tests/registry/groups", id, &group{ID: id}))
+		require.NoError(t, m.Upsert(context.Background(), "/tests/registry/roles", id, &Role{ID: id, Members: []string{"alice"}}))
+	}
+
+	server := func(h *Handler) *httptest.Server {
+		r := httprouter.New()
+		r.GET("/groups", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make([]group, 0)
+			return &ListRequest{Collection: "/tests/registry/groups", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		r.GET("/count/groups", h.Count(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make([]group, 0)
+			return &ListRequest{Collection: "/tests/registry/groups", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Roles, 0)
+			return &ListRequest{Collection: "/tests/registry/roles", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	registered := server(NewHandler(m, herodot.NewJSONWriter(nil), WithFilterRegistry(filters)))
+	defer registered.Close()
+	unregistered := server(NewHandler(m, herodot.NewJSONWriter(nil)))
+	defer unregistered.Close()
+
+	for k, tc := range []struct {
+		ts   *httptest.Server
+		path string
+		code int
+		body string
+	}{
+		{ts: registered, path: "/groups?suffix=-admins", code: http.StatusOK, body: `[{"id":"a-admins"},{"id":"c-admins"}]`},
+		{ts: registered, path: "/groups?suffix=-admins&offset=1", code: http.StatusOK, body: `[{"id":"c-admins"}]`},
+		{ts: registered, path: "/groups", code: http.StatusOK, body: `[{"id":"a-admins"},{"id":"b-users"},{"id":"c-admins"}]`},
+		{ts: registered, path: "/count/groups?suffix=-users", code: http.StatusOK, body: `{"count":1}`},
+		{ts: registered, path: "/roles?member=alice&id_prefix=b-", code: http.StatusOK, body: `[{"id":"b-users","description":"","members":["alice"]}]`},
+		{ts: unregistered, path: "/groups?suffix=-admins", code: http.StatusInternalServerError},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := tc.ts.Client().Get(tc.ts.URL + tc.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			if tc.body != "" {
+				var body json.RawMessage
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				assert.JSONEq(t, tc.body, string(body))
+			}
+		})
+	}
+}
@@ -2,9 +2,14 @@ package storage
 
 import (
 	"fmt"
+	"net/http"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
 )
 
 func TestListRequest_Filter(t *testing.T) {
@@ -15,7 +20,9 @@ func TestListRequest_Filter(t *testing.T) {
 				Value:      &polReq,
 				FilterFunc: ListByQuery,
 			}
-			assert.Equal(t, &polRes[i], l.Filter(paramsReq[i].target, paramsReq[i].offset, paramsReq[i].limit).Value)
+			res, err := l.Filter(paramsReq[i].target, paramsReq[i].offset, paramsReq[i].limit)
+			require.NoError(t, err)
+			assert.Equal(t, &polRes[i], res.Value)
 		})
 
 		t.Run(fmt.Sprintf("Filter Roles: case=%s", paramsReq[i].target), func(t *testing.T) {
@@ -24,7 +31,865 @@ func TestListRequest_Filter(t *testing.T) {
 				Value:      &rolReq,
 				FilterFunc: ListByQuery,
 			}
-			assert.Equal(t, &rolRes[i], l.Filter(paramsReq[i].target, paramsReq[i].offset, paramsReq[i].limit).Value)
+			res, err := l.Filter(paramsReq[i].target, paramsReq[i].offset, paramsReq[i].limit)
+			require.NoError(t, err)
+			assert.Equal(t, &rolRes[i], res.Value)
+		})
+	}
+}
+
+func TestListRequest_FilterUnknownType(t *testing.T) {
+	var v []string
+	l := ListRequest{
+		Collection: "filter_test",
+		Value:      &v,
+		FilterFunc: ListByQuery,
+	}
+	_, err := l.Filter(map[string][]string{}, 0, 100)
+	require.Error(t, err)
+}
+
+func TestListRequest_FilterMatch(t *testing.T) {
+	policies := Policies{
+		{ID: "p1", Subjects: []string{"alice", "bob"}, Resources: []string{"r1"}, Actions: []string{"read"}},
+		{ID: "p2", Subjects: []string{"bob"}, Resources: []string{"r1", "r2"}, Actions: []string{"read", "write"}},
+		{ID: "p3", Subjects: []string{"carol"}, Resources: []string{"r2"}, Actions: []string{"write"}},
+	}
+	roles := Roles{
+		{ID: "r1", Members: []string{"alice", "bob"}},
+		{ID: "r2", Members: []string{"bob"}},
+		{ID: "r3", Members: []string{"carol"}},
+	}
+
+	for k, tc := range []struct {
+		query    map[string][]string
+		policies []string
+		roles    []string
+	}{
+		{query: map[string][]string{}, policies: []string{"p1", "p2", "p3"}, roles: []string{"r1", "r2", "r3"}},
+		{query: map[string][]string{"match": {"any"}}, policies: []string{"p1", "p2", "p3"}, roles: []string{"r1", "r2", "r3"}},
+		{query: map[string][]string{"subject": {"alice", "bob"}, "member": {"alice", "bob"}}, policies: []string{"p1"}, roles: []string{"r1"}},
+		{query: map[string][]string{"subject": {"alice", "bob"}, "member": {"alice", "bob"}, "match": {"all"}}, policies: []string{"p1"}, roles: []string{"r1"}},
+		{query: map[string][]string{"subject": {"alice", "bob"}, "member": {"alice", "bob"}, "match": {"any"}}, policies: []string{"p1", "p2"}, roles: []string{"r1", "r2"}},
+		{query: map[string][]string{"subject": {"bob"}, "action": {"write"}}, policies: []string{"p2"}, roles: []string{"r1", "r2", "r3"}},
+		{query: map[string][]string{"subject": {"carol"}, "action": {"read"}, "match": {"any"}}, policies: []string{"p1", "p2", "p3"}, roles: []string{"r1", "r2", "r3"}},
+		{query: map[string][]string{"subject": {"carol"}, "resource": {"r1"}, "match": {"any"}, "id": {"p1", "p2"}}, policies: []string{"p1", "p2"}, roles: []string{}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			var ids []string
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.policies, ids)
+
+			rl := roles
+			l = &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err = l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids = []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.roles, ids)
+		})
+	}
+
+	t.Run("case=invalid", func(t *testing.T) {
+		l := &ListRequest{Value: &policies, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"match": {"some"}}, 0, 100)
+		require.Error(t, err)
+	})
+}
+
+func TestListRequest_FilterCase(t *testing.T) {
+	policies := Policies{
+		{ID: "p1", Subjects: []string{"Alice"}, Resources: []string{"Articles"}, Actions: []string{"READ"}},
+		{ID: "p2", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}},
+		{ID: "p3", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"write"}},
+	}
+	roles := Roles{
+		{ID: "r1", Members: []string{"Alice"}},
+		{ID: "r2", Members: []string{"alice"}},
+		{ID: "r3", Members: []string{"bob"}},
+	}
+
+	for k, tc := range []struct {
+		query    map[string][]string
+		policies []string
+		roles    []string
+	}{
+		{query: map[string][]string{"subject": {"alice"}, "member": {"alice"}}, policies: []string{"p2"}, roles: []string{"r2"}},
+		{query: map[string][]string{"subject": {"Alice"}, "member": {"Alice"}, "case": {"sensitive"}}, policies: []string{"p1"}, roles: []string{"r1"}},
+		{query: map[string][]string{"subject": {"ALICE"}, "member": {"ALICE"}}, policies: []string{}, roles: []string{}},
+		{query: map[string][]string{"subject": {"ALICE"}, "member": {"ALICE"}, "case": {"insensitive"}}, policies: []string{"p1", "p2"}, roles: []string{"r1", "r2"}},
+		{query: map[string][]string{"resource": {"ARTICLES"}, "action": {"Read"}, "case": {"insensitive"}}, policies: []string{"p1", "p2"}, roles: []string{"r1", "r2", "r3"}},
+		{query: map[string][]string{"resource": {"ARTICLES"}, "action": {"Read"}}, policies: []string{}, roles: []string{"r1", "r2", "r3"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.policies, ids)
+
+			rl := roles
+			l = &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err = l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids = []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.roles, ids)
+		})
+	}
+
+	t.Run("case=invalid", func(t *testing.T) {
+		l := &ListRequest{Value: &policies, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"case": {"upper"}}, 0, 100)
+		require.Error(t, err)
+	})
+}
+
+func TestListRequest_FilterExpand(t *testing.T) {
+	// admins -> (editors, reviewers) -> writers forms a diamond, and writers -> admins closes a cycle.
+	roles := func() Roles {
+		return Roles{
+			{ID: "admins", Members: []string{"alice", "editors", "reviewers"}},
+			{ID: "editors", Members: []string{"bob", "writers"}},
+			{ID: "reviewers", Members: []string{"carol", "writers"}},
+			{ID: "writers", Members: []string{"dave", "admins"}},
+			{ID: "readers", Members: []string{"erin"}},
+		}
+	}
+
+	t.Run("case=expand", func(t *testing.T) {
+		rl := roles()
+		l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"expand": {"true"}}, 0, 100)
+		require.NoError(t, err)
+
+		effective := map[string][]string{}
+		for _, r := range *l.Value.(*Roles) {
+			effective[r.ID] = r.EffectiveMembers
+		}
+		assert.Equal(t, map[string][]string{
+			"admins":    {"alice", "bob", "carol", "dave"},
+			"editors":   {"alice", "bob", "carol", "dave"},
+			"reviewers": {"alice", "bob", "carol", "dave"},
+			"writers":   {"alice", "bob", "carol", "dave"},
+			"readers":   {"erin"},
+		}, effective)
+		assert.Equal(t, []string{"alice", "editors", "reviewers"}, (*l.Value.(*Roles))[0].Members)
+	})
+
+	t.Run("case=member filter uses effective members", func(t *testing.T) {
+		for _, tc := range []struct {
+			expand string
+			ids    []string
+		}{
+			{expand: "true", ids: []string{"admins", "editors", "reviewers", "writers"}},
+			{expand: "false", ids: []string{"writers"}},
+		} {
+			rl := roles()
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(map[string][]string{"member": {"dave"}, "expand": {tc.expand}}, 0, 100)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids, "expand=%s", tc.expand)
+		}
+	})
+
+	t.Run("case=invalid", func(t *testing.T) {
+		rl := roles()
+		l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"expand": {"maybe"}}, 0, 100)
+		require.Error(t, err)
+	})
+
+	t.Run("case=max depth", func(t *testing.T) {
+		// level-0 contains level-1, which contains level-2, and so on down to level-9, which contains alice.
+		chain := func() Roles {
+			rl := make(Roles, 10)
+			for k := range rl {
+				rl[k] = Role{ID: fmt.Sprintf("level-%d", k), Members: []string{fmt.Sprintf("level-%d", k+1)}}
+			}
+			rl[9].Members = []string{"alice"}
+			return rl
+		}
+
+		for _, tc := range []struct {
+			depth int
+			err   bool
+		}{
+			{depth: 3, err: true},
+			{depth: 8, err: true},
+			{depth: 9},
+			{depth: 0},
+		} {
+			t.Run(fmt.Sprintf("depth=%d", tc.depth), func(t *testing.T) {
+				r := NewFilterRegistry()
+				r.SetMaxExpansionDepth(tc.depth)
+
+				rl := chain()
+				l := &ListRequest{Collection: "/tests/depth/roles", Value: &rl}
+				err := r.Filter(l, map[string][]string{"member": {"alice"}, "expand": {"true"}}, 0, 100)
+				if tc.err {
+					require.Error(t, err)
+					assert.Equal(t, http.StatusUnprocessableEntity, herodot.ToDefaultError(err, "").StatusCode())
+					assert.Equal(t, "level-0", herodot.ToDefaultError(err, "").Details()["key"])
+					return
+				}
+				require.NoError(t, err)
+				assert.Len(t, *l.Value.(*Roles), 10)
+			})
+		}
+	})
+}
+
+func TestListRequest_FilterPattern(t *testing.T) {
+	policies := Policies{
+		{ID: "exact", Subjects: []string{"alice"}, Resources: []string{"articles:1"}, Actions: []string{"read"}},
+		{ID: "glob", Subjects: []string{"users:*"}, Resources: []string{"articles:*"}, Actions: []string{"*"}},
+		{ID: "super-glob", Subjects: []string{"users:**"}, Resources: []string{"comments:**"}, Actions: []string{"read"}},
+		{ID: "regex", Subjects: []string{"<alice|bob>"}, Resources: []string{"articles:<[0-9]+>"}, Actions: []string{"<read|write>"}},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"resource": {"articles:1"}}, ids: []string{"exact", "glob", "regex"}},
+		{query: map[string][]string{"resource": {"articles:abc"}}, ids: []string{"glob"}},
+		{query: map[string][]string{"resource": {"articles:1:2"}}, ids: []string{}},
+		{query: map[string][]string{"resource": {"comments:1:2"}}, ids: []string{"super-glob"}},
+		{query: map[string][]string{"resource": {"articles:<[0-9]+>"}}, ids: []string{"glob", "regex"}},
+		{query: map[string][]string{"subject": {"bob"}, "action": {"write"}}, ids: []string{"regex"}},
+		{query: map[string][]string{"subject": {"users:peter"}, "action": {"delete"}}, ids: []string{"glob"}},
+		{query: map[string][]string{"subject": {"BOB"}, "case": {"insensitive"}}, ids: []string{"regex"}},
+		{query: map[string][]string{"subject": {"BOB"}}, ids: []string{}},
+		{query: map[string][]string{"subject": {"users:peter"}, "resource": {"articles:1"}, "match": {"any"}}, ids: []string{"exact", "glob", "regex", "super-glob"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	for k, pattern := range []string{"articles:<[0-9+>", "articles:<.*", "articles:.*>"} {
+		t.Run(fmt.Sprintf("case=malformed-%d", k), func(t *testing.T) {
+			pl := Policies{{ID: "malformed", Resources: []string{pattern}}}
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(map[string][]string{"resource": {"articles:1"}}, 0, 100)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, errors.Cause(err).(*herodot.DefaultError).StatusCode())
+		})
+	}
+}
+
+func TestListRequest_FilterSort(t *testing.T) {
+	policies := Policies{
+		{ID: "c", Effect: "allow"},
+		{ID: "a", Effect: "deny"},
+		{ID: "d", Effect: "deny"},
+		{ID: "b", Effect: "allow"},
+	}
+	roles := Roles{{ID: "c"}, {ID: "a"}, {ID: "b"}}
+
+	for k, tc := range []struct {
+		query    map[string][]string
+		policies []string
+		roles    []string
+	}{
+		{query: map[string][]string{}, policies: []string{"a", "b", "c", "d"}, roles: []string{"a", "b", "c"}},
+		{query: map[string][]string{"order": {"desc"}}, policies: []string{"d", "c", "b", "a"}, roles: []string{"c", "b", "a"}},
+		{query: map[string][]string{"sort": {"id"}, "order": {"asc"}}, policies: []string{"a", "b", "c", "d"}, roles: []string{"a", "b", "c"}},
+		{query: map[string][]string{"sort": {"effect"}}, policies: []string{"b", "c", "a", "d"}},
+		{query: map[string][]string{"sort": {"effect"}, "order": {"desc"}}, policies: []string{"d", "a", "c", "b"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := append(Policies{}, policies...)
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.policies, ids)
+
+			if tc.roles == nil {
+				return
+			}
+			rl := append(Roles{}, roles...)
+			l = &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err = l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			ids = []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.roles, ids)
+		})
+	}
+
+	t.Run("case=pages are sorted before pagination", func(t *testing.T) {
+		pl := append(Policies{}, policies...)
+		l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{}, 2, 2)
+		require.NoError(t, err)
+		assert.Equal(t, Policies{policies[0], policies[2]}, *l.Value.(*Policies))
+	})
+
+	for k, query := range []map[string][]string{
+		{"sort": {"effect"}},
+		{"sort": {"description"}},
+		{"order": {"random"}},
+	} {
+		t.Run(fmt.Sprintf("case=invalid-%d", k), func(t *testing.T) {
+			rl := append(Roles{}, roles...)
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(query, 0, 100)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, errors.Cause(err).(*herodot.DefaultError).StatusCode())
 		})
 	}
 }
+
+func TestListRequest_FilterBounds(t *testing.T) {
+	for k, tc := range []struct {
+		limit, offset int
+		ids           []string
+	}{
+		{limit: 100, offset: 1000, ids: []string{}},
+		{limit: 2, offset: 3, ids: []string{}},
+		{limit: 2, offset: 2, ids: []string{"c"}},
+		{limit: -1, offset: 0, ids: []string{}},
+		{limit: 2, offset: -5, ids: []string{"a", "b"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := Policies{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(map[string][]string{}, tc.offset, tc.limit)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+
+			rl := Roles{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+			l = &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err = l.Filter(map[string][]string{}, tc.offset, tc.limit)
+			require.NoError(t, err)
+			ids = []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestListRequest_FilterIDPrefix(t *testing.T) {
+	roles := Roles{
+		{ID: "tenant:acme:editors", Members: []string{"alice"}},
+		{ID: "tenant:acme:viewers", Members: []string{"bob"}},
+		{ID: "tenant:acmecorp:editors", Members: []string{"alice"}},
+		{ID: "legacy:tenant:acme:editors", Members: []string{"alice"}},
+		{ID: "Tenant:ACME:admins", Members: []string{"carol"}},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"id_prefix": {"tenant:acme:"}}, ids: []string{"tenant:acme:editors", "tenant:acme:viewers"}},
+		{query: map[string][]string{"id_prefix": {"tenant:acme"}}, ids: []string{"tenant:acme:editors", "tenant:acme:viewers", "tenant:acmecorp:editors"}},
+		{query: map[string][]string{"id_prefix": {"acme:"}}, ids: []string{}},
+		{query: map[string][]string{"id_prefix": {"editors"}}, ids: []string{}},
+		{query: map[string][]string{"id_prefix": {"tenant:acme:"}, "member": {"alice"}}, ids: []string{"tenant:acme:editors"}},
+		{query: map[string][]string{"id_prefix": {"tenant:acme:"}, "member": {"alice", "bob"}, "match": {"any"}}, ids: []string{"tenant:acme:editors", "tenant:acme:viewers"}},
+		{query: map[string][]string{"id_prefix": {"tenant:acme:"}, "case": {"insensitive"}}, ids: []string{"Tenant:ACME:admins", "tenant:acme:editors", "tenant:acme:viewers"}},
+		{query: map[string][]string{"id_prefix": {"tenant:acme:", "legacy:"}}, ids: []string{"legacy:tenant:acme:editors", "tenant:acme:editors", "tenant:acme:viewers"}},
+		{query: map[string][]string{"id_prefix": {""}}, ids: []string{"Tenant:ACME:admins", "legacy:tenant:acme:editors", "tenant:acme:editors", "tenant:acme:viewers", "tenant:acmecorp:editors"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			rl := roles
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("case=applied before pagination", func(t *testing.T) {
+		rl := roles
+		l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"id_prefix": {"tenant:acme:"}}, 1, 1)
+		require.NoError(t, err)
+		require.Len(t, *l.Value.(*Roles), 1)
+		assert.Equal(t, "tenant:acme:viewers", (*l.Value.(*Roles))[0].ID)
+	})
+}
+
+func TestListRequest_FilterEmpty(t *testing.T) {
+	roles := Roles{
+		{ID: "admins", Members: []string{"alice"}},
+		{ID: "orphans"},
+		{ID: "staff", Members: []string{"editors"}},
+		{ID: "editors", Members: []string{"bob"}},
+		{ID: "unused", Members: []string{}},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+		err   bool
+	}{
+		{query: map[string][]string{"empty": {"true"}}, ids: []string{"orphans", "unused"}},
+		{query: map[string][]string{"empty": {"false"}}, ids: []string{"admins", "editors", "staff"}},
+		{query: map[string][]string{"empty": {""}}, ids: []string{"admins", "editors", "orphans", "staff", "unused"}},
+		{query: map[string][]string{"empty": {"false"}, "member": {"bob"}}, ids: []string{"editors"}},
+		{query: map[string][]string{"empty": {"true"}, "member": {"bob"}, "match": {"any"}}, ids: []string{}},
+		{query: map[string][]string{"empty": {"false"}, "member": {"bob"}, "expand": {"true"}}, ids: []string{"editors", "staff"}},
+		{query: map[string][]string{"empty": {"true"}, "id_prefix": {"un"}}, ids: []string{"unused"}},
+		{query: map[string][]string{"empty": {"maybe"}}, err: true},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			rl := append(Roles{}, roles...)
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("case=applied before pagination", func(t *testing.T) {
+		rl := append(Roles{}, roles...)
+		l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"empty": {"false"}}, 1, 1)
+		require.NoError(t, err)
+		require.Len(t, *l.Value.(*Roles), 1)
+		assert.Equal(t, "editors", (*l.Value.(*Roles))[0].ID)
+	})
+}
+
+func TestListRequest_FilterEffect(t *testing.T) {
+	policies := Policies{
+		{ID: "p1", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "p2", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "deny"},
+		{ID: "p3", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "p4", Subjects: []string{"bob"}, Resources: []string{"comments"}, Actions: []string{"delete"}, Effect: "deny"},
+		{ID: "p5", Subjects: []string{"carol"}, Resources: []string{"comments"}, Actions: []string{"read"}, Effect: "deny"},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		count int
+	}{
+		{query: map[string][]string{}, count: 5},
+		{query: map[string][]string{"effect": {""}}, count: 5},
+		{query: map[string][]string{"effect": {"allow"}}, count: 2},
+		{query: map[string][]string{"effect": {"deny"}}, count: 3},
+		{query: map[string][]string{"effect": {"deny"}, "subject": {"alice"}}, count: 1},
+		{query: map[string][]string{"effect": {"allow"}, "resource": {"comments"}}, count: 0},
+		{query: map[string][]string{"effect": {"deny"}, "action": {"read"}, "resource": {"comments"}}, count: 1},
+		{query: map[string][]string{"effect": {"deny"}, "subject": {"alice", "bob"}, "match": {"any"}}, count: 2},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+			assert.Len(t, *l.Value.(*Policies), tc.count)
+		})
+	}
+
+	t.Run("case=invalid", func(t *testing.T) {
+		pl := policies
+		l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"effect": {"maybe"}}, 0, 100)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, errors.Cause(err).(*herodot.DefaultError).StatusCode())
+	})
+}
+
+func TestListRequest_FilterConditions(t *testing.T) {
+	policies := Policies{
+		{ID: "p1", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "p2", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow",
+			Conditions: map[string]interface{}{"remoteIP": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}}},
+		{ID: "p3", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "deny",
+			Conditions: map[string]interface{}{
+				"remoteIP": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "192.168.0.0/16"}},
+				"owner":    map[string]interface{}{"type": "EqualsSubjectCondition"},
+			}},
+		{ID: "p4", Subjects: []string{"bob"}, Resources: []string{"comments"}, Actions: []string{"delete"}, Effect: "deny", Conditions: map[string]interface{}{}},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"has_condition": {""}}, ids: []string{"p1", "p2", "p3", "p4"}},
+		{query: map[string][]string{"has_condition": {"true"}}, ids: []string{"p2", "p3"}},
+		{query: map[string][]string{"has_condition": {"false"}}, ids: []string{"p1", "p4"}},
+		{query: map[string][]string{"condition_key": {"remoteIP"}}, ids: []string{"p2", "p3"}},
+		{query: map[string][]string{"condition_key": {"owner"}}, ids: []string{"p3"}},
+		{query: map[string][]string{"condition_key": {"owner", "unknown"}}, ids: []string{"p3"}},
+		{query: map[string][]string{"condition_key": {"unknown"}}, ids: []string{}},
+		{query: map[string][]string{"has_condition": {"true"}, "subject": {"alice"}}, ids: []string{"p2"}},
+		{query: map[string][]string{"has_condition": {"false"}, "condition_key": {"remoteIP"}}, ids: []string{}},
+		{query: map[string][]string{"condition_key": {"remoteIP"}, "subject": {"alice", "carol"}, "match": {"any"}}, ids: []string{"p2"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("case=invalid", func(t *testing.T) {
+		pl := policies
+		l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"has_condition": {"maybe"}}, 0, 100)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, errors.Cause(err).(*herodot.DefaultError).StatusCode())
+	})
+}
+
+func TestListRequest_FilterResourcePrefix(t *testing.T) {
+	policies := Policies{
+		{ID: "table", Resources: []string{"projects/1/datasets/2/tables/3"}, Effect: "allow"},
+		{ID: "dataset", Resources: []string{"projects/1/datasets/2"}, Effect: "allow"},
+		{ID: "project", Resources: []string{"projects/1"}, Effect: "deny"},
+		{ID: "sibling", Resources: []string{"projects/10/datasets/2"}, Effect: "allow"},
+		{ID: "other", Resources: []string{"projects/2/datasets/<.*>"}, Effect: "allow"},
+		{ID: "any-project", Resources: []string{"projects/<[0-9]+>/datasets/2"}, Effect: "allow"},
+		{ID: "any-dataset", Resources: []string{"projects/1/datasets/*"}, Effect: "allow"},
+		{ID: "all", Resources: []string{"projects/**"}, Effect: "deny"},
+		{ID: "root", Resources: []string{"projects"}, Effect: "allow"},
+		{ID: "spanning", Resources: []string{"projects/<1/datasets/[0-9]+>/tables/3"}, Effect: "allow"},
+		{ID: "only-projects", Resources: []string{"projects/<[0-9]+>"}, Effect: "allow"},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"resource_prefix": {"projects/1"}}, ids: []string{"all", "any-dataset", "any-project", "dataset", "only-projects", "project", "table"}},
+		{query: map[string][]string{"resource_prefix": {"projects/1/"}}, ids: []string{"all", "any-dataset", "any-project", "dataset", "only-projects", "project", "table"}},
+		{query: map[string][]string{"resource_prefix": {"projects/1/datasets/2"}}, ids: []string{"all", "any-dataset", "any-project", "dataset", "spanning", "table"}},
+		{query: map[string][]string{"resource_prefix": {"projects/1/datasets/2/tables"}}, ids: []string{"all", "any-dataset", "spanning", "table"}},
+		{query: map[string][]string{"resource_prefix": {"projects/10"}}, ids: []string{"all", "any-project", "only-projects", "sibling"}},
+		{query: map[string][]string{"resource_prefix": {"projects/2"}}, ids: []string{"all", "any-project", "only-projects", "other"}},
+		{query: map[string][]string{"resource_prefix": {"projects/3/datasets/4"}}, ids: []string{"all"}},
+		{query: map[string][]string{"resource_prefix": {"projects/2", "projects/10"}}, ids: []string{"all", "any-project", "only-projects", "other", "sibling"}},
+		{query: map[string][]string{"resource_prefix": {"PROJECTS/10"}, "case": {"insensitive"}}, ids: []string{"all", "any-project", "only-projects", "sibling"}},
+		{query: map[string][]string{"resource_prefix": {"PROJECTS/10"}}, ids: []string{}},
+		{query: map[string][]string{"resource_prefix": {"projects/1"}, "effect": {"deny"}}, ids: []string{"all", "project"}},
+		{query: map[string][]string{"resource_prefix": {"projects/1"}, "resource": {"projects/1/datasets/2"}}, ids: []string{"all", "any-dataset", "any-project", "dataset"}},
+		{query: map[string][]string{"resource_prefix": {"projects/1"}, "resource": {"projects/1/datasets/2"}, "match": {"any"}}, ids: []string{"all", "any-dataset", "any-project", "dataset"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			pl := policies
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("case=malformed", func(t *testing.T) {
+		pl := Policies{{ID: "malformed", Resources: []string{"projects/<[>"}, Effect: "allow"}}
+		l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"resource_prefix": {"projects/1"}}, 0, 100)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, errors.Cause(err).(*herodot.DefaultError).StatusCode())
+	})
+}
+
+func TestListRequest_FilterCommaSeparated(t *testing.T) {
+	roles := Roles{
+		{ID: "admins", Members: []string{"alice", "bob"}},
+		{ID: "editors", Members: []string{"bob", "carol"}},
+		{ID: "escaped", Members: []string{"doe, john"}},
+		{ID: "viewers", Members: []string{"alice", "bob", "carol"}},
+	}
+	policies := Policies{
+		{ID: "read", Subjects: []string{"alice"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "write", Subjects: []string{"bob"}, Actions: []string{"write", "read"}, Effect: "allow"},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"member": {"alice", "bob"}}, ids: []string{"admins", "viewers"}},
+		{query: map[string][]string{"member": {"alice,bob"}}, ids: []string{"admins", "viewers"}},
+		{query: map[string][]string{"member": {"alice,bob", "carol"}}, ids: []string{"viewers"}},
+		{query: map[string][]string{"member": {"alice,", ",,carol"}}, ids: []string{"viewers"}},
+		{query: map[string][]string{"member": {"alice,carol"}, "match": {"any"}}, ids: []string{"admins", "editors", "viewers"}},
+		{query: map[string][]string{"member": {`doe\, john`}}, ids: []string{"escaped"}},
+		{query: map[string][]string{"member": {`doe\, john,alice`}, "match": {"any"}}, ids: []string{"admins", "escaped", "viewers"}},
+		{query: map[string][]string{"id": {"admins,editors"}}, ids: []string{"admins", "editors"}},
+		{query: map[string][]string{"id_prefix": {"ad,ed"}}, ids: []string{"admins", "editors"}},
+	} {
+		t.Run(fmt.Sprintf("case=roles/%d", k), func(t *testing.T) {
+			rl := append(Roles{}, roles...)
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"action": {"write", "read"}}, ids: []string{"write"}},
+		{query: map[string][]string{"action": {"write,read"}}, ids: []string{"write"}},
+		{query: map[string][]string{"subject": {"alice,bob"}, "match": {"any"}}, ids: []string{"read", "write"}},
+	} {
+		t.Run(fmt.Sprintf("case=policies/%d", k), func(t *testing.T) {
+			pl := append(Policies{}, policies...)
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestListRequest_FilterNegation(t *testing.T) {
+	policies := Policies{
+		{ID: "read", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "write", Subjects: []string{"bob"}, Resources: []string{"articles"}, Actions: []string{"read", "write"}, Effect: "allow"},
+		{ID: "pattern", Subjects: []string{"users:<.*>"}, Resources: []string{"comments"}, Actions: []string{"<read|delete>"}, Effect: "allow"},
+		{ID: "bang", Subjects: []string{"!root"}, Resources: []string{"articles"}, Actions: []string{"update"}, Effect: "deny"},
+	}
+	roles := Roles{
+		{ID: "admins", Members: []string{"alice", "bob"}},
+		{ID: "editors", Members: []string{"bob", "carol"}},
+		{ID: "viewers", Members: []string{"carol"}},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		// pure positive filters are unchanged.
+		{query: map[string][]string{"action": {"read"}}, ids: []string{"pattern", "read", "write"}},
+		// pure negative filters keep everything which does not match, including patterns.
+		{query: map[string][]string{"action": {"!read"}}, ids: []string{"bang"}},
+		{query: map[string][]string{"action": {"!write"}}, ids: []string{"bang", "pattern", "read"}},
+		{query: map[string][]string{"action": {"!write,!delete"}}, ids: []string{"bang", "read"}},
+		{query: map[string][]string{"subject": {"!users:alice"}}, ids: []string{"bang", "read", "write"}},
+		// mixed filters include the positives and exclude the negatives.
+		{query: map[string][]string{"action": {"read", "!write"}}, ids: []string{"pattern", "read"}},
+		{query: map[string][]string{"action": {"read,!delete"}, "resource": {"!comments"}}, ids: []string{"read", "write"}},
+		{query: map[string][]string{"resource": {"articles"}, "action": {"!read"}}, ids: []string{"bang"}},
+		// exclusions apply regardless of the match mode.
+		{query: map[string][]string{"action": {"write", "delete", "!read"}, "match": {"any"}}, ids: []string{}},
+		{query: map[string][]string{"subject": {"alice"}, "action": {"update", "!write"}, "match": {"any"}}, ids: []string{"bang", "read"}},
+		{query: map[string][]string{"action": {"!write"}, "match": {"any"}}, ids: []string{"bang", "pattern", "read"}},
+		// a literal leading "!" is escaped.
+		{query: map[string][]string{"subject": {`\!root`}}, ids: []string{"bang"}},
+		{query: map[string][]string{"subject": {"!!root"}}, ids: []string{"pattern", "read", "write"}},
+	} {
+		t.Run(fmt.Sprintf("case=policies/%d", k), func(t *testing.T) {
+			pl := append(Policies{}, policies...)
+			l := &ListRequest{Value: &pl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, p := range *l.Value.(*Policies) {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"member": {"bob"}}, ids: []string{"admins", "editors"}},
+		{query: map[string][]string{"member": {"!alice"}}, ids: []string{"editors", "viewers"}},
+		{query: map[string][]string{"member": {"bob", "!alice"}}, ids: []string{"editors"}},
+		{query: map[string][]string{"member": {"alice,carol,!bob"}, "match": {"any"}}, ids: []string{"viewers"}},
+	} {
+		t.Run(fmt.Sprintf("case=roles/%d", k), func(t *testing.T) {
+			rl := append(Roles{}, roles...)
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestListRequest_FilterScope(t *testing.T) {
+	roles := Roles{
+		{ID: "editors", Members: []string{"alice"}},
+		{ID: "project-1-editors", Members: []string{"alice"}, Scope: "projects:1"},
+		{ID: "project-2-editors", Members: []string{"bob"}, Scope: "projects:2"},
+		{ID: "project-editors", Members: []string{"carol"}, Scope: "projects:<.*>"},
+	}
+
+	for k, tc := range []struct {
+		query map[string][]string
+		ids   []string
+	}{
+		{query: map[string][]string{"scope": {"projects:1"}}, ids: []string{"project-1-editors", "project-editors"}},
+		{query: map[string][]string{"scope": {"projects:1,projects:2"}}, ids: []string{"project-1-editors", "project-2-editors", "project-editors"}},
+		{query: map[string][]string{"scope": {"projects:3"}}, ids: []string{"project-editors"}},
+		{query: map[string][]string{"scope": {"teams:1"}}, ids: []string{}},
+		{query: map[string][]string{"scope": {"projects:1"}, "member": {"alice"}}, ids: []string{"project-1-editors"}},
+		// global roles have no scope, so only negated scopes keep them.
+		{query: map[string][]string{"scope": {"!projects:1"}}, ids: []string{"editors", "project-2-editors"}},
+		{query: map[string][]string{"member": {"alice"}}, ids: []string{"editors", "project-1-editors"}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			rl := append(Roles{}, roles...)
+			l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+			_, err := l.Filter(tc.query, 0, 100)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, r := range *l.Value.(*Roles) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("case=malformed scope", func(t *testing.T) {
+		rl := Roles{{ID: "broken", Members: []string{"alice"}, Scope: "projects:<[>"}}
+		l := &ListRequest{Value: &rl, FilterFunc: ListByQuery}
+		_, err := l.Filter(map[string][]string{"scope": {"projects:1"}}, 0, 100)
+		require.Error(t, err)
+	})
+}
+
+func TestRoles_InScope(t *testing.T) {
+	// alice is an editor everywhere, but an admin only of project 1, and owners contains the admins of project 1.
+	roles := Roles{
+		{ID: "editors", Members: []string{"alice"}},
+		{ID: "project-1-admins", Members: []string{"alice"}, Scope: "projects:1"},
+		{ID: "owners", Members: []string{"project-1-admins"}},
+		{ID: "project-admins", Members: []string{"bob"}, Scope: "projects:<.*>"},
+	}
+
+	o := &filterOptions{match: MatchAny, literal: true}
+	for _, tc := range []struct {
+		member, scope string
+		ids           []string
+	}{
+		{member: "alice", scope: "projects:1", ids: []string{"editors", "owners", "project-1-admins"}},
+		{member: "alice", scope: "projects:2", ids: []string{"editors"}},
+		{member: "bob", scope: "projects:2", ids: []string{"project-admins"}},
+		{member: "bob", scope: "teams:1", ids: []string{}},
+	} {
+		assert.Equal(t, tc.ids, roles.inScope(tc.scope, o).memberOf(tc.member), "%s in %s", tc.member, tc.scope)
+	}
+	require.NoError(t, o.err)
+
+	// without a scope, every role counts.
+	assert.Equal(t, []string{"editors", "owners", "project-1-admins"}, roles.memberOf("alice"))
+}
+
+func TestRoles_Ancestors(t *testing.T) {
+	// writers <- (editors, reviewers) <- admins <- owners, and editors -> owners closes a cycle.
+	roles := Roles{
+		{ID: "owners", Members: []string{"admins"}},
+		{ID: "admins", Members: []string{"editors", "reviewers"}},
+		{ID: "editors", Members: []string{"writers", "owners"}},
+		{ID: "reviewers", Members: []string{"writers"}},
+		{ID: "writers", Members: []string{"alice"}},
+		{ID: "readers", Members: []string{"bob"}},
+	}
+
+	ids := func(rs Roles) []string {
+		res := []string{}
+		for _, r := range rs {
+			res = append(res, r.ID)
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		id        string
+		ancestors []string
+	}{
+		{id: "writers", ancestors: []string{"editors", "reviewers", "admins", "owners"}},
+		{id: "admins", ancestors: []string{"owners", "editors"}},
+		{id: "alice", ancestors: []string{"writers", "editors", "reviewers", "admins", "owners"}},
+		{id: "readers", ancestors: []string{}},
+		{id: "unknown", ancestors: []string{}},
+	} {
+		assert.Equal(t, tc.ancestors, ids(roles.ancestors(tc.id)), "%s", tc.id)
+	}
+}
@@ -2,34 +2,147 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"math"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
 	"github.com/ory/herodot"
-	"github.com/ory/x/pagination"
+	"github.com/ory/x/logrusx"
 )
 
 type Handler struct {
 	s Manager
 	h herodot.Writer
+
+	streamThreshold int
+	tracer          opentracing.Tracer
+	metrics         *Metrics
+	auditSink       AuditSink
+	notifier        ChangeNotifier
+	auditReads      bool
+	timeout         time.Duration
+
+	strictPagination     bool
+	paginationLimits     map[string]PaginationLimits
+	idempotencyTTL       time.Duration
+	idempotencyKeys      idempotencyKeys
+	compressionThreshold int
+	filters              *FilterRegistry
+	softDelete           bool
+	tombstoneRetention   time.Duration
+	destructive          bool
+	maxBodySize          int64
+	filterLimiter        *rateLimiter
+	rateLimitHeader      string
+	defaultDecision      string
+	precedence           string
+	maxBatchSize         int
+	slowQueryThreshold   time.Duration
+	readOnly             bool
+	readOnlyCollections  map[string]bool
+	protectedKeys        []string
+	protectedSecret      string
+	lockTTL              time.Duration
+	timestamps           bool
+	naming               string
+	createdStatus        bool
+	referentialIntegrity bool
+	l                    *logrusx.Logger
+
+	// conditional serializes conditional upserts so that two of them can not both pass their precondition.
+	conditional sync.Mutex
+
+	distinct distinctCache
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithStreamThreshold sets the collection size above which filtered lists are streamed from the backend instead of
+// being loaded at once. Defaults to DefaultStreamThreshold.
+func WithStreamThreshold(n int) HandlerOption {
+	return func(h *Handler) {
+		h.streamThreshold = n
+	}
+}
+
+// WithDefaultDecision sets the decision of Allowed and Test for requests which no policy matches, "allow" or "deny".
+// Anything but "allow" denies. Defaults to "deny".
+func WithDefaultDecision(effect string) HandlerOption {
+	return func(h *Handler) {
+		h.defaultDecision = effect
+	}
 }
 
-func NewHandler(s Manager, h herodot.Writer) *Handler {
-	return &Handler{
-		s: s,
-		h: h,
+// WithPrecedence sets the effect which wins in Allowed and Test if both an allow and a deny policy match a request,
+// "allow" or "deny". Anything but "allow" lets deny override allow. Defaults to "deny".
+func WithPrecedence(effect string) HandlerOption {
+	return func(h *Handler) {
+		h.precedence = effect
+	}
+}
+
+func NewHandler(s Manager, h herodot.Writer, opts ...HandlerOption) *Handler {
+	handler := &Handler{
+		s:               s,
+		h:               &errorWriter{Writer: &timeoutWriter{Writer: h}},
+		streamThreshold: DefaultStreamThreshold,
+		tracer:          opentracing.NoopTracer{},
+
+		compressionThreshold: DefaultCompressionThreshold,
+		filters:              DefaultFilterRegistry,
+		maxBodySize:          DefaultMaxBodySize,
+		idempotencyTTL:       DefaultIdempotencyTTL,
+		maxBatchSize:         DefaultMaxBatchSize,
+		slowQueryThreshold:   DefaultSlowQueryThreshold,
+		lockTTL:              DefaultLockTTL,
+		tombstoneRetention:   DefaultTombstoneRetention,
 	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	if handler.naming == NamingCamelCase {
+		handler.h = &namingWriter{Writer: handler.h}
+	}
+	handler.h = &compressWriter{Writer: handler.h, threshold: handler.compressionThreshold}
+	return handler
 }
 
 type GetRequest struct {
 	Collection string
 	Key        string
 	Value      interface{}
+
+	// PostLoad is called with Value once it has been loaded and before it is written, for example to redact or
+	// enrich it. Its error is written instead of the value. It does not change the entity tag, which identifies the
+	// stored value.
+	PostLoad func(value interface{}) error
 }
 
+// Get responds with the value of the key. The ETag header of the response identifies the current version of the value
+// and can be passed to Upsert in the If-Match header. The value is written as YAML if the Accept header prefers
+// application/x-yaml, and as JSON otherwise.
+//
+// If the If-None-Match header contains the current entity tag, the response is 304 without a body, so clients can
+// cache values and revalidate them cheaply. A wildcard is ignored because it is only meaningful for writes. The tag is
+// computed from the decoded value rather than the stored bytes, so it only changes if the value does, not if it was
+// merely stored with a different formatting.
+//
+// A HEAD request runs the same lookup but only writes the status code and headers. The value is never encoded, so the
+// response has no Content-Length header rather than one which does not match the body. Errors are written as for GET
+// and net/http discards their body.
 func (h *Handler) Get(factory func(context.Context, *http.Request, httprouter.Params) (*GetRequest, error)) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	return h.instrument("get", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := r.Context()
 		d, err := factory(ctx, r, ps)
 
@@ -38,164 +151,1364 @@ func (h *Handler) Get(factory func(context.Context, *http.Request, httprouter.Pa
 			return
 		}
 
-		if err := h.s.Get(ctx, d.Collection, d.Key, d.Value); err != nil {
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
 
-		h.h.Write(w, r, d.Value)
-	}
+		includeDeleted, err := boolQuery(r, includeDeletedParam)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.s.Get(ctx, d.Collection, d.Key, d.Value); isNotFound(err) && includeDeleted {
+			deleted, err := h.getDeleted(ctx, d.Collection, d.Key, d.Value, d.PostLoad)
+			if err != nil {
+				h.h.WriteError(w, r, withKey(err, d.Collection, d.Key))
+				return
+			}
+
+			h.auditRead(ctx, d.Key)
+			if r.Method == http.MethodHead {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			h.write(w, r, deleted)
+			return
+		} else if err != nil {
+			h.h.WriteError(w, r, withKey(err, d.Collection, d.Key))
+			return
+		}
+		tag, err := etag(d.Value)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		// the entity tag identifies the stored value, so it is computed before the timestamps are added.
+		if err := h.addTimestamps(ctx, d.Collection, d.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := postLoad(d.PostLoad, d.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx, d.Key)
+		w.Header().Set("ETag", tag)
+		if inm := strings.TrimSpace(r.Header.Get("If-None-Match")); inm != "" && inm != "*" && matchesETag(inm, tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Add("Vary", "Accept")
+			if acceptsYAML(r) {
+				w.Header().Set("Content-Type", yamlContentType)
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		h.write(w, r, d.Value)
+	})
 }
 
-type DeleteRequest struct {
+type GetManyRequest struct {
 	Collection string
-	Key        string
+	Keys       []string
+
+	// Value is a pointer to a slice into which the values are decoded.
+	Value interface{}
+
+	// PostLoad is called with Value once all values have been loaded and before they are written, see
+	// GetRequest.PostLoad.
+	PostLoad func(value interface{}) error
 }
 
-func (h *Handler) Delete(factory func(context.Context, *http.Request, httprouter.Params) (*DeleteRequest, error)) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// GetMany responds with the values of the keys as an array, in the order of the keys and fetched from the backend in
+// one call. Keys which do not exist are left out, unless the query parameter "strict" is "true", in which case it
+// responds with 404 naming the missing keys instead.
+func (h *Handler) GetMany(factory func(context.Context, *http.Request, httprouter.Params) (*GetManyRequest, error)) httprouter.Handle {
+	return h.instrument("get_many", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := r.Context()
-		d, err := factory(ctx, r, ps)
+		g, err := factory(ctx, r, ps)
 		if err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
 
-		if err := h.s.Delete(ctx, d.Collection, d.Key); err != nil {
+		annotate(ctx, g.Collection)
+
+		if err := validateCollection(g.Collection); err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusNoContent)
-	}
-}
+		strict, err := boolQuery(r, "strict")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
 
-type ListRequest struct {
-	Collection string
-	Value      interface{}
-	FilterFunc func(*ListRequest, map[string][]string, int, int)
+		if err := h.s.GetMany(ctx, g.Collection, g.Keys, g.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.addTimestamps(ctx, g.Collection, g.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := postLoad(g.PostLoad, g.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if strict {
+			missing, err := h.missingKeys(ctx, g.Collection, g.Keys, length(g.Value))
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			} else if len(missing) > 0 {
+				h.h.WriteError(w, r, errors.WithStack(herodot.ErrNotFound.
+					WithReasonf("Unable to locate keys %s in collection %s.", strings.Join(missing, ", "), g.Collection).
+					WithDetail("collection", g.Collection).
+					WithDetail("keys", missing)))
+				return
+			}
+		}
+
+		h.auditRead(ctx, g.Keys...)
+		h.write(w, r, g.Value)
+	})
 }
 
-func (l *ListRequest) Filter(m map[string][]string, offset int, limit int) *ListRequest {
-	if l.FilterFunc != nil {
-		l.FilterFunc(l, m, offset, limit)
+// missingKeys returns the keys which do not exist, given the number of keys which were found. The backend is only
+// asked for the individual keys if some are missing.
+func (h *Handler) missingKeys(ctx context.Context, collection string, keys []string, found int) ([]string, error) {
+	unique := map[string]bool{}
+	for _, key := range keys {
+		unique[key] = true
+	}
+	if found >= len(unique) {
+		return nil, nil
 	}
-	return l
+
+	missing := []string{}
+	for _, key := range keys {
+		if !unique[key] {
+			continue
+		}
+		delete(unique, key)
+
+		exists, err := h.s.Exists(ctx, collection, key)
+		if err != nil {
+			return nil, err
+		} else if !exists {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
 }
 
-func ListByQuery(l *ListRequest, m map[string][]string, offset int, limit int) {
-	switch val := l.Value.(type) {
-	case *Roles:
-		res := make(Roles, 0)
-		for _, role := range *val {
-			filteredRole := role.withMembers(m["member"]).withIDs(m["id"])
-			if filteredRole != nil {
-				res = append(res, *filteredRole)
-			}
+// existingKeys returns the distinct keys which exist, in the order of the keys.
+func existingKeys(ctx context.Context, m Manager, collection string, keys []string) ([]string, error) {
+	seen := map[string]bool{}
+	existing := []string{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
 		}
-		start, end := pagination.Index(limit, offset, len(res))
-		res = res[start:end]
-		l.Value = &res
-	case *Policies:
-		res := make(Policies, 0)
-		for _, policy := range *val {
-			filteredPolicy := policy.withSubjects(m["subject"]).withResources(m["resource"]).withActions(m["action"]).withIDs(m["id"])
-			if filteredPolicy != nil {
-				res = append(res, *filteredPolicy)
-			}
+		seen[key] = true
+
+		exists, err := m.Exists(ctx, collection, key)
+		if err != nil {
+			return nil, err
+		} else if exists {
+			existing = append(existing, key)
 		}
-		start, end := pagination.Index(limit, offset, len(res))
-		res = res[start:end]
-		l.Value = &res
-	default:
-		panic("storage:unable to cast list request to a known type!")
 	}
+	return existing, nil
 }
 
-func (h *Handler) List(factory func(context.Context, *http.Request, httprouter.Params) (*ListRequest, error)) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		isFilter := false
-		queryParams := r.URL.Query()
+type ExistsRequest struct {
+	Collection string
+	Key        string
+}
+
+// Exists responds with 204 if the key exists and with 404 otherwise. The response has no body.
+func (h *Handler) Exists(factory func(context.Context, *http.Request, httprouter.Params) (*ExistsRequest, error)) httprouter.Handle {
+	return h.instrument("exists", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := r.Context()
-		l, err := factory(ctx, r, ps)
+		d, err := factory(ctx, r, ps)
 		if err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
-		limit, offset := pagination.Parse(r, 100, 0, 500)
-		split := strings.Split(l.Collection, "/")
-		collectionType := split[len(split)-1]
-		if collectionType == "policies" {
-			if _, ok := queryParams["action"]; ok {
-				isFilter = true
-			}
-			if _, ok := queryParams["subject"]; ok {
-				isFilter = true
-			}
 
-			if _, ok := queryParams["resource"]; ok {
-				isFilter = true
-			}
-			if isFilter {
-				// assuming that there's no limit imposed.
-				if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
-					h.h.WriteError(w, r, err)
-					return
-				}
-			} else {
-				if err := h.s.List(ctx, l.Collection, l.Value, limit, offset); err != nil {
-					h.h.WriteError(w, r, err)
-					return
-				}
-			}
-		} else if collectionType == "roles" {
-			if _, ok := queryParams["member"]; ok {
-				isFilter = true
-			}
+		annotate(ctx, d.Collection)
 
-			if isFilter {
-				if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
-					h.h.WriteError(w, r, err)
-					return
-				}
-			} else {
-				if err := h.s.List(ctx, l.Collection, l.Value, limit, offset); err != nil {
-					h.h.WriteError(w, r, err)
-					return
-				}
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		found, err := h.s.Exists(ctx, d.Collection, d.Key)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.auditRead(ctx, d.Key)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type DeleteRequest struct {
+	Collection string
+	Key        string
+
+	// PolicyCollection is set if the key is a role. Deleting a role which policies of the collection still reference
+	// is answered with 409 or carries a Warning header, see WithReferentialIntegrity.
+	PolicyCollection string
+}
+
+// Delete removes the key and responds with 204. Keys which do not exist are ignored. If soft deletion is enabled, see
+// WithSoftDelete, the entry is kept as a tombstone which Restore brings back. If the query parameter "purge" is set to
+// "true", the entry and its tombstone are removed for good.
+func (h *Handler) Delete(factory func(context.Context, *http.Request, httprouter.Params) (*DeleteRequest, error)) httprouter.Handle {
+	return h.instrument("delete", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		d, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, d.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		purge, err := boolQuery(r, "purge")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if d.PolicyCollection != "" {
+			if err := validateCollection(d.PolicyCollection); err != nil {
+				h.h.WriteError(w, r, err)
+				return
 			}
-		} else {
-			if err := h.s.List(ctx, l.Collection, l.Value, limit, offset); err != nil {
+			if err := h.checkReferences(ctx, w, r, d.PolicyCollection, d.Key); err != nil {
 				h.h.WriteError(w, r, err)
 				return
 			}
+		}
 
+		if err := h.delete(ctx, d.Collection, d.Key, purge); err != nil {
+			h.h.WriteError(w, r, err)
+			return
 		}
-		m := r.URL.Query()
-		h.h.Write(w, r, l.Filter(m, offset, limit).Value)
-	}
+		h.audit(ctx, d.Key)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
 }
 
-type UpsertRequest struct {
+type DeleteManyRequest struct {
 	Collection string
-	Key        string
-	Value      interface{}
+	Keys       []string
+
+	// PolicyCollection is set if the keys are roles. Deleting roles which policies of the collection still reference
+	// is answered with 409 or carries Warning headers, see WithReferentialIntegrity.
+	PolicyCollection string
 }
 
-func (h *Handler) Upsert(factory func(context.Context, *http.Request, httprouter.Params) (*UpsertRequest, error)) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// DeleteManyResponse is the response of a bulk delete with a report.
+//
+// swagger:ignore
+type DeleteManyResponse struct {
+	// Deleted is the number of entries which were actually removed.
+	Deleted int `json:"deleted"`
+}
+
+// DeleteMany removes all keys in one transaction and responds with 204. Keys which do not exist are ignored. If the
+// query parameter "report" is set to "true", it responds with 200 and the number of removed entries instead. Like in
+// Delete, the entries are kept as tombstones if soft deletion is enabled, unless the query parameter "purge" is set
+// to "true".
+//
+// If the query parameter "atomic" is set to "false", every key is removed on its own and the response is 207 with a
+// BulkResult per key, so that a few failing keys, such as protected ones, do not prevent removing the others.
+func (h *Handler) DeleteMany(factory func(context.Context, *http.Request, httprouter.Params) (*DeleteManyRequest, error)) httprouter.Handle {
+	return h.instrument("delete_many", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		ctx := r.Context()
-		u, err := factory(ctx, r, ps)
+
+		report, err := boolQuery(r, "report")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		atomic, err := isAtomic(r)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		purge, err := boolQuery(r, "purge")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		tooLarge := h.limitBody(w, r)
+		d, err := factory(ctx, r, ps)
 		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if d.PolicyCollection != "" {
+			if err := validateCollection(d.PolicyCollection); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+		}
+
+		if !atomic {
+			results, deleted := h.deleteEach(ctx, w, r, d, purge)
+			h.audit(ctx, deleted...)
+			h.h.WriteCode(w, r, http.StatusMultiStatus, results)
+			return
+		}
+
+		if err := h.checkProtected(ctx, r, d.Keys...); err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
+		if d.PolicyCollection != "" {
+			if err := h.checkReferences(ctx, w, r, d.PolicyCollection, d.Keys...); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+		}
 
-		if err := h.s.Upsert(ctx, u.Collection, u.Key, u.Value); err != nil {
+		// the keys which exist are looked up in the same transaction, so that only the removed ones are audited.
+		var existing []string
+		if err := h.s.WithTransaction(ctx, func(tx Manager) error {
+			var err error
+			if existing, err = existingKeys(ctx, tx, d.Collection, d.Keys); err != nil {
+				return err
+			}
+			return h.deleteMany(ctx, tx, d.Collection, d.Keys, purge)
+		}); err != nil {
 			h.h.WriteError(w, r, err)
 			return
 		}
+		h.audit(ctx, existing...)
 
-		h.h.Write(w, r, u.Value)
+		if report {
+			h.h.Write(w, r, &DeleteManyResponse{Deleted: len(existing)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// postLoad calls the PostLoad hook of a request with the loaded value, if the request has one.
+func postLoad(f func(value interface{}) error, value interface{}) error {
+	if f == nil {
+		return nil
+	}
+	return f(value)
+}
+
+// boolQuery parses the boolean query parameter, which defaults to false.
+func boolQuery(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" must be a boolean but got "%s".`, name, v))
+	}
+	return b, nil
+}
+
+type ListRequest struct {
+	Collection string
+	Value      interface{}
+	FilterFunc func(*ListRequest, map[string][]string, int, int) error
+
+	// PostLoad is called with Value after the filters and the pagination have been applied and before the page is
+	// written, so it only sees the entries of the page and can not affect which entries match the filters. Its error
+	// is written instead of the page. Count does not call it.
+	PostLoad func(value interface{}) error
+}
+
+func (l *ListRequest) Filter(m map[string][]string, offset int, limit int) (*ListRequest, error) {
+	if l.FilterFunc != nil {
+		if err := l.FilterFunc(l, m, offset, limit); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// ListByQuery filters roles by member and id, and policies by subject, resource, action, and id, and then applies
+// the pagination. It dispatches through DefaultFilterRegistry, so other collection types can be made filterable by
+// registering a FilterFunc for them. Handlers dispatch through their own registry, see WithFilterRegistry.
+//
+// The query parameter "match" controls how filter values are combined. With "all" (the default) a role or policy
+// must match every value of every filter key. With "any" it must match at least one value of at least one filter key.
+// The "id" filter is not affected by "match" and always restricts the result to exactly the given IDs, also if it is
+// the only filter key.
+//
+// Filter keys which take several values accept them both as repeated keys and comma-separated in a single value, so
+// "member=a,b" is the same as "member=a&member=b", and both forms can be mixed. A comma which is part of a value is
+// escaped as "\,".
+//
+// Member, subject, resource, and action values prefixed with "!" exclude the roles or policies they match instead of
+// including them, so "action=!read" keeps the policies which do not grant read and "action=update&action=!delete"
+// those which grant update but not delete. Exclusions apply regardless of "match", which only combines the other
+// values, and a filter key with only exclusions keeps everything else. A literal leading "!" is escaped as "\!".
+//
+// The query parameter "case" set to "insensitive" ignores the casing when comparing members, subjects, resources, and
+// actions. By default the comparison is case-sensitive.
+//
+// Subjects, resources, and actions of policies may be patterns. A filter value matches a pattern if it is equal to it
+// or if it matches the regular expressions in "<" and ">" or the "*" glob wildcards, see compilePattern. A malformed
+// pattern results in a bad request error.
+//
+// The result is sorted before the pagination is applied. The query parameter "sort" selects the field, "id",
+// "created_at", or "updated_at" for roles and additionally "effect" for policies, and "order" set to "asc" (the
+// default) or "desc" the direction. Without these parameters the result is sorted ascending by id. Because sorting
+// requires the whole collection, both parameters are filter keys. Lists without any filter keys are paginated by the
+// backend, which orders them by key, the ID of roles and policies, so that they are sorted ascending by id as well.
+//
+// The query parameter "effect" set to "allow" or "deny" only keeps policies with that effect. Like "id_prefix" for
+// roles, it is combined with the other filters using AND, regardless of "match". So are "has_condition", which set to
+// "true" only keeps policies with conditions and set to "false" only those without, "condition_key", which only keeps
+// policies with a condition under one of the given keys, and "active_only", which set to "true" only keeps policies
+// which apply now, see Policy.NotBefore and Policy.NotAfter.
+//
+// The query parameter "resource_prefix" only keeps policies with a resource at or below one of the given paths, or
+// with a resource pattern matching such a resource. Paths are split into segments at "/", so "projects/1" matches
+// "projects/1/datasets/<.*>" and "projects/*" but not "projects/10". It is combined with the other filters using AND,
+// regardless of "match".
+//
+// The query parameter "id_prefix" only keeps roles whose ID starts with one of the given prefixes. It is combined with
+// the "member" filter using AND, regardless of "match". So is "empty", which set to "true" only keeps roles without
+// members and set to "false" only those with members, and "scope", which only keeps roles whose scope, see
+// Role.Scope, is one of the given values or a pattern matching one of them. Global roles have no scope, so
+// "scope=!projects:1" keeps them along with the roles of other scopes.
+//
+// The query parameter "expand" set to "true" resolves nested roles: members which are IDs of other roles are
+// recursively replaced by the members of those roles and the result is written to "effective_members". The "member"
+// filter is then applied to the effective members. The stored members are left untouched. Roles nested deeper than
+// the maximum expansion depth of the filter registry are answered with 422, see FilterRegistry.SetMaxExpansionDepth.
+//
+// If the logger of the handler is at debug level, every list request filtered by the handler is logged with its
+// filter parameters, the number of entries before and after filtering, and the bounds of the page, see WithLogger.
+func ListByQuery(l *ListRequest, m map[string][]string, offset int, limit int) error {
+	return DefaultFilterRegistry.Filter(l, m, offset, limit)
+}
+
+func filterRoles(value interface{}, m map[string][]string, offset, limit, maxDepth int) (interface{}, error) {
+	val, ok := value.(*Roles)
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to cast list request of type %T to a known type.", value))
+	}
+
+	o, err := parseFilterOptions(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEmptyFilter(m); err != nil {
+		return nil, err
+	}
+
+	if o.expand {
+		if err := val.expand(maxDepth); err != nil {
+			return nil, err
+		}
+	}
+	res := make(Roles, 0)
+	for _, role := range *val {
+		filteredRole := role.withQuery(m, o)
+		if filteredRole != nil {
+			res = append(res, *filteredRole)
+		}
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	if err := o.sortRoles(res); err != nil {
+		return nil, err
+	}
+	start, end := index(limit, offset, len(res))
+	res = res[start:end]
+	return &res, nil
+}
+
+func filterPolicies(value interface{}, m map[string][]string, offset, limit int) (interface{}, error) {
+	val, ok := value.(*Policies)
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to cast list request of type %T to a known type.", value))
 	}
+
+	o, err := parseFilterOptions(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEffect(m); err != nil {
+		return nil, err
+	}
+	if err := validateConditionFilters(m); err != nil {
+		return nil, err
+	}
+	if err := validateActiveOnlyFilter(m); err != nil {
+		return nil, err
+	}
+
+	res := make(Policies, 0)
+	for _, policy := range *val {
+		filteredPolicy := policy.withQuery(m, o)
+		if filteredPolicy != nil {
+			res = append(res, *filteredPolicy)
+		}
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	if err := o.sortPolicies(res); err != nil {
+		return nil, err
+	}
+	start, end := index(limit, offset, len(res))
+	res = res[start:end]
+	return &res, nil
+}
+
+func collectionType(collection string) string {
+	split := strings.Split(collection, "/")
+	return split[len(split)-1]
+}
+
+// filter applies the filter of the list request. ListByQuery is dispatched through the filter registry of the handler.
+func (h *Handler) filter(l *ListRequest, m map[string][]string, offset, limit int) error {
+	if usesListByQuery(l) {
+		return h.filters.Filter(l, m, offset, limit)
+	}
+	_, err := l.Filter(m, offset, limit)
+	return err
+}
+
+// List responds with a page of the collection, filtered as described in ListByQuery. If the query parameter "explain"
+// is set to a key, it responds with the ListExplanation of that entry instead, which tells the outcome of every filter
+// of the request and whether the entry is part of the filtered list. If the query parameter "envelope" is "true", the
+// page is wrapped in a ListEnvelope which repeats the pagination headers in the body.
+func (h *Handler) List(factory func(context.Context, *http.Request, httprouter.Params) (*ListRequest, error)) httprouter.Handle {
+	return h.instrument("list", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		l, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		annotate(ctx, l.Collection)
+
+		if err := validateCollection(l.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		// every kind of filtered list loads the whole collection, so the limit applies to all of them.
+		if h.filters.isFilter(l.Collection, r.URL.Query()) && !h.limitFilter(w, r) {
+			return
+		}
+
+		if _, ok := r.URL.Query()[explainParam]; ok {
+			annotateOperation(ctx, "list_explain")
+			h.explain(w, r, l)
+			return
+		}
+
+		limit, offset, err := h.parsePagination(w, r, l.Collection)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		m := r.URL.Query()
+
+		if includeDeleted, err := boolQuery(r, includeDeletedParam); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		} else if includeDeleted {
+			annotateOperation(ctx, "list_deleted")
+			total, page, err := h.listDeleted(ctx, l, m, limit, offset)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+
+			h.auditRead(ctx)
+			paginationHeader(w, r.URL, total, limit, offset)
+			h.writeList(w, r, page, ListEnvelope{Total: total, Limit: limit, Offset: offset})
+			return
+		}
+
+		if _, ok := m[pageTokenParam]; ok {
+			annotateOperation(ctx, "list_cursor")
+			total, next, err := h.listCursor(ctx, l, m, limit)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if err := h.addTimestamps(ctx, l.Collection, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if err := postLoad(l.PostLoad, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+
+			h.auditRead(ctx)
+			cursorHeader(w, r.URL, total, limit, next)
+			h.writeList(w, r, l.Value, ListEnvelope{Total: total, Limit: limit, NextPageToken: next})
+			return
+		}
+
+		var total int
+		if streamed, n, err := h.stream(ctx, l, m, limit, offset); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		} else if streamed {
+			annotateOperation(ctx, "list_streamed")
+			total = n
+			if err := h.addTimestamps(ctx, l.Collection, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+		} else if h.filters.isFilter(l.Collection, m) {
+			annotateOperation(ctx, "list_filtered")
+			start := time.Now()
+			// assuming that there's no limit imposed.
+			if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			// the timestamps are added before filtering so that they can be sorted by.
+			if err := h.addTimestamps(ctx, l.Collection, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			before := length(l.Value)
+			if err := h.filter(l, m, 0, math.MaxInt32); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			total = length(l.Value)
+			h.observeQuery(ctx, l.Collection, m, start, total)
+			pageStart, pageEnd := index(limit, offset, total)
+			h.debugFilter(ctx, l.Collection, m, before, total, pageStart, pageEnd)
+			paginate(l.Value, limit, offset)
+		} else {
+			if err := h.s.List(ctx, l.Collection, l.Value, limit, offset); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if total, err = h.s.Count(ctx, l.Collection); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if err := h.addTimestamps(ctx, l.Collection, l.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			// the backend already applied the offset, so only the remaining filters are applied to the page.
+			if err := h.filter(l, m, 0, limit); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+		}
+		if err := postLoad(l.PostLoad, l.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx)
+		paginationHeader(w, r.URL, total, limit, offset)
+		h.writeList(w, r, l.Value, ListEnvelope{Total: total, Limit: limit, Offset: offset})
+	})
+}
+
+// CountResponse is the response of a count request.
+//
+// swagger:ignore
+type CountResponse struct {
+	// Count is the number of entries in the collection.
+	Count int `json:"count"`
+}
+
+// Count writes the number of entries in a collection. If the request contains any of the filter parameters
+// supported by List, only the matching entries are counted, which is rate limited like a filtered list, see
+// WithFilterRateLimit.
+func (h *Handler) Count(factory func(context.Context, *http.Request, httprouter.Params) (*ListRequest, error)) httprouter.Handle {
+	return h.instrument("count", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		l, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, l.Collection)
+
+		if err := validateCollection(l.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		m := r.URL.Query()
+		if !h.filters.isFilter(l.Collection, m) {
+			n, err := h.s.Count(ctx, l.Collection)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			h.auditRead(ctx)
+			h.h.Write(w, r, &CountResponse{Count: n})
+			return
+		}
+		if !h.limitFilter(w, r) {
+			return
+		}
+
+		start := time.Now()
+		if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.filter(l, m, 0, math.MaxInt32); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		h.observeQuery(ctx, l.Collection, m, start, length(l.Value))
+
+		h.auditRead(ctx)
+		h.h.Write(w, r, &CountResponse{Count: length(l.Value)})
+	})
+}
+
+type UpsertRequest struct {
+	Collection string
+	Key        string
+	Value      interface{}
+
+	// Location is the path of the entry which is reported if Upsert creates it, see WithCreatedStatus. Defaults to
+	// the path of the request followed by the key.
+	Location string
+}
+
+// WithCreatedStatus makes Upsert respond with 201 and a Location header if the key did not exist before, and with
+// 200 if it replaced a stored value. Telling them apart costs an additional Exists call per upsert, which is not
+// atomic with the write. Disabled by default, so that Upsert always responds with 200.
+func WithCreatedStatus(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.createdStatus = enabled
+	}
+}
+
+// Upsert writes the value of the key. If-Match rejects the write with 412 unless the stored value has one of the given
+// entity tags, and If-None-Match: * rejects it with 412 if the key exists already. Conditional upserts of the same
+// handler are serialized, but the precondition is not atomic with writes of other handlers, processes or endpoints.
+//
+// If the query parameter "dry_run" is set to "true", the value is decoded, validated and checked against the
+// preconditions but not written. The response then has the header "X-Dry-Run: true".
+//
+// If WithCreatedStatus is enabled, creating the key is answered with 201 and the Location of the entry instead of 200.
+//
+// If the query parameter "dedupe" is set to "true" and another key of the collection stores the same content, nothing
+// is written. The response is the stored entry instead, with its key in the header "X-Duplicate-Of" and its path in
+// the header "Content-Location". Entries have the same content if they only differ in their ID, their timestamps, or
+// in what canonicalize normalizes. Deduplicated upserts list the whole collection and are serialized like
+// conditional ones.
+//
+// A body with the Content-Type application/x-yaml is converted to JSON before it is passed to the factory. Bodies
+// larger than the limit set by WithMaxBodySize are answered with 413. Writes to protected keys are answered with 403,
+// see WithProtectedKeys.
+func (h *Handler) Upsert(factory func(context.Context, *http.Request, httprouter.Params) (*UpsertRequest, error)) httprouter.Handle {
+	return h.instrument("upsert", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		dryRun, err := boolQuery(r, "dry_run")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		dedupe, err := boolQuery(r, dedupeParam)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		tooLarge := h.limitBody(w, r)
+		if err := decodeYAMLBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		u, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		clearTimestamps(u.Value)
+
+		annotate(ctx, u.Collection)
+
+		if err := validateCollection(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, u.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if isConditional(r) || dedupe {
+			h.conditional.Lock()
+			defer h.conditional.Unlock()
+		}
+
+		if err := h.checkPreconditions(ctx, r, u); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if dedupe {
+			key, value, err := h.duplicateOf(ctx, u.Collection, u.Key, u.Value)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			} else if key != "" {
+				h.auditRead(ctx, key)
+				h.writeDuplicate(w, r, key, value)
+				return
+			}
+		}
+
+		var created bool
+		if h.createdStatus {
+			exists, err := h.s.Exists(ctx, u.Collection, u.Key)
+			if err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			created = !exists
+		}
+
+		if dryRun {
+			w.Header().Set("X-Dry-Run", "true")
+		} else {
+			if err := h.s.Upsert(ctx, u.Collection, u.Key, u.Value); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			h.audit(ctx, u.Key)
+		}
+
+		tag, err := etag(u.Value)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", tag)
+		if created {
+			location := u.Location
+			if location == "" {
+				location = path.Join(r.URL.Path, url.PathEscape(u.Key))
+			}
+			h.h.WriteCreated(w, r, location, u.Value)
+			return
+		}
+		h.h.Write(w, r, u.Value)
+	}))
+}
+
+// Create writes the value of the key of a request decoded like for Upsert, but fails with 409 if the key exists
+// already, so that clients can tell creating an entry from replacing it. It responds with 201 and the entry, and the
+// Location header is the path of the request followed by the key.
+func (h *Handler) Create(factory func(context.Context, *http.Request, httprouter.Params) (*UpsertRequest, error)) httprouter.Handle {
+	return h.instrument("create", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		tooLarge := h.limitBody(w, r)
+		if err := decodeYAMLBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		u, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		clearTimestamps(u.Value)
+
+		annotate(ctx, u.Collection)
+
+		if err := validateCollection(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, u.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.s.Create(ctx, u.Collection, u.Key, u.Value); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		h.audit(ctx, u.Key)
+
+		tag, err := etag(u.Value)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", tag)
+		h.h.WriteCreated(w, r, path.Join(r.URL.Path, url.PathEscape(u.Key)), u.Value)
+	}))
+}
+
+// UpsertManyRequest is a request to write several entries of a collection at once.
+type UpsertManyRequest struct {
+	Collection string
+	Entries    []UpsertEntry
+}
+
+// UpsertEntry is a single entry of an UpsertManyRequest.
+type UpsertEntry struct {
+	Key   string
+	Value interface{}
+
+	// Err is set by the factory if the entry is invalid. It fails the whole request unless the request is not
+	// atomic, in which case only the entry fails.
+	Err error
+}
+
+// UpsertMany writes all entries of the request at once. If the backend supports transactions, either all or none
+// of the entries are written. If an entry fails, the error identifies its index in the request.
+//
+// If the query parameter "atomic" is set to "false", every entry is written on its own and the response is 207 with a
+// BulkResult per entry, so that a few invalid or protected entries do not prevent writing the others.
+func (h *Handler) UpsertMany(factory func(context.Context, *http.Request, httprouter.Params) (*UpsertManyRequest, error)) httprouter.Handle {
+	return h.instrument("upsert_many", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		atomic, err := isAtomic(r)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		tooLarge := h.limitBody(w, r)
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		u, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		annotate(ctx, u.Collection)
+
+		if err := validateCollection(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(u.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if !atomic {
+			results := h.upsertEach(ctx, r, u)
+			h.audit(ctx, succeeded(results)...)
+			h.h.WriteCode(w, r, http.StatusMultiStatus, results)
+			return
+		}
+
+		kv := make(map[string]interface{}, len(u.Entries))
+		index := make(map[string]int, len(u.Entries))
+		values := make([]interface{}, len(u.Entries))
+		for k, e := range u.Entries {
+			if e.Err != nil {
+				h.h.WriteError(w, r, e.Err)
+				return
+			}
+			if i, ok := index[e.Key]; ok {
+				h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Entry %d uses key %s which is already used by entry %d.", k, e.Key, i).
+					WithDetail("index", k).
+					WithDetail("key", e.Key)))
+				return
+			}
+			clearTimestamps(e.Value)
+			kv[e.Key] = e.Value
+			index[e.Key] = k
+			values[k] = e.Value
+		}
+		if err := h.checkProtected(ctx, r, keysOf(kv)...); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.s.UpsertMany(ctx, u.Collection, kv); err != nil {
+			var ke *KeyError
+			if errors.As(err, &ke) {
+				h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Unable to write entry %d with key %s: %s", index[ke.Key], ke.Key, ke.Err).
+					WithDetail("index", index[ke.Key]).
+					WithDetail("key", ke.Key)))
+				return
+			}
+			h.h.WriteError(w, r, err)
+			return
+		}
+		h.audit(ctx, keysOf(kv)...)
+
+		h.h.Write(w, r, values)
+	}))
+}
+
+type PatchRequest struct {
+	Collection string
+	Key        string
+	Patch      interface{}
+	Value      interface{}
+
+	// Validate is called with the JSON document which results from merging the patch into the stored value. Its
+	// error is written instead of storing the document, so that a patch can not store a value which would be rejected
+	// by Upsert.
+	Validate func(document []byte) error
+}
+
+// Patch merges the patch into the stored value and writes the result. See mergePatch for the patch semantics. Unlike
+// Upsert, Patch responds with 404 if the key does not exist.
+//
+// If the request has a Validate function, the merged document is validated before the patch is applied. The patch is
+// merged again when it is applied, so the check is not atomic with concurrent writes of the same key.
+func (h *Handler) Patch(factory func(context.Context, *http.Request, httprouter.Params) (*PatchRequest, error)) httprouter.Handle {
+	return h.instrument("patch", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		tooLarge := h.limitBody(w, r)
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		p, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		annotate(ctx, p.Collection)
+
+		if err := validateCollection(p.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(p.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, p.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.validatePatch(ctx, p); err != nil {
+			h.h.WriteError(w, r, withKey(err, p.Collection, p.Key))
+			return
+		}
+
+		if err := h.s.Patch(ctx, p.Collection, p.Key, p.Patch); err != nil {
+			h.h.WriteError(w, r, withKey(err, p.Collection, p.Key))
+			return
+		}
+		h.audit(ctx, p.Key)
+
+		if err := h.s.Get(ctx, p.Collection, p.Key, p.Value); err != nil {
+			h.h.WriteError(w, r, withKey(err, p.Collection, p.Key))
+			return
+		}
+
+		h.h.Write(w, r, p.Value)
+	})
+}
+
+// validatePatch merges the patch into the stored value and passes the result to the Validate function of the request,
+// if any.
+func (h *Handler) validatePatch(ctx context.Context, p *PatchRequest) error {
+	if p.Validate == nil {
+		return nil
+	}
+
+	var stored json.RawMessage
+	if err := h.s.Get(ctx, p.Collection, p.Key, &stored); err != nil {
+		return err
+	}
+	document, err := applyPatch(stored, p.Patch)
+	if err != nil {
+		return err
+	}
+	return p.Validate(document)
+}
+
+type MemberRequest struct {
+	Collection string
+	Key        string
+	Member     string
+	Value      interface{}
+}
+
+// AddMember atomically adds the member to the role stored under the key and writes the updated role. Adding an
+// existing member does nothing.
+func (h *Handler) AddMember(factory func(context.Context, *http.Request, httprouter.Params) (*MemberRequest, error)) httprouter.Handle {
+	return h.instrument("add_member", h.member(factory, h.s.AddMember))
+}
+
+// RemoveMember atomically removes the member from the role stored under the key and writes the updated role. If the
+// member is not part of the role, it responds with 404.
+func (h *Handler) RemoveMember(factory func(context.Context, *http.Request, httprouter.Params) (*MemberRequest, error)) httprouter.Handle {
+	return h.instrument("remove_member", h.member(factory, h.s.RemoveMember))
+}
+
+func (h *Handler) member(
+	factory func(context.Context, *http.Request, httprouter.Params) (*MemberRequest, error),
+	op func(ctx context.Context, collection string, key string, member string) error,
+) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		m, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, m.Collection)
+
+		if err := validateCollection(m.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(m.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, m.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := op(ctx, m.Collection, m.Key, m.Member); err != nil {
+			h.h.WriteError(w, r, withKey(err, m.Collection, m.Key))
+			return
+		}
+		h.audit(ctx, m.Key)
+
+		if err := h.s.Get(ctx, m.Collection, m.Key, m.Value); err != nil {
+			h.h.WriteError(w, r, withKey(err, m.Collection, m.Key))
+			return
+		}
+
+		h.h.Write(w, r, m.Value)
+	}
+}
+
+type AllowedRequest struct {
+	Collection string
+	Subject    string
+	Action     string
+	Resource   string
+	Context    map[string]interface{}
+
+	// RoleCollection is the collection from which the roles of the subject are resolved, see WithEvaluatorRoles. No
+	// roles are resolved if it is empty.
+	RoleCollection string
+
+	// Flavor is the pattern syntax of the policies and of the scopes of the roles, see WithEvaluatorFlavor.
+	Flavor string
+}
+
+// AllowedResponse is the response of an authorization decision.
+//
+// swagger:ignore
+type AllowedResponse struct {
+	// Allowed is true if the request is allowed and false otherwise.
+	Allowed bool `json:"allowed"`
+
+	// Default is true if no policy matched, so the request was decided by the default decision.
+	Default bool `json:"default"`
+
+	// Obligations are the obligations of the matching allow policies which the caller must enforce. They are only
+	// set if the request is allowed.
+	Obligations []string `json:"obligations,omitempty"`
+
+	// Trace is how every policy was matched against the request and which policies decided it. It is only set if the
+	// decision was explained, see Allowed.
+	Trace *DecisionTrace `json:"trace,omitempty"`
+}
+
+// Allowed decides the access request against the policies stored in the collection using an Evaluator. It responds
+// with 200 if the request is allowed and with 403 if it is denied. The response tells whether the request was decided
+// by a matching policy or by the default decision, see WithDefaultDecision. An allowed response lists the obligations
+// of the matching allow policies. If the query parameter "explain" is "true", the response also contains the trace of
+// the decision, see Evaluator.Explain. Explaining evaluates every policy, so it is opt-in.
+func (h *Handler) Allowed(factory func(context.Context, *http.Request, httprouter.Params) (*AllowedRequest, error)) httprouter.Handle {
+	return h.instrument("allowed", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		a, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, a.Collection)
+
+		if err := validateCollection(a.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		explain, err := boolQuery(r, explainParam)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		e := h.evaluator(a.Collection, a.RoleCollection, a.Flavor)
+		var d *Decision
+		var trace *DecisionTrace
+		if explain {
+			if trace, err = e.Explain(ctx, a.Subject, a.Action, a.Resource, a.Context, nil); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			d = &trace.Decision
+		} else if d, err = e.decide(ctx, a.Subject, a.Action, a.Resource, a.Context, nil, false); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		code := http.StatusOK
+		if !d.Allowed {
+			code = http.StatusForbidden
+		}
+		h.h.WriteCode(w, r, code, &AllowedResponse{Allowed: d.Allowed, Default: d.Default, Obligations: d.Obligations, Trace: trace})
+	})
+}
+
+func (h *Handler) evaluator(collection, roleCollection, flavor string) *Evaluator {
+	return NewEvaluator(h.s, collection, WithEvaluatorDefaultDecision(h.defaultDecision), WithEvaluatorPrecedence(h.precedence),
+		WithEvaluatorRoles(roleCollection), WithEvaluatorFlavor(flavor), WithEvaluatorLogger(h.l))
+}
+
+// TestRequest is an access request which is decided without being enforced.
+type TestRequest struct {
+	Collection string
+	Subject    string
+	Action     string
+	Resource   string
+	Context    map[string]interface{}
+
+	// Policies are decided instead of the policies stored in the collection if they are not nil.
+	Policies Policies
+
+	// RoleCollection is the collection from which the roles of the subject are resolved, see AllowedRequest.
+	RoleCollection string
+
+	// Flavor is the pattern syntax of the policies and of the scopes of the roles, see AllowedRequest.
+	Flavor string
+}
+
+// Test decides the access request like Allowed but always responds with 200 and the Decision, which names the
+// matching policies and the effect that won. It is meant to try out policies before storing them.
+func (h *Handler) Test(factory func(context.Context, *http.Request, httprouter.Params) (*TestRequest, error)) httprouter.Handle {
+	return h.instrument("test", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		t, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, t.Collection)
+
+		if err := validateCollection(t.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		d, err := h.evaluator(t.Collection, t.RoleCollection, t.Flavor).Decide(ctx, t.Subject, t.Action, t.Resource, t.Context, t.Policies)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx)
+		h.h.Write(w, r, d)
+	})
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -35,6 +37,13 @@ func TestCRUD(t *testing.T) {
 				assert.Equal(t, http.StatusNotFound, res.StatusCode)
 			})
 
+			t.Run("case=exists", func(t *testing.T) {
+				res, err := ts.Client().Get(ts.URL + "/1234/exists")
+				require.NoError(t, err)
+				res.Body.Close()
+				assert.Equal(t, http.StatusNotFound, res.StatusCode)
+			})
+
 			t.Run("case=create", func(t *testing.T) {
 				res, err := ts.Client().Post(ts.URL+"/?key=1234&value=bar", "application/json", bytes.NewBuffer(nil))
 				require.NoError(t, err)
@@ -52,6 +61,16 @@ func TestCRUD(t *testing.T) {
 				assert.Equal(t, `"bar"`, string(b))
 			})
 
+			t.Run("case=exists", func(t *testing.T) {
+				res, err := ts.Client().Get(ts.URL + "/1234/exists")
+				require.NoError(t, err)
+				b, err := ioutil.ReadAll(res.Body)
+				require.NoError(t, err)
+				res.Body.Close()
+				assert.Equal(t, http.StatusNoContent, res.StatusCode)
+				assert.Empty(t, b)
+			})
+
 			t.Run("case=list", func(t *testing.T) {
 				res, err := ts.Client().Get(ts.URL + "/")
 				require.NoError(t, err)
@@ -60,6 +79,8 @@ func TestCRUD(t *testing.T) {
 				require.NoError(t, err)
 				res.Body.Close()
 				assert.Equal(t, `["bar"]`, string(b))
+				assert.Equal(t, "1", res.Header.Get("X-Total-Count"))
+				assert.Equal(t, `</?limit=100&offset=0>; rel="first",</?limit=100&offset=0>; rel="last"`, res.Header.Get("Link"))
 			})
 
 			t.Run("case=delete", func(t *testing.T) {
@@ -85,6 +106,931 @@ func TestCRUD(t *testing.T) {
 	}
 }
 
+func TestCount(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/count", h.Count(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/count/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	count := func(t *testing.T, query string) string {
+		res, err := ts.Client().Get(ts.URL + "/count" + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("case=empty", func(t *testing.T) {
+		assert.Equal(t, `{"count":0}`, count(t, ""))
+		assert.Equal(t, `{"count":0}`, count(t, "?member=mem1"))
+	})
+
+	for _, role := range rolReq {
+		require.NoError(t, m.Upsert(context.Background(), "/tests/count/roles", role.ID, role))
+	}
+
+	t.Run("case=all", func(t *testing.T) {
+		assert.Equal(t, `{"count":3}`, count(t, ""))
+		assert.Equal(t, `{"count":3}`, count(t, "?limit=1&offset=1"))
+	})
+
+	t.Run("case=filtered", func(t *testing.T) {
+		assert.Equal(t, `{"count":2}`, count(t, "?member=mem1"))
+		assert.Equal(t, `{"count":2}`, count(t, "?member=mem1&limit=1"))
+		assert.Equal(t, `{"count":0}`, count(t, "?member=mem3"))
+	})
+}
+
+func TestListPagination(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/pagination/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, m.Upsert(context.Background(), "/tests/pagination/roles", fmt.Sprintf("role-%d", i), &Role{
+			ID:      fmt.Sprintf("role-%d", i),
+			Members: []string{"mem1"},
+		}))
+	}
+
+	for k, tc := range []struct {
+		query string
+		ids   []string
+		total string
+		link  string
+	}{
+		{
+			query: "?limit=2&offset=0",
+			ids:   []string{"role-0", "role-1"},
+			total: "5",
+			link:  `</roles?limit=2&offset=0>; rel="first",</roles?limit=2&offset=2>; rel="next",</roles?limit=2&offset=4>; rel="last"`,
+		},
+		{
+			query: "?limit=2&offset=2",
+			ids:   []string{"role-2", "role-3"},
+			total: "5",
+			link:  `</roles?limit=2&offset=0>; rel="first",</roles?limit=2&offset=4>; rel="next",</roles?limit=2&offset=0>; rel="prev",</roles?limit=2&offset=4>; rel="last"`,
+		},
+		{
+			query: "?limit=2&offset=4&member=mem1",
+			ids:   []string{"role-4"},
+			total: "5",
+			link:  `</roles?limit=2&member=mem1&offset=0>; rel="first",</roles?limit=2&member=mem1&offset=2>; rel="prev",</roles?limit=2&member=mem1&offset=4>; rel="last"`,
+		},
+		{
+			query: "?limit=10",
+			ids:   []string{"role-0", "role-1", "role-2", "role-3", "role-4"},
+			total: "5",
+			link:  `</roles?limit=10&offset=0>; rel="first",</roles?limit=10&offset=0>; rel="last"`,
+		},
+		{
+			query: "?member=mem2",
+			ids:   []string{},
+			total: "0",
+			link:  `</roles?limit=100&member=mem2&offset=0>; rel="first",</roles?limit=100&member=mem2&offset=0>; rel="last"`,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/roles" + tc.query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			var roles Roles
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&roles))
+			ids := make([]string, len(roles))
+			for i, role := range roles {
+				ids[i] = role.ID
+			}
+
+			assert.Equal(t, tc.ids, ids)
+			assert.Equal(t, tc.total, res.Header.Get("X-Total-Count"))
+			assert.Equal(t, tc.link, res.Header.Get("Link"))
+		})
+	}
+}
+
+func TestListStrictPagination(t *testing.T) {
+	m := NewMemoryManager()
+	server := func(h *Handler) *httptest.Server {
+		r := httprouter.New()
+		r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Roles, 0)
+			return &ListRequest{Collection: "/tests/strict/roles", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	lenient := server(NewHandler(m, herodot.NewJSONWriter(nil)))
+	defer lenient.Close()
+	strict := server(NewHandler(m, herodot.NewJSONWriter(nil), WithStrictPagination(true)))
+	defer strict.Close()
+
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("strict-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/strict/roles", id, &Role{ID: id}))
+	}
+
+	for k, tc := range []struct {
+		ts        *httptest.Server
+		query     string
+		code      int
+		parameter string
+	}{
+		{ts: lenient, query: "?limit=-1", code: http.StatusOK},
+		{ts: lenient, query: "?offset=abc", code: http.StatusOK},
+		{ts: lenient, query: "?limit=999999", code: http.StatusOK},
+		{ts: lenient, query: "?limit=-1&strict_pagination=true", code: http.StatusBadRequest, parameter: "limit"},
+		{ts: lenient, query: "?offset=abc&strict_pagination=true", code: http.StatusBadRequest, parameter: "offset"},
+		{ts: lenient, query: "?limit=999999&strict_pagination=true", code: http.StatusBadRequest, parameter: "limit"},
+		{ts: lenient, query: "?limit=2&offset=1&strict_pagination=true", code: http.StatusOK},
+		{ts: lenient, query: "?strict_pagination=maybe", code: http.StatusBadRequest},
+		{ts: strict, query: "?limit=-1", code: http.StatusBadRequest, parameter: "limit"},
+		{ts: strict, query: "?offset=abc", code: http.StatusBadRequest, parameter: "offset"},
+		{ts: strict, query: "?offset=-5", code: http.StatusBadRequest, parameter: "offset"},
+		{ts: strict, query: "?limit=999999", code: http.StatusBadRequest, parameter: "limit"},
+		{ts: strict, query: "?limit=500", code: http.StatusOK},
+		{ts: strict, query: "", code: http.StatusOK},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := tc.ts.Client().Get(tc.ts.URL + "/roles" + tc.query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			if tc.parameter != "" {
+				var body struct {
+					Error struct {
+						Details map[string]interface{} `json:"details"`
+					} `json:"error"`
+				}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				assert.Equal(t, tc.parameter, body.Error.Details["parameter"])
+			}
+		})
+	}
+}
+
+func TestListPaginationLimits(t *testing.T) {
+	m := NewMemoryManager()
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("limits-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/limits/roles", id, &Role{ID: id}))
+		require.NoError(t, m.Upsert(context.Background(), "/tests/limits/policies", id, &Policy{ID: id}))
+	}
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil),
+		WithPaginationLimits("roles", PaginationLimits{DefaultLimit: 2, DefaultOffset: 1, MaxLimit: 4}),
+		WithPaginationLimits("policies", PaginationLimits{MaxLimit: 6}))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/limits/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: "/tests/limits/policies", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		path     string
+		code     int
+		ids      []string
+		maxLimit string
+	}{
+		{path: "/roles", code: http.StatusOK, ids: []string{"limits-1", "limits-2"}, maxLimit: "4"},
+		{path: "/roles?limit=10", code: http.StatusOK, ids: []string{"limits-1", "limits-2", "limits-3", "limits-4"}, maxLimit: "4"},
+		{path: "/roles?limit=1&offset=0", code: http.StatusOK, ids: []string{"limits-0"}, maxLimit: "4"},
+		{path: "/roles?limit=5&strict_pagination=true", code: http.StatusBadRequest, maxLimit: "4"},
+		{path: "/policies?limit=10", code: http.StatusOK, ids: []string{"limits-0", "limits-1", "limits-2", "limits-3", "limits-4", "limits-5"}, maxLimit: "6"},
+		{path: "/policies?offset=5", code: http.StatusOK, ids: []string{"limits-5", "limits-6", "limits-7"}, maxLimit: "6"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + tc.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			assert.Equal(t, tc.maxLimit, res.Header.Get("X-Max-Limit"))
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var entries []struct {
+				ID string `json:"id"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&entries))
+			ids := make([]string, len(entries))
+			for i, e := range entries {
+				ids[i] = e.ID
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/cursor/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, id := range []string{"role-c", "role-e", "role-a", "role-d", "role-b"} {
+		members := []string{"alice"}
+		if id == "role-b" {
+			members = []string{"bob"}
+		}
+		require.NoError(t, m.Upsert(context.Background(), "/tests/cursor/roles", id, &Role{ID: id, Members: members}))
+	}
+
+	list := func(t *testing.T, query string) (*http.Response, []string) {
+		res, err := ts.Client().Get(ts.URL + "/roles" + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return res, nil
+		}
+
+		var roles Roles
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&roles))
+		ids := make([]string, len(roles))
+		for i, role := range roles {
+			ids[i] = role.ID
+		}
+		return res, ids
+	}
+
+	iterate := func(t *testing.T, query string, between func()) [][]string {
+		var pages [][]string
+		token := ""
+		for {
+			res, ids := list(t, query+"&page_token="+token)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			pages = append(pages, ids)
+
+			token = res.Header.Get("X-Next-Page-Token")
+			if token == "" {
+				return pages
+			}
+			assert.Contains(t, res.Header.Get("Link"), `rel="next"`)
+			if between != nil {
+				between()
+				between = nil
+			}
+		}
+	}
+
+	t.Run("case=ordered by id", func(t *testing.T) {
+		assert.Equal(t, [][]string{{"role-a", "role-b"}, {"role-c", "role-d"}, {"role-e"}}, iterate(t, "?limit=2", nil))
+	})
+
+	t.Run("case=filtered", func(t *testing.T) {
+		assert.Equal(t, [][]string{{"role-a", "role-c"}, {"role-d", "role-e"}}, iterate(t, "?limit=2&member=alice", nil))
+	})
+
+	t.Run("case=stable while entries change", func(t *testing.T) {
+		pages := iterate(t, "?limit=2", func() {
+			require.NoError(t, m.Delete(context.Background(), "/tests/cursor/roles", "role-a"))
+			require.NoError(t, m.Upsert(context.Background(), "/tests/cursor/roles", "role-0", &Role{ID: "role-0"}))
+		})
+		assert.Equal(t, [][]string{{"role-a", "role-b"}, {"role-c", "role-d"}, {"role-e"}}, pages)
+	})
+
+	for _, query := range []string{"?page_token=&offset=2", "?page_token=&sort=id", "?page_token=%21%21"} {
+		t.Run("case=invalid "+query, func(t *testing.T) {
+			res, _ := list(t, query)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	}
+}
+
+func TestListOffsetPastEnd(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/offset/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: "/tests/offset/policies", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("offset-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/offset/roles", id, &Role{ID: id, Members: []string{"mem1"}}))
+		require.NoError(t, m.Upsert(context.Background(), "/tests/offset/policies", id, &Policy{ID: id, Subjects: []string{"sub1"}}))
+	}
+
+	for _, path := range []string{
+		"/roles?offset=1000&member=mem1",
+		"/roles?offset=1000",
+		"/policies?offset=1000&subject=sub1",
+		"/policies?offset=1000",
+	} {
+		t.Run(fmt.Sprintf("path=%s", path), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, "[]", string(body))
+			assert.Equal(t, "3", res.Header.Get("X-Total-Count"))
+		})
+	}
+}
+
+func TestListEnvelope(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/envelope/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: "/tests/envelope/policies", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("envelope-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/envelope/roles", id, &Role{ID: id, Members: []string{"alice"}}))
+		require.NoError(t, m.Upsert(context.Background(), "/tests/envelope/policies", id, &Policy{ID: id, Subjects: []string{"alice"}, Effect: "allow"}))
+	}
+
+	for _, tc := range []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{path: "/roles?limit=1&offset=1&fields=id,members", code: http.StatusOK, expected: `[{"id":"envelope-1","members":["alice"]}]`},
+		{path: "/roles?limit=1&offset=1&fields=id,members&envelope=false", code: http.StatusOK, expected: `[{"id":"envelope-1","members":["alice"]}]`},
+		{path: "/roles?limit=1&offset=1&fields=id,members&envelope=true", code: http.StatusOK, expected: `{"items":[{"id":"envelope-1","members":["alice"]}],"total":3,"limit":1,"offset":1}`},
+		{path: "/roles?limit=2&member=alice&fields=id&envelope=true", code: http.StatusOK, expected: `{"items":[{"id":"envelope-0"},{"id":"envelope-1"}],"total":3,"limit":2,"offset":0}`},
+		{path: "/roles?limit=2&page_token=&fields=id&envelope=true", code: http.StatusOK, expected: `{"items":[{"id":"envelope-0"},{"id":"envelope-1"}],"total":3,"limit":2,"offset":0,"next_page_token":"ZW52ZWxvcGUtMQ"}`},
+		{path: "/roles?offset=1000&envelope=true", code: http.StatusOK, expected: `{"items":[],"total":3,"limit":100,"offset":1000}`},
+		{path: "/policies?limit=1&fields=id&envelope=true", code: http.StatusOK, expected: `{"items":[{"id":"envelope-0"}],"total":3,"limit":1,"offset":0}`},
+		{path: "/policies?envelope=foo", code: http.StatusBadRequest},
+	} {
+		t.Run("path="+tc.path, func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + tc.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(body))
+			assert.Equal(t, "3", res.Header.Get("X-Total-Count"))
+		})
+	}
+}
+
+func TestListStream(t *testing.T) {
+	// the entries are stored in reverse order, so that the order of the backend differs from the sort order.
+	m := NewMemoryManager()
+	for i := 9; i >= 0; i-- {
+		id := fmt.Sprintf("stream-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/stream/roles", id, &Role{ID: id, Members: []string{fmt.Sprintf("mem%d", i%2)}}))
+		require.NoError(t, m.Upsert(context.Background(), "/tests/stream/policies", id, &Policy{ID: id, Subjects: []string{fmt.Sprintf("sub%d", i%2)}, Resources: []string{"articles:<.*>"}}))
+	}
+
+	server := func(h *Handler) *httptest.Server {
+		r := httprouter.New()
+		r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Roles, 0)
+			return &ListRequest{Collection: "/tests/stream/roles", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Policies, 0)
+			return &ListRequest{Collection: "/tests/stream/policies", Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	buffered := server(NewHandler(m, herodot.NewJSONWriter(nil)))
+	defer buffered.Close()
+	streamed := server(NewHandler(m, herodot.NewJSONWriter(nil), WithStreamThreshold(5)))
+	defer streamed.Close()
+
+	get := func(t *testing.T, ts *httptest.Server, path string) (int, string, http.Header) {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body), res.Header
+	}
+
+	for _, path := range []string{
+		"/roles?member=mem1",
+		"/roles?member=mem0&limit=2&offset=1",
+		"/roles?member=mem0&limit=2&offset=100",
+		"/roles?member=none",
+		"/policies?subject=sub1&resource=articles:1",
+		"/policies?subject=sub0&subject=sub1&match=any&limit=3&offset=4",
+		"/policies?subject=SUB1&case=insensitive",
+		"/policies?match=invalid&subject=sub1",
+	} {
+		t.Run(fmt.Sprintf("path=%s", path), func(t *testing.T) {
+			bc, bb, bh := get(t, buffered, path)
+			sc, sb, sh := get(t, streamed, path)
+			assert.Equal(t, bc, sc)
+			assert.JSONEq(t, bb, sb)
+			assert.Equal(t, bh.Get("X-Total-Count"), sh.Get("X-Total-Count"))
+			assert.Equal(t, bh.Get("Link"), sh.Get("Link"))
+		})
+	}
+}
+
+func TestListOrder(t *testing.T) {
+	m := NewMemoryManager()
+	for _, id := range []string{"c", "a", "d", "b"} {
+		require.NoError(t, m.Upsert(context.Background(), "/tests/order/policies", id, &Policy{ID: id, Effect: "allow"}))
+	}
+
+	r := httprouter.New()
+	r.GET("/policies", NewHandler(m, herodot.NewJSONWriter(nil)).List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Policies, 0)
+		return &ListRequest{Collection: "/tests/order/policies", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// unfiltered lists are paginated like filtered ones, ascending by id.
+	for _, query := range []string{"", "&effect=allow"} {
+		t.Run("query="+query, func(t *testing.T) {
+			var ids []string
+			for offset := 0; offset < 4; offset += 2 {
+				res, err := ts.Client().Get(fmt.Sprintf("%s/policies?limit=2&offset=%d%s", ts.URL, offset, query))
+				require.NoError(t, err)
+				var page Policies
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+				res.Body.Close()
+				for _, p := range page {
+					ids = append(ids, p.ID)
+				}
+			}
+			assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+		})
+	}
+}
+
+type failingManager struct {
+	Manager
+}
+
+func (failingManager) Get(context.Context, string, string, interface{}) error {
+	return errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+}
+
+func TestGetNotFound(t *testing.T) {
+	for k, tc := range []struct {
+		m       Manager
+		code    int
+		details map[string]interface{}
+	}{
+		{m: NewMemoryManager(), code: http.StatusNotFound, details: map[string]interface{}{"collection": "/tests/notfound/roles", "key": "foo"}},
+		{m: failingManager{Manager: NewMemoryManager()}, code: http.StatusInternalServerError},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			h := NewHandler(tc.m, herodot.NewJSONWriter(nil))
+			r := httprouter.New()
+			r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+				return &GetRequest{Collection: "/tests/notfound/roles", Key: ps.ByName("id"), Value: new(Role)}, nil
+			}))
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := ts.Client().Get(ts.URL + "/roles/foo")
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.code, res.StatusCode)
+
+			var body struct {
+				Error struct {
+					Code    int                    `json:"code"`
+					Reason  string                 `json:"reason"`
+					Details map[string]interface{} `json:"details"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, tc.code, body.Error.Code)
+			assert.Equal(t, tc.details, body.Error.Details)
+		})
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.GetMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetManyRequest, error) {
+		p := make(Roles, 0)
+		return &GetManyRequest{Collection: "/tests/getmany/roles", Keys: r.URL.Query()["id"], Value: &p}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("getmany-%d", i)
+		require.NoError(t, m.Upsert(context.Background(), "/tests/getmany/roles", id, &Role{ID: id, Members: []string{"alice"}}))
+	}
+
+	for _, tc := range []struct {
+		query    string
+		code     int
+		expected []string
+		missing  []string
+	}{
+		{query: "", code: http.StatusOK, expected: []string{}},
+		{query: "?id=getmany-2&id=getmany-0", code: http.StatusOK, expected: []string{"getmany-2", "getmany-0"}},
+		{query: "?id=getmany-1&id=unknown&id=getmany-1", code: http.StatusOK, expected: []string{"getmany-1"}},
+		{query: "?id=getmany-1&id=getmany-1&strict=true", code: http.StatusOK, expected: []string{"getmany-1"}},
+		{query: "?id=getmany-1&id=unknown&id=other&strict=true", code: http.StatusNotFound, missing: []string{"unknown", "other"}},
+		{query: "?strict=foo", code: http.StatusBadRequest},
+	} {
+		t.Run("query="+tc.query, func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/roles" + tc.query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			switch tc.code {
+			case http.StatusOK:
+				var roles Roles
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&roles))
+				ids := []string{}
+				for _, role := range roles {
+					ids = append(ids, role.ID)
+				}
+				assert.Equal(t, tc.expected, ids)
+			case http.StatusNotFound:
+				var e struct {
+					Error struct {
+						Details struct {
+							Keys []string `json:"keys"`
+						} `json:"details"`
+					} `json:"error"`
+				}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+				assert.Equal(t, tc.missing, e.Error.Details.Keys)
+			}
+		})
+	}
+}
+
+func TestGetHead(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	get := h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "/tests/head/roles", Key: ps.ByName("id"), Value: new(Role)}, nil
+	})
+	r.GET("/roles/:id", get)
+	r.HEAD("/roles/:id", get)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, m.Upsert(context.Background(), "/tests/head/roles", "foo", &Role{ID: "foo", Members: []string{"alice"}}))
+
+	res, err := ts.Client().Get(ts.URL + "/roles/foo")
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	tag := res.Header.Get("ETag")
+	require.NotEmpty(t, tag)
+
+	for k, tc := range []struct {
+		path string
+		code int
+		etag string
+	}{
+		{path: "/roles/foo", code: http.StatusOK, etag: tag},
+		{path: "/roles/bar", code: http.StatusNotFound},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Head(ts.URL + tc.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.code, res.StatusCode)
+			assert.Equal(t, tc.etag, res.Header.Get("ETag"))
+
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Empty(t, body)
+
+			if tc.code == http.StatusOK {
+				assert.Equal(t, int64(-1), res.ContentLength)
+				assert.Empty(t, res.Header.Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	const collection = "/tests/conditional-get/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	get := h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+	})
+	r.GET("/roles/:id", get)
+	r.HEAD("/roles/:id", get)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, tag string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, ts.URL+"/roles/foo", nil)
+		require.NoError(t, err)
+		if tag != "" {
+			req.Header.Set("If-None-Match", tag)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	// the map is stored with its keys sorted, unlike the fields of a role.
+	require.NoError(t, m.Upsert(context.Background(), collection, "foo", map[string]interface{}{"members": []string{"alice"}, "id": "foo"}))
+	res, _ := do(t, "GET", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	tag := res.Header.Get("ETag")
+	require.NotEmpty(t, tag)
+
+	t.Run("case=matching tag is not modified", func(t *testing.T) {
+		for _, method := range []string{"GET", "HEAD"} {
+			for _, header := range []string{tag, `"other", W/` + tag} {
+				res, body := do(t, method, header)
+				assert.Equal(t, http.StatusNotModified, res.StatusCode, "%s %s", method, header)
+				assert.Equal(t, tag, res.Header.Get("ETag"))
+				assert.Empty(t, body)
+			}
+		}
+	})
+
+	t.Run("case=reformatted value keeps its tag", func(t *testing.T) {
+		require.NoError(t, m.Upsert(context.Background(), collection, "foo", &Role{ID: "foo", Members: []string{"alice"}}))
+		res, body := do(t, "GET", tag)
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+		assert.Empty(t, body)
+	})
+
+	t.Run("case=modified value is sent", func(t *testing.T) {
+		require.NoError(t, m.Upsert(context.Background(), collection, "foo", &Role{ID: "foo", Members: []string{"alice", "bob"}}))
+		res, body := do(t, "GET", tag)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEqual(t, tag, res.Header.Get("ETag"))
+
+		var role Role
+		require.NoError(t, json.Unmarshal(body, &role))
+		assert.Equal(t, []string{"alice", "bob"}, role.Members)
+	})
+
+	t.Run("case=stale tag is sent", func(t *testing.T) {
+		for _, header := range []string{`"stale"`, "*"} {
+			res, body := do(t, "GET", header)
+			assert.Equal(t, http.StatusOK, res.StatusCode, header)
+			assert.NotEmpty(t, body)
+		}
+	})
+}
+
+func TestConditionalUpsert(t *testing.T) {
+	h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil))
+	i := &mockHandler{c: "tests-etag", sh: h}
+	r := httprouter.New()
+	i.Register(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	upsert := func(t *testing.T, value string, header http.Header) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/?key=1&value="+value, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	get := func(t *testing.T) string {
+		res, err := ts.Client().Get(ts.URL + "/1")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		return res.Header.Get("ETag")
+	}
+
+	t.Run("case=if-match on a missing key fails", func(t *testing.T) {
+		res := upsert(t, "foo", http.Header{"If-Match": {"*"}})
+		assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	var created string
+	t.Run("case=if-none-match creates the key", func(t *testing.T) {
+		res := upsert(t, "foo", http.Header{"If-None-Match": {"*"}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		created = res.Header.Get("ETag")
+		assert.NotEmpty(t, created)
+		assert.Equal(t, created, get(t))
+	})
+
+	t.Run("case=if-none-match on an existing key fails", func(t *testing.T) {
+		res := upsert(t, "bar", http.Header{"If-None-Match": {"*"}})
+		assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	t.Run("case=if-none-match only supports a wildcard", func(t *testing.T) {
+		res := upsert(t, "bar", http.Header{"If-None-Match": {created}})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("case=matching tag updates the key", func(t *testing.T) {
+		res := upsert(t, "bar", http.Header{"If-Match": {`"other", W/` + created}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotEqual(t, created, res.Header.Get("ETag"))
+		assert.Equal(t, res.Header.Get("ETag"), get(t))
+	})
+
+	t.Run("case=stale tag is rejected", func(t *testing.T) {
+		res := upsert(t, "baz", http.Header{"If-Match": {created}})
+		assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	t.Run("case=unconditional upsert", func(t *testing.T) {
+		res := upsert(t, "baz", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
+
+func TestUpsertCreatedStatus(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil), WithCreatedStatus(enabled))
+			i := &mockHandler{c: "tests-created", sh: h}
+			r := httprouter.New()
+			i.Register(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			upsert := func(t *testing.T, query string) *http.Response {
+				res, err := ts.Client().Post(ts.URL+"/?"+query, "", nil)
+				require.NoError(t, err)
+				res.Body.Close()
+				return res
+			}
+
+			res := upsert(t, "key=1&value=foo&dry_run=true")
+			created := http.StatusOK
+			if enabled {
+				created = http.StatusCreated
+			}
+			assert.Equal(t, created, res.StatusCode)
+
+			res = upsert(t, "key=1&value=foo")
+			assert.Equal(t, created, res.StatusCode)
+			if enabled {
+				assert.Equal(t, "/1", res.Header.Get("Location"))
+			} else {
+				assert.Empty(t, res.Header.Get("Location"))
+			}
+
+			res = upsert(t, "key=1&value=bar")
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Empty(t, res.Header.Get("Location"))
+		})
+	}
+}
+
+func TestListUnknownFilterType(t *testing.T) {
+	h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		var p []string
+		return &ListRequest{Collection: "/tests/unknown/roles", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, query := range []string{"", "?member=foo"} {
+		t.Run(fmt.Sprintf("query=%s", query), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/roles" + query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+			var body struct {
+				Error herodot.DefaultError `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, http.StatusInternalServerError, body.Error.CodeField)
+			assert.Contains(t, body.Error.ReasonField, "*[]string")
+		})
+	}
+}
+
+func TestUpsertMany(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.PUT("/bulk", h.UpsertMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertManyRequest, error) {
+		var values []string
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			return nil, err
+		}
+		entries := make([]UpsertEntry, len(values))
+		for k, v := range values {
+			entries[k] = UpsertEntry{Key: v, Value: v}
+			if v == "fail" {
+				entries[k].Value = make(chan int)
+			}
+		}
+		return &UpsertManyRequest{Collection: "tests-bulk", Entries: entries}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	upsert := func(t *testing.T, body string) (int, herodot.DefaultError) {
+		req, err := http.NewRequest("PUT", ts.URL+"/bulk", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var e struct {
+			Error herodot.DefaultError `json:"error"`
+		}
+		if res.StatusCode != http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&e))
+		}
+		return res.StatusCode, e.Error
+	}
+
+	t.Run("case=success", func(t *testing.T) {
+		code, _ := upsert(t, `["a","b","c"]`)
+		assert.Equal(t, http.StatusOK, code)
+
+		var vs []string
+		require.NoError(t, m.ListAll(context.Background(), "tests-bulk", &vs))
+		assert.Equal(t, []string{"a", "b", "c"}, vs)
+	})
+
+	t.Run("case=rollback", func(t *testing.T) {
+		code, e := upsert(t, `["d","fail","e"]`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.EqualValues(t, 1, e.DetailsField["index"])
+		assert.Equal(t, "fail", e.DetailsField["key"])
+
+		var vs []string
+		require.NoError(t, m.ListAll(context.Background(), "tests-bulk", &vs))
+		assert.Equal(t, []string{"a", "b", "c"}, vs)
+	})
+
+	t.Run("case=duplicate", func(t *testing.T) {
+		code, e := upsert(t, `["f","f"]`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.EqualValues(t, 1, e.DetailsField["index"])
+	})
+}
+
 type mockHandler struct {
 	c  string
 	sh *Handler
@@ -94,6 +1040,7 @@ func (e *mockHandler) Register(r *httprouter.Router) {
 	r.POST("/", e.sh.Upsert(e.create))
 	r.GET("/", e.sh.List(e.list))
 	r.GET("/:id", e.sh.Get(e.get))
+	r.GET("/:id/exists", e.sh.Exists(e.exists))
 	r.DELETE("/:id", e.sh.Delete(e.delete))
 }
 
@@ -120,6 +1067,13 @@ func (e *mockHandler) delete(ctx context.Context, r *http.Request, ps httprouter
 	}, nil
 }
 
+func (e *mockHandler) exists(ctx context.Context, r *http.Request, ps httprouter.Params) (*ExistsRequest, error) {
+	return &ExistsRequest{
+		Collection: e.c,
+		Key:        ps.ByName("id"),
+	}, nil
+}
+
 func (e *mockHandler) get(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
 	var p string
 	return &GetRequest{
@@ -128,3 +1082,75 @@ func (e *mockHandler) get(ctx context.Context, r *http.Request, ps httprouter.Pa
 		Value:      &p,
 	}, nil
 }
+
+func TestPostLoad(t *testing.T) {
+	const collection = "/tests/postload/roles"
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(context.Background(), collection, map[string]interface{}{
+		"alice":  &Role{ID: "alice", Members: []string{"alice@example.com"}},
+		"bob":    &Role{ID: "bob", Members: []string{"bob@example.com"}},
+		"secret": &Role{ID: "secret", Members: []string{"carol@example.com"}},
+	}))
+
+	redact := func(value interface{}) error {
+		redactRole := func(r *Role) error {
+			if r.ID == "secret" {
+				return errors.WithStack(herodot.ErrForbidden.WithReason("The role is secret."))
+			}
+			r.Members = []string{"redacted"}
+			return nil
+		}
+		switch v := value.(type) {
+		case *Role:
+			return redactRole(v)
+		case *Roles:
+			for k := range *v {
+				if err := redactRole(&(*v)[k]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return errors.Errorf("unexpected value of type %T", value)
+	}
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		return &ListRequest{Collection: collection, Value: &Roles{}, FilterFunc: ListByQuery, PostLoad: redact}, nil
+	}))
+	r.GET("/bulk", h.GetMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetManyRequest, error) {
+		return &GetManyRequest{Collection: collection, Keys: r.URL.Query()["id"], Value: &Roles{}, PostLoad: redact}, nil
+	}))
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role), PostLoad: redact}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	get := func(t *testing.T, path string, value interface{}) int {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(value))
+		}
+		return res.StatusCode
+	}
+
+	var role Role
+	require.Equal(t, http.StatusOK, get(t, "/roles/alice", &role))
+	assert.Equal(t, Role{ID: "alice", Members: []string{"redacted"}}, role)
+	assert.Equal(t, http.StatusForbidden, get(t, "/roles/secret", &role))
+
+	var roles Roles
+	require.Equal(t, http.StatusOK, get(t, "/bulk?id=bob&id=alice", &roles))
+	assert.Equal(t, Roles{{ID: "bob", Members: []string{"redacted"}}, {ID: "alice", Members: []string{"redacted"}}}, roles)
+
+	// the filters are applied before PostLoad, so the redacted members still match.
+	require.Equal(t, http.StatusOK, get(t, "/roles?member=bob@example.com", &roles))
+	assert.Equal(t, Roles{{ID: "bob", Members: []string{"redacted"}}}, roles)
+	require.Equal(t, http.StatusOK, get(t, "/roles?limit=2", &roles))
+	assert.Equal(t, Roles{{ID: "alice", Members: []string{"redacted"}}, {ID: "bob", Members: []string{"redacted"}}}, roles)
+	assert.Equal(t, http.StatusForbidden, get(t, "/roles", &roles))
+}
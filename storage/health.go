@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// AliveCheckPath is the path of Alive as registered by SetHealthRoutes.
+	AliveCheckPath = "/health/storage/alive"
+
+	// ReadyCheckPath is the path of Ready as registered by SetHealthRoutes.
+	ReadyCheckPath = "/health/storage/ready"
+)
+
+// errNotReady is returned by Ready if the backend is not reachable.
+var errNotReady = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusServiceUnavailable),
+	ErrorField:  "storage backend is not ready",
+	CodeField:   http.StatusServiceUnavailable,
+}
+
+// HealthStatus is the response of Alive and Ready.
+//
+// swagger:ignore
+type HealthStatus struct {
+	// Status is always "ok".
+	Status string `json:"status"`
+}
+
+// SetHealthRoutes registers Alive at AliveCheckPath and Ready at ReadyCheckPath.
+func (h *Handler) SetHealthRoutes(r *httprouter.Router) {
+	r.GET(AliveCheckPath, h.Alive())
+	r.GET(ReadyCheckPath, h.Ready())
+}
+
+// Alive responds with 200 as long as the process serves requests. It does not touch the backend, so an orchestrator
+// should restart the instance if it fails rather than just stop routing traffic to it.
+func (h *Handler) Alive() httprouter.Handle {
+	return h.instrument("alive", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		h.h.Write(w, r, &HealthStatus{Status: "ok"})
+	})
+}
+
+// Ready responds with 200 if the backend is reachable, see Manager.Ping, and with 503 and the reason otherwise. The
+// ping is bounded by the timeout of the handler, see WithTimeout.
+func (h *Handler) Ready() httprouter.Handle {
+	return h.instrument("ready", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := h.s.Ping(r.Context()); err != nil {
+			h.h.WriteError(w, r, errors.WithStack(errNotReady.WithReasonf("The storage backend is not reachable: %s", err)))
+			return
+		}
+		h.h.Write(w, r, &HealthStatus{Status: "ok"})
+	})
+}
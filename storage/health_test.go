@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type unreachableManager struct {
+	*MemoryManager
+}
+
+func (m *unreachableManager) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealth(t *testing.T) {
+	for _, tc := range []struct {
+		d     string
+		m     Manager
+		ready int
+	}{
+		{d: "reachable", m: NewMemoryManager(), ready: http.StatusOK},
+		{d: "unreachable", m: &unreachableManager{MemoryManager: NewMemoryManager()}, ready: http.StatusServiceUnavailable},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			r := httprouter.New()
+			NewHandler(tc.m, herodot.NewJSONWriter(nil)).SetHealthRoutes(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := ts.Client().Get(ts.URL + AliveCheckPath)
+			require.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+
+			res, err = ts.Client().Get(ts.URL + ReadyCheckPath)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.ready, res.StatusCode)
+
+			if tc.ready != http.StatusOK {
+				var body struct {
+					Error struct {
+						Reason string `json:"reason"`
+					} `json:"error"`
+				}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				assert.Contains(t, body.Error.Reason, "connection refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header naming the idempotency key of a write.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyCollection is the collection in which the responses to writes with an idempotency key are kept.
+	idempotencyCollection = "/keto/idempotency"
+
+	// DefaultIdempotencyTTL is how long the response to a write with an idempotency key is kept by default.
+	DefaultIdempotencyTTL = 24 * time.Hour
+)
+
+// errUnprocessableEntity is returned if an idempotency key is reused for a different request.
+var errUnprocessableEntity = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusUnprocessableEntity),
+	ErrorField:  "unprocessable entity",
+	CodeField:   http.StatusUnprocessableEntity,
+}
+
+// WithIdempotencyTTL sets how long the response to a write with an Idempotency-Key header is kept, see
+// Handler.idempotent. Defaults to DefaultIdempotencyTTL. Zero or less ignores the header, and so does a read-only
+// handler, which must not write the responses.
+func WithIdempotencyTTL(ttl time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.idempotencyTTL = ttl
+	}
+}
+
+// idempotencyRecord is the response to a write with an idempotency key.
+type idempotencyRecord struct {
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"`
+	Code        int         `json:"code"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Expires     time.Time   `json:"expires"`
+}
+
+// idempotencyKeys are the idempotency keys of the writes in progress.
+type idempotencyKeys struct {
+	sync.Mutex
+	keys map[string]bool
+}
+
+func (k *idempotencyKeys) acquire(key string) bool {
+	k.Lock()
+	defer k.Unlock()
+	if k.keys == nil {
+		k.keys = map[string]bool{}
+	}
+	if k.keys[key] {
+		return false
+	}
+	k.keys[key] = true
+	return true
+}
+
+func (k *idempotencyKeys) release(key string) {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.keys, key)
+}
+
+// idempotent makes the write safe to retry. The first request with an Idempotency-Key header runs the write and its
+// response is kept for the idempotency TTL, unless it has a status code of 500 or above. Repeating the request with
+// the same key responds with the kept response and the header "Idempotent-Replayed: true" without writing again.
+// The key is bound to the method, path, query, and body of the first request, and reusing it for a different request
+// responds with 422. A request whose key is used by a write still in progress on the same handler responds with 409.
+//
+// The response is kept before it is compressed, and both the first response and a replayed one are compressed as
+// their own request accepts, so that a retry with a different Accept-Encoding header gets a body it can decode.
+func (h *Handler) idempotent(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || h.idempotencyTTL <= 0 || h.readOnly {
+			handle(w, r, ps)
+			return
+		}
+
+		ctx := r.Context()
+		fingerprint, err := h.fingerprint(r)
+		if err != nil {
+			handle(w, r, ps)
+			return
+		}
+
+		if !h.idempotencyKeys.acquire(key) {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrConflict.
+				WithReasonf(`A request with the idempotency key "%s" is still in progress.`, key)))
+			return
+		}
+		defer h.idempotencyKeys.release(key)
+
+		var record idempotencyRecord
+		if err := h.s.Get(ctx, idempotencyCollection, key, &record); err != nil && !isNotFound(err) {
+			h.h.WriteError(w, r, err)
+			return
+		} else if err == nil && time.Now().Before(record.Expires) {
+			if record.Fingerprint != fingerprint {
+				h.h.WriteError(w, r, errors.WithStack(errUnprocessableEntity.
+					WithReasonf(`The idempotency key "%s" was already used for a different request.`, key)))
+				return
+			}
+
+			for k, v := range record.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			cw, done := compress(w, r, h.compressionThreshold)
+			cw.WriteHeader(record.Code)
+			_, _ = cw.Write(record.Body)
+			done()
+			return
+		}
+
+		cw, done := compress(w, r, h.compressionThreshold)
+		rec := &responseRecorder{ResponseWriter: cw}
+		handle(rec, withoutCompression(r), ps)
+		done()
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		if rec.code >= http.StatusInternalServerError {
+			return
+		}
+
+		// the response is sent already, so a failure to keep it only means that a retry writes again.
+		_ = h.s.Upsert(ctx, idempotencyCollection, key, &idempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			Code:        rec.code,
+			Header:      uncompressedHeader(w.Header()),
+			Body:        rec.body.Bytes(),
+			Expires:     time.Now().Add(h.idempotencyTTL),
+		})
+	}
+}
+
+// fingerprint hashes the method, path, query, and body of the request and restores the body for the handler. It
+// fails if the body is larger than the maximum body size, in which case the request is not idempotent.
+func (h *Handler) fingerprint(r *http.Request) (string, error) {
+	sum := sha256.New()
+	_, _ = io.WriteString(sum, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	if r.Body == nil {
+		return hex.EncodeToString(sum.Sum(nil)), nil
+	}
+
+	limit := h.maxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return "", errors.WithStack(err)
+	} else if int64(len(body)) > limit {
+		return "", errors.Errorf("request body is larger than %d bytes", limit)
+	}
+
+	_, _ = sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// withoutCompression returns a copy of the request which does not accept a compressed response, so that the handler
+// writes the body as it is.
+func withoutCompression(r *http.Request) *http.Request {
+	r = r.Clone(r.Context())
+	r.Header.Del("Accept-Encoding")
+	return r
+}
+
+// uncompressedHeader returns a copy of the response header without the headers which compress added.
+func uncompressedHeader(header http.Header) http.Header {
+	header = header.Clone()
+	header.Del("Content-Encoding")
+
+	vary := header.Values("Vary")
+	header.Del("Vary")
+	for _, v := range vary {
+		if v != "Accept-Encoding" {
+			header.Add("Vary", v)
+		}
+	}
+	return header
+}
+
+// responseRecorder keeps the status code and body of a response while writing it.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type upsertCountingManager struct {
+	*MemoryManager
+	upserts int32
+}
+
+func (m *upsertCountingManager) UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error {
+	atomic.AddInt32(&m.upserts, 1)
+	return m.MemoryManager.UpsertMany(ctx, collection, kv)
+}
+
+func TestIdempotency(t *testing.T) {
+	const collection = "/tests/idempotency/roles"
+
+	newServer := func(m Manager, opts ...HandlerOption) *httptest.Server {
+		h := NewHandler(m, herodot.NewJSONWriter(nil), opts...)
+		r := httprouter.New()
+		r.PUT("/roles", h.UpsertMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertManyRequest, error) {
+			var roles Roles
+			if err := json.NewDecoder(r.Body).Decode(&roles); err != nil {
+				return nil, errors.WithStack(herodot.ErrBadRequest.WithReason(err.Error()))
+			}
+			u := &UpsertManyRequest{Collection: collection}
+			for k := range roles {
+				u.Entries = append(u.Entries, UpsertEntry{Key: roles[k].ID, Value: &roles[k]})
+			}
+			return u, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	put := func(t *testing.T, ts *httptest.Server, key, body string) (*http.Response, string) {
+		req, err := http.NewRequest("PUT", ts.URL+"/roles", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+
+	t.Run("case=repeated requests write once", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m)
+		defer ts.Close()
+
+		first, firstBody := put(t, ts, "k1", `[{"id":"a","members":["alice"]}]`)
+		require.Equal(t, http.StatusOK, first.StatusCode, firstBody)
+		assert.Empty(t, first.Header.Get("Idempotent-Replayed"))
+
+		second, secondBody := put(t, ts, "k1", `[{"id":"a","members":["alice"]}]`)
+		require.Equal(t, http.StatusOK, second.StatusCode)
+		assert.Equal(t, "true", second.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, firstBody, secondBody)
+		assert.Equal(t, first.Header.Get("Content-Type"), second.Header.Get("Content-Type"))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&m.upserts))
+
+		res, body := put(t, ts, "k1", `[{"id":"a","members":["bob"]}]`)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode, body)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&m.upserts))
+
+		res, _ = put(t, ts, "k2", `[{"id":"a","members":["bob"]}]`)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&m.upserts))
+
+		var r Role
+		require.NoError(t, m.Get(context.Background(), collection, "a", &r))
+		assert.Equal(t, []string{"bob"}, r.Members)
+	})
+
+	t.Run("case=responses are kept uncompressed", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m, WithCompressionThreshold(0))
+		defer ts.Close()
+
+		do := func(t *testing.T, encoding string) (*http.Response, []byte) {
+			req, err := http.NewRequest("PUT", ts.URL+"/roles", bytes.NewBufferString(`[{"id":"a","members":["alice"]}]`))
+			require.NoError(t, err)
+			req.Header.Set(IdempotencyKeyHeader, "k")
+			// setting the header disables the transparent decompression of the client.
+			req.Header.Set("Accept-Encoding", encoding)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			b, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			return res, b
+		}
+		gunzip := func(t *testing.T, b []byte) []byte {
+			gz, err := gzip.NewReader(bytes.NewReader(b))
+			require.NoError(t, err)
+			plain, err := ioutil.ReadAll(gz)
+			require.NoError(t, err)
+			return plain
+		}
+
+		first, compressed := do(t, "gzip")
+		require.Equal(t, http.StatusOK, first.StatusCode)
+		require.Equal(t, "gzip", first.Header.Get("Content-Encoding"))
+		plain := gunzip(t, compressed)
+
+		res, body := do(t, "identity")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+		assert.Empty(t, res.Header.Get("Content-Encoding"))
+		assert.Empty(t, res.Header.Values("Vary"))
+		assert.Equal(t, plain, body)
+
+		res, body = do(t, "gzip")
+		require.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+		require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+		assert.Equal(t, []string{"Accept-Encoding"}, res.Header.Values("Vary"))
+		assert.Equal(t, plain, gunzip(t, body))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&m.upserts))
+	})
+
+	t.Run("case=client errors are kept", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m)
+		defer ts.Close()
+
+		res, _ := put(t, ts, "k", `not json`)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res, _ = put(t, ts, "k", `not json`)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+	})
+
+	t.Run("case=requests without key write every time", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m)
+		defer ts.Close()
+
+		for i := 0; i < 2; i++ {
+			res, _ := put(t, ts, "", `[{"id":"a"}]`)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		assert.EqualValues(t, 2, atomic.LoadInt32(&m.upserts))
+	})
+
+	t.Run("case=expired responses are not replayed", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m, WithIdempotencyTTL(time.Millisecond))
+		defer ts.Close()
+
+		res, _ := put(t, ts, "k", `[{"id":"a"}]`)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		time.Sleep(10 * time.Millisecond)
+		res, _ = put(t, ts, "k", `[{"id":"b"}]`)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Idempotent-Replayed"))
+		assert.EqualValues(t, 2, atomic.LoadInt32(&m.upserts))
+	})
+
+	t.Run("case=disabled", func(t *testing.T) {
+		m := &upsertCountingManager{MemoryManager: NewMemoryManager()}
+		ts := newServer(m, WithIdempotencyTTL(0))
+		defer ts.Close()
+
+		for i := 0; i < 2; i++ {
+			res, _ := put(t, ts, "k", `[{"id":"a"}]`)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Empty(t, res.Header.Get("Idempotent-Replayed"))
+		}
+		assert.EqualValues(t, 2, atomic.LoadInt32(&m.upserts))
+	})
+
+	t.Run("case=concurrent requests with the same key", func(t *testing.T) {
+		h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil))
+		require.True(t, h.idempotencyKeys.acquire("busy"))
+		defer h.idempotencyKeys.release("busy")
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/roles", bytes.NewBufferString(`[]`))
+		req.Header.Set(IdempotencyKeyHeader, "busy")
+		h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			t.Fatal("the write must not run")
+		})(w, req, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// ImportModeMerge upserts the imported entries and keeps all other entries of the collection.
+	ImportModeMerge = "merge"
+	// ImportModeReplace removes all entries of the collection before upserting the imported entries.
+	ImportModeReplace = "replace"
+)
+
+func validateImportMode(mode string) error {
+	switch mode {
+	case ImportModeMerge, ImportModeReplace:
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Import mode must be "%s" or "%s" but got "%s".`, ImportModeMerge, ImportModeReplace, mode))
+}
+
+// ImportRequest is a request to restore a collection from newline delimited JSON, as written by Export.
+type ImportRequest struct {
+	Collection string
+	Mode       string
+	Body       io.Reader
+
+	// Decode decodes and validates a single line and returns the key it is stored under.
+	Decode func(line json.RawMessage) (key string, value interface{}, err error)
+}
+
+// ImportResponse is the number of imported entries.
+type ImportResponse struct {
+	Imported int `json:"imported"`
+}
+
+// Import reads all lines of the request body and stores them at once. Empty lines are skipped. If a line can not be
+// decoded or repeats a key, nothing is imported and the error names the line. If the backend supports transactions,
+// either all or none of the entries are written. Importing protected keys, or replacing a collection while any keys
+// are protected, is answered with 403, see WithProtectedKeys.
+func (h *Handler) Import(factory func(context.Context, *http.Request, httprouter.Params) (*ImportRequest, error)) httprouter.Handle {
+	return h.instrument("import", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		tooLarge := h.limitBody(w, r)
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		i, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		annotate(ctx, i.Collection)
+
+		if err := validateCollection(i.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(i.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		kv, err := readImport(i)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		if i.Mode == ImportModeReplace {
+			err = h.checkProtectedCollection(ctx, r)
+		} else {
+			err = h.checkProtected(ctx, r, keysOf(kv)...)
+		}
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.s.Import(ctx, i.Collection, kv, i.Mode); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		h.audit(ctx, keysOf(kv)...)
+
+		h.h.Write(w, r, &ImportResponse{Imported: len(kv)})
+	}))
+}
+
+func readImport(i *ImportRequest) (map[string]interface{}, error) {
+	if err := validateImportMode(i.Mode); err != nil {
+		return nil, err
+	}
+
+	kv := map[string]interface{}{}
+	lines := map[string]int{}
+	br := bufio.NewReader(i.Body)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.WithStack(err)
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			key, value, derr := i.Decode(trimmed)
+			if derr != nil {
+				return nil, errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Unable to import line %d: %s", n, derr).
+					WithDetail("line", n))
+			}
+			if first, ok := lines[key]; ok {
+				return nil, errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Unable to import line %d: key %s was already imported on line %d", n, key, first).
+					WithDetail("line", n).
+					WithDetail("key", key))
+			}
+			clearTimestamps(value)
+			lines[key] = n
+			kv[key] = value
+		}
+
+		if err == io.EOF {
+			return kv, nil
+		}
+	}
+}
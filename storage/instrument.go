@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// statusRecorder remembers the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+type operationKey struct{}
+
+// operation describes the request being served. The handle fills in the details once they are known.
+type operation struct {
+	name       string
+	collection string
+}
+
+// annotate records the collection of the request being served.
+func annotate(ctx context.Context, collection string) {
+	if o, ok := ctx.Value(operationKey{}).(*operation); ok {
+		o.collection = collection
+	}
+}
+
+// annotateOperation replaces the name of the operation being served, for example to tell apart the different ways
+// a list is computed.
+func annotateOperation(ctx context.Context, name string) {
+	if o, ok := ctx.Value(operationKey{}).(*operation); ok {
+		o.name = name
+	}
+}
+
+// instrument records a trace span and metrics named after the operation around the handle. Responses with a status
+// code of 500 and above mark the span as failed.
+func (h *Handler) instrument(name string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		o := &operation{name: name}
+		span, ctx := opentracing.StartSpanFromContextWithTracer(r.Context(), h.tracer, "storage.handler."+name)
+		defer span.Finish()
+		ext.SpanKindRPCServer.Set(span)
+		ext.HTTPMethod.Set(span, r.Method)
+		ext.HTTPUrl.Set(span, r.URL.Path)
+
+		if h.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		handle(rec, r.WithContext(context.WithValue(ctx, operationKey{}, o)), ps)
+
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		span.SetTag("collection", o.collection)
+		ext.HTTPStatusCode.Set(span, uint16(rec.code))
+		if rec.code >= http.StatusInternalServerError {
+			ext.Error.Set(span, true)
+		}
+
+		h.metrics.observe(o, rec.code, time.Since(start))
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// DefaultMaxBodySize is the size in bytes up to which the request bodies of writes are read.
+const DefaultMaxBodySize = 4 << 20
+
+var errRequestEntityTooLarge = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusRequestEntityTooLarge),
+	ErrorField:  "The request body is too large",
+	CodeField:   http.StatusRequestEntityTooLarge,
+}
+
+// WithMaxBodySize sets the size in bytes up to which Upsert, UpsertMany, Patch, Import and DeleteMany read the
+// request body. Larger bodies are answered with 413. A size of zero or less disables the limit. Defaults to
+// DefaultMaxBodySize.
+func WithMaxBodySize(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// limitedBody records if reading the body failed because it exceeded the limit of http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+	limit, read int64
+	exceeded    bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	// http.MaxBytesReader returns the first limit bytes and fails afterwards.
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitBody limits the request body to the maximum body size of the handler. The returned function replaces errors by
+// 413 if the body was larger than allowed and returns them as they are otherwise. This hides the error of whoever read
+// the body, such as a decoding error with 400 for the truncated body.
+func (h *Handler) limitBody(w http.ResponseWriter, r *http.Request) func(error) error {
+	if h.maxBodySize <= 0 || r.Body == nil {
+		return func(err error) error { return err }
+	}
+
+	b := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, h.maxBodySize), limit: h.maxBodySize}
+	r.Body = b
+	return func(err error) error {
+		if err != nil && b.exceeded {
+			return errors.WithStack(errRequestEntityTooLarge.WithReasonf("The request body must not be larger than %d bytes.", h.maxBodySize))
+		}
+		return err
+	}
+}
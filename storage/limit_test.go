@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	const collection = "/tests/limit/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithMaxBodySize(64))
+	r := httprouter.New()
+	r.PUT("/roles", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+		var role Role
+		if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode role: %s", err))
+		}
+		return &UpsertRequest{Collection: collection, Key: role.ID, Value: &role}, nil
+	}))
+	r.POST("/import", h.Import(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ImportRequest, error) {
+		return &ImportRequest{Collection: collection, Mode: ImportModeMerge, Body: r.Body, Decode: func(line json.RawMessage) (string, interface{}, error) {
+			var role Role
+			if err := json.Unmarshal(line, &role); err != nil {
+				return "", nil, err
+			}
+			return role.ID, &role, nil
+		}}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(b)
+	}
+
+	large := fmt.Sprintf(`{"id":"large","members":["%s"]}`, strings.Repeat("a", 64))
+
+	for _, tc := range []struct {
+		d      string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{d: "upsert", method: "PUT", path: "/roles", body: `{"id":"small"}`, code: http.StatusOK},
+		{d: "upsert of a malformed body", method: "PUT", path: "/roles", body: `{"id":`, code: http.StatusBadRequest},
+		{d: "upsert of a large body", method: "PUT", path: "/roles", body: large, code: http.StatusRequestEntityTooLarge},
+		{d: "import", method: "POST", path: "/import", body: `{"id":"imported"}` + "\n", code: http.StatusOK},
+		{d: "import of a large body", method: "POST", path: "/import", body: `{"id":"a"}` + "\n" + large + "\n", code: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			code, body := do(t, tc.method, tc.path, tc.body)
+			require.Equal(t, tc.code, code, body)
+			if tc.code == http.StatusRequestEntityTooLarge {
+				assert.Contains(t, body, "The request body must not be larger than 64 bytes.")
+			}
+		})
+	}
+
+	var roles Roles
+	require.NoError(t, m.ListAll(context.Background(), collection, &roles))
+	assert.Equal(t, Roles{{ID: "small"}, {ID: "imported"}}, roles)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+// DefaultLockTTL is the time after which the lock of a compound operation expires by default.
+const DefaultLockTTL = 10 * time.Second
+
+// lockRetryInterval is the time Manager.Lock waits before trying again to acquire a lock which is held.
+const lockRetryInterval = 10 * time.Millisecond
+
+// WithLockTTL sets the time after which the lock held by a handler wrapped with Locked expires, so that an instance
+// which crashed while holding it does not block the key forever. Defaults to DefaultLockTTL.
+func WithLockTTL(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.lockTTL = d
+	}
+}
+
+// LockRequest names the key which has to be locked while a compound operation runs.
+type LockRequest struct {
+	Collection string
+	Key        string
+}
+
+// Locked runs next while holding the lock of the key returned by the factory, see Manager.Lock. It serializes
+// handlers which read a value and write it back in separate steps, such as adding members to a role in the factory of
+// an Upsert, so that concurrent requests for the same key can not overwrite each other's changes. The lock is released
+// once next returns.
+func (h *Handler) Locked(factory func(context.Context, *http.Request, httprouter.Params) (*LockRequest, error), next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		l, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := validateCollection(l.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		unlock, err := h.s.Lock(ctx, path.Join(l.Collection, l.Key), h.lockTTL)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		defer unlock()
+
+		next(w, r, ps)
+	}
+}
+
+// keyLocks are advisory locks held in memory which expire after their ttl.
+type keyLocks struct {
+	sync.Mutex
+	held map[string]heldLock
+}
+
+type heldLock struct {
+	token   string
+	expires time.Time
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{held: map[string]heldLock{}}
+}
+
+func (l *keyLocks) lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	token := uuid.New()
+	for !l.tryLock(key, token, ttl) {
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	return func() {
+		l.Lock()
+		defer l.Unlock()
+		// the lock may have expired and been acquired by someone else in the meantime.
+		if l.held[key].token == token {
+			delete(l.held, key)
+		}
+	}, nil
+}
+
+func (l *keyLocks) tryLock(key, token string, ttl time.Duration) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	if h, ok := l.held[key]; ok && now.Before(h.expires) {
+		return false
+	}
+	l.held[key] = heldLock{token: token, expires: now.Add(ttl)}
+	return true
+}
@@ -4,19 +4,179 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/pkg/errors"
 )
 
+// Manager stores the documents of the collections. Implementations report keys, tombstones, and members which do not
+// exist with errors wrapping ErrNotFound, and keys which exist already with errors wrapping ErrConflict, so that
+// handlers respond with the same status codes for every backend.
 type Manager interface {
 	Get(ctx context.Context, collection string, key string, value interface{}) error
+
+	// GetMany decodes the values of the keys into value, a pointer to a slice, in the order of the keys. Keys which do
+	// not exist are left out and keys which are given more than once are only decoded once.
+	GetMany(ctx context.Context, collection string, keys []string, value interface{}) error
+
+	Exists(ctx context.Context, collection string, key string) (bool, error)
+
+	// Timestamps returns the times at which the keys were first written and last changed. Every write records them,
+	// keys which do not exist or have no timestamps are left out.
+	Timestamps(ctx context.Context, collection string, keys []string) (map[string]Timestamps, error)
+
+	// RolesForMember returns the sorted IDs of the roles in the collection which contain the member, either directly
+	// or through other roles.
+	RolesForMember(ctx context.Context, collection string, member string) ([]string, error)
+
+	// List decodes a page of the values of the collection into value, ordered by key.
 	List(ctx context.Context, collection string, value interface{}, limit, offset int) error
+
 	ListAll(ctx context.Context, collection string, value interface{}) error
+	ListAfter(ctx context.Context, collection string, afterKey string, limit int, value interface{}) error
+
+	// Stream calls fn with every value of the collection, ordered by key, without loading the whole collection at
+	// once. It stops at the first error returned by fn.
+	Stream(ctx context.Context, collection string, fn func(raw json.RawMessage) error) error
+
+	Count(ctx context.Context, collection string) (int, error)
 	Upsert(ctx context.Context, collection string, key string, value interface{}) error
+	UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error
+	Import(ctx context.Context, collection string, kv map[string]interface{}, mode string) error
+	Patch(ctx context.Context, collection string, key string, patch interface{}) error
+	AddMember(ctx context.Context, collection string, key string, member string) error
+	RemoveMember(ctx context.Context, collection string, key string, member string) error
 	Delete(ctx context.Context, collection string, key string) error
+	DeleteMany(ctx context.Context, collection string, keys []string) (int, error)
+
+	// Rename moves the value of oldKey to newKey in one step, keeping the time at which it was first written. The field
+	// "id" of the value is set to newKey if it was oldKey. It fails with ErrNotFound if oldKey does not exist and with
+	// ErrConflict if newKey exists already.
+	Rename(ctx context.Context, collection string, oldKey, newKey string) error
+
+	// Create writes the value of the key like Upsert but fails with ErrConflict if the key exists already.
+	Create(ctx context.Context, collection string, key string, value interface{}) error
+
+	// Clear removes all entries and tombstones of the collection and returns the number of removed entries.
+	Clear(ctx context.Context, collection string) (int, error)
+
 	Storage(ctx context.Context, schema string, collections []string) (storage.Store, error)
+
+	// Migrate creates or upgrades the schema of the backend. It is idempotent and records the applied migrations.
+	Migrate(ctx context.Context) error
+
+	// MigrationStatus lists the migrations known to the backend in the order in which they are applied.
+	MigrationStatus(ctx context.Context) ([]MigrationInfo, error)
+
+	// Ping checks that the backend is reachable. It is cheap enough to be called by readiness probes.
+	Ping(ctx context.Context) error
+
+	// SoftDelete moves the entry of the key out of the collection and keeps it as a tombstone, recording the time of
+	// the deletion, so that the entry can be restored. A previous tombstone of the key is replaced. Keys which do not
+	// exist are ignored, like in Delete.
+	SoftDelete(ctx context.Context, collection string, key string) error
+
+	// Restore moves the tombstone of the key back into the collection. The entry keeps the time at which it was
+	// created and is updated now. It fails with ErrNotFound if the key has no tombstone and with ErrConflict if the key
+	// exists in the collection.
+	Restore(ctx context.Context, collection string, key string) error
+
+	// ListDeleted returns the tombstones of the collection ordered by key.
+	ListDeleted(ctx context.Context, collection string) ([]Tombstone, error)
+
+	// Purge removes the tombstone of the key for good. It fails with ErrNotFound if the key has no tombstone.
+	Purge(ctx context.Context, collection string, key string) error
+
+	// Compact removes the tombstones of all collections which were deleted before the time and the locks which have
+	// expired, and then reclaims the space of removed entries where the backend supports it. It returns the number of
+	// removed tombstones. It may run alongside other operations and can be repeated if it was interrupted.
+	Compact(ctx context.Context, deletedBefore time.Time) (int, error)
+
+	// WithTransaction runs f against tx, a Manager whose writes are committed together if f returns nil and are
+	// discarded otherwise, so that related writes to several collections either all happen or none does. f has to
+	// use tx for all operations belonging to the transaction and must not keep it after it returns. Transactions started
+	// on tx join the transaction.
+	WithTransaction(ctx context.Context, f func(tx Manager) error) error
+
+	// Lock acquires an advisory lock of the key, waiting until it is released or has expired, and returns the function
+	// which releases it. The lock expires after ttl, so that a holder which crashed does not block others forever.
+	// Locks are shared by all instances using the same backend and do not affect the other operations.
+	Lock(ctx context.Context, key string, ttl time.Duration) (unlock func(), err error)
+}
+
+// Timestamps are the times at which an entry was first written and last changed, see Manager.Timestamps.
+type Timestamps struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Tombstone is an entry which was removed by Manager.SoftDelete.
+type Tombstone struct {
+	Key       string
+	DeletedAt time.Time
+	Data      json.RawMessage
+
+	// CreatedAt is the time at which the entry was first written, which Restore keeps. It is zero for tombstones
+	// whose entry has no timestamps.
+	CreatedAt time.Time
+}
+
+// KeyError is returned by operations working on several keys at once if the operation failed for a specific key.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %s: %s", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// inKeyOrder returns the found values in the order of the keys, leaving out missing and repeated keys.
+func inKeyOrder(keys []string, found map[string]json.RawMessage) []json.RawMessage {
+	items := make([]json.RawMessage, 0, len(found))
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if v, ok := found[key]; ok && !seen[key] {
+			seen[key] = true
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// errKeyExists is returned by Manager.Create if the key exists already.
+func errKeyExists(key string) error {
+	return conflictf(`Key "%s" can not be created because it exists already.`, key)
+}
+
+// errRenameTargetExists is returned by Manager.Rename if the new key exists already.
+func errRenameTargetExists(oldKey, newKey string) error {
+	return conflictf(`Key "%s" can not be renamed to "%s" because it exists already.`, oldKey, newKey)
+}
+
+// renameDocument sets the field "id" of the JSON document to newKey if it is oldKey. Documents which are no objects
+// or have another ID are returned as they are.
+func renameDocument(document []byte, oldKey, newKey string) ([]byte, error) {
+	id, err := json.Marshal(newKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b, _, err := mapObject(document, func(key string, v json.RawMessage) (json.RawMessage, bool, error) {
+		var current string
+		if key == "id" && json.Unmarshal(v, &current) == nil && current == oldKey {
+			return id, true, nil
+		}
+		return v, true, nil
+	})
+	return b, err
 }
 
 func roundTrip(in, out interface{}) error {
@@ -35,6 +195,26 @@ func roundTrip(in, out interface{}) error {
 	return nil
 }
 
+// applyPatch merges patch into the JSON document and returns the encoded result.
+func applyPatch(document []byte, patch interface{}) ([]byte, error) {
+	var p interface{}
+	if err := roundTrip(patch, &p); err != nil {
+		return nil, err
+	}
+
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(mergePatch(target, p)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return b.Bytes(), nil
+}
+
 func toRegoStore(ctx context.Context, schema string, collections []string, query func(context.Context, string) ([]json.RawMessage, error)) (storage.Store, error) {
 	var s map[string]interface{}
 	dec := json.NewDecoder(bytes.NewBufferString(schema))
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+)
+
+// CachedManager caches the decoded results of ListAll in a LRU cache keyed by collection. Entries expire after the
+// TTL and are invalidated by every write to their collection. All other methods are passed to the wrapped Manager.
+type CachedManager struct {
+	Manager
+
+	cache  *lru.Cache
+	ttl    time.Duration
+	hits   uint64
+	misses uint64
+
+	// versions counts the writes per collection, and epoch the transactions, so that a ListAll which raced with a
+	// write does not cache its outdated result.
+	mu       sync.Mutex
+	versions map[string]uint64
+	epoch    uint64
+}
+
+type cacheEntry struct {
+	value   reflect.Value
+	expires time.Time
+}
+
+// NewCachedManager wraps the manager with a cache holding the ListAll results of up to size collections for the TTL.
+func NewCachedManager(m Manager, size int, ttl time.Duration) (*CachedManager, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &CachedManager{Manager: m, cache: cache, ttl: ttl, versions: map[string]uint64{}}, nil
+}
+
+// Hits returns the number of ListAll calls which were served from the cache.
+func (m *CachedManager) Hits() uint64 {
+	return atomic.LoadUint64(&m.hits)
+}
+
+// Misses returns the number of ListAll calls which were passed to the wrapped Manager.
+func (m *CachedManager) Misses() uint64 {
+	return atomic.LoadUint64(&m.misses)
+}
+
+func (m *CachedManager) ListAll(ctx context.Context, collection string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return m.Manager.ListAll(ctx, collection, value)
+	}
+
+	if e, ok := m.cache.Get(collection); ok {
+		entry := e.(*cacheEntry)
+		if entry.value.Type() == v.Elem().Type() && time.Now().Before(entry.expires) {
+			atomic.AddUint64(&m.hits, 1)
+			v.Elem().Set(copySlice(entry.value))
+			return nil
+		}
+	}
+
+	atomic.AddUint64(&m.misses, 1)
+	version := m.version(collection)
+	if err := m.Manager.ListAll(ctx, collection, value); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.epoch+m.versions[collection] == version {
+		m.cache.Add(collection, &cacheEntry{value: copySlice(v.Elem()), expires: time.Now().Add(m.ttl)})
+	}
+	return nil
+}
+
+// RolesForMember computes the roles from the cached ListAll result instead of querying the wrapped Manager.
+func (m *CachedManager) RolesForMember(ctx context.Context, collection string, member string) ([]string, error) {
+	var roles Roles
+	if err := m.ListAll(ctx, collection, &roles); err != nil {
+		return nil, err
+	}
+	return roles.memberOf(member), nil
+}
+
+func (m *CachedManager) version(collection string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.epoch + m.versions[collection]
+}
+
+// copySlice copies the slice so that changes made by the caller, for example by filtering, do not affect the cache.
+func copySlice(s reflect.Value) reflect.Value {
+	c := reflect.MakeSlice(s.Type(), s.Len(), s.Len())
+	reflect.Copy(c, s)
+	return c
+}
+
+func (m *CachedManager) invalidate(collection string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[collection]++
+	m.cache.Remove(collection)
+	return err
+}
+
+func (m *CachedManager) Upsert(ctx context.Context, collection string, key string, value interface{}) error {
+	return m.invalidate(collection, m.Manager.Upsert(ctx, collection, key, value))
+}
+
+func (m *CachedManager) Create(ctx context.Context, collection string, key string, value interface{}) error {
+	return m.invalidate(collection, m.Manager.Create(ctx, collection, key, value))
+}
+
+func (m *CachedManager) UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error {
+	return m.invalidate(collection, m.Manager.UpsertMany(ctx, collection, kv))
+}
+
+func (m *CachedManager) Import(ctx context.Context, collection string, kv map[string]interface{}, mode string) error {
+	return m.invalidate(collection, m.Manager.Import(ctx, collection, kv, mode))
+}
+
+func (m *CachedManager) Patch(ctx context.Context, collection string, key string, patch interface{}) error {
+	return m.invalidate(collection, m.Manager.Patch(ctx, collection, key, patch))
+}
+
+func (m *CachedManager) AddMember(ctx context.Context, collection string, key string, member string) error {
+	return m.invalidate(collection, m.Manager.AddMember(ctx, collection, key, member))
+}
+
+func (m *CachedManager) RemoveMember(ctx context.Context, collection string, key string, member string) error {
+	return m.invalidate(collection, m.Manager.RemoveMember(ctx, collection, key, member))
+}
+
+func (m *CachedManager) Delete(ctx context.Context, collection string, key string) error {
+	return m.invalidate(collection, m.Manager.Delete(ctx, collection, key))
+}
+
+func (m *CachedManager) DeleteMany(ctx context.Context, collection string, keys []string) (int, error) {
+	n, err := m.Manager.DeleteMany(ctx, collection, keys)
+	return n, m.invalidate(collection, err)
+}
+
+func (m *CachedManager) Clear(ctx context.Context, collection string) (int, error) {
+	n, err := m.Manager.Clear(ctx, collection)
+	return n, m.invalidate(collection, err)
+}
+
+func (m *CachedManager) Rename(ctx context.Context, collection string, oldKey, newKey string) error {
+	return m.invalidate(collection, m.Manager.Rename(ctx, collection, oldKey, newKey))
+}
+
+func (m *CachedManager) SoftDelete(ctx context.Context, collection string, key string) error {
+	return m.invalidate(collection, m.Manager.SoftDelete(ctx, collection, key))
+}
+
+func (m *CachedManager) Restore(ctx context.Context, collection string, key string) error {
+	return m.invalidate(collection, m.Manager.Restore(ctx, collection, key))
+}
+
+// WithTransaction passes the wrapped manager of the transaction to f, so that reads within the transaction see its
+// writes, and clears the whole cache afterwards because the transaction may have written to any collection.
+func (m *CachedManager) WithTransaction(ctx context.Context, f func(tx Manager) error) error {
+	err := m.Manager.WithTransaction(ctx, f)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.epoch++
+	m.cache.Purge()
+	return err
+}
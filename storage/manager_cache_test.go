@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedManager(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewCachedManager(NewMemoryManager(), 10, time.Hour)
+	require.NoError(t, err)
+
+	list := func(t *testing.T) Policies {
+		var ps Policies
+		require.NoError(t, m.ListAll(ctx, "cache", &ps))
+		return ps
+	}
+
+	require.NoError(t, m.Upsert(ctx, "cache", "1", &Policy{ID: "1"}))
+	assert.Len(t, list(t), 1)
+	assert.EqualValues(t, 0, m.Hits())
+	assert.EqualValues(t, 1, m.Misses())
+
+	ps := list(t)
+	assert.Len(t, ps, 1)
+	assert.EqualValues(t, 1, m.Hits())
+	assert.EqualValues(t, 1, m.Misses())
+
+	t.Run("case=changes by the caller do not affect the cache", func(t *testing.T) {
+		ps[0].ID = "changed"
+		assert.Equal(t, "1", list(t)[0].ID)
+	})
+
+	t.Run("case=writes invalidate the collection", func(t *testing.T) {
+		misses := m.Misses()
+		require.NoError(t, m.Upsert(ctx, "cache", "2", &Policy{ID: "2"}))
+		assert.Len(t, list(t), 2)
+		assert.Equal(t, misses+1, m.Misses())
+
+		_, err := m.DeleteMany(ctx, "cache", []string{"1"})
+		require.NoError(t, err)
+		assert.Equal(t, Policies{{ID: "2"}}, list(t))
+		assert.Equal(t, misses+2, m.Misses())
+
+		require.NoError(t, m.Delete(ctx, "cache", "2"))
+		assert.Len(t, list(t), 0)
+		assert.Equal(t, misses+3, m.Misses())
+	})
+
+	t.Run("case=transactions invalidate all collections", func(t *testing.T) {
+		assert.Len(t, list(t), 0)
+		misses := m.Misses()
+		require.NoError(t, m.WithTransaction(ctx, func(tx Manager) error {
+			return tx.Upsert(ctx, "cache", "3", &Policy{ID: "3"})
+		}))
+		assert.Equal(t, Policies{{ID: "3"}}, list(t))
+		assert.Equal(t, misses+1, m.Misses())
+	})
+
+	t.Run("case=other types are not served from the cache", func(t *testing.T) {
+		require.NoError(t, m.Upsert(ctx, "cache-types", "1", &Role{ID: "1"}))
+		var rs Roles
+		require.NoError(t, m.ListAll(ctx, "cache-types", &rs))
+
+		misses := m.Misses()
+		var raw []map[string]interface{}
+		require.NoError(t, m.ListAll(ctx, "cache-types", &raw))
+		assert.Len(t, raw, 1)
+		assert.Equal(t, misses+1, m.Misses())
+	})
+
+	t.Run("case=entries expire", func(t *testing.T) {
+		m, err := NewCachedManager(NewMemoryManager(), 10, time.Nanosecond)
+		require.NoError(t, err)
+
+		var ps Policies
+		require.NoError(t, m.ListAll(ctx, "cache", &ps))
+		time.Sleep(time.Millisecond)
+		require.NoError(t, m.ListAll(ctx, "cache", &ps))
+		assert.EqualValues(t, 0, m.Hits())
+		assert.EqualValues(t, 2, m.Misses())
+	})
+}
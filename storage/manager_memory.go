@@ -4,102 +4,435 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/pkg/errors"
 
-	"github.com/ory/herodot"
 	"github.com/ory/x/pagination"
 )
 
+// MemoryManager is a Manager which keeps all collections in memory. It has no dependencies, which makes it useful for
+// tests, local development and small deployments, but it loses all data when the process exits.
+//
+// It is safe for concurrent use. A sync.RWMutex guards the collections, and values are stored as encoded JSON and
+// decoded on every read, so callers can not change the stored state through a value passed to Upsert or returned by
+// Get or List. The documents are kept in the encoding of the codec, see SetCodec.
 type MemoryManager struct {
-	sync.RWMutex
-	items map[string][]memoryItem
+	mu         sync.RWMutex
+	items      map[string][]memoryItem
+	tombstones map[string][]Tombstone
+	codec      Codec
+
+	// transaction is set for the copy WithTransaction passes to its function.
+	transaction bool
+
+	locks *keyLocks
 }
 
 type memoryItem struct {
 	Key  string
 	Data json.RawMessage
+
+	Timestamps
+}
+
+// newMemoryItem returns an item which was created and updated just now.
+func newMemoryItem(key string, data json.RawMessage) memoryItem {
+	now := time.Now().UTC()
+	return memoryItem{Key: key, Data: data, Timestamps: Timestamps{CreatedAt: now, UpdatedAt: now}}
 }
 
+var _ Manager = new(MemoryManager)
+
+// NewMemoryManager returns an empty MemoryManager.
 func NewMemoryManager() *MemoryManager {
 	return &MemoryManager{
-		items: map[string][]memoryItem{},
+		items:      map[string][]memoryItem{},
+		tombstones: map[string][]Tombstone{},
+		codec:      JSONCodec{},
+		locks:      newKeyLocks(),
 	}
 }
 
-func (m *MemoryManager) collection(collection string) []memoryItem {
-	m.RLock()
-	v, ok := m.items[collection]
-	m.RUnlock()
-	if !ok {
-		m.Lock()
-		v = []memoryItem{}
-		m.items[collection] = v
-		m.Unlock()
+// SetCodec sets the codec in which the documents are kept, which trades the time of encoding and decoding every
+// value for memory. Defaults to JSONCodec. It must be set before the first write.
+func (m *MemoryManager) SetCodec(c Codec) {
+	if c == nil {
+		c = JSONCodec{}
 	}
-	return v
+	m.codec = c
 }
 
-func (m *MemoryManager) Upsert(_ context.Context, collection, key string, value interface{}) error {
-	b := bytes.NewBuffer(nil)
-	if err := json.NewEncoder(b).Encode(value); err != nil {
+// snapshot copies the items of the collection, so that the caller can read them without holding the lock while
+// other goroutines keep writing.
+func (m *MemoryManager) snapshot(collection string) []memoryItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]memoryItem{}, m.items[collection]...)
+}
+
+// sortedSnapshot is like snapshot but orders the items by key.
+func (m *MemoryManager) sortedSnapshot(collection string) []memoryItem {
+	items := m.snapshot(collection)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
+
+func (m *MemoryManager) Upsert(ctx context.Context, collection, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
-	// no need to evaluate, just create collection if necessary.
-	m.collection(collection)
+	b, err := m.encode(value)
+	if err != nil {
+		return err
+	}
 
-	m.Lock()
-	defer m.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	var found bool
 	for k, i := range m.items[collection] {
 		if i.Key == key {
-			m.items[collection][k].Data = b.Bytes()
+			m.items[collection][k].Data = b
+			m.items[collection][k].UpdatedAt = time.Now().UTC()
 			found = true
 			break
 		}
 	}
 	if !found {
-		m.items[collection] = append(m.items[collection], memoryItem{Key: key, Data: b.Bytes()})
+		m.items[collection] = append(m.items[collection], newMemoryItem(key, b))
+	}
+
+	return nil
+}
+
+// Create writes the value of the key unless the key exists already, in which case it fails with 409.
+func (m *MemoryManager) Create(ctx context.Context, collection, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
 	}
 
+	b, err := m.encode(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.items[collection] {
+		if i.Key == key {
+			return errKeyExists(key)
+		}
+	}
+	m.items[collection] = append(m.items[collection], newMemoryItem(key, b))
 	return nil
 }
 
+// Rename moves the item of oldKey to newKey under the write lock, so that no reader sees both keys or neither.
+func (m *MemoryManager) Rename(ctx context.Context, collection, oldKey, newKey string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found, exists := -1, false
+	for k, i := range m.items[collection] {
+		if i.Key == oldKey {
+			found = k
+		} else if i.Key == newKey {
+			exists = true
+		}
+	}
+	if found < 0 {
+		return errors.WithStack(ErrNotFound)
+	} else if exists {
+		return errRenameTargetExists(oldKey, newKey)
+	}
+
+	doc, err := m.decode(m.items[collection][found].Data)
+	if err != nil {
+		return err
+	}
+	b, err := renameDocument(doc, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	if b, err = m.codec.Encode(b); err != nil {
+		return err
+	}
+
+	m.items[collection][found].Key = newKey
+	m.items[collection][found].Data = b
+	m.items[collection][found].UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (m *MemoryManager) UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	encoded, err := m.encodeAll(kv)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.merge(collection, encoded)
+	return nil
+}
+
+func (m *MemoryManager) Import(ctx context.Context, collection string, kv map[string]interface{}, mode string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := validateImportMode(mode); err != nil {
+		return err
+	}
+
+	encoded, err := m.encodeAll(kv)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mode == ImportModeReplace {
+		m.items[collection] = []memoryItem{}
+	}
+	m.merge(collection, encoded)
+	return nil
+}
+
+// encode encodes the value as JSON and then with the codec.
+func (m *MemoryManager) encode(value interface{}) ([]byte, error) {
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m.codec.Encode(b.Bytes())
+}
+
+// decode decodes the stored document with the codec.
+func (m *MemoryManager) decode(b []byte) (json.RawMessage, error) {
+	return m.codec.Decode(b)
+}
+
+func (m *MemoryManager) encodeAll(kv map[string]interface{}) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, len(kv))
+	for key, value := range kv {
+		b, err := m.encode(value)
+		if err != nil {
+			return nil, errors.WithStack(&KeyError{Key: key, Err: errors.Cause(err)})
+		}
+		encoded[key] = b
+	}
+	return encoded, nil
+}
+
+// merge replaces the documents of existing keys and appends new keys in sorted order. The caller must hold the lock.
+func (m *MemoryManager) merge(collection string, encoded map[string][]byte) {
+	for k, i := range m.items[collection] {
+		if v, ok := encoded[i.Key]; ok {
+			m.items[collection][k].Data = v
+			m.items[collection][k].UpdatedAt = time.Now().UTC()
+			delete(encoded, i.Key)
+		}
+	}
+
+	keys := make([]string, 0, len(encoded))
+	for key := range encoded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.items[collection] = append(m.items[collection], newMemoryItem(key, encoded[key]))
+	}
+}
+
+// update atomically replaces the document stored under key with the result of f.
+func (m *MemoryManager) update(collection, key string, f func([]byte) ([]byte, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, i := range m.items[collection] {
+		if i.Key == key {
+			doc, err := m.decode(i.Data)
+			if err != nil {
+				return err
+			}
+			b, err := f(doc)
+			if err != nil {
+				return err
+			}
+			if b, err = m.codec.Encode(b); err != nil {
+				return err
+			}
+			m.items[collection][k].Data = b
+			m.items[collection][k].UpdatedAt = time.Now().UTC()
+			return nil
+		}
+	}
+
+	return errors.WithStack(ErrNotFound)
+}
+
+func (m *MemoryManager) Patch(ctx context.Context, collection, key string, patch interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return m.update(collection, key, func(b []byte) ([]byte, error) {
+		return applyPatch(b, patch)
+	})
+}
+
+func (m *MemoryManager) AddMember(ctx context.Context, collection, key, member string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return m.update(collection, key, func(b []byte) ([]byte, error) {
+		return addMember(b, member)
+	})
+}
+
+func (m *MemoryManager) RemoveMember(ctx context.Context, collection, key, member string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return m.update(collection, key, func(b []byte) ([]byte, error) {
+		return removeMember(b, member)
+	})
+}
+
+// List lists a page of the values of the collection, ordered by key.
 func (m *MemoryManager) List(ctx context.Context, collection string, value interface{}, limit, offset int) error {
-	c := m.collection(collection)
-	start, end := pagination.Index(limit, offset, len(c))
-	items := m.list(ctx, collection)[start:end]
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// the bounds are computed from the same snapshot which is paginated, so that concurrent deletes can not move
+	// them out of range.
+	sorted := m.sortedSnapshot(collection)
+	start, end := pagination.Index(limit, offset, len(sorted))
+	items := make([]json.RawMessage, 0, end-start)
+	for _, i := range sorted[start:end] {
+		doc, err := m.decode(i.Data)
+		if err != nil {
+			return err
+		}
+		items = append(items, doc)
+	}
 	return roundTrip(&items, value)
 }
 
 func (m *MemoryManager) ListAll(ctx context.Context, collection string, value interface{}) error {
-	items := m.list(ctx, collection)
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	items, err := m.list(ctx, collection)
+	if err != nil {
+		return err
+	}
 	return roundTrip(&items, value)
 }
-func (m *MemoryManager) list(ctx context.Context, collection string) []json.RawMessage {
-	c := m.collection(collection)
+
+// ListAfter lists at most limit values whose keys sort after afterKey, ordered by key.
+func (m *MemoryManager) ListAfter(ctx context.Context, collection string, afterKey string, limit int, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	sorted := make([]memoryItem, 0)
+	for _, i := range m.sortedSnapshot(collection) {
+		if i.Key > afterKey {
+			sorted = append(sorted, i)
+		}
+	}
+
+	_, end := index(limit, 0, len(sorted))
+	items := make([]json.RawMessage, end)
+	for k := range items {
+		doc, err := m.decode(sorted[k].Data)
+		if err != nil {
+			return err
+		}
+		items[k] = doc
+	}
+	return roundTrip(&items, value)
+}
+
+// Stream calls fn with every value of the collection, ordered by key.
+func (m *MemoryManager) Stream(ctx context.Context, collection string, fn func(raw json.RawMessage) error) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, i := range m.sortedSnapshot(collection) {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		doc, err := m.decode(i.Data)
+		if err != nil {
+			return err
+		}
+		// the callback gets its own copy, so that it can not change the stored document.
+		if err := fn(append(json.RawMessage{}, doc...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryManager) Count(ctx context.Context, collection string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.items[collection]), nil
+}
+
+func (m *MemoryManager) list(ctx context.Context, collection string) ([]json.RawMessage, error) {
+	c := m.snapshot(collection)
 	items := make([]json.RawMessage, len(c))
-	m.RLock()
 	for k, i := range c {
-		items[k] = i.Data
+		doc, err := m.decode(i.Data)
+		if err != nil {
+			return nil, err
+		}
+		items[k] = doc
 	}
-	m.RUnlock()
-
-	return items
+	return items, nil
 }
 
-func (m *MemoryManager) Get(_ context.Context, collection, key string, value interface{}) error {
-	c := m.collection(collection)
+func (m *MemoryManager) Get(ctx context.Context, collection, key string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
 
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	var v []byte
-	for _, i := range c {
+	for _, i := range m.items[collection] {
 		if i.Key == key {
 			v = i.Data
 			break
@@ -107,10 +440,15 @@ func (m *MemoryManager) Get(_ context.Context, collection, key string, value int
 	}
 
 	if len(v) == 0 {
-		return errors.WithStack(&herodot.ErrNotFound)
+		return errors.WithStack(ErrNotFound)
+	}
+
+	doc, err := m.decode(v)
+	if err != nil {
+		return err
 	}
 
-	b := bytes.NewBuffer(v)
+	b := bytes.NewBuffer(doc)
 	d := json.NewDecoder(b)
 	d.DisallowUnknownFields()
 	if err := d.Decode(value); err != nil {
@@ -120,24 +458,331 @@ func (m *MemoryManager) Get(_ context.Context, collection, key string, value int
 	return nil
 }
 
-func (m *MemoryManager) Delete(_ context.Context, collection, key string) error {
-	// no need to evaluate, just create collection if necessary.
-	m.collection(collection)
+// Timestamps returns the timestamps of the keys which exist.
+func (m *MemoryManager) Timestamps(ctx context.Context, collection string, keys []string) (map[string]Timestamps, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ts := make(map[string]Timestamps, len(keys))
+	for _, i := range m.items[collection] {
+		if wanted[i.Key] {
+			ts[i.Key] = i.Timestamps
+		}
+	}
+	return ts, nil
+}
+
+func (m *MemoryManager) RolesForMember(ctx context.Context, collection, member string) ([]string, error) {
+	var roles Roles
+	if err := m.ListAll(ctx, collection, &roles); err != nil {
+		return nil, err
+	}
+	return roles.memberOf(member), nil
+}
+
+func (m *MemoryManager) GetMany(ctx context.Context, collection string, keys []string, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	wanted := map[string]bool{}
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	found := map[string]json.RawMessage{}
+	for _, i := range m.snapshot(collection) {
+		if wanted[i.Key] {
+			doc, err := m.decode(i.Data)
+			if err != nil {
+				return err
+			}
+			found[i.Key] = doc
+		}
+	}
+
+	items := inKeyOrder(keys, found)
+	return roundTrip(&items, value)
+}
+
+func (m *MemoryManager) Exists(ctx context.Context, collection, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	m.Lock()
+	for _, i := range m.items[collection] {
+		if i.Key == key {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *MemoryManager) Delete(ctx context.Context, collection, key string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.mu.Lock()
 	for k, i := range m.items[collection] {
 		if i.Key == key {
 			m.items[collection] = append(m.items[collection][:k], m.items[collection][k+1:]...)
 			break
 		}
 	}
-	m.Unlock()
+	m.mu.Unlock()
 
 	return nil
 }
 
+func (m *MemoryManager) DeleteMany(ctx context.Context, collection string, keys []string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	remove := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		remove[key] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := make([]memoryItem, 0, len(m.items[collection]))
+	for _, i := range m.items[collection] {
+		if !remove[i.Key] {
+			items = append(items, i)
+		}
+	}
+	deleted := len(m.items[collection]) - len(items)
+	m.items[collection] = items
+
+	return deleted, nil
+}
+
+func (m *MemoryManager) Clear(ctx context.Context, collection string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := len(m.items[collection])
+	delete(m.items, collection)
+	delete(m.tombstones, collection)
+	return deleted, nil
+}
+
 func (m *MemoryManager) Storage(ctx context.Context, schema string, collections []string) (storage.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	return toRegoStore(ctx, schema, collections, func(i context.Context, s string) ([]json.RawMessage, error) {
-		return m.list(i, s), nil
+		return m.list(i, s)
+	})
+}
+
+// Migrate does nothing because the memory manager has no schema.
+func (m *MemoryManager) Migrate(ctx context.Context) error {
+	return errors.WithStack(ctx.Err())
+}
+
+// MigrationStatus returns no migrations because the memory manager has no schema.
+func (m *MemoryManager) MigrationStatus(ctx context.Context) ([]MigrationInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []MigrationInfo{}, nil
+}
+
+// Ping always succeeds unless the context is done because the memory manager has no backend.
+func (m *MemoryManager) Ping(ctx context.Context) error {
+	return errors.WithStack(ctx.Err())
+}
+
+// SoftDelete moves the entry of the key to the tombstones of the collection.
+func (m *MemoryManager) SoftDelete(ctx context.Context, collection, key string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, i := range m.items[collection] {
+		if i.Key == key {
+			m.items[collection] = append(m.items[collection][:k], m.items[collection][k+1:]...)
+			m.removeTombstone(collection, key)
+			m.tombstones[collection] = append(m.tombstones[collection], Tombstone{Key: key, DeletedAt: time.Now().UTC(), Data: i.Data, CreatedAt: i.CreatedAt})
+			break
+		}
+	}
+	return nil
+}
+
+// Restore moves the tombstone of the key back to the collection.
+func (m *MemoryManager) Restore(ctx context.Context, collection, key string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.items[collection] {
+		if i.Key == key {
+			return conflictf(`Key "%s" can not be restored because it exists already.`, key)
+		}
+	}
+
+	t, ok := m.removeTombstone(collection, key)
+	if !ok {
+		return errors.WithStack(ErrNotFound)
+	}
+	i := newMemoryItem(key, t.Data)
+	if !t.CreatedAt.IsZero() {
+		i.CreatedAt = t.CreatedAt
+	}
+	m.items[collection] = append(m.items[collection], i)
+	return nil
+}
+
+// ListDeleted returns the tombstones of the collection ordered by key.
+func (m *MemoryManager) ListDeleted(ctx context.Context, collection string) ([]Tombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	m.mu.RLock()
+	ts := append([]Tombstone{}, m.tombstones[collection]...)
+	m.mu.RUnlock()
+
+	res := make([]Tombstone, len(ts))
+	for k, t := range ts {
+		doc, err := m.decode(t.Data)
+		if err != nil {
+			return nil, err
+		}
+		t.Data = append(json.RawMessage{}, doc...)
+		res[k] = t
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
 	})
+	return res, nil
+}
+
+// Purge removes the tombstone of the key.
+func (m *MemoryManager) Purge(ctx context.Context, collection, key string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.removeTombstone(collection, key); !ok {
+		return errors.WithStack(ErrNotFound)
+	}
+	return nil
+}
+
+// Compact removes the tombstones deleted before the time. Released memory is reclaimed by the garbage collector and
+// locks are removed as soon as they are released or expire, so there is nothing else to do.
+func (m *MemoryManager) Compact(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var removed int
+	for collection, ts := range m.tombstones {
+		kept := make([]Tombstone, 0, len(ts))
+		for _, t := range ts {
+			if t.DeletedAt.Before(deletedBefore) {
+				removed++
+				continue
+			}
+			kept = append(kept, t)
+		}
+		m.tombstones[collection] = kept
+	}
+	return removed, nil
+}
+
+// removeTombstone removes the tombstone of the key. The caller must hold the write lock.
+func (m *MemoryManager) removeTombstone(collection, key string) (Tombstone, bool) {
+	for k, t := range m.tombstones[collection] {
+		if t.Key == key {
+			m.tombstones[collection] = append(m.tombstones[collection][:k], m.tombstones[collection][k+1:]...)
+			return t, true
+		}
+	}
+	return Tombstone{}, false
+}
+
+// WithTransaction runs f against a copy of all collections and replaces the collections by the copy if f succeeds, so
+// that the writes of a failed transaction are never seen. The manager is locked until f returns, which makes
+// transactions serializable but means that f must not use the manager itself.
+func (m *MemoryManager) WithTransaction(ctx context.Context, f func(tx Manager) error) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if m.transaction {
+		return f(m)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &MemoryManager{
+		items:       make(map[string][]memoryItem, len(m.items)),
+		tombstones:  make(map[string][]Tombstone, len(m.tombstones)),
+		codec:       m.codec,
+		transaction: true,
+		locks:       m.locks,
+	}
+	// the slices are copied because deletes shift their elements in place, the encoded values are never changed.
+	for c, items := range m.items {
+		tx.items[c] = append([]memoryItem{}, items...)
+	}
+	for c, ts := range m.tombstones {
+		tx.tombstones[c] = append([]Tombstone{}, ts...)
+	}
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	m.items, m.tombstones = tx.items, tx.tombstones
+	return nil
+}
+
+// Lock acquires the lock of the key within this process, which is sufficient because the entries of the manager are
+// not shared with other instances either.
+func (m *MemoryManager) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	return m.locks.lock(ctx, key, ttl)
 }
@@ -3,10 +3,16 @@ package storage
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	migrate "github.com/rubenv/sql-migrate"
 
@@ -15,9 +21,10 @@ import (
 )
 
 type sqlItem struct {
-	Key        string `db:"pkey"`
-	Collection string `db:"collection"`
-	Data       string `db:"document"`
+	Key        string    `db:"pkey"`
+	Collection string    `db:"collection"`
+	Data       string    `db:"document"`
+	UpdatedAt  time.Time `db:"updated_at"`
 }
 
 var Migrations = map[string]*migrate.MemoryMigrationSource{
@@ -38,6 +45,53 @@ var Migrations = map[string]*migrate.MemoryMigrationSource{
 					"DROP TABLE rego_data",
 				},
 			},
+			{
+				Id: "2",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS rego_data_tombstones (
+    id 					INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	collection 			VARCHAR(64) NOT NULL,
+	pkey 				VARCHAR(64) NOT NULL,
+	document		 	JSON,
+	deleted_at			TIMESTAMP NOT NULL,
+	UNIQUE KEY rego_data_tombstones_uidx_ck (collection, pkey)
+)`,
+				},
+				Down: []string{
+					"DROP TABLE rego_data_tombstones",
+				},
+			},
+			{
+				Id: "3",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS rego_locks (
+	lock_key 			VARCHAR(255) NOT NULL PRIMARY KEY,
+	token 				VARCHAR(64) NOT NULL,
+	expires_at			TIMESTAMP NOT NULL
+)`,
+				},
+				Down: []string{
+					"DROP TABLE rego_locks",
+				},
+			},
+			{
+				Id: "4",
+				Up: []string{
+					"ALTER TABLE rego_data ADD COLUMN created_at TIMESTAMP(6) NULL, ADD COLUMN updated_at TIMESTAMP(6) NULL",
+				},
+				Down: []string{
+					"ALTER TABLE rego_data DROP COLUMN created_at, DROP COLUMN updated_at",
+				},
+			},
+			{
+				Id: "5",
+				Up: []string{
+					"ALTER TABLE rego_data_tombstones ADD COLUMN created_at TIMESTAMP(6) NULL",
+				},
+				Down: []string{
+					"ALTER TABLE rego_data_tombstones DROP COLUMN created_at",
+				},
+			},
 		},
 	},
 	dbal.DriverPostgreSQL: {
@@ -57,22 +111,174 @@ var Migrations = map[string]*migrate.MemoryMigrationSource{
 					"DROP TABLE rego_data",
 				},
 			},
+			{
+				Id: "2",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS rego_data_tombstones (
+    id 			SERIAL PRIMARY KEY,
+	collection 	VARCHAR(64) NOT NULL,
+	pkey 		VARCHAR(64) NOT NULL,
+	document	JSON,
+	deleted_at	TIMESTAMP NOT NULL
+)`,
+					`CREATE UNIQUE INDEX rego_data_tombstones_uidx_ck ON rego_data_tombstones (collection, pkey)`,
+				},
+				Down: []string{
+					"DROP TABLE rego_data_tombstones",
+				},
+			},
+			{
+				Id: "3",
+				Up: []string{
+					`CREATE TABLE IF NOT EXISTS rego_locks (
+	lock_key 	VARCHAR(255) PRIMARY KEY,
+	token 		VARCHAR(64) NOT NULL,
+	expires_at	TIMESTAMP NOT NULL
+)`,
+				},
+				Down: []string{
+					"DROP TABLE rego_locks",
+				},
+			},
+			{
+				Id: "4",
+				Up: []string{
+					"ALTER TABLE rego_data ADD COLUMN created_at TIMESTAMP NULL, ADD COLUMN updated_at TIMESTAMP NULL",
+				},
+				Down: []string{
+					"ALTER TABLE rego_data DROP COLUMN created_at, DROP COLUMN updated_at",
+				},
+			},
+			{
+				Id: "5",
+				Up: []string{
+					"ALTER TABLE rego_data_tombstones ADD COLUMN created_at TIMESTAMP NULL",
+				},
+				Down: []string{
+					"ALTER TABLE rego_data_tombstones DROP COLUMN created_at",
+				},
+			},
 		},
 	},
 }
 
 type SQLManager struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	codec Codec
+
+	// conn runs the queries. It is the database, or the transaction for the manager WithTransaction passes to its
+	// function, in which case tx is set as well.
+	conn sqlConn
+	tx   *sqlx.Tx
+}
+
+// sqlConn is implemented by *sqlx.DB and *sqlx.Tx.
+type sqlConn interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
 }
 
 func NewSQLManager(db *sqlx.DB) *SQLManager {
 	return &SQLManager{
-		db: db,
+		db:    db,
+		codec: JSONCodec{},
+		conn:  db,
 	}
 }
 
+// sqlCodecPrefix starts the documents which are not stored as plain JSON. Because the document column has the JSON
+// type, they are stored as a JSON string of the prefix, the name of the codec, a colon, and the base64 encoded output
+// of the codec, for example "keto+gzip:H4sI...".
+const sqlCodecPrefix = "keto+"
+
+// SetCodec sets the codec in which new documents are stored. Documents are decoded with the codec named in their
+// prefix, so that documents written with an earlier codec remain readable. Codecs other than JSONCodec keep the
+// database from searching the documents, which makes RolesForMember load the whole collection. Defaults to JSONCodec.
+func (m *SQLManager) SetCodec(c Codec) {
+	if c == nil {
+		c = JSONCodec{}
+	}
+	m.codec = c
+}
+
+// encode encodes the value as JSON and then with the codec.
+func (m *SQLManager) encode(value interface{}) (string, error) {
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(value); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return m.encodeDocument(b.Bytes())
+}
+
+// encodeDocument encodes the JSON document with the codec.
+func (m *SQLManager) encodeDocument(doc []byte) (string, error) {
+	if isPlainJSON(m.codec) {
+		return string(doc), nil
+	}
+
+	b, err := m.codec.Encode(doc)
+	if err != nil {
+		return "", err
+	}
+
+	tagged, err := json.Marshal(sqlCodecPrefix + m.codec.Name() + ":" + base64.StdEncoding.EncodeToString(b))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(tagged), nil
+}
+
+// decode returns the JSON document of the stored document.
+func (m *SQLManager) decode(item string) (json.RawMessage, error) {
+	if !strings.HasPrefix(item, `"`+sqlCodecPrefix) {
+		return json.RawMessage(item), nil
+	}
+
+	var tagged string
+	if err := json.Unmarshal([]byte(item), &tagged); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(tagged, sqlCodecPrefix), ":", 2)
+	if len(parts) != 2 {
+		return json.RawMessage(item), nil
+	}
+
+	c := m.codec
+	if c == nil || c.Name() != parts[0] {
+		var err error
+		if c, err = NewCodec(parts[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c.Decode(b)
+}
+
+// decodeAll returns the JSON documents of the stored documents.
+func (m *SQLManager) decodeAll(items []string) ([]json.RawMessage, error) {
+	ji := make([]json.RawMessage, len(items))
+	for k, v := range items {
+		doc, err := m.decode(v)
+		if err != nil {
+			return nil, err
+		}
+		ji[k] = doc
+	}
+	return ji, nil
+}
+
+// migrationTable is the table in which the applied migrations are recorded.
+const migrationTable = "keto_storage_migration"
+
 func (m *SQLManager) CreateSchemas(db *sqlx.DB) (int, error) {
-	migrate.SetTable("keto_storage_migration")
+	migrate.SetTable(migrationTable)
 	n, err := migrate.Exec(db.DB, dbal.Canonicalize(db.DriverName()), Migrations[dbal.MustCanonicalize(db.DriverName())], migrate.Up)
 	if err != nil {
 		return 0, errors.Wrapf(err, "could not migrate sql schema completely, applied only %d migrations", n)
@@ -80,26 +286,82 @@ func (m *SQLManager) CreateSchemas(db *sqlx.DB) (int, error) {
 	return n, nil
 }
 
-func (m *SQLManager) Upsert(ctx context.Context, collection, key string, value interface{}) error {
-	b := bytes.NewBuffer(nil)
-	if err := json.NewEncoder(b).Encode(value); err != nil {
+// Migrate applies all pending migrations, see CreateSchemas.
+func (m *SQLManager) Migrate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
 		return errors.WithStack(err)
 	}
 
-	var query string
+	_, err := m.CreateSchemas(m.db)
+	return err
+}
+
+// MigrationStatus lists the migrations of the database driver together with the time they were applied at.
+func (m *SQLManager) MigrationStatus(ctx context.Context) ([]MigrationInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	source, ok := Migrations[dbal.Canonicalize(m.db.DriverName())]
+	if !ok {
+		return nil, errors.Errorf("unknown database driver: %s", m.db.DriverName())
+	}
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	migrate.SetTable(migrationTable)
+	records, err := migrate.GetMigrationRecords(m.db.DB, dbal.Canonicalize(m.db.DriverName()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	applied := make(map[string]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Id] = r.AppliedAt
+	}
+
+	status := make([]MigrationInfo, len(migrations))
+	for k, mi := range migrations {
+		status[k] = MigrationInfo{ID: mi.Id}
+		if at, ok := applied[mi.Id]; ok {
+			at := at
+			status[k].Applied = true
+			status[k].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+func (m *SQLManager) upsertQuery() (string, error) {
 	switch database := dbal.Canonicalize(m.db.DriverName()); database {
 	case dbal.DriverMySQL:
-		query = "INSERT INTO rego_data (pkey, collection, document) VALUES (:pkey, :collection, :document) ON DUPLICATE KEY UPDATE document=:document"
+		return "INSERT INTO rego_data (pkey, collection, document, created_at, updated_at) VALUES (:pkey, :collection, :document, :updated_at, :updated_at) ON DUPLICATE KEY UPDATE document=:document, updated_at=:updated_at", nil
 	case dbal.DriverPostgreSQL:
-		query = `INSERT INTO rego_data (pkey, collection, document) VALUES (:pkey, :collection, :document) ON CONFLICT(collection, pkey) DO UPDATE SET document = :document`
+		return `INSERT INTO rego_data (pkey, collection, document, created_at, updated_at) VALUES (:pkey, :collection, :document, :updated_at, :updated_at) ON CONFLICT(collection, pkey) DO UPDATE SET document = :document, updated_at = :updated_at`, nil
 	default:
-		return errors.Errorf("unknown database driver: %s", m.db.DriverName())
+		return "", errors.Errorf("unknown database driver: %s", m.db.DriverName())
 	}
+}
 
-	if _, err := m.db.NamedExecContext(ctx, query, &sqlItem{
+func (m *SQLManager) Upsert(ctx context.Context, collection, key string, value interface{}) error {
+	doc, err := m.encode(value)
+	if err != nil {
+		return err
+	}
+
+	query, err := m.upsertQuery()
+	if err != nil {
+		return err
+	}
+
+	if _, err := m.conn.NamedExecContext(ctx, query, &sqlItem{
 		Key:        key,
 		Collection: collection,
-		Data:       b.String(),
+		Data:       doc,
+		UpdatedAt:  time.Now().UTC(),
 	}); err != nil {
 		return errors.WithStack(err)
 	}
@@ -107,20 +369,225 @@ func (m *SQLManager) Upsert(ctx context.Context, collection, key string, value i
 	return nil
 }
 
+// Create inserts the value of the key. The unique key of rego_data makes it fail with 409 if the key exists already.
+func (m *SQLManager) Create(ctx context.Context, collection, key string, value interface{}) error {
+	doc, err := m.encode(value)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := m.conn.ExecContext(
+		ctx,
+		m.conn.Rebind("INSERT INTO rego_data (collection, pkey, document, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"), collection, key, doc, now, now,
+	); errors.Is(handleError(err), ErrConflict) {
+		return errKeyExists(key)
+	} else if err != nil {
+		return handleError(err)
+	}
+
+	return nil
+}
+
+func (m *SQLManager) UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		return m.upsertAll(ctx, tx, collection, kv)
+	})
+}
+
+func (m *SQLManager) Import(ctx context.Context, collection string, kv map[string]interface{}, mode string) error {
+	if err := validateImportMode(mode); err != nil {
+		return err
+	}
+
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		if mode == ImportModeReplace {
+			if _, err := tx.ExecContext(ctx, m.conn.Rebind("DELETE FROM rego_data WHERE collection=?"), collection); err != nil {
+				return handleError(err)
+			}
+		}
+		return m.upsertAll(ctx, tx, collection, kv)
+	})
+}
+
+// handleError is sqlcon.HandleError but reports missing rows with ErrNotFound and unique violations with ErrConflict,
+// as the Manager contract requires.
+func handleError(err error) error {
+	err = sqlcon.HandleError(err)
+	switch errors.Cause(err) {
+	case sqlcon.ErrNoRows:
+		return errors.WithStack(ErrNotFound)
+	case sqlcon.ErrUniqueViolation:
+		return errors.Wrap(ErrConflict, err.Error())
+	}
+	return err
+}
+
+// transaction runs f in a transaction which is committed if f succeeds and rolled back otherwise. Within
+// WithTransaction, f runs in the surrounding transaction instead.
+func (m *SQLManager) transaction(ctx context.Context, f func(tx *sqlx.Tx) error) error {
+	if m.tx != nil {
+		return f(m.tx)
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return handleError(err)
+	}
+
+	return nil
+}
+
+func (m *SQLManager) upsertAll(ctx context.Context, tx *sqlx.Tx, collection string, kv map[string]interface{}) error {
+	query, err := m.upsertQuery()
+	if err != nil {
+		return err
+	}
+
+	// sorting the keys gives concurrent transactions a consistent lock order.
+	keys := make([]string, 0, len(kv))
+	for key := range kv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		doc, err := m.encode(kv[key])
+		if err != nil {
+			return errors.WithStack(&KeyError{Key: key, Err: errors.Cause(err)})
+		}
+
+		if _, err := tx.NamedExecContext(ctx, query, &sqlItem{
+			Key:        key,
+			Collection: collection,
+			Data:       doc,
+			UpdatedAt:  time.Now().UTC(),
+		}); err != nil {
+			// a failing statement is a problem of the database rather than of the value, so it is not a KeyError.
+			return handleError(err)
+		}
+	}
+
+	return nil
+}
+
+// update atomically replaces the document stored under key with the result of f.
+func (m *SQLManager) update(ctx context.Context, collection, key string, f func([]byte) ([]byte, error)) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		var item string
+		if err := tx.GetContext(
+			ctx,
+			&item,
+			tx.Rebind("SELECT document FROM rego_data WHERE collection=? AND pkey=? FOR UPDATE"), collection, key,
+		); err != nil {
+			return handleError(err)
+		}
+
+		doc, err := m.decode(item)
+		if err != nil {
+			return err
+		}
+
+		b, err := f(doc)
+		if err != nil {
+			return err
+		}
+
+		updated, err := m.encodeDocument(b)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			tx.Rebind("UPDATE rego_data SET document=?, updated_at=? WHERE collection=? AND pkey=?"), updated, time.Now().UTC(), collection, key,
+		); err != nil {
+			return handleError(err)
+		}
+		return nil
+	})
+}
+
+// Rename changes the key of the row in one transaction. The unique index on the key makes the update fail if the new
+// key exists already.
+func (m *SQLManager) Rename(ctx context.Context, collection, oldKey, newKey string) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		var item string
+		if err := tx.GetContext(
+			ctx,
+			&item,
+			tx.Rebind("SELECT document FROM rego_data WHERE collection=? AND pkey=? FOR UPDATE"), collection, oldKey,
+		); err != nil {
+			return handleError(err)
+		}
+
+		doc, err := m.decode(item)
+		if err != nil {
+			return err
+		}
+		b, err := renameDocument(doc, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+		renamed, err := m.encodeDocument(b)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			tx.Rebind("UPDATE rego_data SET pkey=?, document=?, updated_at=? WHERE collection=? AND pkey=?"), newKey, renamed, time.Now().UTC(), collection, oldKey,
+		); errors.Is(handleError(err), ErrConflict) {
+			return errRenameTargetExists(oldKey, newKey)
+		} else if err != nil {
+			return handleError(err)
+		}
+		return nil
+	})
+}
+
+func (m *SQLManager) Patch(ctx context.Context, collection, key string, patch interface{}) error {
+	return m.update(ctx, collection, key, func(b []byte) ([]byte, error) {
+		return applyPatch(b, patch)
+	})
+}
+
+func (m *SQLManager) AddMember(ctx context.Context, collection, key, member string) error {
+	return m.update(ctx, collection, key, func(b []byte) ([]byte, error) {
+		return addMember(b, member)
+	})
+}
+
+func (m *SQLManager) RemoveMember(ctx context.Context, collection, key, member string) error {
+	return m.update(ctx, collection, key, func(b []byte) ([]byte, error) {
+		return removeMember(b, member)
+	})
+}
+
+// List lists a page of the values of the collection, ordered by key.
 func (m *SQLManager) List(ctx context.Context, collection string, value interface{}, limit, offset int) error {
 
 	var items []string
-	query := "SELECT document FROM rego_data WHERE collection=? ORDER BY id ASC LIMIT ? OFFSET ?"
-	if err := m.db.SelectContext(
+	query := "SELECT document FROM rego_data WHERE collection=? ORDER BY pkey ASC LIMIT ? OFFSET ?"
+	if err := m.conn.SelectContext(
 		ctx,
 		&items,
-		m.db.Rebind(query), collection, limit, offset,
+		m.conn.Rebind(query), collection, limit, offset,
 	); err != nil {
-		return sqlcon.HandleError(err)
+		return handleError(err)
 	}
-	ji := make([]json.RawMessage, len(items))
-	for k, v := range items {
-		ji[k] = json.RawMessage(v)
+	ji, err := m.decodeAll(items)
+	if err != nil {
+		return err
 	}
 
 	return roundTrip(&ji, value)
@@ -130,40 +597,215 @@ func (m *SQLManager) ListAll(ctx context.Context, collection string, value inter
 
 	var items []string
 	query := "SELECT document FROM rego_data WHERE collection=? ORDER BY id"
-	if err := m.db.SelectContext(
+	if err := m.conn.SelectContext(
 		ctx,
 		&items,
-		m.db.Rebind(query), collection,
+		m.conn.Rebind(query), collection,
 	); err != nil {
-		return sqlcon.HandleError(err)
+		return handleError(err)
 	}
 
-	ji := make([]json.RawMessage, len(items))
-	for k, v := range items {
-		ji[k] = json.RawMessage(v)
+	ji, err := m.decodeAll(items)
+	if err != nil {
+		return err
 	}
 
 	return roundTrip(&ji, value)
 }
 
+// ListAfter lists at most limit values whose keys sort after afterKey, ordered by key.
+func (m *SQLManager) ListAfter(ctx context.Context, collection string, afterKey string, limit int, value interface{}) error {
+	var items []string
+	query := "SELECT document FROM rego_data WHERE collection=? AND pkey > ? ORDER BY pkey ASC LIMIT ?"
+	if err := m.conn.SelectContext(
+		ctx,
+		&items,
+		m.conn.Rebind(query), collection, afterKey, limit,
+	); err != nil {
+		return handleError(err)
+	}
+
+	ji, err := m.decodeAll(items)
+	if err != nil {
+		return err
+	}
+
+	return roundTrip(&ji, value)
+}
+
+// Stream calls fn with every value of the collection, ordered by key.
+func (m *SQLManager) Stream(ctx context.Context, collection string, fn func(raw json.RawMessage) error) error {
+	query := "SELECT document FROM rego_data WHERE collection=? ORDER BY pkey ASC"
+	rows, err := m.conn.QueryContext(ctx, m.conn.Rebind(query), collection)
+	if err != nil {
+		return handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item string
+		if err := rows.Scan(&item); err != nil {
+			return handleError(err)
+		}
+
+		doc, err := m.decode(item)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+
+	return handleError(rows.Err())
+}
+
+func (m *SQLManager) Count(ctx context.Context, collection string) (int, error) {
+	var n int
+	query := "SELECT COUNT(*) FROM rego_data WHERE collection=?"
+	if err := m.conn.GetContext(
+		ctx,
+		&n,
+		m.conn.Rebind(query), collection,
+	); err != nil {
+		return 0, handleError(err)
+	}
+
+	return n, nil
+}
+
 func (m *SQLManager) Get(ctx context.Context, collection, key string, value interface{}) error {
 	query := "SELECT document FROM rego_data WHERE collection=? AND pkey=?"
 	var item string
-	if err := m.db.GetContext(
+	if err := m.conn.GetContext(
 		ctx,
 		&item,
-		m.db.Rebind(query), collection, key,
+		m.conn.Rebind(query), collection, key,
 	); err != nil {
-		return sqlcon.HandleError(err)
+		return handleError(err)
 	}
 
-	ji := json.RawMessage(item)
+	ji, err := m.decode(item)
+	if err != nil {
+		return err
+	}
 	return roundTrip(&ji, value)
 }
 
+// GetMany selects all keys with a single query.
+func (m *SQLManager) GetMany(ctx context.Context, collection string, keys []string, value interface{}) error {
+	found := map[string]json.RawMessage{}
+	if len(keys) > 0 {
+		query, args, err := sqlx.In("SELECT pkey, document FROM rego_data WHERE collection=? AND pkey IN (?)", collection, keys)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var items []sqlItem
+		if err := m.conn.SelectContext(ctx, &items, m.conn.Rebind(query), args...); err != nil {
+			return handleError(err)
+		}
+		for _, i := range items {
+			doc, err := m.decode(i.Data)
+			if err != nil {
+				return err
+			}
+			found[i.Key] = doc
+		}
+	}
+
+	items := inKeyOrder(keys, found)
+	return roundTrip(&items, value)
+}
+
+// Timestamps selects the timestamps of all keys with a single query. Entries written before the timestamps were
+// recorded have none and are left out.
+func (m *SQLManager) Timestamps(ctx context.Context, collection string, keys []string) (map[string]Timestamps, error) {
+	ts := make(map[string]Timestamps, len(keys))
+	if len(keys) == 0 {
+		return ts, nil
+	}
+
+	query, args, err := sqlx.In("SELECT pkey, created_at, updated_at FROM rego_data WHERE collection=? AND pkey IN (?) AND created_at IS NOT NULL AND updated_at IS NOT NULL", collection, keys)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var items []struct {
+		Key       string    `db:"pkey"`
+		CreatedAt time.Time `db:"created_at"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	if err := m.conn.SelectContext(ctx, &items, m.conn.Rebind(query), args...); err != nil {
+		return nil, handleError(err)
+	}
+	for _, i := range items {
+		ts[i.Key] = Timestamps{CreatedAt: i.CreatedAt.UTC(), UpdatedAt: i.UpdatedAt.UTC()}
+	}
+	return ts, nil
+}
+
+// RolesForMember walks up the role hierarchy with one query per role, so that only the IDs of the containing roles
+// are read instead of the whole collection.
+func (m *SQLManager) RolesForMember(ctx context.Context, collection, member string) ([]string, error) {
+	if !isPlainJSON(m.codec) {
+		var roles Roles
+		if err := m.ListAll(ctx, collection, &roles); err != nil {
+			return nil, err
+		}
+		return roles.memberOf(member), nil
+	}
+
+	var query string
+	switch dbal.Canonicalize(m.db.DriverName()) {
+	case dbal.DriverMySQL:
+		query = "SELECT pkey FROM rego_data WHERE collection=? AND JSON_CONTAINS(JSON_EXTRACT(document, '$.members'), JSON_QUOTE(?))"
+	case dbal.DriverPostgreSQL:
+		query = "SELECT pkey FROM rego_data WHERE collection=? AND (document->'members')::jsonb @> to_jsonb(?::text)"
+	default:
+		return nil, errors.Errorf("unknown database driver: %s", m.db.DriverName())
+	}
+
+	visited := map[string]bool{member: true}
+	res := make([]string, 0)
+	for queue := []string{member}; len(queue) > 0; queue = queue[1:] {
+		var parents []string
+		if err := m.conn.SelectContext(ctx, &parents, m.conn.Rebind(query), collection, queue[0]); err != nil {
+			return nil, handleError(err)
+		}
+		for _, p := range parents {
+			if visited[p] {
+				continue
+			}
+			visited[p] = true
+			res = append(res, p)
+			queue = append(queue, p)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *SQLManager) Exists(ctx context.Context, collection, key string) (bool, error) {
+	query := "SELECT 1 FROM rego_data WHERE collection=? AND pkey=? LIMIT 1"
+	var found int
+	if err := m.conn.GetContext(
+		ctx,
+		&found,
+		m.conn.Rebind(query), collection, key,
+	); errors.Cause(err) == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, handleError(err)
+	}
+
+	return true, nil
+}
+
 func (m *SQLManager) Delete(ctx context.Context, collection, key string) error {
 	query := "DELETE FROM rego_data WHERE pkey=:pkey AND collection=:collection"
-	if _, err := m.db.NamedExecContext(ctx, query, &sqlItem{
+	if _, err := m.conn.NamedExecContext(ctx, query, &sqlItem{
 		Key:        key,
 		Collection: collection,
 	}); err != nil {
@@ -173,16 +815,292 @@ func (m *SQLManager) Delete(ctx context.Context, collection, key string) error {
 	return nil
 }
 
+func (m *SQLManager) DeleteMany(ctx context.Context, collection string, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	// sorting the keys gives concurrent transactions a consistent lock order.
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+
+	var deleted int64
+	query := "DELETE FROM rego_data WHERE pkey=:pkey AND collection=:collection"
+	if err := m.transaction(ctx, func(tx *sqlx.Tx) error {
+		for k, key := range sorted {
+			if k > 0 && sorted[k-1] == key {
+				continue
+			}
+
+			res, err := tx.NamedExecContext(ctx, query, &sqlItem{
+				Key:        key,
+				Collection: collection,
+			})
+			if err != nil {
+				return errors.WithStack(&KeyError{Key: key, Err: err})
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			deleted += n
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
+// Clear deletes the rows and tombstones of the collection in one transaction.
+func (m *SQLManager) Clear(ctx context.Context, collection string) (int, error) {
+	var deleted int64
+	if err := m.transaction(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM rego_data WHERE collection=?"), collection)
+		if err != nil {
+			return handleError(err)
+		}
+		if deleted, err = res.RowsAffected(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tx.ExecContext(ctx, tx.Rebind("DELETE FROM rego_data_tombstones WHERE collection=?"), collection)
+		return handleError(err)
+	}); err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
 func (m *SQLManager) Storage(ctx context.Context, schema string, collections []string) (storage.Store, error) {
 	return toRegoStore(ctx, schema, collections, func(i context.Context, s string) ([]json.RawMessage, error) {
-		var items []json.RawMessage
-		if err := m.db.SelectContext(
+		var items []string
+		if err := m.conn.SelectContext(
 			ctx,
 			&items,
-			m.db.Rebind("SELECT document FROM rego_data WHERE collection=? ORDER BY id ASC"), s,
+			m.conn.Rebind("SELECT document FROM rego_data WHERE collection=? ORDER BY id ASC"), s,
 		); err != nil {
 			return nil, errors.WithStack(err)
 		}
-		return items, nil
+		return m.decodeAll(items)
+	})
+}
+
+// Ping checks the connection to the database.
+func (m *SQLManager) Ping(ctx context.Context) error {
+	return errors.WithStack(m.db.PingContext(ctx))
+}
+
+type sqlTombstone struct {
+	Key       string       `db:"pkey"`
+	Data      string       `db:"document"`
+	DeletedAt time.Time    `db:"deleted_at"`
+	CreatedAt sql.NullTime `db:"created_at"`
+}
+
+// SoftDelete moves the row of the key to the rego_data_tombstones table in one transaction.
+func (m *SQLManager) SoftDelete(ctx context.Context, collection, key string) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		var item sqlTombstone
+		if err := tx.GetContext(
+			ctx,
+			&item,
+			tx.Rebind("SELECT document, created_at FROM rego_data WHERE collection=? AND pkey=? FOR UPDATE"), collection, key,
+		); errors.Cause(err) == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return handleError(err)
+		}
+
+		for _, q := range []struct {
+			query string
+			args  []interface{}
+		}{
+			{query: "DELETE FROM rego_data_tombstones WHERE collection=? AND pkey=?", args: []interface{}{collection, key}},
+			{query: "INSERT INTO rego_data_tombstones (collection, pkey, document, deleted_at, created_at) VALUES (?, ?, ?, ?, ?)", args: []interface{}{collection, key, item.Data, time.Now().UTC(), item.CreatedAt}},
+			{query: "DELETE FROM rego_data WHERE collection=? AND pkey=?", args: []interface{}{collection, key}},
+		} {
+			if _, err := tx.ExecContext(ctx, tx.Rebind(q.query), q.args...); err != nil {
+				return handleError(err)
+			}
+		}
+		return nil
+	})
+}
+
+// Restore moves the tombstone of the key back to the rego_data table in one transaction.
+func (m *SQLManager) Restore(ctx context.Context, collection, key string) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		var item sqlTombstone
+		if err := tx.GetContext(
+			ctx,
+			&item,
+			tx.Rebind("SELECT document, created_at FROM rego_data_tombstones WHERE collection=? AND pkey=? FOR UPDATE"), collection, key,
+		); err != nil {
+			return handleError(err)
+		}
+
+		now := time.Now().UTC()
+		createdAt := now
+		if item.CreatedAt.Valid {
+			createdAt = item.CreatedAt.Time.UTC()
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			tx.Rebind("INSERT INTO rego_data (collection, pkey, document, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"), collection, key, item.Data, createdAt, now,
+		); errors.Is(handleError(err), ErrConflict) {
+			return conflictf(`Key "%s" can not be restored because it exists already.`, key)
+		} else if err != nil {
+			return handleError(err)
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			tx.Rebind("DELETE FROM rego_data_tombstones WHERE collection=? AND pkey=?"), collection, key,
+		); err != nil {
+			return handleError(err)
+		}
+		return nil
+	})
+}
+
+// ListDeleted returns the tombstones of the collection ordered by key.
+func (m *SQLManager) ListDeleted(ctx context.Context, collection string) ([]Tombstone, error) {
+	var items []sqlTombstone
+	if err := m.conn.SelectContext(
+		ctx,
+		&items,
+		m.conn.Rebind("SELECT pkey, document, deleted_at, created_at FROM rego_data_tombstones WHERE collection=? ORDER BY pkey ASC"), collection,
+	); err != nil {
+		return nil, handleError(err)
+	}
+
+	res := make([]Tombstone, len(items))
+	for k, i := range items {
+		doc, err := m.decode(i.Data)
+		if err != nil {
+			return nil, err
+		}
+		res[k] = Tombstone{Key: i.Key, DeletedAt: i.DeletedAt.UTC(), Data: doc, CreatedAt: i.CreatedAt.Time.UTC()}
+	}
+	return res, nil
+}
+
+// Purge removes the tombstone of the key.
+func (m *SQLManager) Purge(ctx context.Context, collection, key string) error {
+	res, err := m.conn.ExecContext(
+		ctx,
+		m.conn.Rebind("DELETE FROM rego_data_tombstones WHERE collection=? AND pkey=?"), collection, key,
+	)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.WithStack(err)
+	} else if n == 0 {
+		return errors.WithStack(ErrNotFound)
+	}
+	return nil
+}
+
+// Compact deletes the old tombstones and the expired locks with one statement each, so that an interrupted compaction
+// leaves no partial state. Afterwards PostgreSQL vacuums and MySQL optimizes the tables, which is skipped within
+// WithTransaction because neither can run in a transaction.
+func (m *SQLManager) Compact(ctx context.Context, deletedBefore time.Time) (int, error) {
+	res, err := m.conn.ExecContext(
+		ctx,
+		m.conn.Rebind("DELETE FROM rego_data_tombstones WHERE deleted_at<?"), deletedBefore.UTC(),
+	)
+	if err != nil {
+		return 0, handleError(err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if _, err := m.conn.ExecContext(
+		ctx,
+		m.conn.Rebind("DELETE FROM rego_locks WHERE expires_at<?"), time.Now().UTC(),
+	); err != nil {
+		return int(removed), handleError(err)
+	}
+
+	if m.tx != nil {
+		return int(removed), nil
+	}
+
+	var queries []string
+	switch dbal.Canonicalize(m.db.DriverName()) {
+	case dbal.DriverPostgreSQL:
+		queries = []string{"VACUUM ANALYZE rego_data", "VACUUM ANALYZE rego_data_tombstones"}
+	case dbal.DriverMySQL:
+		queries = []string{"OPTIMIZE TABLE rego_data, rego_data_tombstones"}
+	}
+	for _, q := range queries {
+		if _, err := m.db.ExecContext(ctx, q); err != nil {
+			return int(removed), handleError(err)
+		}
+	}
+	return int(removed), nil
+}
+
+// Lock acquires the lock of the key by inserting a row into rego_locks, replacing the row of an expired lock, and
+// retries until the lock is free or the context is done. The lock is taken outside of any transaction of the manager
+// so that other instances see it right away.
+func (m *SQLManager) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	token := uuid.New()
+	for {
+		acquired, err := m.tryLock(ctx, key, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() {
+				// the lock is released even if the context of the holder was canceled in the meantime.
+				_, _ = m.db.ExecContext(
+					context.Background(),
+					m.db.Rebind("DELETE FROM rego_locks WHERE lock_key=? AND token=?"), key, token,
+				)
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func (m *SQLManager) tryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	if _, err := m.db.ExecContext(
+		ctx,
+		m.db.Rebind("DELETE FROM rego_locks WHERE lock_key=? AND expires_at<?"), key, now,
+	); err != nil {
+		return false, handleError(err)
+	}
+
+	if _, err := m.db.ExecContext(
+		ctx,
+		m.db.Rebind("INSERT INTO rego_locks (lock_key, token, expires_at) VALUES (?, ?, ?)"), key, token, now.Add(ttl),
+	); errors.Is(handleError(err), ErrConflict) {
+		return false, nil
+	} else if err != nil {
+		return false, handleError(err)
+	}
+	return true, nil
+}
+
+// WithTransaction runs f in a database transaction. The manager passed to f runs all of its queries in the
+// transaction, including those of operations which use a transaction of their own otherwise.
+func (m *SQLManager) WithTransaction(ctx context.Context, f func(tx Manager) error) error {
+	return m.transaction(ctx, func(tx *sqlx.Tx) error {
+		return f(&SQLManager{db: m.db, codec: m.codec, conn: tx, tx: tx})
 	})
 }
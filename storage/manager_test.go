@@ -2,15 +2,19 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v4"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -18,7 +22,8 @@ import (
 )
 
 var managers = map[string]Manager{
-	"memory": NewMemoryManager(),
+	"memory":      NewMemoryManager(),
+	"memory-gzip": newGzipMemoryManager(),
 }
 var m sync.Mutex
 
@@ -104,6 +109,22 @@ func TestMemoryManager(t *testing.T) {
 				assert.Equal(t, 1, len(vs))
 			})
 
+			t.Run("case=create", func(t *testing.T) {
+				var v string
+				require.NoError(t, m.Create(ctx, "test-create", "foo", "bar"))
+				require.NoError(t, m.Get(ctx, "test-create", "foo", &v))
+				assert.Equal(t, "bar", v)
+
+				assert.True(t, errors.Is(m.Create(ctx, "test-create", "foo", "baz"), ErrConflict))
+				require.NoError(t, m.Get(ctx, "test-create", "foo", &v))
+				assert.Equal(t, "bar", v)
+
+				require.NoError(t, m.Create(ctx, "test-create-other", "foo", "baz"))
+				count, err := m.Count(ctx, "test-create")
+				require.NoError(t, err)
+				assert.Equal(t, 1, count)
+			})
+
 			t.Run("case=list", func(t *testing.T) {
 				for i := 0; i < 10; i++ {
 					require.NoError(t, m.Upsert(ctx, "test-list", fmt.Sprintf("list-%d", i), i))
@@ -145,6 +166,83 @@ func TestMemoryManager(t *testing.T) {
 
 			})
 
+			t.Run("case=exists", func(t *testing.T) {
+				found, err := m.Exists(ctx, "test-exists", "foo")
+				require.NoError(t, err)
+				assert.False(t, found)
+
+				require.NoError(t, m.Upsert(ctx, "test-exists", "foo", "bar"))
+				found, err = m.Exists(ctx, "test-exists", "foo")
+				require.NoError(t, err)
+				assert.True(t, found)
+
+				found, err = m.Exists(ctx, "test-exists-other", "foo")
+				require.NoError(t, err)
+				assert.False(t, found)
+			})
+
+			t.Run("case=patch", func(t *testing.T) {
+				require.Error(t, m.Patch(ctx, "test-patch", "foo", map[string]interface{}{"id": "foo"}))
+
+				require.NoError(t, m.Upsert(ctx, "test-patch", "foo", &Policy{ID: "foo", Actions: []string{"read"}, Effect: "allow"}))
+				require.NoError(t, m.Patch(ctx, "test-patch", "foo", map[string]interface{}{
+					"description": "patched",
+					"actions":     map[string]interface{}{"add": []string{"write"}},
+				}))
+
+				var p Policy
+				require.NoError(t, m.Get(ctx, "test-patch", "foo", &p))
+				assert.Equal(t, Policy{ID: "foo", Description: "patched", Actions: []string{"read", "write"}, Effect: "allow"}, p)
+			})
+
+			t.Run("case=members", func(t *testing.T) {
+				require.Error(t, m.AddMember(ctx, "test-members", "role", "alice"))
+				require.Error(t, m.RemoveMember(ctx, "test-members", "role", "alice"))
+
+				require.NoError(t, m.Upsert(ctx, "test-members", "role", &Role{ID: "role", Members: []string{"alice"}}))
+				require.NoError(t, m.AddMember(ctx, "test-members", "role", "bob"))
+				require.NoError(t, m.AddMember(ctx, "test-members", "role", "bob"))
+
+				var r Role
+				require.NoError(t, m.Get(ctx, "test-members", "role", &r))
+				assert.Equal(t, []string{"alice", "bob"}, r.Members)
+
+				require.NoError(t, m.RemoveMember(ctx, "test-members", "role", "alice"))
+				require.Error(t, m.RemoveMember(ctx, "test-members", "role", "alice"))
+
+				require.NoError(t, m.Get(ctx, "test-members", "role", &r))
+				assert.Equal(t, []string{"bob"}, r.Members)
+			})
+
+			t.Run("case=upsertmany", func(t *testing.T) {
+				require.NoError(t, m.Upsert(ctx, "test-upsertmany", "a", "foo"))
+				require.NoError(t, m.UpsertMany(ctx, "test-upsertmany", map[string]interface{}{"a": "bar", "b": "baz"}))
+
+				var v string
+				require.NoError(t, m.Get(ctx, "test-upsertmany", "a", &v))
+				assert.Equal(t, "bar", v)
+				require.NoError(t, m.Get(ctx, "test-upsertmany", "b", &v))
+				assert.Equal(t, "baz", v)
+
+				err := m.UpsertMany(ctx, "test-upsertmany", map[string]interface{}{"c": "c", "d": make(chan int)})
+				require.Error(t, err)
+				require.Error(t, m.Get(ctx, "test-upsertmany", "c", &v))
+			})
+
+			t.Run("case=count", func(t *testing.T) {
+				n, err := m.Count(ctx, "test-count")
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+
+				for i := 0; i < 5; i++ {
+					require.NoError(t, m.Upsert(ctx, "test-count", fmt.Sprintf("count-%d", i), i))
+				}
+
+				n, err = m.Count(ctx, "test-count")
+				require.NoError(t, err)
+				assert.Equal(t, 5, n)
+			})
+
 			t.Run("case=delete", func(t *testing.T) {
 				for i := 0; i < 10; i++ {
 					require.NoError(t, m.Upsert(ctx, "test-delete", fmt.Sprintf("delete-%d", i), i))
@@ -157,6 +255,378 @@ func TestMemoryManager(t *testing.T) {
 				}
 			})
 
+			t.Run("case=stream", func(t *testing.T) {
+				for i := 0; i < 5; i++ {
+					require.NoError(t, m.Upsert(ctx, "test-stream", fmt.Sprintf("stream-%d", i), i))
+				}
+
+				var v []int
+				require.NoError(t, m.Stream(ctx, "test-stream", func(raw json.RawMessage) error {
+					var i int
+					require.NoError(t, json.Unmarshal(raw, &i))
+					v = append(v, i)
+					return nil
+				}))
+				assert.Equal(t, []int{0, 1, 2, 3, 4}, v)
+
+				stop := errors.New("stop")
+				var calls int
+				assert.Equal(t, stop, m.Stream(ctx, "test-stream", func(raw json.RawMessage) error {
+					calls++
+					return stop
+				}))
+				assert.Equal(t, 1, calls)
+			})
+
+			t.Run("case=getmany", func(t *testing.T) {
+				for i := 0; i < 5; i++ {
+					require.NoError(t, m.Upsert(ctx, "test-getmany", fmt.Sprintf("getmany-%d", i), i))
+				}
+
+				var v []int
+				require.NoError(t, m.GetMany(ctx, "test-getmany", nil, &v))
+				assert.Equal(t, []int{}, v)
+
+				require.NoError(t, m.GetMany(ctx, "test-getmany", []string{"getmany-3", "unknown", "getmany-1", "getmany-3"}, &v))
+				assert.Equal(t, []int{3, 1}, v)
+
+				require.NoError(t, m.GetMany(ctx, "test-getmany-other", []string{"getmany-1"}, &v))
+				assert.Equal(t, []int{}, v)
+			})
+
+			t.Run("case=deletemany", func(t *testing.T) {
+				for i := 0; i < 5; i++ {
+					require.NoError(t, m.Upsert(ctx, "test-deletemany", fmt.Sprintf("deletemany-%d", i), i))
+				}
+
+				n, err := m.DeleteMany(ctx, "test-deletemany", nil)
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+
+				n, err = m.DeleteMany(ctx, "test-deletemany", []string{"deletemany-3", "deletemany-1", "deletemany-1", "unknown"})
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+
+				var v []int
+				require.NoError(t, m.ListAll(ctx, "test-deletemany", &v))
+				assert.Equal(t, []int{0, 2, 4}, v)
+
+				n, err = m.DeleteMany(ctx, "test-deletemany", []string{"deletemany-1"})
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+			})
+
+			t.Run("case=clear", func(t *testing.T) {
+				for i := 0; i < 3; i++ {
+					require.NoError(t, m.Upsert(ctx, "test-clear", fmt.Sprintf("clear-%d", i), i))
+				}
+				require.NoError(t, m.SoftDelete(ctx, "test-clear", "clear-2"))
+				require.NoError(t, m.Upsert(ctx, "test-clear-other", "other", 0))
+
+				n, err := m.Clear(ctx, "test-clear")
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+
+				count, err := m.Count(ctx, "test-clear")
+				require.NoError(t, err)
+				assert.Equal(t, 0, count)
+				ts, err := m.ListDeleted(ctx, "test-clear")
+				require.NoError(t, err)
+				assert.Empty(t, ts)
+
+				count, err = m.Count(ctx, "test-clear-other")
+				require.NoError(t, err)
+				assert.Equal(t, 1, count)
+
+				n, err = m.Clear(ctx, "test-clear")
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+			})
+
+			t.Run("case=import", func(t *testing.T) {
+				require.NoError(t, m.UpsertMany(ctx, "test-import", map[string]interface{}{"import-0": 0, "import-1": 1}))
+
+				require.NoError(t, m.Import(ctx, "test-import", map[string]interface{}{"import-1": 10, "import-2": 2}, ImportModeMerge))
+				var v []int
+				require.NoError(t, m.ListAll(ctx, "test-import", &v))
+				assert.Equal(t, []int{0, 10, 2}, v)
+
+				require.NoError(t, m.Import(ctx, "test-import", map[string]interface{}{"import-3": 3}, ImportModeReplace))
+				require.NoError(t, m.ListAll(ctx, "test-import", &v))
+				assert.Equal(t, []int{3}, v)
+
+				require.Error(t, m.Import(ctx, "test-import", nil, "unknown"))
+				require.NoError(t, m.ListAll(ctx, "test-import", &v))
+				assert.Equal(t, []int{3}, v)
+			})
+
+			t.Run("case=listafter", func(t *testing.T) {
+				for _, key := range []string{"c", "a", "d", "b"} {
+					require.NoError(t, m.Upsert(ctx, "test-listafter", key, key))
+				}
+
+				var v []string
+				require.NoError(t, m.ListAfter(ctx, "test-listafter", "", 2, &v))
+				assert.Equal(t, []string{"a", "b"}, v)
+				require.NoError(t, m.ListAfter(ctx, "test-listafter", "b", 2, &v))
+				assert.Equal(t, []string{"c", "d"}, v)
+				require.NoError(t, m.ListAfter(ctx, "test-listafter", "d", 2, &v))
+				assert.Empty(t, v)
+			})
+
+			t.Run("case=softdelete", func(t *testing.T) {
+				for _, key := range []string{"a", "b"} {
+					require.NoError(t, m.Upsert(ctx, "test-softdelete", key, key))
+				}
+
+				require.NoError(t, m.SoftDelete(ctx, "test-softdelete", "b"))
+				require.NoError(t, m.SoftDelete(ctx, "test-softdelete", "unknown"))
+
+				var v []string
+				require.NoError(t, m.ListAll(ctx, "test-softdelete", &v))
+				assert.Equal(t, []string{"a"}, v)
+				exists, err := m.Exists(ctx, "test-softdelete", "b")
+				require.NoError(t, err)
+				assert.False(t, exists)
+
+				ts, err := m.ListDeleted(ctx, "test-softdelete")
+				require.NoError(t, err)
+				require.Len(t, ts, 1)
+				assert.Equal(t, "b", ts[0].Key)
+				assert.JSONEq(t, `"b"`, string(ts[0].Data))
+				assert.WithinDuration(t, time.Now(), ts[0].DeletedAt, time.Minute)
+
+				require.NoError(t, m.Upsert(ctx, "test-softdelete", "b", "b2"))
+				assert.True(t, errors.Is(m.Restore(ctx, "test-softdelete", "b"), ErrConflict))
+				require.NoError(t, m.Delete(ctx, "test-softdelete", "b"))
+
+				require.NoError(t, m.Restore(ctx, "test-softdelete", "b"))
+				var b string
+				require.NoError(t, m.Get(ctx, "test-softdelete", "b", &b))
+				assert.Equal(t, "b", b)
+				assert.True(t, isNotFound(m.Restore(ctx, "test-softdelete", "unknown")))
+
+				require.NoError(t, m.SoftDelete(ctx, "test-softdelete", "a"))
+				require.NoError(t, m.Purge(ctx, "test-softdelete", "a"))
+				assert.True(t, isNotFound(m.Purge(ctx, "test-softdelete", "a")))
+				ts, err = m.ListDeleted(ctx, "test-softdelete")
+				require.NoError(t, err)
+				assert.Empty(t, ts)
+			})
+
+			t.Run("case=compact", func(t *testing.T) {
+				require.NoError(t, m.Upsert(ctx, "test-compact", "a", "a"))
+				require.NoError(t, m.SoftDelete(ctx, "test-compact", "a"))
+
+				n, err := m.Compact(ctx, time.Now().Add(-time.Hour))
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+				ts, err := m.ListDeleted(ctx, "test-compact")
+				require.NoError(t, err)
+				assert.Len(t, ts, 1)
+
+				n, err = m.Compact(ctx, time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				assert.True(t, n >= 1)
+				ts, err = m.ListDeleted(ctx, "test-compact")
+				require.NoError(t, err)
+				assert.Empty(t, ts)
+
+				n, err = m.Compact(ctx, time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+			})
+
+			t.Run("case=rename", func(t *testing.T) {
+				require.NoError(t, m.Upsert(ctx, "test-rename", "editors", &Role{ID: "editors", Members: []string{"alice"}}))
+				require.NoError(t, m.Upsert(ctx, "test-rename", "admins", &Role{ID: "admins", Members: []string{"bob"}}))
+				before, err := m.Timestamps(ctx, "test-rename", []string{"editors"})
+				require.NoError(t, err)
+
+				require.NoError(t, m.Rename(ctx, "test-rename", "editors", "writers"))
+				exists, err := m.Exists(ctx, "test-rename", "editors")
+				require.NoError(t, err)
+				assert.False(t, exists)
+				var r Role
+				require.NoError(t, m.Get(ctx, "test-rename", "writers", &r))
+				assert.Equal(t, Role{ID: "writers", Members: []string{"alice"}}, r)
+				after, err := m.Timestamps(ctx, "test-rename", []string{"writers"})
+				require.NoError(t, err)
+				assert.True(t, before["editors"].CreatedAt.Equal(after["writers"].CreatedAt))
+
+				assert.True(t, errors.Is(m.Rename(ctx, "test-rename", "writers", "admins"), ErrConflict))
+				require.NoError(t, m.Get(ctx, "test-rename", "admins", &r))
+				assert.Equal(t, []string{"bob"}, r.Members)
+
+				assert.True(t, isNotFound(m.Rename(ctx, "test-rename", "editors", "readers")))
+				n, err := m.Count(ctx, "test-rename")
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+			})
+
+			t.Run("case=transaction", func(t *testing.T) {
+				require.NoError(t, m.Upsert(ctx, "test-tx-roles", "admins", &Role{ID: "admins", Members: []string{"alice"}}))
+
+				failed := errors.New("policy is invalid")
+				err := m.WithTransaction(ctx, func(tx Manager) error {
+					require.NoError(t, tx.AddMember(ctx, "test-tx-roles", "admins", "bob"))
+					require.NoError(t, tx.Upsert(ctx, "test-tx-policies", "p1", "p1"))
+					require.NoError(t, tx.Delete(ctx, "test-tx-roles", "admins"))
+					require.NoError(t, tx.WithTransaction(ctx, func(tx Manager) error {
+						return tx.Upsert(ctx, "test-tx-policies", "p2", "p2")
+					}))
+
+					// the transaction sees its own writes.
+					n, err := tx.Count(ctx, "test-tx-policies")
+					require.NoError(t, err)
+					assert.Equal(t, 2, n)
+					return failed
+				})
+				assert.Equal(t, failed, err)
+
+				var r Role
+				require.NoError(t, m.Get(ctx, "test-tx-roles", "admins", &r))
+				assert.Equal(t, []string{"alice"}, r.Members)
+				n, err := m.Count(ctx, "test-tx-policies")
+				require.NoError(t, err)
+				assert.Equal(t, 0, n)
+
+				require.NoError(t, m.WithTransaction(ctx, func(tx Manager) error {
+					if err := tx.AddMember(ctx, "test-tx-roles", "admins", "bob"); err != nil {
+						return err
+					}
+					return tx.Upsert(ctx, "test-tx-policies", "p1", "p1")
+				}))
+
+				require.NoError(t, m.Get(ctx, "test-tx-roles", "admins", &r))
+				assert.Equal(t, []string{"alice", "bob"}, r.Members)
+				n, err = m.Count(ctx, "test-tx-policies")
+				require.NoError(t, err)
+				assert.Equal(t, 1, n)
+			})
+
+			t.Run("case=migrate", func(t *testing.T) {
+				// migrations are idempotent, so migrating an already migrated backend does nothing.
+				require.NoError(t, m.Migrate(ctx))
+				require.NoError(t, m.Migrate(ctx))
+
+				status, err := m.MigrationStatus(ctx)
+				require.NoError(t, err)
+				if strings.HasPrefix(k, "memory") {
+					assert.Empty(t, status)
+				} else {
+					assert.NotEmpty(t, status)
+				}
+				for _, s := range status {
+					assert.True(t, s.Applied, s.ID)
+					assert.NotNil(t, s.AppliedAt, s.ID)
+				}
+			})
+
+			t.Run("case=timestamps", func(t *testing.T) {
+				require.NoError(t, m.Upsert(ctx, "test-timestamps", "1", &Policy{ID: "1"}))
+				ts, err := m.Timestamps(ctx, "test-timestamps", []string{"1", "missing"})
+				require.NoError(t, err)
+				require.Len(t, ts, 1)
+				first := ts["1"]
+				assert.False(t, first.CreatedAt.IsZero())
+				assert.Equal(t, first.CreatedAt, first.UpdatedAt)
+
+				for _, write := range []func() error{
+					func() error { return m.Upsert(ctx, "test-timestamps", "1", &Policy{ID: "1", Effect: "allow"}) },
+					func() error { return m.Patch(ctx, "test-timestamps", "1", map[string]interface{}{"effect": "deny"}) },
+					func() error {
+						return m.UpsertMany(ctx, "test-timestamps", map[string]interface{}{"1": &Policy{ID: "1"}})
+					},
+				} {
+					time.Sleep(10 * time.Millisecond)
+					require.NoError(t, write())
+
+					ts, err := m.Timestamps(ctx, "test-timestamps", []string{"1"})
+					require.NoError(t, err)
+					assert.True(t, ts["1"].CreatedAt.Equal(first.CreatedAt), "%s != %s", ts["1"].CreatedAt, first.CreatedAt)
+					assert.True(t, ts["1"].UpdatedAt.After(first.UpdatedAt), "%s <= %s", ts["1"].UpdatedAt, first.UpdatedAt)
+					first.UpdatedAt = ts["1"].UpdatedAt
+				}
+
+				// restoring a tombstone keeps the time of the creation.
+				require.NoError(t, m.SoftDelete(ctx, "test-timestamps", "1"))
+				time.Sleep(10 * time.Millisecond)
+				require.NoError(t, m.Restore(ctx, "test-timestamps", "1"))
+				ts, err = m.Timestamps(ctx, "test-timestamps", []string{"1"})
+				require.NoError(t, err)
+				assert.True(t, ts["1"].CreatedAt.Equal(first.CreatedAt), "%s != %s", ts["1"].CreatedAt, first.CreatedAt)
+				assert.True(t, ts["1"].UpdatedAt.After(first.UpdatedAt), "%s <= %s", ts["1"].UpdatedAt, first.UpdatedAt)
+
+				require.NoError(t, m.Delete(ctx, "test-timestamps", "1"))
+				ts, err = m.Timestamps(ctx, "test-timestamps", []string{"1"})
+				require.NoError(t, err)
+				assert.Empty(t, ts)
+			})
+
+			t.Run("case=roles_for_member", func(t *testing.T) {
+				require.NoError(t, m.UpsertMany(ctx, "test-member-of", map[string]interface{}{
+					"owners":  &Role{ID: "owners", Members: []string{"admins"}},
+					"admins":  &Role{ID: "admins", Members: []string{"editors", "alice"}},
+					"editors": &Role{ID: "editors", Members: []string{"owners", "alice"}},
+					"readers": &Role{ID: "readers", Members: []string{"bob"}},
+				}))
+
+				ids, err := m.RolesForMember(ctx, "test-member-of", "alice")
+				require.NoError(t, err)
+				assert.Equal(t, []string{"admins", "editors", "owners"}, ids)
+
+				ids, err = m.RolesForMember(ctx, "test-member-of", "carol")
+				require.NoError(t, err)
+				assert.Empty(t, ids)
+			})
+
+			t.Run("case=lock", func(t *testing.T) {
+				unlock, err := m.Lock(ctx, "test-lock/held", time.Minute)
+				require.NoError(t, err)
+
+				short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+				_, err = m.Lock(short, "test-lock/held", time.Minute)
+				require.True(t, errors.Is(err, context.DeadlineExceeded), "%+v", err)
+
+				// other keys are not affected.
+				other, err := m.Lock(ctx, "test-lock/other", time.Minute)
+				require.NoError(t, err)
+				other()
+
+				unlock()
+				unlock, err = m.Lock(ctx, "test-lock/held", time.Minute)
+				require.NoError(t, err)
+				unlock()
+
+				// expired locks are taken over, and releasing them afterwards does not release the new holder.
+				expired, err := m.Lock(ctx, "test-lock/expired", time.Millisecond)
+				require.NoError(t, err)
+				wait, cancel := context.WithTimeout(ctx, 5*time.Second)
+				defer cancel()
+				unlock, err = m.Lock(wait, "test-lock/expired", time.Minute)
+				require.NoError(t, err)
+				expired()
+
+				short, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+				_, err = m.Lock(short, "test-lock/expired", time.Minute)
+				require.True(t, errors.Is(err, context.DeadlineExceeded), "%+v", err)
+				unlock()
+			})
+
+			t.Run("case=canceled", func(t *testing.T) {
+				canceled, cancel := context.WithCancel(ctx)
+				cancel()
+
+				require.True(t, errors.Is(m.Upsert(canceled, "test-canceled", "1", 1), context.Canceled))
+				require.True(t, errors.Is(m.Get(canceled, "test-canceled", "1", new(int)), context.Canceled))
+				require.True(t, errors.Is(m.ListAll(canceled, "test-canceled", new([]int)), context.Canceled))
+				_, err := m.Count(canceled, "test-canceled")
+				require.True(t, errors.Is(err, context.Canceled))
+			})
+
 			t.Run("case=storage", func(t *testing.T) {
 				for i := 0; i < 2; i++ {
 					require.NoError(t, m.Upsert(ctx, "/tests/storage/bars", fmt.Sprintf("list-%d", i), fmt.Sprintf("a-%d", i)))
@@ -180,3 +650,78 @@ func TestMemoryManager(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryManager_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+
+	// run with -race: every operation below reads or writes the same fresh collection at the same time.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("%d-%d", w, i)
+				assert.NoError(t, m.Upsert(ctx, "test-concurrent", key, &Role{ID: key}))
+				if i%5 == 0 {
+					assert.NoError(t, m.Delete(ctx, "test-concurrent", key))
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				var page, all Roles
+				assert.NoError(t, m.List(ctx, "test-concurrent", &page, 10, 5))
+				assert.NoError(t, m.ListAll(ctx, "test-concurrent", &all))
+				assert.NoError(t, m.ListAfter(ctx, "test-concurrent", "3", 10, &page))
+				_, err := m.Count(ctx, "test-concurrent")
+				assert.NoError(t, err)
+				assert.NoError(t, m.Stream(ctx, "test-concurrent", func(raw json.RawMessage) error { return nil }))
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := m.Count(ctx, "test-concurrent")
+	require.NoError(t, err)
+	assert.Equal(t, 8*40, n)
+
+	var all Roles
+	require.NoError(t, m.ListAll(ctx, "test-concurrent", &all))
+	seen := map[string]bool{}
+	for _, r := range all {
+		assert.False(t, seen[r.ID], "%s is listed twice", r.ID)
+		seen[r.ID] = true
+	}
+	assert.Len(t, seen, 8*40)
+}
+
+func TestMemoryManager_Copies(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryManager()
+
+	stored := &Role{ID: "copies", Members: []string{"alice"}}
+	require.NoError(t, m.Upsert(ctx, "test-copies", "copies", stored))
+	stored.Members[0] = "mallory"
+
+	var got Role
+	require.NoError(t, m.Get(ctx, "test-copies", "copies", &got))
+	got.Members[0] = "mallory"
+
+	var listed Roles
+	require.NoError(t, m.ListAll(ctx, "test-copies", &listed))
+	listed[0].Members[0] = "mallory"
+
+	require.NoError(t, m.Stream(ctx, "test-copies", func(raw json.RawMessage) error {
+		for k := range raw {
+			raw[k] = ' '
+		}
+		return nil
+	}))
+
+	var r Role
+	require.NoError(t, m.Get(ctx, "test-copies", "copies", &r))
+	assert.Equal(t, []string{"alice"}, r.Members)
+}
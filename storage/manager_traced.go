@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// TracedManager records a span for every operation of the wrapped Manager. The spans are children of the span in the
+// context passed to the operation and are tagged with the collection, the key and the number of results.
+type TracedManager struct {
+	Manager
+
+	tracer opentracing.Tracer
+}
+
+// NewTracedManager wraps the manager so that its operations are traced by the tracer.
+func NewTracedManager(m Manager, tracer opentracing.Tracer) *TracedManager {
+	return &TracedManager{Manager: m, tracer: tracer}
+}
+
+func (m *TracedManager) start(ctx context.Context, operation, collection string) (opentracing.Span, context.Context) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage."+operation)
+	span.SetTag("collection", collection)
+	return span, ctx
+}
+
+// finish marks the span as failed if there was an error and finishes it.
+func finish(span opentracing.Span, err error) error {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err))
+	}
+	span.Finish()
+	return err
+}
+
+// resultCount returns the length of the slice the value points to.
+func resultCount(value interface{}) int {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		return v.Elem().Len()
+	}
+	return 0
+}
+
+func (m *TracedManager) Get(ctx context.Context, collection string, key string, value interface{}) error {
+	span, ctx := m.start(ctx, "get", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.Get(ctx, collection, key, value))
+}
+
+func (m *TracedManager) Timestamps(ctx context.Context, collection string, keys []string) (map[string]Timestamps, error) {
+	span, ctx := m.start(ctx, "timestamps", collection)
+	ts, err := m.Manager.Timestamps(ctx, collection, keys)
+	span.SetTag("count", len(ts))
+	return ts, finish(span, err)
+}
+
+func (m *TracedManager) RolesForMember(ctx context.Context, collection string, member string) ([]string, error) {
+	span, ctx := m.start(ctx, "roles_for_member", collection)
+	ids, err := m.Manager.RolesForMember(ctx, collection, member)
+	span.SetTag("count", len(ids))
+	return ids, finish(span, err)
+}
+
+func (m *TracedManager) GetMany(ctx context.Context, collection string, keys []string, value interface{}) error {
+	span, ctx := m.start(ctx, "get_many", collection)
+	err := m.Manager.GetMany(ctx, collection, keys, value)
+	span.SetTag("count", resultCount(value))
+	return finish(span, err)
+}
+
+func (m *TracedManager) Exists(ctx context.Context, collection string, key string) (bool, error) {
+	span, ctx := m.start(ctx, "exists", collection)
+	span.SetTag("key", key)
+	exists, err := m.Manager.Exists(ctx, collection, key)
+	span.SetTag("exists", exists)
+	return exists, finish(span, err)
+}
+
+func (m *TracedManager) List(ctx context.Context, collection string, value interface{}, limit, offset int) error {
+	span, ctx := m.start(ctx, "list", collection)
+	span.SetTag("limit", limit)
+	span.SetTag("offset", offset)
+	err := m.Manager.List(ctx, collection, value, limit, offset)
+	span.SetTag("count", resultCount(value))
+	return finish(span, err)
+}
+
+func (m *TracedManager) ListAll(ctx context.Context, collection string, value interface{}) error {
+	span, ctx := m.start(ctx, "list_all", collection)
+	err := m.Manager.ListAll(ctx, collection, value)
+	span.SetTag("count", resultCount(value))
+	return finish(span, err)
+}
+
+func (m *TracedManager) ListAfter(ctx context.Context, collection string, afterKey string, limit int, value interface{}) error {
+	span, ctx := m.start(ctx, "list_after", collection)
+	span.SetTag("limit", limit)
+	err := m.Manager.ListAfter(ctx, collection, afterKey, limit, value)
+	span.SetTag("count", resultCount(value))
+	return finish(span, err)
+}
+
+func (m *TracedManager) Stream(ctx context.Context, collection string, fn func(raw json.RawMessage) error) error {
+	span, ctx := m.start(ctx, "stream", collection)
+	var n int
+	err := m.Manager.Stream(ctx, collection, func(raw json.RawMessage) error {
+		n++
+		return fn(raw)
+	})
+	span.SetTag("count", n)
+	return finish(span, err)
+}
+
+func (m *TracedManager) Count(ctx context.Context, collection string) (int, error) {
+	span, ctx := m.start(ctx, "count", collection)
+	n, err := m.Manager.Count(ctx, collection)
+	span.SetTag("count", n)
+	return n, finish(span, err)
+}
+
+func (m *TracedManager) Upsert(ctx context.Context, collection string, key string, value interface{}) error {
+	span, ctx := m.start(ctx, "upsert", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.Upsert(ctx, collection, key, value))
+}
+
+func (m *TracedManager) Create(ctx context.Context, collection string, key string, value interface{}) error {
+	span, ctx := m.start(ctx, "create", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.Create(ctx, collection, key, value))
+}
+
+func (m *TracedManager) UpsertMany(ctx context.Context, collection string, kv map[string]interface{}) error {
+	span, ctx := m.start(ctx, "upsert_many", collection)
+	span.SetTag("count", len(kv))
+	return finish(span, m.Manager.UpsertMany(ctx, collection, kv))
+}
+
+func (m *TracedManager) Import(ctx context.Context, collection string, kv map[string]interface{}, mode string) error {
+	span, ctx := m.start(ctx, "import", collection)
+	span.SetTag("count", len(kv))
+	span.SetTag("mode", mode)
+	return finish(span, m.Manager.Import(ctx, collection, kv, mode))
+}
+
+func (m *TracedManager) Patch(ctx context.Context, collection string, key string, patch interface{}) error {
+	span, ctx := m.start(ctx, "patch", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.Patch(ctx, collection, key, patch))
+}
+
+func (m *TracedManager) AddMember(ctx context.Context, collection string, key string, member string) error {
+	span, ctx := m.start(ctx, "add_member", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.AddMember(ctx, collection, key, member))
+}
+
+func (m *TracedManager) RemoveMember(ctx context.Context, collection string, key string, member string) error {
+	span, ctx := m.start(ctx, "remove_member", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.RemoveMember(ctx, collection, key, member))
+}
+
+func (m *TracedManager) Delete(ctx context.Context, collection string, key string) error {
+	span, ctx := m.start(ctx, "delete", collection)
+	span.SetTag("key", key)
+	return finish(span, m.Manager.Delete(ctx, collection, key))
+}
+
+func (m *TracedManager) DeleteMany(ctx context.Context, collection string, keys []string) (int, error) {
+	span, ctx := m.start(ctx, "delete_many", collection)
+	n, err := m.Manager.DeleteMany(ctx, collection, keys)
+	span.SetTag("count", n)
+	return n, finish(span, err)
+}
+
+func (m *TracedManager) Clear(ctx context.Context, collection string) (int, error) {
+	span, ctx := m.start(ctx, "clear", collection)
+	n, err := m.Manager.Clear(ctx, collection)
+	span.SetTag("count", n)
+	return n, finish(span, err)
+}
+
+func (m *TracedManager) Migrate(ctx context.Context) error {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage.migrate")
+	return finish(span, m.Manager.Migrate(ctx))
+}
+
+func (m *TracedManager) Ping(ctx context.Context) error {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage.ping")
+	return finish(span, m.Manager.Ping(ctx))
+}
+
+func (m *TracedManager) Compact(ctx context.Context, deletedBefore time.Time) (int, error) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage.compact")
+	n, err := m.Manager.Compact(ctx, deletedBefore)
+	span.SetTag("count", n)
+	return n, finish(span, err)
+}
+
+func (m *TracedManager) Rename(ctx context.Context, collection string, oldKey, newKey string) error {
+	span, ctx := m.start(ctx, "rename", collection)
+	return finish(span, m.Manager.Rename(ctx, collection, oldKey, newKey))
+}
+
+func (m *TracedManager) SoftDelete(ctx context.Context, collection string, key string) error {
+	span, ctx := m.start(ctx, "soft_delete", collection)
+	return finish(span, m.Manager.SoftDelete(ctx, collection, key))
+}
+
+func (m *TracedManager) Restore(ctx context.Context, collection string, key string) error {
+	span, ctx := m.start(ctx, "restore", collection)
+	return finish(span, m.Manager.Restore(ctx, collection, key))
+}
+
+func (m *TracedManager) ListDeleted(ctx context.Context, collection string) ([]Tombstone, error) {
+	span, ctx := m.start(ctx, "list_deleted", collection)
+	ts, err := m.Manager.ListDeleted(ctx, collection)
+	span.SetTag("count", len(ts))
+	return ts, finish(span, err)
+}
+
+func (m *TracedManager) Purge(ctx context.Context, collection string, key string) error {
+	span, ctx := m.start(ctx, "purge", collection)
+	return finish(span, m.Manager.Purge(ctx, collection, key))
+}
+
+// WithTransaction records a span for the whole transaction. The manager passed to f is traced as well.
+func (m *TracedManager) WithTransaction(ctx context.Context, f func(tx Manager) error) error {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage.transaction")
+	return finish(span, m.Manager.WithTransaction(ctx, func(tx Manager) error {
+		return f(&TracedManager{Manager: tx, tracer: m.tracer})
+	}))
+}
+
+func (m *TracedManager) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, m.tracer, "storage.lock")
+	span.SetTag("key", key)
+	unlock, err := m.Manager.Lock(ctx, key, ttl)
+	return unlock, finish(span, err)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// MatchCountRequest is a request for the number of policies matching an access request.
+type MatchCountRequest struct {
+	Collection string
+
+	Subject  string
+	Action   string
+	Resource string
+
+	// Flavor is the pattern syntax of the policies, see WithEvaluatorFlavor.
+	Flavor string
+}
+
+// MatchCount is the number of allow and deny policies matching an access request, see Handler.MatchCount.
+//
+// swagger:ignore
+type MatchCount struct {
+	// Allow is the number of matching allow policies.
+	Allow int `json:"allow"`
+
+	// Deny is the number of matching deny policies.
+	Deny int `json:"deny"`
+
+	// AllowedBy and DeniedBy are the IDs of the matching policies. They are only set if verbose is true.
+	AllowedBy []string `json:"allowed_by,omitempty"`
+	DeniedBy  []string `json:"denied_by,omitempty"`
+}
+
+// MatchCount responds with the number of policies of the collection matching the subject, action, and resource of the
+// request, using the same matching as the decision of an Evaluator except that conditions are not evaluated because
+// the request has no context. Policies outside of their validity window do not match. It helps to find resources
+// which are guarded by suspiciously many or no policies. The IDs of the matching policies are included if the query
+// parameter "verbose" is true.
+func (h *Handler) MatchCount(factory func(context.Context, *http.Request, httprouter.Params) (*MatchCountRequest, error)) httprouter.Handle {
+	return h.instrument("match_count", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		m, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, m.Collection)
+
+		if err := validateCollection(m.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		for _, q := range []struct{ name, value string }{
+			{name: "subject", value: m.Subject},
+			{name: "action", value: m.Action},
+			{name: "resource", value: m.Resource},
+		} {
+			if q.value == "" {
+				h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" must be set.`, q.name)))
+				return
+			}
+		}
+
+		verbose, err := boolQuery(r, "verbose")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		var policies Policies
+		if err := h.s.ListAll(ctx, m.Collection, &policies); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		d := evaluate(policies, []string{m.Subject}, m.Action, m.Resource, m.Flavor, time.Now(), nil, false, nil)
+
+		res := &MatchCount{Allow: len(d.AllowedBy), Deny: len(d.DeniedBy)}
+		if verbose {
+			res.AllowedBy, res.DeniedBy = d.AllowedBy, d.DeniedBy
+		}
+
+		h.auditRead(ctx, m.Subject)
+		h.h.Write(w, r, res)
+	})
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestMatchCount(t *testing.T) {
+	const collection = "/tests/match/policies"
+
+	m := NewMemoryManager()
+	require.NoError(t, m.UpsertMany(context.Background(), collection, map[string]interface{}{
+		"allow-read":  &Policy{ID: "allow-read", Subjects: []string{"alice", "bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		"allow-all":   &Policy{ID: "allow-all", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: "allow"},
+		"deny-bob":    &Policy{ID: "deny-bob", Subjects: []string{"bob"}, Resources: []string{"<art.*>"}, Actions: []string{"read"}, Effect: "deny"},
+		"allow-write": &Policy{ID: "allow-write", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow"},
+	}))
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/match", h.MatchCount(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*MatchCountRequest, error) {
+		q := r.URL.Query()
+		return &MatchCountRequest{Collection: collection, Subject: q.Get("subject"), Action: q.Get("action"), Resource: q.Get("resource")}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for k, tc := range []struct {
+		query    string
+		code     int
+		expected MatchCount
+	}{
+		{query: "?subject=alice&action=read&resource=articles", code: http.StatusOK, expected: MatchCount{Allow: 2}},
+		{query: "?subject=bob&action=read&resource=articles", code: http.StatusOK, expected: MatchCount{Allow: 2, Deny: 1}},
+		{query: "?subject=bob&action=read&resource=articles&verbose=true", code: http.StatusOK, expected: MatchCount{Allow: 2, Deny: 1, AllowedBy: []string{"allow-all", "allow-read"}, DeniedBy: []string{"deny-bob"}}},
+		{query: "?subject=alice&action=write&resource=articles&verbose=true", code: http.StatusOK, expected: MatchCount{Allow: 2, AllowedBy: []string{"allow-all", "allow-write"}}},
+		{query: "?subject=carol&action=read&resource=comments", code: http.StatusOK, expected: MatchCount{Allow: 1}},
+		{query: "?subject=alice&action=read", code: http.StatusBadRequest},
+		{query: "?subject=alice&action=read&resource=articles&verbose=maybe", code: http.StatusBadRequest},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := ts.Client().Get(ts.URL + "/match" + tc.query)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var c MatchCount
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&c))
+			assert.ElementsMatch(t, tc.expected.AllowedBy, c.AllowedBy)
+			assert.ElementsMatch(t, tc.expected.DeniedBy, c.DeniedBy)
+			assert.Equal(t, tc.expected.Allow, c.Allow)
+			assert.Equal(t, tc.expected.Deny, c.Deny)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// membersParam is the query parameter which controls how the members of roles are written in the responses of
+	// Get and List.
+	membersParam = "members"
+
+	// MembersFull writes the members of roles as they are. This is the default.
+	MembersFull = "full"
+
+	// MembersCount replaces the members of roles by their number.
+	MembersCount = "count"
+)
+
+// countMembers replaces the field "members" of the encoded value by the field "member_count" with the number of
+// members if the query parameter "members" is "count". Lists are changed element by element and the other fields are
+// left as they are, so are values without members. Without the parameter, or if it is "full", the value is returned
+// as it is.
+func countMembers(r *http.Request, e interface{}) (interface{}, error) {
+	switch v := r.URL.Query().Get(membersParam); v {
+	case "", MembersFull:
+		return e, nil
+	case MembersCount:
+	default:
+		return nil, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Query parameter "%s" must be one of "%s" or "%s" but got "%s".`, membersParam, MembersFull, MembersCount, v))
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return mapValues(b, func(v json.RawMessage) (json.RawMessage, error) {
+		res, _, err := mapFields(v, func(key string, v json.RawMessage) (string, json.RawMessage, bool, error) {
+			if key != "members" {
+				return key, v, true, nil
+			}
+
+			var members []json.RawMessage
+			if err := json.Unmarshal(v, &members); err != nil {
+				return key, v, true, nil
+			}
+			return "member_count", json.RawMessage(strconv.Itoa(len(members))), true, nil
+		})
+		return res, err
+	})
+}
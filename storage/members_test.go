@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestMemberCount(t *testing.T) {
+	const collection = "/tests/members/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	many := make([]string, 1000)
+	for k := range many {
+		many[k] = fmt.Sprintf("user-%d", k)
+	}
+	ctx := context.Background()
+	require.NoError(t, m.Upsert(ctx, collection, "many", &Role{ID: "many", Description: "d", Members: many}))
+	require.NoError(t, m.Upsert(ctx, collection, "none", &Role{ID: "none"}))
+	require.NoError(t, m.Upsert(ctx, collection, "one", &Role{ID: "one", Members: []string{"alice"}}))
+
+	get := func(t *testing.T, path string, code int) []byte {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, code, res.StatusCode, "%s", body)
+		return body
+	}
+
+	t.Run("case=count matches the members", func(t *testing.T) {
+		var full []Role
+		require.NoError(t, json.Unmarshal(get(t, "/roles", http.StatusOK), &full))
+
+		var counted []map[string]interface{}
+		require.NoError(t, json.Unmarshal(get(t, "/roles?members=count", http.StatusOK), &counted))
+
+		require.Len(t, counted, len(full))
+		for k, role := range full {
+			assert.Equal(t, role.ID, counted[k]["id"])
+			assert.EqualValues(t, len(role.Members), counted[k]["member_count"], role.ID)
+			assert.NotContains(t, counted[k], "members")
+		}
+		assert.EqualValues(t, 1000, counted[0]["member_count"])
+	})
+
+	t.Run("case=get", func(t *testing.T) {
+		assert.JSONEq(t, `{"id":"many","description":"d","member_count":1000}`, string(get(t, "/roles/many?members=count", http.StatusOK)))
+		assert.JSONEq(t, `{"id":"none","description":"","member_count":0}`, string(get(t, "/roles/none?members=count", http.StatusOK)))
+	})
+
+	t.Run("case=full by default", func(t *testing.T) {
+		assert.JSONEq(t, `{"id":"one","description":"","members":["alice"]}`, string(get(t, "/roles/one", http.StatusOK)))
+		assert.JSONEq(t, `{"id":"one","description":"","members":["alice"]}`, string(get(t, "/roles/one?members=full", http.StatusOK)))
+	})
+
+	t.Run("case=with fields", func(t *testing.T) {
+		assert.JSONEq(t, `[{"id":"many","member_count":1000},{"id":"none","member_count":0},{"id":"one","member_count":1}]`,
+			string(get(t, "/roles?members=count&fields=id,member_count", http.StatusOK)))
+	})
+
+	t.Run("case=with filter", func(t *testing.T) {
+		assert.JSONEq(t, `[{"id":"one","description":"","member_count":1}]`, string(get(t, "/roles?member=alice&members=count", http.StatusOK)))
+	})
+
+	t.Run("case=invalid", func(t *testing.T) {
+		get(t, "/roles?members=some", http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics measures the latency and the failures of the requests served by a Handler. Requests are labeled by the
+// operation and by the type of the collection, which is the last segment of its name, for example "policies".
+// Lists are labeled "list" if the backend paginates, "list_filtered" if the whole collection is loaded to apply
+// filters, and "list_streamed" if the collection is streamed. Slow filtered queries are counted by collection type, see
+// WithSlowQueryThreshold.
+type Metrics struct {
+	duration    *prometheus.HistogramVec
+	failures    *prometheus.CounterVec
+	slowQueries *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with the registerer.
+func NewMetrics(r prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "keto",
+			Subsystem: "storage",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of storage requests by operation and collection type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "collection"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keto",
+			Subsystem: "storage",
+			Name:      "request_failures_total",
+			Help:      "Number of storage requests which failed with a client (4xx) or server (5xx) error.",
+		}, []string{"operation", "collection", "class"}),
+		slowQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keto",
+			Subsystem: "storage",
+			Name:      "slow_queries_total",
+			Help:      "Number of filtered queries which loaded the whole collection and took longer than the slow query threshold.",
+		}, []string{"collection"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.duration, m.failures, m.slowQueries} {
+		if err := r.Register(c); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return m, nil
+}
+
+// WithMetrics sets the metrics which measure the requests served by the handler. Requests are not measured by
+// default.
+func WithMetrics(m *Metrics) HandlerOption {
+	return func(h *Handler) {
+		h.metrics = m
+	}
+}
+
+func (m *Metrics) observe(o *operation, code int, took time.Duration) {
+	if m == nil {
+		return
+	}
+
+	collection := "unknown"
+	if o.collection != "" {
+		collection = path.Base(o.collection)
+	}
+
+	m.duration.WithLabelValues(o.name, collection).Observe(took.Seconds())
+	switch {
+	case code >= 500:
+		m.failures.WithLabelValues(o.name, collection, "5xx").Inc()
+	case code >= 400:
+		m.failures.WithLabelValues(o.name, collection, "4xx").Inc()
+	}
+}
+
+func (m *Metrics) slowQuery(collection string) {
+	if m == nil {
+		return
+	}
+	m.slowQueries.WithLabelValues(collection).Inc()
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	s := NewMemoryManager()
+	h := NewHandler(s, herodot.NewJSONWriter(nil), WithMetrics(metrics))
+	r := httprouter.New()
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "/tests/metrics/roles", Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		return &ListRequest{Collection: "/tests/metrics/roles", Value: new(Roles), FilterFunc: ListByQuery}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, s.Upsert(context.Background(), "/tests/metrics/roles", "foo", &Role{ID: "foo", Members: []string{"bar"}}))
+	for _, path := range []string{"/roles/foo", "/roles/foo", "/roles/unknown", "/roles", "/roles?member=bar"} {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.duration))
+	for _, tc := range []struct {
+		operation string
+		count     uint64
+	}{
+		{operation: "get", count: 3},
+		{operation: "list", count: 1},
+		{operation: "list_filtered", count: 1},
+	} {
+		h, ok := metrics.duration.WithLabelValues(tc.operation, "roles").(prometheus.Histogram)
+		require.True(t, ok)
+		assert.Equal(t, tc.count, histogramCount(t, h), tc.operation)
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.failures.WithLabelValues("get", "roles", "4xx")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.failures.WithLabelValues("get", "roles", "5xx")))
+}
+
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	ch := make(chan prometheus.Metric, 1)
+	h.Collect(ch)
+
+	var m dto.Metric
+	require.NoError(t, (<-ch).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,15 @@
+package storage
+
+import "time"
+
+// MigrationInfo describes a schema migration of a backend and whether it has been applied.
+type MigrationInfo struct {
+	// ID identifies the migration. Migrations are applied in the order of their IDs.
+	ID string `json:"id"`
+
+	// Applied is true if the migration has been applied.
+	Applied bool `json:"applied"`
+
+	// AppliedAt is when the migration was applied. It is nil for pending migrations.
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
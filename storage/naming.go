@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+const (
+	// NamingSnakeCase writes the fields of responses as they are declared, for example "effective_members". This is
+	// the default.
+	NamingSnakeCase = "snake_case"
+
+	// NamingCamelCase writes the fields of responses in camel case, for example "effectiveMembers".
+	NamingCamelCase = "camelCase"
+)
+
+// opaqueFields are fields whose values are objects with keys chosen by clients, such as the names of the conditions
+// of a policy, which are never renamed.
+var opaqueFields = map[string]bool{"conditions": true, "context": true}
+
+// WithNaming sets the naming convention of the fields of JSON and YAML responses, NamingSnakeCase or NamingCamelCase.
+// Anything but NamingCamelCase keeps the field names as they are declared. With NamingCamelCase, the request bodies
+// of Upsert, Create, UpsertMany, Patch and Import may use either convention. Error responses are never renamed.
+func WithNaming(naming string) HandlerOption {
+	return func(h *Handler) {
+		h.naming = naming
+	}
+}
+
+// namingWriter writes the responses of the wrapped writer with the fields renamed to camel case.
+type namingWriter struct {
+	herodot.Writer
+}
+
+func (n *namingWriter) Write(w http.ResponseWriter, r *http.Request, e interface{}) {
+	n.WriteCode(w, r, http.StatusOK, e)
+}
+
+func (n *namingWriter) WriteCode(w http.ResponseWriter, r *http.Request, code int, e interface{}) {
+	b, err := toCamelCase(e)
+	if err != nil {
+		n.Writer.WriteError(w, r, err)
+		return
+	}
+	n.Writer.WriteCode(w, r, code, b)
+}
+
+func (n *namingWriter) WriteCreated(w http.ResponseWriter, r *http.Request, location string, e interface{}) {
+	b, err := toCamelCase(e)
+	if err != nil {
+		n.Writer.WriteError(w, r, err)
+		return
+	}
+	n.Writer.WriteCreated(w, r, location, b)
+}
+
+// toCamelCase encodes the value and renames its fields to camel case.
+func toCamelCase(e interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return renameFields(b, camelCase)
+}
+
+// decodeNamedBody renames the fields of a request body written in camel case to snake case, so that the factories
+// decode either convention. Bodies of newline delimited JSON are renamed line by line and lines which are not JSON are
+// left for the factory to reject. It does nothing unless the naming convention is NamingCamelCase.
+func (h *Handler) decodeNamedBody(r *http.Request) error {
+	if h.naming != NamingCamelCase || r.Body == nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if json.Valid(b) {
+		if b, err = renameFields(b, snakeCase); err != nil {
+			return err
+		}
+	} else {
+		lines := bytes.Split(b, []byte("\n"))
+		for k, line := range lines {
+			if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && json.Valid(trimmed) {
+				if lines[k], err = renameFields(trimmed, snakeCase); err != nil {
+					return err
+				}
+			}
+		}
+		b = bytes.Join(lines, []byte("\n"))
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	return nil
+}
+
+// renameFields renames the fields of all objects of the encoded value, except within opaque fields.
+func renameFields(b json.RawMessage, rename func(string) string) (json.RawMessage, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return b, nil
+	}
+
+	switch b[0] {
+	case '[':
+		return mapValues(b, func(v json.RawMessage) (json.RawMessage, error) {
+			return renameFields(v, rename)
+		})
+	case '{':
+		res, _, err := mapFields(b, func(key string, v json.RawMessage) (string, json.RawMessage, bool, error) {
+			renamed := rename(key)
+			if opaqueFields[snakeCase(key)] {
+				return renamed, v, true, nil
+			}
+			v, err := renameFields(v, rename)
+			return renamed, v, true, err
+		})
+		return res, err
+	}
+	return b, nil
+}
+
+// camelCase converts "effective_members" to "effectiveMembers".
+func camelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for k := 1; k < len(parts); k++ {
+		if parts[k] != "" {
+			parts[k] = strings.ToUpper(parts[k][:1]) + parts[k][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// snakeCase converts "effectiveMembers" to "effective_members". Names in snake case are returned as they are.
+func snakeCase(s string) string {
+	var b strings.Builder
+	for k, c := range s {
+		if unicode.IsUpper(c) {
+			if k > 0 {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestRenameFields(t *testing.T) {
+	for _, tc := range []struct{ snake, camel string }{
+		{snake: "id", camel: "id"},
+		{snake: "effective_members", camel: "effectiveMembers"},
+		{snake: "next_page_token", camel: "nextPageToken"},
+	} {
+		assert.Equal(t, tc.camel, camelCase(tc.snake))
+		assert.Equal(t, tc.snake, snakeCase(tc.camel))
+		assert.Equal(t, tc.snake, snakeCase(tc.snake))
+	}
+
+	const (
+		snake = `{"items":[{"id":"p","created_at":"x","conditions":{"remote_ip":{"type":"CIDRCondition","options":{"cidr_range":"10.0.0.0/8"}}}}],"next_page_token":"t"}`
+		camel = `{"items":[{"id":"p","createdAt":"x","conditions":{"remote_ip":{"type":"CIDRCondition","options":{"cidr_range":"10.0.0.0/8"}}}}],"nextPageToken":"t"}`
+	)
+
+	res, err := renameFields([]byte(snake), camelCase)
+	require.NoError(t, err)
+	assert.Equal(t, camel, string(res), "the keys of conditions are kept")
+
+	res, err = renameFields([]byte(camel), snakeCase)
+	require.NoError(t, err)
+	assert.Equal(t, snake, string(res))
+
+	res, err = renameFields([]byte(`["a",1,null]`), camelCase)
+	require.NoError(t, err)
+	assert.Equal(t, `["a",1,null]`, string(res))
+}
+
+func TestNaming(t *testing.T) {
+	const collection = "/tests/naming/entries"
+
+	type entry struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	}
+
+	for _, tc := range []struct {
+		naming, body string
+	}{
+		{naming: NamingSnakeCase, body: `{"id":"a","display_name":"Alice"}`},
+		{naming: NamingCamelCase, body: `{"id":"a","display_name":"Alice"}`},
+		{naming: NamingCamelCase, body: `{"id":"a","displayName":"Alice"}`},
+	} {
+		t.Run("naming="+tc.naming, func(t *testing.T) {
+			m := NewMemoryManager()
+			h := NewHandler(m, herodot.NewJSONWriter(nil), WithNaming(tc.naming))
+			r := httprouter.New()
+			r.PUT("/", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+				var e entry
+				d := json.NewDecoder(r.Body)
+				d.DisallowUnknownFields()
+				if err := d.Decode(&e); err != nil {
+					return nil, herodot.ErrBadRequest.WithReason(err.Error())
+				}
+				return &UpsertRequest{Collection: collection, Key: e.ID, Value: &e}, nil
+			}))
+			r.GET("/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+				return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(entry)}, nil
+			}))
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest("PUT", ts.URL+"/", bytes.NewBufferString(tc.body))
+			require.NoError(t, err)
+			res, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			put, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode, "%s", put)
+
+			var stored entry
+			require.NoError(t, m.Get(context.Background(), collection, "a", &stored))
+			assert.Equal(t, entry{ID: "a", DisplayName: "Alice"}, stored)
+
+			res, err = ts.Client().Get(ts.URL + "/a")
+			require.NoError(t, err)
+			got, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			res.Body.Close()
+
+			expected := `{"id":"a","display_name":"Alice"}`
+			if tc.naming == NamingCamelCase {
+				expected = `{"id":"a","displayName":"Alice"}`
+			}
+			assert.JSONEq(t, expected, string(got))
+			assert.JSONEq(t, expected, string(put))
+		})
+	}
+}
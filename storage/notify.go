@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/logrusx"
+)
+
+// DefaultWebhookBackoff is the delay before the first retry of a webhook delivery. It doubles with every retry.
+const DefaultWebhookBackoff = 500 * time.Millisecond
+
+// webhookQueueSize is the number of events a WebhookNotifier holds before it drops new ones.
+const webhookQueueSize = 1024
+
+// ChangeEvent describes a key written by a Handler.
+type ChangeEvent struct {
+	Collection string `json:"collection"`
+
+	// Key is empty if the whole collection was cleared.
+	Key string `json:"key"`
+
+	// Op is the operation of the handler which wrote the key, for example "upsert" or "delete_many".
+	Op        string    `json:"op"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChangeNotifier is notified of every key written by a Handler once the write succeeded. Notify is called while the
+// request is served and therefore must not block.
+type ChangeNotifier interface {
+	Notify(e ChangeEvent)
+}
+
+// WithChangeNotifier sets the notifier of the handler. Nobody is notified by default.
+func WithChangeNotifier(n ChangeNotifier) HandlerOption {
+	return func(h *Handler) {
+		h.notifier = n
+	}
+}
+
+// notify sends a change event for every key written by the operation.
+func (h *Handler) notify(o *operation, keys []string) {
+	if h.notifier == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, key := range keys {
+		h.notifier.Notify(ChangeEvent{Collection: o.collection, Key: key, Op: o.name, Timestamp: now})
+	}
+}
+
+// notifyCleared sends a change event with an empty key for the collection of the operation.
+func (h *Handler) notifyCleared(ctx context.Context) {
+	if o, ok := ctx.Value(operationKey{}).(*operation); ok && h.notifier != nil {
+		h.notifier.Notify(ChangeEvent{Collection: o.collection, Op: o.name, Timestamp: time.Now().UTC()})
+	}
+}
+
+// WebhookNotifier POSTs every change event as JSON to a URL. Events are queued and delivered one after the other by a
+// background goroutine, so Notify never blocks. A delivery which fails or is not answered with a 2xx status code is
+// retried with exponential backoff. Events which can not be delivered, or which do not fit into the queue, are logged
+// and dropped.
+type WebhookNotifier struct {
+	url     string
+	retries int
+	backoff time.Duration
+	client  *http.Client
+	l       *logrusx.Logger
+
+	sync.RWMutex
+	events chan ChangeEvent
+	closed bool
+	done   chan struct{}
+}
+
+var _ ChangeNotifier = new(WebhookNotifier)
+
+// NewWebhookNotifier starts a WebhookNotifier which retries each delivery up to retries times, waiting backoff before
+// the first retry. Close stops it.
+func NewWebhookNotifier(url string, retries int, backoff time.Duration, l *logrusx.Logger) *WebhookNotifier {
+	n := &WebhookNotifier{
+		url:     url,
+		retries: retries,
+		backoff: backoff,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		l:       l,
+		events:  make(chan ChangeEvent, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues the event. It is dropped if the queue is full or the notifier is closed.
+func (n *WebhookNotifier) Notify(e ChangeEvent) {
+	n.RLock()
+	defer n.RUnlock()
+	if n.closed {
+		return
+	}
+
+	select {
+	case n.events <- e:
+	default:
+		n.log(e).Warn("Dropped the change event because the webhook queue is full.")
+	}
+}
+
+// Close delivers the queued events and stops the notifier. Events passed to Notify afterwards are dropped.
+func (n *WebhookNotifier) Close() {
+	n.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.events)
+	}
+	n.Unlock()
+	<-n.done
+}
+
+func (n *WebhookNotifier) run() {
+	defer close(n.done)
+	for e := range n.events {
+		n.deliver(e)
+	}
+}
+
+func (n *WebhookNotifier) deliver(e ChangeEvent) {
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.backoff << uint(attempt-1))
+		}
+		if err = n.post(e); err == nil {
+			return
+		}
+	}
+	n.log(e).WithError(err).Error("Unable to deliver the change event to the webhook.")
+}
+
+func (n *WebhookNotifier) post(e ChangeEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("webhook responded with status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) log(e ChangeEvent) *logrusx.Logger {
+	return n.l.
+		WithField("collection", e.Collection).
+		WithField("key", e.Key).
+		WithField("op", e.Op)
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+// captureServer records the change events POSTed to it. It answers the first failures requests with 500.
+type captureServer struct {
+	sync.Mutex
+	events   []ChangeEvent
+	requests int
+	failures int
+}
+
+func (s *captureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	if s.requests <= s.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var e ChangeEvent
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.events = append(s.events, e)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	const collection = "/tests/notify/roles"
+
+	newHandler := func(t *testing.T, n ChangeNotifier) *httptest.Server {
+		h := NewHandler(NewMemoryManager(), herodot.NewJSONWriter(nil), WithChangeNotifier(n))
+		r := httprouter.New()
+		r.PUT("/roles", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+			var role Role
+			if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+				return nil, err
+			}
+			return &UpsertRequest{Collection: collection, Key: role.ID, Value: &role}, nil
+		}))
+		r.DELETE("/roles", h.DeleteMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteManyRequest, error) {
+			return &DeleteManyRequest{Collection: collection, Keys: r.URL.Query()["id"]}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	do := func(t *testing.T, ts *httptest.Server, method, path, body string) int {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	t.Run("case=writes are delivered", func(t *testing.T) {
+		capture := &captureServer{}
+		webhook := httptest.NewServer(capture)
+		defer webhook.Close()
+
+		n := NewWebhookNotifier(webhook.URL, 0, time.Millisecond, logrusx.New("", ""))
+		ts := newHandler(t, n)
+		defer ts.Close()
+
+		require.Equal(t, http.StatusOK, do(t, ts, "PUT", "/roles", `{"id":"alice"}`))
+		require.Equal(t, http.StatusOK, do(t, ts, "PUT", "/roles?dry_run=true", `{"id":"bob"}`))
+		require.Equal(t, http.StatusNoContent, do(t, ts, "DELETE", "/roles?id=alice&id=carol", ""))
+		n.Close()
+
+		capture.Lock()
+		defer capture.Unlock()
+		// carol did not exist, so deleting it changed nothing.
+		require.Len(t, capture.events, 2)
+		for k, e := range []ChangeEvent{
+			{Collection: collection, Key: "alice", Op: "upsert"},
+			{Collection: collection, Key: "alice", Op: "delete_many"},
+		} {
+			assert.Equal(t, e.Collection, capture.events[k].Collection)
+			assert.Equal(t, e.Key, capture.events[k].Key)
+			assert.Equal(t, e.Op, capture.events[k].Op)
+			assert.WithinDuration(t, time.Now(), capture.events[k].Timestamp, time.Minute)
+		}
+	})
+
+	t.Run("case=failed deliveries are retried", func(t *testing.T) {
+		capture := &captureServer{failures: 2}
+		webhook := httptest.NewServer(capture)
+		defer webhook.Close()
+
+		n := NewWebhookNotifier(webhook.URL, 2, time.Millisecond, logrusx.New("", ""))
+		n.Notify(ChangeEvent{Collection: collection, Key: "alice", Op: "upsert"})
+		n.Close()
+
+		capture.Lock()
+		defer capture.Unlock()
+		assert.Equal(t, 3, capture.requests)
+		require.Len(t, capture.events, 1)
+		assert.Equal(t, "alice", capture.events[0].Key)
+	})
+
+	t.Run("case=undeliverable events are dropped", func(t *testing.T) {
+		capture := &captureServer{failures: 10}
+		webhook := httptest.NewServer(capture)
+		defer webhook.Close()
+
+		n := NewWebhookNotifier(webhook.URL, 1, time.Millisecond, logrusx.New("", ""))
+		ts := newHandler(t, n)
+		defer ts.Close()
+
+		assert.Equal(t, http.StatusOK, do(t, ts, "PUT", "/roles", `{"id":"alice"}`))
+		n.Close()
+
+		capture.Lock()
+		defer capture.Unlock()
+		assert.Equal(t, 2, capture.requests)
+		assert.Empty(t, capture.events)
+	})
+
+	t.Run("case=a slow webhook does not block writes", func(t *testing.T) {
+		release := make(chan struct{})
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer webhook.Close()
+
+		n := NewWebhookNotifier(webhook.URL, 0, time.Millisecond, logrusx.New("", ""))
+		ts := newHandler(t, n)
+		defer ts.Close()
+
+		for _, id := range []string{"alice", "bob", "carol"} {
+			assert.Equal(t, http.StatusOK, do(t, ts, "PUT", "/roles", `{"id":"`+id+`"}`))
+		}
+		close(release)
+		n.Close()
+
+		// events passed to a closed notifier are dropped instead of panicking.
+		n.Notify(ChangeEvent{Collection: collection, Key: "dave", Op: "upsert"})
+	})
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/pagination"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// maxLimitHeader is the response header telling clients the largest limit accepted for the collection.
+const maxLimitHeader = "X-Max-Limit"
+
+// PaginationLimits are the pagination bounds of a collection type. Zero values fall back to the defaults of 100 for
+// the limit, 0 for the offset, and 500 for the maximum limit.
+type PaginationLimits struct {
+	DefaultLimit  int
+	DefaultOffset int
+	MaxLimit      int
+}
+
+// WithPaginationLimits sets the pagination bounds of the collection type, the last path segment of the collection,
+// for example "policies" or "roles".
+func WithPaginationLimits(collectionType string, limits PaginationLimits) HandlerOption {
+	return func(h *Handler) {
+		if h.paginationLimits == nil {
+			h.paginationLimits = map[string]PaginationLimits{}
+		}
+		h.paginationLimits[collectionType] = limits
+	}
+}
+
+// limits returns the pagination bounds of the collection with the defaults applied.
+func (h *Handler) limits(collection string) PaginationLimits {
+	l := h.paginationLimits[collectionType(collection)]
+	if l.DefaultLimit <= 0 {
+		l.DefaultLimit = defaultLimit
+	}
+	if l.DefaultOffset < 0 {
+		l.DefaultOffset = 0
+	}
+	if l.MaxLimit <= 0 {
+		l.MaxLimit = maxLimit
+	}
+	if l.DefaultLimit > l.MaxLimit {
+		l.DefaultLimit = l.MaxLimit
+	}
+	return l
+}
+
+// WithStrictPagination makes the handler reject malformed pagination parameters as if every request had set the
+// query parameter "strict_pagination" to "true".
+func WithStrictPagination(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.strictPagination = enabled
+	}
+}
+
+// parsePagination returns the limit and offset of the request, bounded by the pagination limits of the collection,
+// and sets the X-Max-Limit header to the maximum limit. By default malformed values silently fall back to the
+// defaults, see pagination.Parse. With strict pagination a limit or offset which is not a non-negative integer, or a
+// limit above the maximum, results in a bad request error naming the parameter.
+func (h *Handler) parsePagination(w http.ResponseWriter, r *http.Request, collection string) (limit, offset int, err error) {
+	strict, err := boolQuery(r, "strict_pagination")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	l := h.limits(collection)
+	w.Header().Set(maxLimitHeader, strconv.Itoa(l.MaxLimit))
+
+	if !strict && !h.strictPagination {
+		limit, offset = pagination.Parse(r, l.DefaultLimit, l.DefaultOffset, l.MaxLimit)
+		return limit, offset, nil
+	}
+
+	q := r.URL.Query()
+	if limit, err = strictInt(q, "limit", l.DefaultLimit); err != nil {
+		return 0, 0, err
+	}
+	if limit > l.MaxLimit {
+		return 0, 0, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Query parameter "limit" must not exceed %d but got "%d".`, l.MaxLimit, limit).
+			WithDetail("parameter", "limit"))
+	}
+	if offset, err = strictInt(q, "offset", l.DefaultOffset); err != nil {
+		return 0, 0, err
+	}
+	return limit, offset, nil
+}
+
+func strictInt(q url.Values, name string, fallback int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, errors.WithStack(herodot.ErrBadRequest.
+			WithReasonf(`Query parameter "%s" must be a non-negative integer but got "%s".`, name, v).
+			WithDetail("parameter", name))
+	}
+	return i, nil
+}
+
+func linkHeader(u *url.URL, rel string, limit, offset int) string {
+	uu := *u
+	q := uu.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	uu.RawQuery = q.Encode()
+	return fmt.Sprintf("<%s>; rel=\"%s\"", uu.String(), rel)
+}
+
+// paginationHeader sets the RFC 5988 Link header as well as the X-Total-Count header for a paginated result. If the
+// result fits on one page, only the first and last links are set.
+func paginationHeader(w http.ResponseWriter, u *url.URL, total, limit, offset int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if limit <= 0 {
+		limit = 1
+	}
+
+	lastOffset := 0
+	if total > 0 {
+		lastOffset = ((total - 1) / limit) * limit
+	}
+
+	links := []string{linkHeader(u, "first", limit, 0)}
+	if offset+limit < total {
+		links = append(links, linkHeader(u, "next", limit, offset+limit))
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, linkHeader(u, "prev", limit, prev))
+	}
+	links = append(links, linkHeader(u, "last", limit, lastOffset))
+
+	w.Header().Set("Link", strings.Join(links, ","))
+}
+
+// paginate slices the slice value points to in place.
+func paginate(value interface{}, limit, offset int) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return
+	}
+
+	s := v.Elem()
+	start, end := index(limit, offset, s.Len())
+	s.Set(s.Slice(start, end))
+}
+
+// index is like pagination.Index but clamps the bounds so that they are always valid for a slice of the given length.
+// A negative limit or offset is treated as zero and an offset past the end results in an empty page.
+func index(limit, offset, length int) (start, end int) {
+	if limit < 0 {
+		limit = 0
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	start, end = pagination.Index(limit, offset, length)
+	if end > length {
+		end = length
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"reflect"
+)
+
+const (
+	patchAdd    = "add"
+	patchRemove = "remove"
+)
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to target and returns the result. Both values are expected to be
+// decoded JSON.
+//
+// In addition to RFC 7386, arrays support explicit add and remove operations. If target is an array and patch is an
+// object containing only the keys "add" and/or "remove", the values of "remove" are removed from the array and the
+// values of "add" are appended to it unless they are already present. Any other patch value replaces the array.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	if a, ok := target.([]interface{}); ok && isArrayPatch(p) {
+		return patchArray(a, p)
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+func isArrayPatch(p map[string]interface{}) bool {
+	if len(p) == 0 {
+		return false
+	}
+
+	for k, v := range p {
+		if k != patchAdd && k != patchRemove {
+			return false
+		}
+		if _, ok := v.([]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func patchArray(target []interface{}, p map[string]interface{}) []interface{} {
+	res := make([]interface{}, 0, len(target))
+
+	remove, _ := p[patchRemove].([]interface{})
+	for _, v := range target {
+		if !containsValue(v, remove) {
+			res = append(res, v)
+		}
+	}
+
+	add, _ := p[patchAdd].([]interface{})
+	for _, v := range add {
+		if !containsValue(v, res) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+func containsValue(target interface{}, source []interface{}) bool {
+	for _, v := range source {
+		if reflect.DeepEqual(v, target) {
+			return true
+		}
+	}
+	return false
+}
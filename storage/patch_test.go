@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	for k, tc := range []struct {
+		target   string
+		patch    string
+		expected string
+	}{
+		// examples from RFC 7386
+		{target: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{target: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+		{target: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+		{target: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+		{target: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{target: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+		{target: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+		{target: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+		{target: `["a","b"]`, patch: `["c","d"]`, expected: `["c","d"]`},
+		{target: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+		{target: `{"e":null}`, patch: `{"a":1}`, expected: `{"a":1,"e":null}`},
+		{target: `[1,2]`, patch: `{"a":"b","c":null}`, expected: `{"a":"b"}`},
+		{target: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+		// array operations
+		{target: `{"a":["b","c"]}`, patch: `{"a":{"add":["d"]}}`, expected: `{"a":["b","c","d"]}`},
+		{target: `{"a":["b","c"]}`, patch: `{"a":{"add":["b"]}}`, expected: `{"a":["b","c"]}`},
+		{target: `{"a":["b","c"]}`, patch: `{"a":{"remove":["b","x"]}}`, expected: `{"a":["c"]}`},
+		{target: `{"a":["b","c"]}`, patch: `{"a":{"add":["d"],"remove":["c"]}}`, expected: `{"a":["b","d"]}`},
+		{target: `{"a":["b"]}`, patch: `{"a":{"add":["d"],"other":["c"]}}`, expected: `{"a":{"add":["d"],"other":["c"]}}`},
+		{target: `{"a":"b"}`, patch: `{"a":{"add":["d"]}}`, expected: `{"a":{"add":["d"]}}`},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			var target, patch interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.target), &target))
+			require.NoError(t, json.Unmarshal([]byte(tc.patch), &patch))
+
+			actual, err := json.Marshal(mergePatch(target, patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(actual))
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// patternCache holds the compiled regular expressions of stored patterns so that they are not recompiled on every
+// list request.
+var patternCache = struct {
+	sync.RWMutex
+	compiled map[string]*regexp.Regexp
+}{compiled: map[string]*regexp.Regexp{}}
+
+const (
+	// FlavorExact matches stored values literally, so that neither "<" nor "*" have a special meaning.
+	FlavorExact = "exact"
+
+	// FlavorGlob only matches the glob wildcards of stored values, see compilePattern.
+	FlavorGlob = "glob"
+
+	// FlavorRegex only matches the regular expressions of stored values, see compilePattern.
+	FlavorRegex = "regex"
+)
+
+// isPattern checks if the value contains regular expression delimiters or glob wildcards.
+func isPattern(value string) bool {
+	return strings.ContainsAny(value, "<>*")
+}
+
+// isPatternOf is like isPattern but only considers the syntax of the flavor, see compilePatternOf.
+func isPatternOf(value, flavor string) bool {
+	switch flavor {
+	case FlavorExact:
+		return false
+	case FlavorGlob:
+		return strings.Contains(value, "*")
+	case FlavorRegex:
+		return strings.ContainsAny(value, "<>")
+	}
+	return isPattern(value)
+}
+
+// compilePattern compiles a stored pattern. Everything between "<" and ">" is a regular expression, "*" matches any
+// sequence of characters except the ":" separator and "**" matches any sequence of characters. Everything else is
+// matched literally. The compiled pattern is cached.
+func compilePattern(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	return compilePatternOf(pattern, "", caseInsensitive)
+}
+
+// compilePatternOf is like compilePattern but only compiles the syntax of the flavor: the glob wildcards for
+// FlavorGlob and the regular expressions for FlavorRegex, everything else is matched literally. Both are compiled if
+// the flavor is empty. Values of FlavorExact are never patterns, see isPatternOf.
+func compilePatternOf(pattern, flavor string, caseInsensitive bool) (*regexp.Regexp, error) {
+	key := flavor + ":" + pattern
+	if caseInsensitive {
+		key = flavor + ":(?i)" + pattern
+	}
+
+	patternCache.RLock()
+	re, ok := patternCache.compiled[key]
+	patternCache.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	expr, err := patternToRegexp(pattern, flavor)
+	if err != nil {
+		return nil, err
+	}
+	if caseInsensitive {
+		expr = "(?i)" + expr
+	}
+
+	re, err = regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Pattern "%s" is malformed: %s`, pattern, err))
+	}
+
+	patternCache.Lock()
+	patternCache.compiled[key] = re
+	patternCache.Unlock()
+	return re, nil
+}
+
+// splitPattern splits a stored pattern at every sep outside of "<" and ">", so that regular expressions containing sep
+// stay in one part.
+func splitPattern(pattern string, sep byte) []string {
+	var parts []string
+	var depth, start int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+func patternToRegexp(pattern, flavor string) (string, error) {
+	switch flavor {
+	case FlavorExact:
+		return "^" + regexp.QuoteMeta(pattern) + "$", nil
+	case FlavorGlob:
+		return "^" + globToRegexp(pattern) + "$", nil
+	}
+
+	literal := globToRegexp
+	if flavor == FlavorRegex {
+		literal = regexp.QuoteMeta
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+
+	var depth, start int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			if depth == 0 {
+				b.WriteString(literal(pattern[start:i]))
+				start = i + 1
+			}
+			depth++
+		case '>':
+			depth--
+			if depth < 0 {
+				return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Pattern "%s" is malformed: unbalanced ">" at position %d.`, pattern, i))
+			}
+			if depth == 0 {
+				b.WriteString("(" + pattern[start:i] + ")")
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Pattern "%s" is malformed: unbalanced "<".`, pattern))
+	}
+
+	b.WriteString(literal(pattern[start:]))
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+func globToRegexp(glob string) string {
+	parts := strings.Split(glob, "**")
+	for k, p := range parts {
+		parts[k] = strings.Replace(regexp.QuoteMeta(p), `\*`, `[^:]*`, -1)
+	}
+	return strings.Join(parts, ".*")
+}
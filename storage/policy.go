@@ -1,5 +1,12 @@
 package storage
 
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // Policies is an array of policies.
 //
 // swagger:ignore
@@ -29,24 +36,153 @@ type Policy struct {
 
 	// Conditions represents a keyed object of conditions under which this ORY Access Policy is active.
 	Conditions map[string]interface{} `json:"conditions"`
+
+	// Obligations are requirements the caller must enforce if this ORY Access Policy allows a request, for example
+	// "log-access" or "require-mfa". They are ignored for policies with effect "deny".
+	Obligations []string `json:"obligations,omitempty"`
+
+	// NotBefore is the time from which on this ORY Access Policy applies. Policies without it apply as soon as they
+	// are stored.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+
+	// NotAfter is the time from which on this ORY Access Policy no longer applies. Policies without it never expire.
+	NotAfter *time.Time `json:"not_after,omitempty"`
+
+	// CreatedAt is the time at which the policy was first stored. It is only set if timestamps are enabled and is
+	// never stored as part of the policy.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UpdatedAt is the time at which the policy was last changed. It is only set if timestamps are enabled and is
+	// never stored as part of the policy.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Validate checks that the effect of the policy is "allow" or "deny" and that the patterns of its subjects,
+// resources, and actions compile, see compilePattern. Because a policy without subjects, resources, or actions never
+// matches, these are rejected as well unless force is true. So are policies whose validity window is empty.
+func (p *Policy) Validate(force bool) error {
+	if p.Effect != effectAllow && p.Effect != effectDeny {
+		return errors.Errorf(`policy "%s" has invalid effect "%s", only "%s" and "%s" are supported`, p.ID, p.Effect, effectAllow, effectDeny)
+	}
+
+	if err := p.validatePatterns(""); err != nil {
+		return err
+	}
+
+	if force {
+		return nil
+	}
+
+	for _, f := range p.matchedFields() {
+		if len(f.values) == 0 {
+			return errors.Errorf(`policy "%s" has no %s and would never match, use force=true to store it anyway`, p.ID, f.name)
+		}
+	}
+	if p.NotBefore != nil && p.NotAfter != nil && !p.NotAfter.After(*p.NotBefore) {
+		return errors.Errorf(`policy "%s" has "not_after" %s which is not after "not_before" %s, so it would never match, use force=true to store it anyway`,
+			p.ID, p.NotAfter.Format(time.RFC3339), p.NotBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+type policyField struct {
+	name   string
+	values []string
+}
+
+// matchedFields returns the fields of the policy which are matched against access requests.
+func (p *Policy) matchedFields() []policyField {
+	return []policyField{
+		{name: "subjects", values: p.Subjects},
+		{name: "resources", values: p.Resources},
+		{name: "actions", values: p.Actions},
+	}
 }
 
-func (p *Policy) withSubjects(subjects []string) *Policy {
-	if p == nil || len(subjects) == 0 || contains(subjects[0], p.Subjects) {
+// validatePatterns checks that every pattern of the subjects, resources, and actions of the policy compiles in the
+// syntax of the flavor, see compilePatternOf. The compiled patterns are cached, so checking a policy again is cheap.
+func (p *Policy) validatePatterns(flavor string) error {
+	for _, f := range p.matchedFields() {
+		for _, v := range f.values {
+			if !isPatternOf(v, flavor) {
+				continue
+			}
+			if _, err := compilePatternOf(v, flavor, false); err != nil {
+				reason := err.Error()
+				var r interface{ Reason() string }
+				if errors.As(err, &r) && r.Reason() != "" {
+					reason = r.Reason()
+				}
+				return errors.Errorf(`policy "%s" has a malformed pattern in its %s: %s`, p.ID, f.name, reason)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) withSubjects(subjects []string, o *filterOptions) *Policy {
+	if p == nil || len(subjects) == 0 || o.matchesPatterns(subjects, p.Subjects) {
 		return p
 	}
 	return nil
 }
 
-func (p *Policy) withResources(resources []string) *Policy {
-	if p == nil || len(resources) == 0 || contains(resources[0], p.Resources) {
+func (p *Policy) withResources(resources []string, o *filterOptions) *Policy {
+	if p == nil || len(resources) == 0 || o.matchesPatterns(resources, p.Resources) {
 		return p
 	}
 	return nil
 }
 
-func (p *Policy) withActions(actions []string) *Policy {
-	if p == nil || len(actions) == 0 || contains(actions[0], p.Actions) {
+func (p *Policy) withActions(actions []string, o *filterOptions) *Policy {
+	if p == nil || len(actions) == 0 || o.matchesPatterns(actions, p.Actions) {
+		return p
+	}
+	return nil
+}
+
+// withAnyOf returns the policy if at least one of the subject, resource, or action filters matches.
+func (p *Policy) withAnyOf(subjects, resources, actions []string, o *filterOptions) *Policy {
+	if p == nil || o.matchesAny(
+		filter{values: subjects, source: p.Subjects},
+		filter{values: resources, source: p.Resources},
+		filter{values: actions, source: p.Actions},
+	) {
+		return p
+	}
+	return nil
+}
+
+// withQuery applies all filters of ListByQuery to the policy.
+func (p *Policy) withQuery(m map[string][]string, o *filterOptions) *Policy {
+	if o.match == MatchAny {
+		return p.withAnyOf(m["subject"], m["resource"], m["action"], o).withIDs(m["id"]).withEffect(m["effect"]).
+			withHasCondition(m["has_condition"]).withConditionKeys(m["condition_key"]).withResourcePrefix(m["resource_prefix"], o).
+			withActiveOnly(m["active_only"], o)
+	}
+	return p.withSubjects(m["subject"], o).withResources(m["resource"], o).withActions(m["action"], o).withIDs(m["id"]).withEffect(m["effect"]).
+		withHasCondition(m["has_condition"]).withConditionKeys(m["condition_key"]).withResourcePrefix(m["resource_prefix"], o).
+		withActiveOnly(m["active_only"], o)
+}
+
+// withResourcePrefix returns the policy if one of its resources affects a resource at or below one of the paths, see
+// filterOptions.under.
+func (p *Policy) withResourcePrefix(paths []string, o *filterOptions) *Policy {
+	if p == nil || len(paths) == 0 {
+		return p
+	}
+	for _, path := range paths {
+		for _, resource := range p.Resources {
+			if o.under(resource, path) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) withEffect(effects []string) *Policy {
+	if p == nil || len(effects) == 0 || effects[0] == "" || p.Effect == effects[0] {
 		return p
 	}
 	return nil
@@ -58,3 +194,28 @@ func (p *Policy) withIDs(ids []string) *Policy {
 	}
 	return nil
 }
+
+// withHasCondition keeps the policy if it has conditions and the value is "true", or if it has none and the value is
+// "false". Values which are not booleans are rejected by validateConditionFilters.
+func (p *Policy) withHasCondition(values []string) *Policy {
+	if p == nil || len(values) == 0 || values[0] == "" {
+		return p
+	}
+	if has, err := strconv.ParseBool(values[0]); err != nil || has == (len(p.Conditions) > 0) {
+		return p
+	}
+	return nil
+}
+
+// withConditionKeys keeps the policy if it has a condition under one of the keys.
+func (p *Policy) withConditionKeys(keys []string) *Policy {
+	if p == nil || len(keys) == 0 {
+		return p
+	}
+	for _, k := range keys {
+		if _, ok := p.Conditions[k]; ok {
+			return p
+		}
+	}
+	return nil
+}
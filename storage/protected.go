@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// allowProtectedHeader is the request header which carries the secret allowing writes to protected keys, see
+// WithProtectedSecret.
+const allowProtectedHeader = "X-Allow-Protected"
+
+// WithProtectedKeys protects the keys from being written, patched, or deleted in every collection, for example the
+// policies which guard the server itself. Keys may be patterns, see compilePattern, so that "<admin:.*>" protects
+// every key starting with "admin:". Writes to protected keys are rejected with 403 and audited unless the request has
+// the X-Allow-Protected header set to the secret of WithProtectedSecret. Nothing is protected by default.
+func WithProtectedKeys(keys ...string) HandlerOption {
+	return func(h *Handler) {
+		h.protectedKeys = append(h.protectedKeys, keys...)
+	}
+}
+
+// WithProtectedSecret sets the secret which the X-Allow-Protected header of a request has to carry to write protected
+// keys, see WithProtectedKeys. Without a secret, protected keys can not be written at all.
+func WithProtectedSecret(secret string) HandlerOption {
+	return func(h *Handler) {
+		h.protectedSecret = secret
+	}
+}
+
+// isProtected checks if the key is one of the protected keys or matches one of their patterns. A malformed pattern
+// protects every key, so that it never lets a write through by mistake.
+func (h *Handler) isProtected(key string) bool {
+	for _, protected := range h.protectedKeys {
+		if protected == key {
+			return true
+		}
+		if !isPattern(protected) {
+			continue
+		}
+
+		re, err := compilePattern(protected, false)
+		if err != nil || re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsProtected checks if the request carries the secret which allows writes to protected keys.
+func (h *Handler) allowsProtected(r *http.Request) bool {
+	return h.protectedSecret != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get(allowProtectedHeader)), []byte(h.protectedSecret)) == 1
+}
+
+// checkProtected fails with 403 and audits the rejection if any of the keys is protected and the request does not
+// allow writes to protected keys.
+func (h *Handler) checkProtected(ctx context.Context, r *http.Request, keys ...string) error {
+	if len(h.protectedKeys) == 0 || h.allowsProtected(r) {
+		return nil
+	}
+
+	var protected []string
+	for _, key := range keys {
+		if h.isProtected(key) {
+			protected = append(protected, key)
+		}
+	}
+	if len(protected) == 0 {
+		return nil
+	}
+
+	h.auditRejected(ctx, protected...)
+	return errors.WithStack(herodot.ErrForbidden.
+		WithReasonf("Keys %s are protected and can only be modified with the %s header.", strings.Join(protected, ", "), allowProtectedHeader).
+		WithDetail("keys", protected))
+}
+
+// checkProtectedCollection is like checkProtected for writes which may remove any key of the collection, such as
+// clearing it. These are rejected whenever keys are protected.
+func (h *Handler) checkProtectedCollection(ctx context.Context, r *http.Request) error {
+	if len(h.protectedKeys) == 0 || h.allowsProtected(r) {
+		return nil
+	}
+
+	h.auditRejected(ctx)
+	return errors.WithStack(herodot.ErrForbidden.
+		WithReasonf("The collection may contain protected keys and can only be replaced or cleared with the %s header.", allowProtectedHeader))
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestProtectedKeys(t *testing.T) {
+	const collection = "tests-protected"
+
+	sink := new(recordingAuditSink)
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithAuditSink(sink), WithDestructiveOperations(true),
+		WithProtectedKeys("keto-admin", "<system:.*>"), WithProtectedSecret("secret"))
+	i := &mockHandler{c: collection, sh: h}
+	r := httprouter.New()
+	r.POST("/entries", h.Upsert(i.create))
+	r.DELETE("/entries/:id", h.Delete(i.delete))
+	r.POST("/import/:mode", h.Import(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ImportRequest, error) {
+		return &ImportRequest{Collection: collection, Mode: ps.ByName("mode"), Body: r.Body, Decode: func(line json.RawMessage) (string, interface{}, error) {
+			var key string
+			err := json.Unmarshal(line, &key)
+			return key, key, err
+		}}, nil
+	}))
+	r.DELETE("/clear", h.Clear(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ClearRequest, error) {
+		return &ClearRequest{Collection: collection}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	seed := func(t *testing.T) {
+		_, err := m.Clear(context.Background(), collection)
+		require.NoError(t, err)
+		for _, key := range []string{"keto-admin", "system:root", "other"} {
+			require.NoError(t, m.Upsert(context.Background(), collection, key, key))
+		}
+		sink.reset(t)
+	}
+
+	do := func(t *testing.T, method, path, secret string, body string) int {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		if secret != "" {
+			req.Header.Set("X-Allow-Protected", secret)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		operation          string
+		keys               []string
+		code               int
+	}{
+		{method: "POST", path: "/entries?key=keto-admin&value=foo", operation: "upsert", keys: []string{"keto-admin"}, code: http.StatusOK},
+		{method: "POST", path: "/entries?key=system:root&value=foo", operation: "upsert", keys: []string{"system:root"}, code: http.StatusOK},
+		{method: "DELETE", path: "/entries/keto-admin", operation: "delete", keys: []string{"keto-admin"}, code: http.StatusNoContent},
+		{method: "POST", path: "/import/merge", body: "\"other\"\n\"system:new\"\n", operation: "import", keys: []string{"system:new"}, code: http.StatusOK},
+		{method: "POST", path: "/import/replace", body: "\"other\"\n", operation: "import", code: http.StatusOK},
+		{method: "DELETE", path: "/clear", operation: "clear", code: http.StatusOK},
+	} {
+		t.Run("case="+tc.method+" "+tc.path, func(t *testing.T) {
+			seed(t)
+			for _, secret := range []string{"", "wrong"} {
+				assert.Equal(t, http.StatusForbidden, do(t, tc.method, tc.path, secret, tc.body))
+				assert.Equal(t, []AuditEvent{{Operation: tc.operation, Collection: collection, Keys: tc.keys, Rejected: true}}, sink.reset(t))
+			}
+
+			var v string
+			require.NoError(t, m.Get(context.Background(), collection, "keto-admin", &v))
+			assert.Equal(t, "keto-admin", v)
+
+			assert.Equal(t, tc.code, do(t, tc.method, tc.path, "secret", tc.body))
+			events := sink.reset(t)
+			require.Len(t, events, 1)
+			assert.False(t, events[0].Rejected)
+		})
+	}
+
+	t.Run("case=unprotected keys", func(t *testing.T) {
+		seed(t)
+		assert.Equal(t, http.StatusOK, do(t, "POST", "/entries?key=other&value=foo", "", ""))
+		assert.Equal(t, http.StatusOK, do(t, "POST", "/entries?key=systems&value=foo", "", ""))
+		assert.Equal(t, http.StatusNoContent, do(t, "DELETE", "/entries/other", "", ""))
+		assert.Equal(t, http.StatusOK, do(t, "POST", "/import/merge", "", "\"other\"\n"))
+	})
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// errRangeNotSatisfiable is returned if a requested byte range starts after the end of the response.
+var errRangeNotSatisfiable = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusRequestedRangeNotSatisfiable),
+	ErrorField:  "requested range not satisfiable",
+	CodeField:   http.StatusRequestedRangeNotSatisfiable,
+}
+
+// byteRange is a single range of the Range header. Its end is inclusive and negative if the range is open. A negative
+// start denotes the suffix of length end.
+type byteRange struct {
+	start, end int64
+}
+
+// parseRange parses a Range header requesting a single byte range, for example "bytes=100-199", "bytes=100-", or
+// "bytes=-100". It returns false for every other header, which is then ignored as allowed by RFC 7233.
+func parseRange(header string) (byteRange, bool) {
+	spec := strings.TrimSpace(header)
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return byteRange{}, false
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(spec, "bytes=")), "-", 2)
+	if len(parts) != 2 {
+		return byteRange{}, false
+	}
+	first, last := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false
+		}
+		return byteRange{start: -1, end: n}, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false
+	}
+	if last == "" {
+		return byteRange{start: start, end: -1}, true
+	}
+
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return byteRange{}, false
+	}
+	return byteRange{start: start, end: end}, true
+}
+
+// resolve returns the first and last byte of the range in a response of the given size, or false if the range does
+// not overlap with it.
+func (b byteRange) resolve(size int64) (int64, int64, bool) {
+	if b.start < 0 {
+		if b.end == 0 || size == 0 {
+			return 0, 0, false
+		}
+		if b.end > size {
+			return 0, size - 1, true
+		}
+		return size - b.end, size - 1, true
+	}
+
+	if b.start >= size {
+		return 0, 0, false
+	}
+	if b.end < 0 || b.end >= size {
+		return b.start, size - 1, true
+	}
+	return b.start, b.end, true
+}
+
+// exportRange responds with the byte range of the export and 206 Partial Content. Both backends stream a collection
+// in a stable order, in the order of insertion in memory and by row in SQL, so byte offsets stay valid across
+// requests as long as the collection is not written. To find the size of the export and its entity tag, which is
+// sent in the ETag header, it is streamed twice. If the collection changed in between, the response is aborted.
+//
+// If the If-Range header does not match the entity tag of the export, it returns false without responding and the
+// whole export is sent instead. Ranges starting after the end of the export are answered with 416. Partial responses
+// are never compressed.
+func (h *Handler) exportRange(w http.ResponseWriter, r *http.Request, collection string, rng byteRange, asYAML bool, setHeaders func()) bool {
+	ctx := r.Context()
+	size, tag, err := h.exportSize(ctx, collection, asYAML)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return true
+	}
+
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && strings.TrimSpace(ifRange) != tag {
+		return false
+	}
+
+	start, end, ok := rng.resolve(size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		h.h.WriteError(w, r, errors.WithStack(errRangeNotSatisfiable.
+			WithReasonf(`The range "%s" does not overlap with the export of %d bytes.`, r.Header.Get("Range"), size)))
+		return true
+	}
+
+	setHeaders()
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+
+	sum := sha256.New()
+	var offset int64
+	if err := h.exportLines(ctx, collection, asYAML, func(line []byte) error {
+		_, _ = sum.Write(line)
+		from := offset
+		offset += int64(len(line))
+		if offset <= start || from > end {
+			return nil
+		}
+
+		lo, hi := int64(0), int64(len(line))
+		if start > from {
+			lo = start - from
+		}
+		if end+1 < offset {
+			hi = end + 1 - from
+		}
+		_, err := w.Write(line[lo:hi])
+		return errors.WithStack(err)
+	}); err != nil || offset != size || exportTag(sum) != tag {
+		panic(http.ErrAbortHandler)
+	}
+
+	h.auditRead(ctx)
+	return true
+}
+
+// exportSize streams the export of the collection and returns its size in bytes and its entity tag.
+func (h *Handler) exportSize(ctx context.Context, collection string, asYAML bool) (int64, string, error) {
+	sum := sha256.New()
+	var size int64
+	if err := h.exportLines(ctx, collection, asYAML, func(line []byte) error {
+		_, _ = sum.Write(line)
+		size += int64(len(line))
+		return nil
+	}); err != nil {
+		return 0, "", err
+	}
+	return size, exportTag(sum), nil
+}
+
+func exportTag(sum hash.Hash) string {
+	return `"` + hex.EncodeToString(sum.Sum(nil)) + `"`
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestParseRange(t *testing.T) {
+	for k, tc := range []struct {
+		header     string
+		ok         bool
+		start, end int64
+	}{
+		{header: "bytes=0-9", ok: true, start: 0, end: 9},
+		{header: "bytes=10-", ok: true, start: 10, end: -1},
+		{header: "bytes=-5", ok: true, start: -1, end: 5},
+		{header: " bytes= 3 - 4 ", ok: true, start: 3, end: 4},
+		{header: ""},
+		{header: "bytes=0-1,5-6"},
+		{header: "bytes=5-1"},
+		{header: "bytes=a-"},
+		{header: "bytes=-"},
+		{header: "items=0-1"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			rng, ok := parseRange(tc.header)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				assert.Equal(t, byteRange{start: tc.start, end: tc.end}, rng)
+			}
+		})
+	}
+}
+
+func TestByteRangeResolve(t *testing.T) {
+	for k, tc := range []struct {
+		rng        byteRange
+		size       int64
+		ok         bool
+		start, end int64
+	}{
+		{rng: byteRange{start: 0, end: 9}, size: 100, ok: true, start: 0, end: 9},
+		{rng: byteRange{start: 90, end: 200}, size: 100, ok: true, start: 90, end: 99},
+		{rng: byteRange{start: 10, end: -1}, size: 100, ok: true, start: 10, end: 99},
+		{rng: byteRange{start: -1, end: 5}, size: 100, ok: true, start: 95, end: 99},
+		{rng: byteRange{start: -1, end: 500}, size: 100, ok: true, start: 0, end: 99},
+		{rng: byteRange{start: -1, end: 0}, size: 100},
+		{rng: byteRange{start: 100, end: -1}, size: 100},
+		{rng: byteRange{start: 0, end: -1}, size: 0},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			start, end, ok := tc.rng.resolve(tc.size)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				assert.Equal(t, tc.start, start)
+				assert.Equal(t, tc.end, end)
+			}
+		})
+	}
+}
+
+func TestExportRange(t *testing.T) {
+	const collection = "/tests/range/roles"
+
+	m := NewMemoryManager()
+	for _, id := range []string{"alice", "bob", "carol", "dave"} {
+		require.NoError(t, m.Upsert(context.Background(), collection, id, &Role{ID: id, Members: []string{id + "-member"}}))
+	}
+
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithCompressionThreshold(0))
+	r := httprouter.New()
+	r.GET("/export", h.Export(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ExportRequest, error) {
+		return &ExportRequest{Collection: collection, Filename: "roles.jsonl"}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	get := func(t *testing.T, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest("GET", ts.URL+"/export", nil)
+		require.NoError(t, err)
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	res, full := get(t, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+	size := len(full)
+
+	t.Run("case=ranges are parts of the full export", func(t *testing.T) {
+		for _, tc := range []struct {
+			header     string
+			start, end int
+		}{
+			{header: "bytes=0-9", start: 0, end: 9},
+			{header: "bytes=30-59", start: 30, end: 59},
+			{header: "bytes=50-", start: 50, end: size - 1},
+			{header: "bytes=-20", start: size - 20, end: size - 1},
+			{header: fmt.Sprintf("bytes=10-%d", size+100), start: 10, end: size - 1},
+		} {
+			t.Run("range="+tc.header, func(t *testing.T) {
+				res, body := get(t, http.Header{"Range": {tc.header}, "Accept-Encoding": {"gzip"}})
+				require.Equal(t, http.StatusPartialContent, res.StatusCode, body)
+				assert.Equal(t, fmt.Sprintf("bytes %d-%d/%d", tc.start, tc.end, size), res.Header.Get("Content-Range"))
+				assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+				assert.Empty(t, res.Header.Get("Content-Encoding"))
+				assert.NotEmpty(t, res.Header.Get("ETag"))
+				assert.Equal(t, full[tc.start:tc.end+1], body)
+			})
+		}
+	})
+
+	t.Run("case=resumed export is complete", func(t *testing.T) {
+		res, first := get(t, http.Header{"Range": {"bytes=0-24"}})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+
+		res, rest := get(t, http.Header{"Range": {"bytes=25-"}, "If-Range": {res.Header.Get("ETag")}})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, full, first+rest)
+	})
+
+	t.Run("case=changed export is sent in full", func(t *testing.T) {
+		res, _ := get(t, http.Header{"Range": {"bytes=0-24"}})
+		require.Equal(t, http.StatusPartialContent, res.StatusCode)
+		tag := res.Header.Get("ETag")
+
+		require.NoError(t, m.Upsert(context.Background(), collection, "erin", &Role{ID: "erin"}))
+		res, body := get(t, http.Header{"Range": {"bytes=25-"}, "If-Range": {tag}})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, body, `"erin"`)
+		assert.NotEqual(t, tag, res.Header.Get("ETag"))
+	})
+
+	t.Run("case=unsatisfiable range", func(t *testing.T) {
+		res, _ := get(t, http.Header{"Range": {"bytes=100000-"}})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.StatusCode)
+		assert.Regexp(t, `^bytes \*/\d+$`, res.Header.Get("Content-Range"))
+	})
+
+	t.Run("case=unsupported ranges are ignored", func(t *testing.T) {
+		res, _ := get(t, http.Header{"Range": {"bytes=0-1,5-6"}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// rateLimitSweepSize is the number of clients above which the buckets of idle clients are dropped.
+const rateLimitSweepSize = 10000
+
+// errTooManyRequests is returned if a client exceeded its rate limit.
+var errTooManyRequests = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusTooManyRequests),
+	ErrorField:  "too many requests",
+	CodeField:   http.StatusTooManyRequests,
+}
+
+// WithFilterRateLimit limits the filtered lists each client may request to rate per second, allowing bursts of up to
+// burst requests. Filtered lists and counts load the whole collection, so they are limited while paginated lists
+// without filters are not, also if they are explained, include deleted entries, or are paginated by page token.
+// Clients are identified by the subject stored with ContextWithSubject, by the header set with WithRateLimitHeader, or
+// by their IP address, in this order. Requests exceeding the limit are answered with 429 and a Retry-After header.
+// There is no limit by default.
+func WithFilterRateLimit(rate float64, burst int) HandlerOption {
+	return func(h *Handler) {
+		if rate <= 0 {
+			h.filterLimiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		h.filterLimiter = &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*bucket{}}
+	}
+}
+
+// WithRateLimitHeader sets the request header identifying clients which were not authenticated, for example
+// "X-Forwarded-For" behind a trusted proxy. Clients are identified by their IP address if it is empty, which is the
+// default.
+func WithRateLimitHeader(header string) HandlerOption {
+	return func(h *Handler) {
+		h.rateLimitHeader = header
+	}
+}
+
+// limitFilter answers the request with 429 and returns false if the client exceeded the rate limit of filtered lists.
+func (h *Handler) limitFilter(w http.ResponseWriter, r *http.Request) bool {
+	if h.filterLimiter == nil {
+		return true
+	}
+
+	wait := h.filterLimiter.take(h.client(r), time.Now())
+	if wait <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	h.h.WriteError(w, r, errors.WithStack(errTooManyRequests.
+		WithReason("The client sent too many filtered list requests, retry after the time given in the Retry-After header.")))
+	return false
+}
+
+// client returns the identity of the client which sent the request.
+func (h *Handler) client(r *http.Request) string {
+	if subject := SubjectFromContext(r.Context()); subject != "" {
+		return "subject:" + subject
+	}
+	if h.rateLimitHeader != "" {
+		if v := r.Header.Get(h.rateLimitHeader); v != "" {
+			return "header:" + v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimiter is a token bucket per client. Each bucket holds up to burst tokens and is refilled with rate tokens per
+// second.
+type rateLimiter struct {
+	sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket of the client. It returns zero if a token was taken and the time until the next
+// token is available otherwise.
+func (l *rateLimiter) take(client string, now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= rateLimitSweepSize {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops the buckets which are full again, they behave like new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestFilterRateLimit(t *testing.T) {
+	const collection = "/tests/ratelimit/policies"
+
+	m := NewMemoryManager()
+	require.NoError(t, m.Upsert(context.Background(), collection, "p", &Policy{ID: "p", Subjects: []string{"alice"}}))
+
+	newServer := func(opts ...HandlerOption) *httptest.Server {
+		h := NewHandler(m, herodot.NewJSONWriter(nil), opts...)
+		r := httprouter.New()
+		r.GET("/policies", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Policies, 0)
+			return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		r.GET("/policies/count", h.Count(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			p := make(Policies, 0)
+			return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+		}))
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if subject := req.Header.Get("X-Subject"); subject != "" {
+				req = req.WithContext(ContextWithSubject(req.Context(), subject))
+			}
+			r.ServeHTTP(w, req)
+		}))
+	}
+
+	get := func(t *testing.T, ts *httptest.Server, path string, header http.Header) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		require.NoError(t, err)
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("case=no limit by default", func(t *testing.T) {
+		ts := newServer()
+		defer ts.Close()
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", nil).StatusCode)
+		}
+	})
+
+	t.Run("case=filtered lists are limited", func(t *testing.T) {
+		ts := newServer(WithFilterRateLimit(0.5, 2))
+		defer ts.Close()
+
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", nil).StatusCode)
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", nil).StatusCode)
+		res := get(t, ts, "/policies?subject=alice", nil)
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, "2", res.Header.Get("Retry-After"))
+
+		// unfiltered lists are not limited.
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies", nil).StatusCode)
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?limit=1", nil).StatusCode)
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies/count", nil).StatusCode)
+	})
+
+	t.Run("case=every kind of filtered list is limited", func(t *testing.T) {
+		for _, path := range []string{
+			"/policies?subject=alice&explain=p",
+			"/policies?subject=alice&include_deleted=true",
+			"/policies?subject=alice&page_token=",
+			"/policies/count?subject=alice",
+		} {
+			ts := newServer(WithFilterRateLimit(0.5, 1))
+			assert.Equal(t, http.StatusOK, get(t, ts, path, nil).StatusCode, path)
+			assert.Equal(t, http.StatusTooManyRequests, get(t, ts, path, nil).StatusCode, path)
+			ts.Close()
+		}
+	})
+
+	t.Run("case=clients are limited separately", func(t *testing.T) {
+		ts := newServer(WithFilterRateLimit(0.5, 1), WithRateLimitHeader("X-Client"))
+		defer ts.Close()
+
+		alice, bob := http.Header{"X-Client": {"alice"}}, http.Header{"X-Client": {"bob"}}
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", alice).StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, get(t, ts, "/policies?subject=alice", alice).StatusCode)
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", bob).StatusCode)
+
+		// authenticated subjects take precedence over the header.
+		carol := http.Header{"X-Client": {"alice"}, "X-Subject": {"carol"}}
+		assert.Equal(t, http.StatusOK, get(t, ts, "/policies?subject=alice", carol).StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, get(t, ts, "/policies?subject=alice", carol).StatusCode)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{rate: 2, burst: 2, buckets: map[string]*bucket{}}
+	now := time.Now()
+
+	assert.Zero(t, l.take("a", now))
+	assert.Zero(t, l.take("a", now))
+	assert.Equal(t, 500*time.Millisecond, l.take("a", now))
+	assert.Zero(t, l.take("b", now))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Zero(t, l.take("a", now))
+	assert.Equal(t, 500*time.Millisecond, l.take("a", now))
+
+	now = now.Add(time.Hour)
+	l.sweep(now)
+	assert.Empty(t, l.buckets)
+}
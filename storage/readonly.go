@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+var errMethodNotAllowed = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusMethodNotAllowed),
+	ErrorField:  "The request method is not allowed",
+	CodeField:   http.StatusMethodNotAllowed,
+}
+
+// WithReadOnly rejects every write with 405, for example on a replica which only serves reads. Reads, including
+// decisions, are served as usual. Disabled by default.
+func WithReadOnly(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.readOnly = enabled
+	}
+}
+
+// WithReadOnlyCollections rejects the writes to collections of the given types with 405, like WithReadOnly does for
+// all collections. The type is the last segment of the collection name, for example "roles".
+func WithReadOnlyCollections(collectionTypes ...string) HandlerOption {
+	return func(h *Handler) {
+		if h.readOnlyCollections == nil {
+			h.readOnlyCollections = map[string]bool{}
+		}
+		for _, t := range collectionTypes {
+			h.readOnlyCollections[t] = true
+		}
+	}
+}
+
+// checkWritable fails with 405 if the collection is read-only, see WithReadOnly and WithReadOnlyCollections.
+func (h *Handler) checkWritable(collection string) error {
+	if h.readOnly {
+		return errors.WithStack(errMethodNotAllowed.WithReason("Writes are rejected because this server is read-only."))
+	}
+	if t := path.Base(collection); h.readOnlyCollections[t] {
+		return errors.WithStack(errMethodNotAllowed.WithReasonf(`Writes are rejected because the %s of this server are read-only.`, t))
+	}
+	return nil
+}
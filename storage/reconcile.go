@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// ReconcileRequest is a request to make a collection match the desired entries exactly.
+type ReconcileRequest struct {
+	Collection string
+	Entries    []UpsertEntry
+
+	// Current is a pointer to an empty slice into which the stored entries are listed, such as *Policies. Its
+	// elements must encode their key in the field "id".
+	Current interface{}
+}
+
+// ReconcileResponse is the difference between the stored and the desired entries. The keys are sorted.
+type ReconcileResponse struct {
+	// Created are the desired keys which were not stored.
+	Created []string `json:"created"`
+
+	// Updated are the stored keys whose value differs from the desired one.
+	Updated []string `json:"updated"`
+
+	// Deleted are the stored keys which are not desired.
+	Deleted []string `json:"deleted"`
+
+	// Unchanged is the number of stored entries which already have the desired value.
+	Unchanged int `json:"unchanged"`
+
+	// DryRun is true if the difference was not applied.
+	DryRun bool `json:"dry_run"`
+}
+
+// Reconcile compares the desired entries of the request with the stored entries of the collection and creates,
+// updates and deletes entries until the collection matches the request exactly. It responds with the difference.
+// Entries are equal if they encode to the same JSON, timestamps aside. The comparison and the writes run in one
+// transaction, so that either the whole difference or nothing is applied.
+//
+// If the query parameter "dry_run" is set to "true", the difference is computed but not applied. The response then
+// has the header "X-Dry-Run: true". Writing or deleting protected keys is answered with 403, see WithProtectedKeys.
+//
+// Stored entries which are not desired are only deleted if the query parameter "prune" is set to "true", so that an
+// empty or truncated body does not delete entries by accident. Without it, a difference which deletes entries is
+// answered with 403. Deleting every stored entry additionally requires destructive operations to be enabled, see
+// WithDestructiveOperations. Dry runs are not checked and report the deletions. Deleted entries are kept as
+// tombstones if soft deletion is enabled, unless the query parameter "purge" is set to "true", see Delete.
+func (h *Handler) Reconcile(factory func(context.Context, *http.Request, httprouter.Params) (*ReconcileRequest, error)) httprouter.Handle {
+	return h.instrument("reconcile", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		dryRun, err := boolQuery(r, "dry_run")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		prune, err := boolQuery(r, "prune")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		purge, err := boolQuery(r, "purge")
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		tooLarge := h.limitBody(w, r)
+		if err := h.decodeNamedBody(r); err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+		rc, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, tooLarge(err))
+			return
+		}
+
+		annotate(ctx, rc.Collection)
+
+		if err := validateCollection(rc.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(rc.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		desired := make(map[string]interface{}, len(rc.Entries))
+		index := make(map[string]int, len(rc.Entries))
+		for k, e := range rc.Entries {
+			if e.Err != nil {
+				h.h.WriteError(w, r, e.Err)
+				return
+			}
+			if i, ok := index[e.Key]; ok {
+				h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.
+					WithReasonf("Entry %d uses key %s which is already used by entry %d.", k, e.Key, i).
+					WithDetail("index", k).
+					WithDetail("key", e.Key)))
+				return
+			}
+			clearTimestamps(e.Value)
+			desired[e.Key] = e.Value
+			index[e.Key] = k
+		}
+
+		var res *ReconcileResponse
+		apply := func(m Manager) (err error) {
+			if res, err = diffCollection(ctx, m, rc, desired); err != nil {
+				return err
+			}
+			if err := h.checkProtected(ctx, r, res.changed()...); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+			if err := h.checkPrune(res, prune); err != nil {
+				return err
+			}
+
+			kv := make(map[string]interface{}, len(res.Created)+len(res.Updated))
+			for _, key := range append(append([]string{}, res.Created...), res.Updated...) {
+				kv[key] = desired[key]
+			}
+			if len(kv) > 0 {
+				if err := m.UpsertMany(ctx, rc.Collection, kv); err != nil {
+					var ke *KeyError
+					if errors.As(err, &ke) {
+						return errors.WithStack(herodot.ErrBadRequest.
+							WithReasonf("Unable to write entry %d with key %s: %s", index[ke.Key], ke.Key, ke.Err).
+							WithDetail("index", index[ke.Key]).
+							WithDetail("key", ke.Key))
+					}
+					return err
+				}
+			}
+			if len(res.Deleted) > 0 {
+				if err := h.deleteMany(ctx, m, rc.Collection, res.Deleted, purge); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if dryRun {
+			err = apply(h.s)
+		} else {
+			err = h.s.WithTransaction(ctx, apply)
+		}
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if dryRun {
+			w.Header().Set("X-Dry-Run", "true")
+			res.DryRun = true
+		} else if changed := res.changed(); len(changed) > 0 {
+			h.audit(ctx, changed...)
+		}
+
+		h.h.Write(w, r, res)
+	}))
+}
+
+// checkPrune refuses to apply a difference which deletes entries unless pruning was requested, and one which deletes
+// every stored entry unless destructive operations are enabled as well.
+func (h *Handler) checkPrune(res *ReconcileResponse, prune bool) error {
+	if len(res.Deleted) == 0 {
+		return nil
+	}
+	if !prune {
+		return errors.WithStack(herodot.ErrForbidden.
+			WithReasonf(`Reconciling would delete %d entries, which requires the query parameter "prune" to be set to "true".`, len(res.Deleted)).
+			WithDetail("deleted", res.Deleted))
+	}
+	if res.Unchanged+len(res.Updated) == 0 && !h.destructive {
+		return errors.WithStack(herodot.ErrForbidden.
+			WithReason("Reconciling would delete every stored entry, which is disabled because destructive operations are not allowed."))
+	}
+	return nil
+}
+
+// changed returns the created, updated and deleted keys.
+func (r *ReconcileResponse) changed() []string {
+	return append(append(append([]string{}, r.Created...), r.Updated...), r.Deleted...)
+}
+
+// diffCollection lists the stored entries of the collection and compares them with the desired entries.
+func diffCollection(ctx context.Context, m Manager, rc *ReconcileRequest, desired map[string]interface{}) (*ReconcileResponse, error) {
+	if err := m.ListAll(ctx, rc.Collection, rc.Current); err != nil {
+		return nil, err
+	}
+	clearTimestamps(rc.Current)
+
+	keys, err := elementIDs(rc.Current)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReconcileResponse{Created: []string{}, Updated: []string{}, Deleted: []string{}}
+	stored := make(map[string]bool, len(keys))
+	current := reflect.ValueOf(rc.Current).Elem()
+	for k, key := range keys {
+		stored[key] = true
+		value, ok := desired[key]
+		if !ok {
+			res.Deleted = append(res.Deleted, key)
+			continue
+		}
+
+		equal, err := equalJSON(current.Index(k).Interface(), value)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			res.Unchanged++
+		} else {
+			res.Updated = append(res.Updated, key)
+		}
+	}
+	for key := range desired {
+		if !stored[key] {
+			res.Created = append(res.Created, key)
+		}
+	}
+
+	sort.Strings(res.Created)
+	sort.Strings(res.Updated)
+	sort.Strings(res.Deleted)
+	return res, nil
+}
+
+// equalJSON reports whether both values encode to the same JSON.
+func equalJSON(a, b interface{}) (bool, error) {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return bytes.Equal(ab, bb), nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type reconcileEntry struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+func TestReconcile(t *testing.T) {
+	const collection = "tests-reconcile"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithProtectedKeys("protected"))
+	r := httprouter.New()
+	r.PUT("/reconcile", h.Reconcile(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ReconcileRequest, error) {
+		var values []reconcileEntry
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			return nil, err
+		}
+		entries := make([]UpsertEntry, len(values))
+		for k := range values {
+			entries[k] = UpsertEntry{Key: values[k].ID, Value: &values[k]}
+		}
+		return &ReconcileRequest{Collection: collection, Entries: entries, Current: &[]reconcileEntry{}}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	seed := func(t *testing.T) {
+		_, err := m.Clear(context.Background(), collection)
+		require.NoError(t, err)
+		for _, e := range []reconcileEntry{{ID: "a", Value: "1"}, {ID: "b", Value: "2"}, {ID: "c", Value: "3"}} {
+			require.NoError(t, m.Upsert(context.Background(), collection, e.ID, e))
+		}
+	}
+
+	stored := func(t *testing.T) []reconcileEntry {
+		var es []reconcileEntry
+		require.NoError(t, m.ListAll(context.Background(), collection, &es))
+		return es
+	}
+
+	reconcile := func(t *testing.T, query string, body []reconcileEntry) (int, *ReconcileResponse, http.Header) {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest("PUT", ts.URL+"/reconcile"+query, bytes.NewReader(b))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return res.StatusCode, nil, res.Header
+		}
+		var rr ReconcileResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&rr))
+		return res.StatusCode, &rr, res.Header
+	}
+
+	desired := []reconcileEntry{{ID: "a", Value: "1"}, {ID: "b", Value: "changed"}, {ID: "d", Value: "4"}}
+	diff := &ReconcileResponse{Created: []string{"d"}, Updated: []string{"b"}, Deleted: []string{"c"}, Unchanged: 1}
+
+	t.Run("case=dry run", func(t *testing.T) {
+		seed(t)
+		code, res, header := reconcile(t, "?dry_run=true", desired)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "true", header.Get("X-Dry-Run"))
+		assert.Equal(t, &ReconcileResponse{Created: diff.Created, Updated: diff.Updated, Deleted: diff.Deleted, Unchanged: 1, DryRun: true}, res)
+		assert.Equal(t, []reconcileEntry{{ID: "a", Value: "1"}, {ID: "b", Value: "2"}, {ID: "c", Value: "3"}}, stored(t))
+	})
+
+	t.Run("case=apply", func(t *testing.T) {
+		seed(t)
+		code, res, header := reconcile(t, "?prune=true", desired)
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, header.Get("X-Dry-Run"))
+		assert.Equal(t, diff, res)
+		assert.Equal(t, desired, stored(t))
+
+		code, res, _ = reconcile(t, "", desired)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, &ReconcileResponse{Created: []string{}, Updated: []string{}, Deleted: []string{}, Unchanged: 3}, res)
+	})
+
+	t.Run("case=without prune", func(t *testing.T) {
+		seed(t)
+		code, _, _ := reconcile(t, "", desired)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Len(t, stored(t), 3)
+
+		code, _, _ = reconcile(t, "?prune=maybe", desired)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Len(t, stored(t), 3)
+
+		// differences without deletions do not need it.
+		code, res, _ := reconcile(t, "", []reconcileEntry{{ID: "a", Value: "1"}, {ID: "b", Value: "2"}, {ID: "c", Value: "changed"}, {ID: "d", Value: "4"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"d"}, res.Created)
+		assert.Len(t, stored(t), 4)
+	})
+
+	t.Run("case=empty", func(t *testing.T) {
+		seed(t)
+		code, _, _ := reconcile(t, "", []reconcileEntry{})
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _, _ = reconcile(t, "?prune=true", []reconcileEntry{})
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Len(t, stored(t), 3)
+
+		h.destructive = true
+		defer func() { h.destructive = false }()
+		code, res, _ := reconcile(t, "?prune=true", []reconcileEntry{})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"a", "b", "c"}, res.Deleted)
+		assert.Empty(t, stored(t))
+	})
+
+	t.Run("case=protected", func(t *testing.T) {
+		seed(t)
+		require.NoError(t, m.Upsert(context.Background(), collection, "protected", reconcileEntry{ID: "protected"}))
+		code, _, _ := reconcile(t, "?prune=true", desired)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Len(t, stored(t), 4)
+	})
+
+	t.Run("case=duplicate", func(t *testing.T) {
+		seed(t)
+		code, _, _ := reconcile(t, "", []reconcileEntry{{ID: "a"}, {ID: "a"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Len(t, stored(t), 3)
+	})
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// WithReferentialIntegrity makes Delete and DeleteMany refuse to delete roles which policies still reference with 409,
+// unless the query parameter "force" is set to "true". Disabled by default, in which case such deletes only carry a
+// Warning header. Reconcile and Import, which make the collection match the request, do not check references.
+func WithReferentialIntegrity(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.referentialIntegrity = enabled
+	}
+}
+
+// PoliciesReferencingRoleRequest is a request for the policies which grant or deny something to a role.
+type PoliciesReferencingRoleRequest struct {
+	PolicyCollection string
+	Role             string
+}
+
+// PoliciesReferencingRole responds with the policies whose subjects match the role, either because they list its ID
+// or because one of their subject patterns matches it. It helps to find the policies which are orphaned once the role
+// is deleted or renamed. The role does not have to exist, so that references to deleted roles can be found as well.
+func (h *Handler) PoliciesReferencingRole(factory func(context.Context, *http.Request, httprouter.Params) (*PoliciesReferencingRoleRequest, error)) httprouter.Handle {
+	return h.instrument("policies_referencing_role", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		p, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, p.PolicyCollection)
+
+		if err := validateCollection(p.PolicyCollection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		policies, err := h.referencingPolicies(ctx, p.PolicyCollection, p.Role)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		h.auditRead(ctx, p.Role)
+		h.write(w, r, policies)
+	})
+}
+
+// referencingPolicies returns the policies of the collection whose subjects match the role.
+func (h *Handler) referencingPolicies(ctx context.Context, collection, role string) (Policies, error) {
+	var policies Policies
+	if err := h.s.ListAll(ctx, collection, &policies); err != nil {
+		return nil, err
+	}
+	return policies.referencing(role), nil
+}
+
+// referencing returns the policies whose subjects match the role.
+func (ps Policies) referencing(role string) Policies {
+	o := &filterOptions{match: MatchAny, literal: true}
+	res := Policies{}
+	for k := range ps {
+		if p := ps[k].withSubjects([]string{role}, o); p != nil {
+			res = append(res, *p)
+		}
+	}
+	return res
+}
+
+// checkReferences refuses to delete the roles if policies of the collection reference any of them and referential
+// integrity is enforced, unless force is set. Otherwise it warns about the references of every role in a Warning
+// header of the response.
+func (h *Handler) checkReferences(ctx context.Context, w http.ResponseWriter, r *http.Request, collection string, roles ...string) error {
+	force, err := boolQuery(r, "force")
+	if err != nil {
+		return err
+	}
+
+	var policies Policies
+	if err := h.s.ListAll(ctx, collection, &policies); err != nil {
+		return err
+	}
+
+	warnings := []string{}
+	for _, role := range roles {
+		referencing := policies.referencing(role)
+		if len(referencing) == 0 {
+			continue
+		}
+
+		ids := make([]string, len(referencing))
+		for k := range referencing {
+			ids[k] = referencing[k].ID
+		}
+
+		if h.referentialIntegrity && !force {
+			return errors.WithStack(herodot.ErrConflict.
+				WithReasonf(`Role "%s" is still referenced by the policies %s. Set the query parameter "force" to "true" to delete it anyway.`, role, strings.Join(ids, ", ")).
+				WithDetail("role", role).
+				WithDetail("policies", ids))
+		}
+		warnings = append(warnings, fmt.Sprintf(`299 - "Role %s is still referenced by the policies %s."`, role, strings.Join(ids, ", ")))
+	}
+
+	for _, warning := range warnings {
+		w.Header().Add("Warning", warning)
+	}
+	return nil
+}
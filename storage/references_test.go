@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestPoliciesReferencingRole(t *testing.T) {
+	const (
+		policies = "tests-references-policies"
+		roles    = "tests-references-roles"
+	)
+
+	ctx := context.Background()
+	m := NewMemoryManager()
+	for _, p := range []Policy{
+		{ID: "direct", Subjects: []string{"roles:editors", "users:alice"}},
+		{ID: "regex", Subjects: []string{"<roles:(editors|admins)>"}},
+		{ID: "glob", Subjects: []string{"roles:*"}},
+		{ID: "other", Subjects: []string{"roles:admins", "users:editors"}},
+	} {
+		require.NoError(t, m.Upsert(ctx, policies, p.ID, p))
+	}
+	require.NoError(t, m.Upsert(ctx, roles, "roles:editors", Role{ID: "roles:editors"}))
+	require.NoError(t, m.Upsert(ctx, roles, "roles:unused", Role{ID: "roles:unused"}))
+
+	router := func(opts ...HandlerOption) *httptest.Server {
+		h := NewHandler(m, herodot.NewJSONWriter(nil), opts...)
+		r := httprouter.New()
+		r.GET("/roles/:id/policies", h.PoliciesReferencingRole(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*PoliciesReferencingRoleRequest, error) {
+			return &PoliciesReferencingRoleRequest{PolicyCollection: policies, Role: ps.ByName("id")}, nil
+		}))
+		r.DELETE("/roles/:id", h.Delete(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteRequest, error) {
+			return &DeleteRequest{Collection: roles, Key: ps.ByName("id"), PolicyCollection: policies}, nil
+		}))
+		r.DELETE("/roles", h.DeleteMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteManyRequest, error) {
+			return &DeleteManyRequest{Collection: roles, Keys: r.URL.Query()["id"], PolicyCollection: policies}, nil
+		}))
+		return httptest.NewServer(r)
+	}
+
+	t.Run("case=list", func(t *testing.T) {
+		ts := router()
+		defer ts.Close()
+
+		for role, expected := range map[string][]string{
+			"roles:editors": {"direct", "regex", "glob"},
+			"roles:admins":  {"regex", "glob", "other"},
+			"roles:deleted": {"glob"},
+			"groups:none":   {},
+		} {
+			t.Run("role="+role, func(t *testing.T) {
+				res, err := ts.Client().Get(ts.URL + "/roles/" + role + "/policies")
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				var ps Policies
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&ps))
+				ids := []string{}
+				for _, p := range ps {
+					ids = append(ids, p.ID)
+				}
+				assert.Equal(t, expected, ids)
+			})
+		}
+	})
+
+	remove := func(t *testing.T, ts *httptest.Server, path string) *http.Response {
+		req, err := http.NewRequest("DELETE", ts.URL+path, nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("case=delete warns", func(t *testing.T) {
+		ts := router()
+		defer ts.Close()
+
+		res := remove(t, ts, "/roles/roles:editors")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Equal(t, `299 - "Role roles:editors is still referenced by the policies direct, regex, glob."`, res.Header.Get("Warning"))
+		require.NoError(t, m.Upsert(ctx, roles, "roles:editors", Role{ID: "roles:editors"}))
+	})
+
+	t.Run("case=delete enforces integrity", func(t *testing.T) {
+		ts := router(WithReferentialIntegrity(true))
+		defer ts.Close()
+
+		res := remove(t, ts, "/roles/roles:editors")
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		exists, err := m.Exists(ctx, roles, "roles:editors")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		res = remove(t, ts, "/roles/roles:editors?force=true")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get("Warning"))
+		exists, err = m.Exists(ctx, roles, "roles:editors")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("case=bulk delete enforces integrity", func(t *testing.T) {
+		ts := router(WithReferentialIntegrity(true))
+		defer ts.Close()
+
+		for _, id := range []string{"roles:editors", "groups:unused"} {
+			require.NoError(t, m.Upsert(ctx, roles, id, Role{ID: id}))
+		}
+		res := remove(t, ts, "/roles?id=groups:unused&id=roles:editors")
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+		exists, err := m.Exists(ctx, roles, "groups:unused")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		// without atomic, only the referenced role is kept.
+		res = remove(t, ts, "/roles?id=groups:unused&id=roles:editors&atomic=false")
+		assert.Equal(t, http.StatusMultiStatus, res.StatusCode)
+		exists, err = m.Exists(ctx, roles, "groups:unused")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = m.Exists(ctx, roles, "roles:editors")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		res = remove(t, ts, "/roles?id=groups:unused&id=roles:editors&force=true")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Equal(t, []string{`299 - "Role roles:editors is still referenced by the policies direct, regex, glob."`}, res.Header.Values("Warning"))
+		exists, err = m.Exists(ctx, roles, "roles:editors")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("case=delete unreferenced", func(t *testing.T) {
+		require.NoError(t, m.Delete(ctx, policies, "glob"))
+		ts := router(WithReferentialIntegrity(true))
+		defer ts.Close()
+
+		res := remove(t, ts, "/roles/roles:unused")
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Empty(t, res.Header.Get("Warning"))
+	})
+}
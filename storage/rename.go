@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// RenameRequest is a request to move the value of Key to NewKey. The renamed value is decoded into Value.
+type RenameRequest struct {
+	Collection string
+	Key        string
+	NewKey     string
+	Value      interface{}
+
+	// PolicyCollection is the collection of the policies which may reference the renamed role, see Delete. It is
+	// only set for roles.
+	PolicyCollection string
+}
+
+// Rename moves the value of the key to the new key in one step, see Manager.Rename, and responds with the renamed
+// value. Responds with 404 if the key does not exist and with 409 if the new key exists already. Renaming a role
+// which policies reference is handled like deleting it: the references are reported in the Warning header or, with
+// referential integrity, refused unless the query parameter "force" is set to "true".
+func (h *Handler) Rename(factory func(context.Context, *http.Request, httprouter.Params) (*RenameRequest, error)) httprouter.Handle {
+	return h.instrument("rename", h.idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		d, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if d.NewKey == "" {
+			h.h.WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Key "%s" can not be renamed to an empty key.`, d.Key)))
+			return
+		}
+		if err := h.checkWritable(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, d.Key, d.NewKey); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if d.PolicyCollection != "" {
+			if err := validateCollection(d.PolicyCollection); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+			if err := h.checkReferences(ctx, w, r, d.PolicyCollection, d.Key); err != nil {
+				h.h.WriteError(w, r, err)
+				return
+			}
+		}
+
+		if err := h.s.Rename(ctx, d.Collection, d.Key, d.NewKey); err != nil {
+			h.h.WriteError(w, r, withConflictingKey(withKey(err, d.Collection, d.Key), d.Collection, d.NewKey))
+			return
+		}
+		h.audit(ctx, d.Key, d.NewKey)
+
+		if err := h.s.Get(ctx, d.Collection, d.NewKey, d.Value); err != nil {
+			h.h.WriteError(w, r, withKey(err, d.Collection, d.NewKey))
+			return
+		}
+		h.write(w, r, d.Value)
+	}))
+}
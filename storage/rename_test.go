@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestRename(t *testing.T) {
+	const collection = "/tests/rename/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.POST("/roles/:id/rename", h.Rename(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*RenameRequest, error) {
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		return &RenameRequest{Collection: collection, Key: ps.ByName("id"), NewKey: body.ID, Value: new(Role)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, id := range []string{"editors", "admins"} {
+		require.NoError(t, m.Upsert(context.Background(), collection, id, &Role{ID: id, Members: []string{id}}))
+	}
+
+	rename := func(t *testing.T, from, to string) (int, []byte) {
+		res, err := ts.Client().Post(ts.URL+"/roles/"+from+"/rename", "application/json", strings.NewReader(`{"id":"`+to+`"}`))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, body
+	}
+
+	t.Run("case=success", func(t *testing.T) {
+		code, body := rename(t, "editors", "writers")
+		require.Equal(t, http.StatusOK, code, "%s", body)
+		assert.JSONEq(t, `{"id":"writers","description":"","members":["editors"]}`, string(body))
+
+		var roles Roles
+		require.NoError(t, m.ListAll(context.Background(), collection, &roles))
+		var ids []string
+		for _, r := range roles {
+			ids = append(ids, r.ID)
+		}
+		assert.Equal(t, []string{"writers", "admins"}, ids)
+	})
+
+	t.Run("case=conflict", func(t *testing.T) {
+		code, body := rename(t, "writers", "admins")
+		require.Equal(t, http.StatusConflict, code, "%s", body)
+		var e struct {
+			Error struct {
+				Details map[string]interface{} `json:"details"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(body, &e))
+		assert.Equal(t, "admins", e.Error.Details["key"])
+
+		var r Role
+		require.NoError(t, m.Get(context.Background(), collection, "writers", &r))
+		require.NoError(t, m.Get(context.Background(), collection, "admins", &r))
+		assert.Equal(t, []string{"admins"}, r.Members)
+	})
+
+	t.Run("case=not found", func(t *testing.T) {
+		code, body := rename(t, "editors", "readers")
+		assert.Equal(t, http.StatusNotFound, code, "%s", body)
+
+		exists, err := m.Exists(context.Background(), collection, "readers")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("case=empty key", func(t *testing.T) {
+		code, body := rename(t, "writers", "")
+		assert.Equal(t, http.StatusBadRequest, code, "%s", body)
+	})
+}
@@ -1,5 +1,17 @@
 package storage
 
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // A list of roles.
 //
 // swagger:ignore
@@ -18,10 +30,115 @@ type Role struct {
 
 	// Members is who belongs to the role.
 	Members []string `json:"members"`
+
+	// Scope limits the role to the resources which match it, for example "projects:1" for the editors of project 1.
+	// The members of a scoped role only hold it for requests on such resources. Like the resources of policies, the
+	// scope may be a pattern. Roles without a scope are global and apply to every resource.
+	Scope string `json:"scope,omitempty"`
+
+	// EffectiveMembers is the flattened set of members including the members of nested roles. It is only set if
+	// the role was listed with expansion enabled and is never stored.
+	EffectiveMembers []string `json:"effective_members,omitempty"`
+
+	// CreatedAt is the time at which the role was first stored. It is only set if timestamps are enabled and is never
+	// stored as part of the role.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UpdatedAt is the time at which the role was last changed. It is only set if timestamps are enabled and is never
+	// stored as part of the role.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Validate trims the whitespace around the scope and the members of the role and removes duplicate members, keeping
+// the first occurrence. Members which are empty after trimming are rejected, as are members not matching format
+// unless it is nil.
+func (r *Role) Validate(format *regexp.Regexp) error {
+	r.Scope = strings.TrimSpace(r.Scope)
+
+	seen := make(map[string]bool, len(r.Members))
+	members := make([]string, 0, len(r.Members))
+	for k, m := range r.Members {
+		trimmed := strings.TrimSpace(m)
+		if trimmed == "" {
+			return errors.Errorf(`role "%s" has the empty member "%s" at index %d`, r.ID, m, k)
+		}
+		if format != nil && !format.MatchString(trimmed) {
+			return errors.Errorf(`role "%s" has the member "%s" at index %d which does not match the format "%s"`, r.ID, trimmed, k, format)
+		}
+		if !seen[trimmed] {
+			seen[trimmed] = true
+			members = append(members, trimmed)
+		}
+	}
+	if r.Members != nil {
+		r.Members = members
+	}
+	return nil
+}
+
+func (r *Role) withMembers(members []string, o *filterOptions) *Role {
+	source := r.Members
+	if o.expand && r != nil {
+		source = r.EffectiveMembers
+	}
+	if r == nil || len(members) == 0 || o.matches(members, source) {
+		return r
+	}
+	return nil
+}
+
+// withQuery applies all filters of ListByQuery to the role.
+func (r *Role) withQuery(m map[string][]string, o *filterOptions) *Role {
+	return r.withMembers(m["member"], o).withIDs(m["id"]).withIDPrefix(m["id_prefix"], o).withEmpty(m["empty"]).
+		withScopes(m["scope"], o)
 }
 
-func (r *Role) withMembers(members []string) *Role {
-	if r == nil || len(members) == 0 || contains(members[0], r.Members) {
+// withScopes keeps the role if one of the scopes matches its scope, including its pattern, and none of the negated
+// scopes does. Global roles have no scope to match, so only negated scopes keep them.
+func (r *Role) withScopes(scopes []string, o *filterOptions) *Role {
+	if r == nil || len(scopes) == 0 {
+		return r
+	}
+
+	var source []string
+	if r.Scope != "" {
+		source = []string{r.Scope}
+	}
+	included, excluded := splitNegations(scopes)
+	if o.excludes(o.containsPattern, excluded, source) {
+		return nil
+	}
+	if len(included) == 0 {
+		return r
+	}
+	for _, scope := range included {
+		if o.containsPattern(scope, source) {
+			return r
+		}
+	}
+	return nil
+}
+
+// inScope returns the roles which apply to the resource: the global roles and the roles whose scope matches it,
+// including its pattern.
+func (rs Roles) inScope(resource string, o *filterOptions) Roles {
+	res := make(Roles, 0, len(rs))
+	for k := range rs {
+		if rs[k].Scope == "" || o.containsPattern(resource, []string{rs[k].Scope}) {
+			res = append(res, rs[k])
+		}
+	}
+	return res
+}
+
+// withEmpty keeps the role if it has no members and the value is "true", or if it has members and the value is
+// "false". Only the stored members count, even if the roles are expanded. Values which are not booleans are rejected
+// by validateEmptyFilter.
+func (r *Role) withEmpty(values []string) *Role {
+	if r == nil || len(values) == 0 || values[0] == "" {
+		return r
+	}
+	if empty, err := strconv.ParseBool(values[0]); err != nil || empty == (len(r.Members) == 0) {
 		return r
 	}
 	return nil
@@ -33,3 +150,152 @@ func (r *Role) withIDs(ids []string) *Role {
 	}
 	return nil
 }
+
+// withIDPrefix returns the role if its ID starts with one of the prefixes.
+func (r *Role) withIDPrefix(prefixes []string, o *filterOptions) *Role {
+	if r == nil || len(prefixes) == 0 {
+		return r
+	}
+	for _, prefix := range prefixes {
+		if o.hasPrefix(r.ID, prefix) {
+			return r
+		}
+	}
+	return nil
+}
+
+// DefaultMaxExpansionDepth is the number of levels of nested roles which are expanded by default, see
+// FilterRegistry.SetMaxExpansionDepth.
+const DefaultMaxExpansionDepth = 32
+
+// expand sets the effective members of every role. A member which is the ID of another role in the list is replaced
+// by the effective members of that role. Roles which are reached more than once, for example because of a cycle or
+// a diamond shaped graph, are only expanded once. It fails with 422 if a role contains roles nested more than
+// maxDepth levels deep.
+func (rs Roles) expand(maxDepth int) error {
+	index := make(map[string]*Role, len(rs))
+	for k := range rs {
+		index[rs[k].ID] = &rs[k]
+	}
+
+	for k := range rs {
+		members := map[string]bool{}
+		if !rs.collectMembers(&rs[k], index, map[string]bool{}, members, maxDepth) {
+			return errors.WithStack(errUnprocessableEntity.
+				WithReasonf("Unable to expand role %s because its members are nested more than %d levels deep.", rs[k].ID, maxDepth).
+				WithDetail("key", rs[k].ID).
+				WithDetail("max_depth", maxDepth))
+		}
+
+		rs[k].EffectiveMembers = make([]string, 0, len(members))
+		for m := range members {
+			rs[k].EffectiveMembers = append(rs[k].EffectiveMembers, m)
+		}
+		sort.Strings(rs[k].EffectiveMembers)
+	}
+	return nil
+}
+
+// collectMembers adds the members of the role to members, expanding nested roles at most depth levels deep. It
+// returns false if the role contains roles nested deeper.
+func (rs Roles) collectMembers(r *Role, index map[string]*Role, visited map[string]bool, members map[string]bool, depth int) bool {
+	if visited[r.ID] {
+		return true
+	}
+	visited[r.ID] = true
+
+	for _, m := range r.Members {
+		if nested, ok := index[m]; ok {
+			if depth == 0 || !rs.collectMembers(nested, index, visited, members, depth-1) {
+				return false
+			}
+			continue
+		}
+		members[m] = true
+	}
+	return true
+}
+
+// ancestors returns the roles which contain the role with the given ID transitively, ordered by their distance to it:
+// first the roles which have it as a member, then the roles which have those as a member, and so on. Roles at the same
+// distance keep their order in the list. Every role is returned at most once, so cycles end the traversal, and the role
+// itself is never returned.
+func (rs Roles) ancestors(id string) Roles {
+	parents := map[string][]int{}
+	for k := range rs {
+		for _, m := range rs[k].Members {
+			parents[m] = append(parents[m], k)
+		}
+	}
+
+	visited := map[string]bool{id: true}
+	res := make(Roles, 0)
+	for queue := []string{id}; len(queue) > 0; queue = queue[1:] {
+		for _, k := range parents[queue[0]] {
+			if visited[rs[k].ID] {
+				continue
+			}
+			visited[rs[k].ID] = true
+			res = append(res, rs[k])
+			queue = append(queue, rs[k].ID)
+		}
+	}
+	return res
+}
+
+// memberOf returns the sorted IDs of the roles which contain the member, directly or through other roles.
+func (rs Roles) memberOf(member string) []string {
+	ancestors := rs.ancestors(member)
+	ids := make([]string, len(ancestors))
+	for k := range ancestors {
+		ids[k] = ancestors[k].ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// updateRole decodes the role document, applies f, and encodes the result.
+func updateRole(document []byte, f func(*Role) error) ([]byte, error) {
+	var r Role
+	if err := json.Unmarshal(document, &r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := f(&r); err != nil {
+		return nil, err
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(&r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return b.Bytes(), nil
+}
+
+// addMember adds the member to the role document. Adding an existing member does nothing.
+func addMember(document []byte, member string) ([]byte, error) {
+	return updateRole(document, func(r *Role) error {
+		if !contains(member, r.Members) {
+			r.Members = append(r.Members, member)
+		}
+		return nil
+	})
+}
+
+// removeMember removes the member from the role document and fails with a not found error if it is no member.
+func removeMember(document []byte, member string) ([]byte, error) {
+	return updateRole(document, func(r *Role) error {
+		if !contains(member, r.Members) {
+			return notFoundf("Role %s has no member %s.", r.ID, member)
+		}
+
+		members := make([]string, 0, len(r.Members)-1)
+		for _, m := range r.Members {
+			if m != member {
+				members = append(members, m)
+			}
+		}
+		r.Members = members
+		return nil
+	})
+}
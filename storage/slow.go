@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/ory/x/logrusx"
+)
+
+// DefaultSlowQueryThreshold is the duration of loading and filtering a whole collection above which a warning is
+// logged by default.
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+// WithLogger sets the logger which receives the warnings of the handler, such as slow queries, and at debug level how
+// list requests were filtered. Nothing is logged by default.
+func WithLogger(l *logrusx.Logger) HandlerOption {
+	return func(h *Handler) {
+		h.l = l
+	}
+}
+
+// WithSlowQueryThreshold sets the duration of loading and filtering a whole collection above which a warning is logged
+// and the slow query metric is incremented. Defaults to DefaultSlowQueryThreshold. Zero or less disables it.
+func WithSlowQueryThreshold(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.slowQueryThreshold = d
+	}
+}
+
+// observeQuery reports a filtered query which loaded the whole collection if it took longer than the slow query
+// threshold. The query holds the filter parameters of the request and size is the number of matching entries.
+func (h *Handler) observeQuery(ctx context.Context, collection string, query url.Values, start time.Time, size int) {
+	took := time.Since(start)
+	if h.slowQueryThreshold <= 0 || took <= h.slowQueryThreshold {
+		return
+	}
+
+	h.metrics.slowQuery(path.Base(collection))
+	if h.l == nil {
+		return
+	}
+
+	h.l.WithContext(ctx).
+		WithField("collection", collection).
+		WithField("filters", query.Encode()).
+		WithField("duration", took.String()).
+		WithField("size", size).
+		WithField("threshold", h.slowQueryThreshold.String()).
+		Warn("Filtering the collection was slow, consider narrowing the filters or paginating with a cursor.")
+}
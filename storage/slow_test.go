@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/logrusx"
+)
+
+type slowListManager struct {
+	*MemoryManager
+	delay time.Duration
+}
+
+func (m *slowListManager) ListAll(ctx context.Context, collection string, value interface{}) error {
+	time.Sleep(m.delay)
+	return m.MemoryManager.ListAll(ctx, collection, value)
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	const collection = "/tests/slow/roles"
+
+	m := &slowListManager{MemoryManager: NewMemoryManager(), delay: 20 * time.Millisecond}
+	require.NoError(t, m.UpsertMany(context.Background(), collection, map[string]interface{}{
+		"admins":  &Role{ID: "admins", Members: []string{"alice"}},
+		"editors": &Role{ID: "editors", Members: []string{"bob"}},
+	}))
+
+	newServer := func(opts ...HandlerOption) *httptest.Server {
+		h := NewHandler(m, herodot.NewJSONWriter(nil), opts...)
+		r := httprouter.New()
+		factory := func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+			return &ListRequest{Collection: collection, Value: new(Roles), FilterFunc: ListByQuery}, nil
+		}
+		r.GET("/roles", h.List(factory))
+		r.GET("/count", h.Count(factory))
+		return httptest.NewServer(r)
+	}
+
+	get := func(t *testing.T, ts *httptest.Server, path string) {
+		res, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	t.Run("case=logs slow filtered queries", func(t *testing.T) {
+		hook := new(test.Hook)
+		metrics, err := NewMetrics(prometheus.NewRegistry())
+		require.NoError(t, err)
+		ts := newServer(WithSlowQueryThreshold(time.Millisecond), WithMetrics(metrics),
+			WithLogger(logrusx.New("", "", logrusx.WithHook(hook), logrusx.ForceLevel(logrus.WarnLevel))))
+		defer ts.Close()
+
+		get(t, ts, "/roles?member=alice")
+		get(t, ts, "/count?member=bob")
+		get(t, ts, "/roles")
+
+		entries := hook.AllEntries()
+		require.Len(t, entries, 2)
+		for k, filters := range []string{"member=alice", "member=bob"} {
+			assert.Equal(t, logrus.WarnLevel, entries[k].Level)
+			assert.Equal(t, collection, entries[k].Data["collection"])
+			assert.Equal(t, filters, entries[k].Data["filters"])
+			assert.Equal(t, 1, entries[k].Data["size"])
+			assert.NotEmpty(t, entries[k].Data["duration"])
+		}
+		assert.Equal(t, float64(2), testutil.ToFloat64(metrics.slowQueries.WithLabelValues("roles")))
+	})
+
+	t.Run("case=ignores fast queries", func(t *testing.T) {
+		hook := new(test.Hook)
+		ts := newServer(WithSlowQueryThreshold(time.Hour), WithLogger(logrusx.New("", "", logrusx.WithHook(hook))))
+		defer ts.Close()
+
+		get(t, ts, "/roles?member=alice")
+		assert.Empty(t, hook.AllEntries())
+	})
+
+	t.Run("case=disabled", func(t *testing.T) {
+		hook := new(test.Hook)
+		ts := newServer(WithSlowQueryThreshold(0), WithLogger(logrusx.New("", "", logrusx.WithHook(hook))))
+		defer ts.Close()
+
+		get(t, ts, "/roles?member=alice")
+		assert.Empty(t, hook.AllEntries())
+	})
+}
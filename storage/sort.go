@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// roleSortFields are the fields roles can be sorted by. Roles with the same timestamp are sorted by id.
+var roleSortFields = map[string]func(a, b *Role) bool{
+	"id":         func(a, b *Role) bool { return a.ID < b.ID },
+	"created_at": func(a, b *Role) bool { return timeLess(a.CreatedAt, b.CreatedAt, a.ID, b.ID) },
+	"updated_at": func(a, b *Role) bool { return timeLess(a.UpdatedAt, b.UpdatedAt, a.ID, b.ID) },
+}
+
+// policySortFields are the fields policies can be sorted by. Policies with the same effect or timestamp are sorted by
+// id.
+var policySortFields = map[string]func(a, b *Policy) bool{
+	"id": func(a, b *Policy) bool { return a.ID < b.ID },
+	"effect": func(a, b *Policy) bool {
+		if a.Effect == b.Effect {
+			return a.ID < b.ID
+		}
+		return a.Effect < b.Effect
+	},
+	"created_at": func(a, b *Policy) bool { return timeLess(a.CreatedAt, b.CreatedAt, a.ID, b.ID) },
+	"updated_at": func(a, b *Policy) bool { return timeLess(a.UpdatedAt, b.UpdatedAt, a.ID, b.ID) },
+}
+
+// timeLess compares two timestamps, sorting missing ones first and equal ones by id.
+func timeLess(a, b *time.Time, aID, bID string) bool {
+	switch {
+	case a == nil && b == nil:
+		return aID < bID
+	case a == nil || b == nil:
+		return a == nil
+	case a.Equal(*b):
+		return aID < bID
+	}
+	return a.Before(*b)
+}
+
+func (o *filterOptions) sortRoles(rs Roles) error {
+	less, ok := roleSortFields[o.sort]
+	if !ok {
+		return unknownSortField(o.sort, "id", "created_at", "updated_at")
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		if o.desc {
+			return less(&rs[j], &rs[i])
+		}
+		return less(&rs[i], &rs[j])
+	})
+	return nil
+}
+
+func (o *filterOptions) sortPolicies(ps Policies) error {
+	less, ok := policySortFields[o.sort]
+	if !ok {
+		return unknownSortField(o.sort, "id", "effect", "created_at", "updated_at")
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		if o.desc {
+			return less(&ps[j], &ps[i])
+		}
+		return less(&ps[i], &ps[j])
+	})
+	return nil
+}
+
+func unknownSortField(field string, fields ...string) error {
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "sort" must be one of "%s" but got "%s".`, strings.Join(fields, `", "`), field))
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStreamThreshold is the collection size above which filtered lists are streamed.
+const DefaultStreamThreshold = 10000
+
+// streamUnsupportedKeys are query parameters which need the whole collection at once and therefore can not be
+// applied while streaming.
+var streamUnsupportedKeys = []string{"sort", "order", "expand"}
+
+// stream applies the filters of ListByQuery while streaming the collection from the backend. Only the requested page is
+// kept in memory, so memory usage is bounded by the limit instead of the collection size. The backend streams the
+// collection ordered by key, which is the ID of roles and policies, so streamed lists are sorted ascending by id like
+// the filtered lists which are not streamed. It returns false if the list request can not be streamed or if the
+// collection is not larger than the stream threshold, and the number of all matching entries otherwise.
+func (h *Handler) stream(ctx context.Context, l *ListRequest, m map[string][]string, limit, offset int) (bool, int, error) {
+	if !h.filters.isFilter(l.Collection, m) || !usesListByQuery(l) || !h.filters.streamable(l) {
+		return false, 0, nil
+	}
+	for _, k := range streamUnsupportedKeys {
+		if _, ok := m[k]; ok {
+			return false, 0, nil
+		}
+	}
+
+	n, err := h.s.Count(ctx, l.Collection)
+	if err != nil {
+		return false, 0, err
+	}
+	if n <= h.streamThreshold {
+		return false, 0, nil
+	}
+
+	m = splitFilterValues(m)
+	o, err := parseFilterOptions(m)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var match func(raw json.RawMessage) (interface{}, error)
+	switch l.Value.(type) {
+	case *Roles:
+		match = func(raw json.RawMessage) (interface{}, error) {
+			var r Role
+			if err := decodeItem(raw, &r); err != nil {
+				return nil, err
+			}
+			if f := r.withQuery(m, o); f != nil {
+				return *f, nil
+			}
+			return nil, o.err
+		}
+	case *Policies:
+		match = func(raw json.RawMessage) (interface{}, error) {
+			var p Policy
+			if err := decodeItem(raw, &p); err != nil {
+				return nil, err
+			}
+			if f := p.withQuery(m, o); f != nil {
+				return *f, nil
+			}
+			return nil, o.err
+		}
+	default:
+		return false, 0, nil
+	}
+
+	page := reflect.MakeSlice(reflect.TypeOf(l.Value).Elem(), 0, 0)
+	var total int
+	if err := h.s.Stream(ctx, l.Collection, func(raw json.RawMessage) error {
+		item, err := match(raw)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return nil
+		}
+
+		if total >= offset && total-offset < limit {
+			page = reflect.Append(page, reflect.ValueOf(item))
+		}
+		total++
+		return nil
+	}); err != nil {
+		return false, 0, err
+	}
+
+	start, end := index(limit, offset, total)
+	h.debugFilter(ctx, l.Collection, m, n, total, start, end)
+
+	reflect.ValueOf(l.Value).Elem().Set(page)
+	return true, total, nil
+}
+
+// usesListByQuery checks if the list request is filtered by ListByQuery, whose filters are the only ones which can be
+// applied while streaming.
+func usesListByQuery(l *ListRequest) bool {
+	return l.FilterFunc != nil && reflect.ValueOf(l.FilterFunc).Pointer() == reflect.ValueOf(ListByQuery).Pointer()
+}
+
+// decodeItem decodes a stored document as strictly as roundTrip does.
+func decodeItem(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// errTimeout is returned if a storage operation did not complete before the deadline of its context.
+var errTimeout = herodot.DefaultError{
+	StatusField: http.StatusText(http.StatusServiceUnavailable),
+	ErrorField:  "storage operation timed out",
+	CodeField:   http.StatusServiceUnavailable,
+}
+
+// WithTimeout limits the time a request may spend on storage operations. The deadline is added to the request
+// context, so a shorter deadline set by the caller is kept. Requests exceeding it are answered with 503. Exports are
+// limited as well. There is no limit by default.
+func WithTimeout(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.timeout = d
+	}
+}
+
+// timeoutWriter reports an exceeded deadline as errTimeout instead of as an internal error.
+type timeoutWriter struct {
+	herodot.Writer
+}
+
+func (w *timeoutWriter) WriteError(rw http.ResponseWriter, r *http.Request, err error, opts ...herodot.Option) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.WithStack(errTimeout.WithReason("The storage operation did not complete before the deadline of the request."))
+	}
+	w.Writer.WriteError(rw, r, err, opts...)
+}
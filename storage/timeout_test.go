@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+// slowManager blocks every Get until its context is done.
+type slowManager struct {
+	Manager
+}
+
+func (slowManager) Get(ctx context.Context, _ string, _ string, _ interface{}) error {
+	<-ctx.Done()
+	return errors.WithStack(ctx.Err())
+}
+
+func TestTimeout(t *testing.T) {
+	h := NewHandler(slowManager{Manager: NewMemoryManager()}, herodot.NewJSONWriter(nil), WithTimeout(10*time.Millisecond))
+	r := httprouter.New()
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "timeout", Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := ts.Client().Get(ts.URL + "/roles/foo")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, "storage operation timed out", body.Error.Message)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// WithTimestamps adds the fields "created_at" and "updated_at", see Manager.Timestamps, to the policies and roles in
+// the responses of Get, GetMany and List if enabled, so that "sort=created_at" and "sort=updated_at" order them by
+// these timestamps. If disabled, both fields are omitted and sorting by them orders the entries by their ID. Disabled
+// by default.
+func WithTimestamps(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.timestamps = enabled
+	}
+}
+
+// timestamped is implemented by values which carry the timestamps of their entry, such as *Policy and *Role.
+type timestamped interface {
+	storageKey() string
+	setTimestamps(t *Timestamps)
+}
+
+func (p *Policy) storageKey() string {
+	return p.ID
+}
+
+func (p *Policy) setTimestamps(t *Timestamps) {
+	p.CreatedAt, p.UpdatedAt = timestampFields(t)
+}
+
+func (r *Role) storageKey() string {
+	return r.ID
+}
+
+func (r *Role) setTimestamps(t *Timestamps) {
+	r.CreatedAt, r.UpdatedAt = timestampFields(t)
+}
+
+func timestampFields(t *Timestamps) (createdAt, updatedAt *time.Time) {
+	if t == nil {
+		return nil, nil
+	}
+	c, u := t.CreatedAt, t.UpdatedAt
+	return &c, &u
+}
+
+// timestampedValues returns the values which carry timestamps, either the value itself or the elements of the slice it
+// points to.
+func timestampedValues(value interface{}) []timestamped {
+	if t, ok := value.(timestamped); ok {
+		return []timestamped{t}
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+
+	var res []timestamped
+	for k := 0; k < v.Elem().Len(); k++ {
+		if t, ok := v.Elem().Index(k).Addr().Interface().(timestamped); ok {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// clearTimestamps removes the timestamps from a value which is about to be written, because they are recorded by the
+// Manager and are never stored as part of the value.
+func clearTimestamps(value interface{}) {
+	for _, v := range timestampedValues(value) {
+		v.setTimestamps(nil)
+	}
+}
+
+// addTimestamps sets the timestamps of the value, or of the elements of the slice it points to, if timestamps are
+// enabled. Values without timestamps are left as they are.
+func (h *Handler) addTimestamps(ctx context.Context, collection string, value interface{}) error {
+	if !h.timestamps {
+		return nil
+	}
+
+	values := timestampedValues(value)
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(values))
+	for k, v := range values {
+		keys[k] = v.storageKey()
+	}
+
+	ts, err := h.s.Timestamps(ctx, collection, keys)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if t, ok := ts[v.storageKey()]; ok {
+			v.setTimestamps(&t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// includeDeletedParam is the query parameter which adds tombstones to the responses of Get and List.
+const includeDeletedParam = "include_deleted"
+
+// WithSoftDelete makes Delete keep the removed entries as tombstones, see Manager.SoftDelete, so that they can be
+// brought back with Restore. The query parameter "purge" still removes an entry for good. Disabled by default.
+func WithSoftDelete(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.softDelete = enabled
+	}
+}
+
+// RestoreRequest is a request to restore the tombstone of a key. The restored value is decoded into Value.
+type RestoreRequest struct {
+	Collection string
+	Key        string
+	Value      interface{}
+}
+
+// Restore moves the tombstone of the key back into the collection and responds with the restored value. Responds with
+// 404 if the key has no tombstone and with 409 if the key has been written again since it was deleted.
+func (h *Handler) Restore(factory func(context.Context, *http.Request, httprouter.Params) (*RestoreRequest, error)) httprouter.Handle {
+	return h.instrument("restore", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		d, err := factory(ctx, r, ps)
+		if err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		annotate(ctx, d.Collection)
+
+		if err := validateCollection(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkWritable(d.Collection); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+		if err := h.checkProtected(ctx, r, d.Key); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.s.Restore(ctx, d.Collection, d.Key); err != nil {
+			h.h.WriteError(w, r, withKey(err, d.Collection, d.Key))
+			return
+		}
+		h.audit(ctx, d.Key)
+
+		if err := h.s.Get(ctx, d.Collection, d.Key, d.Value); err != nil {
+			h.h.WriteError(w, r, withKey(err, d.Collection, d.Key))
+			return
+		}
+		h.h.Write(w, r, d.Value)
+	})
+}
+
+// delete removes the key for good if purge is set or soft deletion is disabled, and keeps it as a tombstone otherwise.
+// Purging also removes an earlier tombstone of the key.
+func (h *Handler) delete(ctx context.Context, collection, key string, purge bool) error {
+	return h.deleteFrom(ctx, h.s, collection, key, purge)
+}
+
+// deleteFrom is delete against m, so that keys can be removed in a transaction.
+func (h *Handler) deleteFrom(ctx context.Context, m Manager, collection, key string, purge bool) error {
+	if !purge {
+		if h.softDelete {
+			return m.SoftDelete(ctx, collection, key)
+		}
+		return m.Delete(ctx, collection, key)
+	}
+
+	if err := m.Delete(ctx, collection, key); err != nil {
+		return err
+	}
+	if err := m.Purge(ctx, collection, key); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// deleteMany removes the keys from m like delete. They are removed at once unless they are kept as tombstones or
+// purged, which happens key by key.
+func (h *Handler) deleteMany(ctx context.Context, m Manager, collection string, keys []string, purge bool) error {
+	if !purge && !h.softDelete {
+		_, err := m.DeleteMany(ctx, collection, keys)
+		return err
+	}
+
+	for _, key := range keys {
+		if err := h.deleteFrom(ctx, m, collection, key, purge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tombstone returns the tombstone of the key.
+func (h *Handler) tombstone(ctx context.Context, collection, key string) (*Tombstone, error) {
+	ts, err := h.s.ListDeleted(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	for k := range ts {
+		if ts[k].Key == key {
+			return &ts[k], nil
+		}
+	}
+	return nil, notFoundf("Unable to locate deleted key %s in collection %s.", key, collection)
+}
+
+// getDeleted decodes the tombstone of the key into value, calls the PostLoad hook f, and returns the value with its
+// deletion time.
+func (h *Handler) getDeleted(ctx context.Context, collection, key string, value interface{}, f func(interface{}) error) (json.RawMessage, error) {
+	t, err := h.tombstone(ctx, collection, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeItem(t.Data, value); err != nil {
+		return nil, err
+	}
+	if err := postLoad(f, value); err != nil {
+		return nil, err
+	}
+	return withDeletedAt(value, t.DeletedAt)
+}
+
+// listDeleted lists the whole collection together with its tombstones, which follow the stored entries ordered by
+// key, and then applies the filters and the pagination like a filtered list. The stored entries and the tombstones are
+// filtered on their own, so a deleted role does not take part in the expansion of the stored ones. It returns the
+// number of all matching entries and the page, in which tombstones carry their deletion time in the field
+// "deleted_at".
+func (h *Handler) listDeleted(ctx context.Context, l *ListRequest, m url.Values, limit, offset int) (int, []json.RawMessage, error) {
+	if _, ok := m[pageTokenParam]; ok {
+		return 0, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Query parameter "%s" can not be combined with "%s".`, includeDeletedParam, pageTokenParam))
+	}
+
+	if err := h.s.ListAll(ctx, l.Collection, l.Value); err != nil {
+		return 0, nil, err
+	}
+
+	ts, err := h.s.ListDeleted(ctx, l.Collection)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	v := reflect.ValueOf(l.Value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return 0, nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to list tombstones of type %T.", l.Value))
+	}
+	tv := reflect.New(v.Elem().Type())
+	tv.Elem().Set(reflect.MakeSlice(v.Elem().Type(), 0, len(ts)))
+	deleted := make(map[string]time.Time, len(ts))
+	for _, t := range ts {
+		e := reflect.New(v.Elem().Type().Elem())
+		if err := decodeItem(t.Data, e.Interface()); err != nil {
+			return 0, nil, err
+		}
+		tv.Elem().Set(reflect.Append(tv.Elem(), e.Elem()))
+		deleted[t.Key] = t.DeletedAt
+	}
+
+	if err := h.filter(l, m, 0, math.MaxInt32); err != nil {
+		return 0, nil, err
+	}
+	tl := *l
+	tl.Value = tv.Interface()
+	if err := h.filter(&tl, m, 0, math.MaxInt32); err != nil {
+		return 0, nil, err
+	}
+
+	// the entries from the index stored on are the tombstones, even if a stored entry has the same key.
+	stored := length(l.Value)
+	all := reflect.ValueOf(l.Value).Elem()
+	all.Set(reflect.AppendSlice(all, reflect.ValueOf(tl.Value).Elem()))
+	total := all.Len()
+	start, _ := index(limit, offset, total)
+	paginate(l.Value, limit, offset)
+
+	ids, err := elementIDs(l.Value)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := postLoad(l.PostLoad, l.Value); err != nil {
+		return 0, nil, err
+	}
+
+	page := reflect.ValueOf(l.Value).Elem()
+	res := make([]json.RawMessage, page.Len())
+	for k := range res {
+		b, err := json.Marshal(page.Index(k).Interface())
+		if err != nil {
+			return 0, nil, errors.WithStack(err)
+		}
+		if start+k >= stored {
+			if b, err = withDeletedAt(json.RawMessage(b), deleted[ids[k]]); err != nil {
+				return 0, nil, err
+			}
+		}
+		res[k] = b
+	}
+	return total, res, nil
+}
+
+// withDeletedAt encodes the value, which must encode to a JSON object, with the additional field "deleted_at".
+func withDeletedAt(value interface{}, deletedAt time.Time) (json.RawMessage, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	t, err := json.Marshal(deletedAt.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	b = bytes.TrimSpace(b)
+	if len(b) < 2 || b[0] != '{' {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to mark value of type %T as deleted.", value))
+	}
+
+	res := append([]byte{}, b[:len(b)-1]...)
+	if len(b) > 2 {
+		res = append(res, ',')
+	}
+	res = append(res, `"deleted_at":`...)
+	res = append(res, t...)
+	return append(res, '}'), nil
+}
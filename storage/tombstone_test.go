@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestSoftDelete(t *testing.T) {
+	const collection = "/tests/softdelete/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithSoftDelete(true))
+	r := httprouter.New()
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: collection, Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	r.DELETE("/roles/:id", h.Delete(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteRequest, error) {
+		return &DeleteRequest{Collection: collection, Key: ps.ByName("id")}, nil
+	}))
+	r.POST("/roles/:id/restore", h.Restore(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*RestoreRequest, error) {
+		return &RestoreRequest{Collection: collection, Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, id := range []string{"alice", "bob", "carol"} {
+		require.NoError(t, m.Upsert(context.Background(), collection, id, &Role{ID: id, Members: []string{id}}))
+	}
+
+	do := func(t *testing.T, method, path string) (int, []byte) {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, body
+	}
+
+	list := func(t *testing.T, query string) []map[string]interface{} {
+		code, body := do(t, "GET", "/roles"+query)
+		require.Equal(t, http.StatusOK, code, "%s", body)
+		var roles []map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &roles))
+		return roles
+	}
+
+	ids := func(roles []map[string]interface{}) []string {
+		res := []string{}
+		for _, r := range roles {
+			res = append(res, r["id"].(string))
+		}
+		return res
+	}
+
+	code, _ := do(t, "DELETE", "/roles/bob")
+	require.Equal(t, http.StatusNoContent, code)
+	code, _ = do(t, "DELETE", "/roles/carol?purge=true")
+	require.Equal(t, http.StatusNoContent, code)
+
+	t.Run("case=deleted entries are hidden", func(t *testing.T) {
+		assert.Equal(t, []string{"alice"}, ids(list(t, "")))
+
+		code, _ := do(t, "GET", "/roles/bob")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("case=include deleted", func(t *testing.T) {
+		roles := list(t, "?include_deleted=true")
+		assert.Equal(t, []string{"alice", "bob"}, ids(roles))
+		assert.NotContains(t, roles[0], "deleted_at")
+		assert.NotEmpty(t, roles[1]["deleted_at"])
+
+		assert.Equal(t, []string{"bob"}, ids(list(t, "?include_deleted=true&member=bob")))
+
+		code, body := do(t, "GET", "/roles/bob?include_deleted=true")
+		require.Equal(t, http.StatusOK, code)
+		var role map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &role))
+		assert.Equal(t, "bob", role["id"])
+		assert.NotEmpty(t, role["deleted_at"])
+
+		code, body = do(t, "GET", "/roles/carol?include_deleted=true")
+		require.Equal(t, http.StatusNotFound, code)
+		var e struct {
+			Error struct {
+				Details map[string]interface{} `json:"details"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(body, &e))
+		assert.Equal(t, map[string]interface{}{"collection": collection, "key": "carol"}, e.Error.Details)
+
+		code, _ = do(t, "GET", "/roles?include_deleted=true&page_token=")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("case=restore", func(t *testing.T) {
+		code, body := do(t, "POST", "/roles/bob/restore")
+		require.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"id":"bob","description":"","members":["bob"]}`, string(body))
+		assert.Equal(t, []string{"alice", "bob"}, ids(list(t, "")))
+
+		code, _ = do(t, "POST", "/roles/bob/restore")
+		assert.Equal(t, http.StatusConflict, code)
+		code, _ = do(t, "POST", "/roles/carol/restore")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("case=purge removes the tombstone", func(t *testing.T) {
+		code, _ := do(t, "DELETE", "/roles/alice")
+		require.Equal(t, http.StatusNoContent, code)
+		code, _ = do(t, "DELETE", "/roles/alice?purge=true")
+		require.Equal(t, http.StatusNoContent, code)
+
+		code, _ = do(t, "POST", "/roles/alice/restore")
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, []string{"bob"}, ids(list(t, "?include_deleted=true")))
+	})
+
+	t.Run("case=re-created keys are listed twice", func(t *testing.T) {
+		code, _ := do(t, "DELETE", "/roles/bob")
+		require.Equal(t, http.StatusNoContent, code)
+		require.NoError(t, m.Upsert(context.Background(), collection, "bob", &Role{ID: "bob", Members: []string{"dave"}}))
+
+		roles := list(t, "?include_deleted=true")
+		require.Equal(t, []string{"bob", "bob"}, ids(roles))
+		assert.NotContains(t, roles[0], "deleted_at")
+		assert.Equal(t, []interface{}{"dave"}, roles[0]["members"])
+		assert.NotEmpty(t, roles[1]["deleted_at"])
+		assert.Equal(t, []interface{}{"bob"}, roles[1]["members"])
+
+		roles = list(t, "?include_deleted=true&member=dave")
+		require.Len(t, roles, 1)
+		assert.NotContains(t, roles[0], "deleted_at")
+
+		roles = list(t, "?include_deleted=true&member=bob")
+		require.Len(t, roles, 1)
+		assert.NotEmpty(t, roles[0]["deleted_at"])
+
+		roles = list(t, "?include_deleted=true&offset=1&limit=1")
+		require.Len(t, roles, 1)
+		assert.NotEmpty(t, roles[0]["deleted_at"])
+	})
+}
+
+func TestSoftDeleteMany(t *testing.T) {
+	const collection = "/tests/softdelete/bulk/roles"
+
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithSoftDelete(true))
+	r := httprouter.New()
+	r.DELETE("/roles", h.DeleteMany(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*DeleteManyRequest, error) {
+		return &DeleteManyRequest{Collection: collection, Keys: r.URL.Query()["id"]}, nil
+	}))
+	r.PUT("/roles", h.Reconcile(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ReconcileRequest, error) {
+		var roles Roles
+		if err := json.NewDecoder(r.Body).Decode(&roles); err != nil {
+			return nil, err
+		}
+		entries := make([]UpsertEntry, len(roles))
+		for k := range roles {
+			entries[k] = UpsertEntry{Key: roles[k].ID, Value: &roles[k]}
+		}
+		return &ReconcileRequest{Collection: collection, Entries: entries, Current: &Roles{}}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) int {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	tombstones := func(t *testing.T) []string {
+		ts, err := m.ListDeleted(context.Background(), collection)
+		require.NoError(t, err)
+		keys := []string{}
+		for _, t := range ts {
+			keys = append(keys, t.Key)
+		}
+		return keys
+	}
+
+	reset := func(t *testing.T) {
+		_, err := m.Clear(context.Background(), collection)
+		require.NoError(t, err)
+		for _, id := range []string{"alice", "bob", "carol"} {
+			require.NoError(t, m.Upsert(context.Background(), collection, id, &Role{ID: id, Members: []string{id}}))
+		}
+	}
+
+	for _, query := range []string{"", "&atomic=false"} {
+		t.Run("query="+query, func(t *testing.T) {
+			reset(t)
+
+			code := do(t, "DELETE", "/roles?id=alice&id=bob"+query, "")
+			require.Contains(t, []int{http.StatusNoContent, http.StatusMultiStatus}, code)
+			assert.Equal(t, []string{"alice", "bob"}, tombstones(t))
+
+			code = do(t, "DELETE", "/roles?id=alice&id=carol&purge=true"+query, "")
+			require.Contains(t, []int{http.StatusNoContent, http.StatusMultiStatus}, code)
+			assert.Equal(t, []string{"bob"}, tombstones(t))
+
+			exists, err := m.Exists(context.Background(), collection, "carol")
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+
+	t.Run("case=reconcile", func(t *testing.T) {
+		reset(t)
+
+		code := do(t, "PUT", "/roles?prune=true", `[{"id":"alice","members":["alice"]}]`)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"bob", "carol"}, tombstones(t))
+
+		require.NoError(t, m.Upsert(context.Background(), collection, "dave", &Role{ID: "dave", Members: []string{"dave"}}))
+		code = do(t, "PUT", "/roles?prune=true&purge=true", `[{"id":"alice","members":["alice"]}]`)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"bob", "carol"}, tombstones(t))
+
+		exists, err := m.Exists(context.Background(), collection, "dave")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
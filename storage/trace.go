@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// PolicyTrace is how a policy was matched against an access request.
+//
+// swagger:ignore
+type PolicyTrace struct {
+	// ID is the ID of the policy.
+	ID string `json:"id"`
+
+	// Effect is the effect of the policy, "allow" or "deny".
+	Effect string `json:"effect"`
+
+	// Subject is true if the subjects of the policy match the subject of the request or one of its roles.
+	Subject bool `json:"subject"`
+
+	// Action is true if the actions of the policy match the action of the request.
+	Action bool `json:"action"`
+
+	// Resource is true if the resources of the policy match the resource of the request.
+	Resource bool `json:"resource"`
+
+	// Active is true if the request is made within the validity window of the policy.
+	Active bool `json:"active"`
+
+	// Conditions is true if the context of the request fulfills the conditions of the policy. It is only set if the
+	// subject, action, and resource match, because the conditions are not evaluated otherwise.
+	Conditions *bool `json:"conditions,omitempty"`
+
+	// Matched is true if the policy matched the request, so that its effect took part in the decision.
+	Matched bool `json:"matched"`
+
+	// Error is why the policy could not be matched, because one of its patterns is malformed. Such a policy never
+	// matches.
+	Error string `json:"error,omitempty"`
+}
+
+// DecisionTrace is a Decision together with how every policy was matched against the access request.
+//
+// swagger:ignore
+type DecisionTrace struct {
+	Decision
+
+	// DecidedBy are the IDs of the matching policies whose effect decided the request. It is empty if the request was
+	// decided by the default decision.
+	DecidedBy []string `json:"decided_by"`
+
+	// Policies is how every policy was matched, in the order in which they were evaluated.
+	Policies []PolicyTrace `json:"policies"`
+}
+
+// Explain decides the request like Decide and traces how every policy was matched against it. Unlike Allowed, no
+// policy is skipped, which makes it considerably more expensive, so it is meant for debugging unexpected decisions.
+func (e *Evaluator) Explain(ctx context.Context, subject, action, resource string, env map[string]interface{}, policies Policies) (*DecisionTrace, error) {
+	t := &DecisionTrace{Policies: []PolicyTrace{}}
+	d, err := e.decideTraced(ctx, subject, action, resource, env, policies, true, &t.Policies)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Decision = *d
+	switch {
+	case d.Default:
+		t.DecidedBy = []string{}
+	case d.Effect == effectAllow:
+		t.DecidedBy = d.AllowedBy
+	default:
+		t.DecidedBy = d.DeniedBy
+	}
+	return t, nil
+}
+
+// tracePolicy matches the policy against the request with the same checks as evaluate, but does not stop at the
+// first check which fails so that the trace tells all of them. The subjects are matched with anyOf, the action and
+// the resource with o. The conditions are only evaluated if the subject, action, and resource match.
+func tracePolicy(p *Policy, subjects []string, action, resource string, now time.Time, applies func(*Policy) bool, o, anyOf *filterOptions) PolicyTrace {
+	t := PolicyTrace{
+		ID:       p.ID,
+		Effect:   p.Effect,
+		Subject:  p.withSubjects(subjects, anyOf) != nil,
+		Action:   p.withActions([]string{action}, o) != nil,
+		Resource: p.withResources([]string{resource}, o) != nil,
+		Active:   p.activeAt(now),
+	}
+	if !t.Subject || !t.Action || !t.Resource {
+		return t
+	}
+
+	conditions := applies == nil || applies(p)
+	t.Conditions = &conditions
+	t.Matched = t.Active && conditions
+	return t
+}
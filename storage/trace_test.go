@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluator_Explain(t *testing.T) {
+	ctx := context.Background()
+	expired := time.Now().Add(-time.Hour)
+	policies := Policies{
+		{ID: "allow-read", Subjects: []string{"<users:.*>"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"},
+		{ID: "deny-blocked", Subjects: []string{"users:blocked"}, Resources: []string{"articles"}, Actions: []string{"<.*>"}, Effect: "deny"},
+		{ID: "allow-write", Subjects: []string{"users:alice"}, Resources: []string{"comments"}, Actions: []string{"write"}, Effect: "allow"},
+		{ID: "allow-expired", Subjects: []string{"users:bob"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", NotAfter: &expired},
+		{ID: "allow-office", Subjects: []string{"users:carol"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow",
+			Conditions: map[string]interface{}{"ip": map[string]interface{}{"type": "CIDRCondition", "options": map[string]interface{}{"cidr": "10.0.0.0/8"}}}},
+	}
+
+	yes, no := true, false
+	for k, tc := range []struct {
+		subject, action, resource string
+		env                       map[string]interface{}
+		precedence                string
+		allowed, fallback         bool
+		decidedBy                 []string
+		traces                    map[string]PolicyTrace
+	}{
+		{
+			subject: "users:alice", action: "read", resource: "articles",
+			allowed: true, decidedBy: []string{"allow-read"},
+			traces: map[string]PolicyTrace{
+				"allow-read":   {ID: "allow-read", Effect: "allow", Subject: true, Action: true, Resource: true, Active: true, Conditions: &yes, Matched: true},
+				"deny-blocked": {ID: "deny-blocked", Effect: "deny", Action: true, Resource: true, Active: true},
+				"allow-write":  {ID: "allow-write", Effect: "allow", Subject: true, Active: true},
+			},
+		},
+		{
+			subject: "users:blocked", action: "read", resource: "articles",
+			decidedBy: []string{"deny-blocked"},
+			traces: map[string]PolicyTrace{
+				"allow-read":   {ID: "allow-read", Effect: "allow", Subject: true, Action: true, Resource: true, Active: true, Conditions: &yes, Matched: true},
+				"deny-blocked": {ID: "deny-blocked", Effect: "deny", Subject: true, Action: true, Resource: true, Active: true, Conditions: &yes, Matched: true},
+			},
+		},
+		{
+			subject: "users:blocked", action: "read", resource: "articles", precedence: "allow",
+			allowed: true, decidedBy: []string{"allow-read"},
+		},
+		{
+			subject: "users:bob", action: "read", resource: "articles",
+			allowed: true, decidedBy: []string{"allow-read"},
+			traces: map[string]PolicyTrace{
+				"allow-expired": {ID: "allow-expired", Effect: "allow", Subject: true, Action: true, Resource: true, Conditions: &yes},
+			},
+		},
+		{
+			subject: "users:carol", action: "read", resource: "articles", env: map[string]interface{}{"ip": "192.168.0.1"},
+			allowed: true, decidedBy: []string{"allow-read"},
+			traces: map[string]PolicyTrace{
+				"allow-office": {ID: "allow-office", Effect: "allow", Subject: true, Action: true, Resource: true, Active: true, Conditions: &no},
+			},
+		},
+		{
+			subject: "groups:admins", action: "delete", resource: "articles",
+			fallback: true, decidedBy: []string{},
+			traces: map[string]PolicyTrace{
+				"allow-read": {ID: "allow-read", Effect: "allow", Resource: true, Active: true},
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			e := NewEvaluator(NewMemoryManager(), "explain", WithEvaluatorPrecedence(tc.precedence))
+			trace, err := e.Explain(ctx, tc.subject, tc.action, tc.resource, tc.env, policies)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.allowed, trace.Allowed)
+			assert.Equal(t, tc.fallback, trace.Default)
+			assert.Equal(t, tc.decidedBy, trace.DecidedBy)
+
+			// every policy is traced in order, even after a matching deny policy.
+			require.Len(t, trace.Policies, len(policies))
+			byID := map[string]PolicyTrace{}
+			for i, p := range trace.Policies {
+				assert.Equal(t, policies[i].ID, p.ID)
+				byID[p.ID] = p
+			}
+			for id, expected := range tc.traces {
+				assert.Equal(t, expected, byID[id], id)
+			}
+
+			// the trace decides like the decision which is not explained.
+			d, err := e.decide(ctx, tc.subject, tc.action, tc.resource, tc.env, policies, false)
+			require.NoError(t, err)
+			assert.Equal(t, d.Allowed, trace.Allowed)
+			assert.Equal(t, d.Default, trace.Default)
+		})
+	}
+}
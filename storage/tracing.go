@@ -0,0 +1,14 @@
+package storage
+
+import (
+	"github.com/opentracing/opentracing-go"
+)
+
+// WithTracer sets the tracer which records a span for every request served by the handler. The span is a child of
+// the span in the request context, if there is one, and is passed on to the factory and the Manager. Defaults to a
+// tracer which records nothing.
+func WithTracer(tracer opentracing.Tracer) HandlerOption {
+	return func(h *Handler) {
+		h.tracer = tracer
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	m := NewTracedManager(NewMemoryManager(), tracer)
+	h := NewHandler(m, herodot.NewJSONWriter(nil), WithTracer(tracer))
+
+	r := httprouter.New()
+	r.GET("/roles/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "tracing", Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	r.GET("/roles", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		return &ListRequest{Collection: "tracing", Value: new(Roles)}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	require.NoError(t, m.Upsert(context.Background(), "tracing", "foo", &Role{ID: "foo"}))
+	tracer.Reset()
+
+	for _, tc := range []struct {
+		path    string
+		code    int
+		handler string
+		manager string
+		tags    map[string]interface{}
+		failed  bool
+	}{
+		{path: "/roles/foo", code: http.StatusOK, handler: "storage.handler.get", manager: "storage.get", tags: map[string]interface{}{"collection": "tracing", "key": "foo"}},
+		{path: "/roles/bar", code: http.StatusNotFound, handler: "storage.handler.get", manager: "storage.get", tags: map[string]interface{}{"collection": "tracing", "key": "bar"}, failed: true},
+		{path: "/roles", code: http.StatusOK, handler: "storage.handler.list", manager: "storage.list", tags: map[string]interface{}{"collection": "tracing", "count": 1}},
+	} {
+		t.Run("path="+tc.path, func(t *testing.T) {
+			tracer.Reset()
+			res, err := ts.Client().Get(ts.URL + tc.path)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, tc.code, res.StatusCode)
+
+			spans := tracer.FinishedSpans()
+			require.True(t, len(spans) >= 2)
+			child, parent := spans[0], spans[len(spans)-1]
+			for _, s := range spans[:len(spans)-1] {
+				assert.Equal(t, parent.SpanContext.SpanID, s.ParentID, s.OperationName)
+			}
+
+			assert.Equal(t, tc.handler, parent.OperationName)
+			assert.EqualValues(t, tc.code, parent.Tag("http.status_code"))
+			assert.Nil(t, parent.Tag("error"))
+
+			assert.Equal(t, tc.manager, child.OperationName)
+			for k, v := range tc.tags {
+				assert.Equal(t, v, child.Tag(k), k)
+			}
+			if tc.failed {
+				assert.Equal(t, true, child.Tag("error"))
+				require.Len(t, child.Logs(), 1)
+			} else {
+				assert.Nil(t, child.Tag("error"))
+			}
+		})
+	}
+}
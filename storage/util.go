@@ -1,5 +1,7 @@
 package storage
 
+import "reflect"
+
 func contains(target string, source []string) bool {
 	for _, i := range source {
 		if i == target {
@@ -8,3 +10,12 @@ func contains(target string, source []string) bool {
 	}
 	return false
 }
+
+// length returns the length of a slice or a pointer to a slice and zero for any other value.
+func length(value interface{}) int {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0
+	}
+	return v.Len()
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/ory/jsonschema/v3"
+	"github.com/pkg/errors"
+)
+
+// DefaultPolicySchema is the JSON Schema of a Policy. It only describes the shape of the struct, so additional fields
+// are allowed and the effect is checked by Policy.Validate.
+const DefaultPolicySchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "policy.schema.json",
+  "type": "object",
+  "definitions": {
+    "values": {
+      "type": ["array", "null"],
+      "items": {"type": "string"}
+    }
+  },
+  "properties": {
+    "id": {"type": "string"},
+    "description": {"type": "string"},
+    "subjects": {"$ref": "#/definitions/values"},
+    "resources": {"$ref": "#/definitions/values"},
+    "actions": {"$ref": "#/definitions/values"},
+    "effect": {"type": "string"},
+    "conditions": {
+      "type": ["object", "null"],
+      "additionalProperties": {
+        "type": "object",
+        "required": ["type"],
+        "properties": {
+          "type": {"type": "string", "minLength": 1},
+          "options": {"type": ["object", "null"]}
+        }
+      }
+    }
+  }
+}`
+
+// DefaultRoleSchema is the JSON Schema of a Role. It only describes the shape of the struct, so additional fields are
+// allowed and the members are checked by Role.Validate.
+const DefaultRoleSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "role.schema.json",
+  "type": "object",
+  "properties": {
+    "id": {"type": "string"},
+    "description": {"type": "string"},
+    "members": {
+      "type": ["array", "null"],
+      "items": {"type": "string"}
+    }
+  }
+}`
+
+var (
+	defaultPolicyValidator = mustCompileSchema("policy.schema.json", DefaultPolicySchema)
+	defaultRoleValidator   = mustCompileSchema("role.schema.json", DefaultRoleSchema)
+)
+
+// Validator checks JSON documents before they are stored.
+type Validator interface {
+	// Validate returns the violations of the document ordered by path, which are empty if it is valid. The error is only
+	// set if the document could not be checked, for example because it is no JSON.
+	Validate(document []byte) ([]Violation, error)
+}
+
+// Violation is a part of a document which violates its schema.
+type Violation struct {
+	// Path is the JSON Pointer of the violating value, for example "/subjects/0". It is empty for the whole document.
+	Path string `json:"path"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+// SchemaValidator checks documents against a JSON Schema.
+type SchemaValidator struct {
+	schema *jsonschema.Schema
+}
+
+var _ Validator = new(SchemaValidator)
+
+// DefaultPolicyValidator returns the validator of DefaultPolicySchema.
+func DefaultPolicyValidator() *SchemaValidator {
+	return defaultPolicyValidator
+}
+
+// DefaultRoleValidator returns the validator of DefaultRoleSchema.
+func DefaultRoleValidator() *SchemaValidator {
+	return defaultRoleValidator
+}
+
+// NewSchemaValidator compiles the JSON Schema found at the URL, which may also be a file path, for example to add
+// constraints to DefaultPolicySchema or DefaultRoleSchema.
+func NewSchemaValidator(url string) (*SchemaValidator, error) {
+	s, err := jsonschema.Compile(url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &SchemaValidator{schema: s}, nil
+}
+
+func mustCompileSchema(url, schema string) *SchemaValidator {
+	s, err := jsonschema.CompileString(url, schema)
+	if err != nil {
+		panic(err)
+	}
+	return &SchemaValidator{schema: s}
+}
+
+func (v *SchemaValidator) Validate(document []byte) ([]Violation, error) {
+	err := v.schema.Validate(bytes.NewReader(document))
+	if err == nil {
+		return nil, nil
+	}
+
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil, errors.WithStack(err)
+	}
+
+	var violations []Violation
+	collectViolations(verr, &violations)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations, nil
+}
+
+// collectViolations appends the innermost causes of the validation error, which name the actual violations.
+func collectViolations(err *jsonschema.ValidationError, violations *[]Violation) {
+	if len(err.Causes) == 0 {
+		*violations = append(*violations, Violation{Path: strings.TrimPrefix(err.InstancePtr, "#"), Message: err.Message})
+		return
+	}
+	for _, c := range err.Causes {
+		collectViolations(c, violations)
+	}
+}
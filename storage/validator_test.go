@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	t.Run("case=default policy schema", func(t *testing.T) {
+		for _, doc := range []string{
+			`{"id":"p","subjects":["alice"],"resources":["r"],"actions":["a"],"effect":"allow"}`,
+			`{"id":"p","subjects":null,"conditions":null}`,
+			`{"id":"p","conditions":{"ip":{"type":"CIDRCondition","options":{"cidr":"10.0.0.0/8"}}},"unknown":true}`,
+		} {
+			violations, err := DefaultPolicyValidator().Validate([]byte(doc))
+			require.NoError(t, err)
+			assert.Empty(t, violations, doc)
+		}
+
+		for doc, path := range map[string]string{
+			`[]`:                                              "",
+			`{"subjects":"alice"}`:                            "/subjects",
+			`{"resources":["a",1]}`:                           "/resources/1",
+			`{"actions":[null]}`:                              "/actions/0",
+			`{"effect":true}`:                                 "/effect",
+			`{"conditions":{"ip":"CIDRCondition"}}`:           "/conditions/ip",
+			`{"conditions":{"ip":{"options":{}}}}`:            "/conditions/ip",
+			`{"conditions":{"ip":{"type":""}}}`:               "/conditions/ip/type",
+			`{"conditions":{"ip":{"type":"A","options":[]}}}`: "/conditions/ip/options",
+		} {
+			violations, err := DefaultPolicyValidator().Validate([]byte(doc))
+			require.NoError(t, err)
+			require.Len(t, violations, 1, doc)
+			assert.Equal(t, path, violations[0].Path, doc)
+			assert.NotEmpty(t, violations[0].Message)
+		}
+	})
+
+	t.Run("case=default role schema", func(t *testing.T) {
+		violations, err := DefaultRoleValidator().Validate([]byte(`{"id":"r","members":["alice"],"description":"d"}`))
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+
+		violations, err = DefaultRoleValidator().Validate([]byte(`{"id":1,"members":["alice",{}]}`))
+		require.NoError(t, err)
+		require.Len(t, violations, 2)
+		assert.ElementsMatch(t, []string{"/id", "/members/1"}, []string{violations[0].Path, violations[1].Path})
+	})
+
+	t.Run("case=custom schema", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "keto-schema")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "role.schema.json")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{
+  "type": "object",
+  "required": ["description"],
+  "properties": {"id": {"type": "string", "pattern": "^team:"}}
+}`), 0600))
+
+		v, err := NewSchemaValidator(path)
+		require.NoError(t, err)
+
+		violations, err := v.Validate([]byte(`{"id":"team:a","description":"A"}`))
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+
+		violations, err = v.Validate([]byte(`{"id":"a"}`))
+		require.NoError(t, err)
+		assert.Len(t, violations, 2)
+
+		_, err = v.Validate([]byte(`{`))
+		assert.Error(t, err)
+
+		_, err = NewSchemaValidator(filepath.Join(dir, "unknown.json"))
+		assert.Error(t, err)
+	})
+}
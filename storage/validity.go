@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ory/x/logrusx"
+)
+
+// activeAt reports whether the policy applies at the time. A policy applies from its "not_before" time, inclusive,
+// until its "not_after" time, exclusive. Either bound is optional.
+func (p *Policy) activeAt(t time.Time) bool {
+	if p.NotBefore != nil && t.Before(*p.NotBefore) {
+		return false
+	}
+	if p.NotAfter != nil && !t.Before(*p.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// expiredBefore reports whether the policy stopped applying at or before the time.
+func (p *Policy) expiredBefore(t time.Time) bool {
+	return p.NotAfter != nil && !p.NotAfter.After(t)
+}
+
+// withActiveOnly keeps the policy if the value is "true" and the policy applies at the time of the filter options.
+// Values which are not booleans are rejected by validateActiveOnlyFilter.
+func (p *Policy) withActiveOnly(values []string, o *filterOptions) *Policy {
+	if p == nil || len(values) == 0 || values[0] == "" {
+		return p
+	}
+	if active, err := strconv.ParseBool(values[0]); err != nil || !active || p.activeAt(o.now) {
+		return p
+	}
+	return nil
+}
+
+// validity describes the validity window of the policy in words.
+func (p *Policy) validity() string {
+	switch {
+	case p.NotBefore != nil && p.NotAfter != nil:
+		return fmt.Sprintf("The policy applies from %s until %s.", p.NotBefore.Format(time.RFC3339), p.NotAfter.Format(time.RFC3339))
+	case p.NotBefore != nil:
+		return fmt.Sprintf("The policy applies from %s.", p.NotBefore.Format(time.RFC3339))
+	case p.NotAfter != nil:
+		return fmt.Sprintf("The policy applies until %s.", p.NotAfter.Format(time.RFC3339))
+	}
+	return "The policy always applies."
+}
+
+// WithEvaluatorClock sets the function which returns the time at which the validity of policies is checked. Defaults
+// to time.Now.
+func WithEvaluatorClock(now func() time.Time) EvaluatorOption {
+	return func(e *Evaluator) {
+		e.now = now
+	}
+}
+
+// ExpiredPolicySweeper deletes policies which expired longer ago than the retention, so that temporary grants do not
+// have to be cleaned up by hand. Expired policies never match, so deleting them does not change any decision.
+type ExpiredPolicySweeper struct {
+	h           *Handler
+	collections []string
+	retention   time.Duration
+	now         func() time.Time
+	l           *logrusx.Logger
+}
+
+// NewExpiredPolicySweeper returns a sweeper for the policies of the collections which deletes them through the
+// handler, so that the deletions are audited and notified like those of requests and protected policies are kept. A
+// retention of zero deletes policies as soon as they expire.
+func NewExpiredPolicySweeper(h *Handler, collections []string, retention time.Duration, l *logrusx.Logger) *ExpiredPolicySweeper {
+	return &ExpiredPolicySweeper{h: h, collections: collections, retention: retention, now: time.Now, l: l}
+}
+
+// Sweep deletes the policies whose "not_after" time is at least the retention in the past and returns how many were
+// deleted from every collection. Protected policies are kept, see WithProtectedKeys. Deleted policies are kept as
+// tombstones if soft deletion is enabled.
+func (s *ExpiredPolicySweeper) Sweep(ctx context.Context) (map[string]int, error) {
+	cutoff := s.now().Add(-s.retention)
+	res := make(map[string]int, len(s.collections))
+	for _, collection := range s.collections {
+		var policies Policies
+		if err := s.h.s.ListAll(ctx, collection, &policies); err != nil {
+			return res, err
+		}
+
+		var keys, protected []string
+		for k := range policies {
+			if !policies[k].expiredBefore(cutoff) {
+				continue
+			}
+			if s.h.isProtected(policies[k].ID) {
+				protected = append(protected, policies[k].ID)
+				continue
+			}
+			keys = append(keys, policies[k].ID)
+		}
+		if len(protected) > 0 && s.l != nil {
+			s.l.WithField("collection", collection).WithField("keys", protected).Infof("Kept %d expired policies because they are protected.", len(protected))
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		// the operation names the audit and change events like those of requests.
+		ctx := context.WithValue(ctx, operationKey{}, &operation{name: "sweep_expired_policies", collection: collection})
+		if err := s.h.deleteMany(ctx, s.h.s, collection, keys, false); err != nil {
+			return res, err
+		}
+		s.h.audit(ctx, keys...)
+
+		res[collection] = len(keys)
+		if s.l != nil {
+			s.l.WithField("collection", collection).WithField("keys", keys).Infof("Deleted %d expired policies.", len(keys))
+		}
+	}
+	return res, nil
+}
+
+// Run sweeps at every interval until the context is done. Failed sweeps are logged and retried at the next interval.
+// Intervals which are not positive fall back to an hour.
+func (s *ExpiredPolicySweeper) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := s.Sweep(ctx); err != nil && s.l != nil {
+			s.l.WithError(err).Errorf("Unable to delete expired policies.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
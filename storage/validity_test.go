@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+type recordingNotifier []ChangeEvent
+
+func (n *recordingNotifier) Notify(e ChangeEvent) {
+	*n = append(*n, e)
+}
+
+func TestPolicyValidity(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	t.Run("case=active at", func(t *testing.T) {
+		p := Policy{NotBefore: &start, NotAfter: &end}
+		for k, tc := range []struct {
+			at     time.Time
+			active bool
+		}{
+			{at: start.Add(-time.Nanosecond), active: false},
+			{at: start, active: true},
+			{at: start.Add(time.Minute), active: true},
+			{at: end.Add(-time.Nanosecond), active: true},
+			{at: end, active: false},
+			{at: end.Add(time.Nanosecond), active: false},
+		} {
+			assert.Equal(t, tc.active, p.activeAt(tc.at), "%d", k)
+		}
+
+		assert.True(t, (&Policy{}).activeAt(start))
+		assert.True(t, (&Policy{NotBefore: &start}).activeAt(end))
+		assert.False(t, (&Policy{NotAfter: &end}).activeAt(end))
+	})
+
+	t.Run("case=validate", func(t *testing.T) {
+		p := Policy{ID: "window", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow"}
+		p.NotBefore, p.NotAfter = &start, &end
+		require.NoError(t, p.Validate(false))
+
+		p.NotBefore, p.NotAfter = &end, &start
+		require.Error(t, p.Validate(false))
+		require.NoError(t, p.Validate(true))
+
+		p.NotBefore, p.NotAfter = &start, &start
+		require.Error(t, p.Validate(false))
+	})
+
+	t.Run("case=evaluator", func(t *testing.T) {
+		ctx := context.Background()
+		m := NewMemoryManager()
+		require.NoError(t, m.UpsertMany(ctx, "validity", map[string]interface{}{
+			"temporary": &Policy{ID: "temporary", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: "allow", NotBefore: &start, NotAfter: &end},
+			"freeze":    &Policy{ID: "freeze", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "deny", NotBefore: &start},
+			"write":     &Policy{ID: "write", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"write"}, Effect: "allow"},
+		}))
+
+		for k, tc := range []struct {
+			at            time.Time
+			read, written bool
+		}{
+			{at: start.Add(-time.Nanosecond), read: false, written: true},
+			{at: start, read: true, written: false},
+			{at: end.Add(-time.Nanosecond), read: true, written: false},
+			{at: end, read: false, written: false},
+		} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				e := NewEvaluator(m, "validity", WithEvaluatorClock(func() time.Time { return tc.at }))
+
+				allowed, err := e.Allowed(ctx, "alice", "read", "articles", nil)
+				require.NoError(t, err)
+				assert.Equal(t, tc.read, allowed)
+
+				allowed, err = e.Allowed(ctx, "alice", "write", "articles", nil)
+				require.NoError(t, err)
+				assert.Equal(t, tc.written, allowed)
+			})
+		}
+	})
+
+	t.Run("case=active only", func(t *testing.T) {
+		past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+		policies := Policies{
+			{ID: "always"},
+			{ID: "expired", NotAfter: &past},
+			{ID: "pending", NotBefore: &future},
+			{ID: "current", NotBefore: &past, NotAfter: &future},
+		}
+
+		for v, expected := range map[string][]string{
+			"true":  {"always", "current"},
+			"false": {"always", "current", "expired", "pending"},
+			"":      {"always", "current", "expired", "pending"},
+		} {
+			t.Run("active_only="+v, func(t *testing.T) {
+				ps := append(Policies{}, policies...)
+				res, err := filterPolicies(&ps, map[string][]string{"active_only": {v}}, 0, 100)
+				require.NoError(t, err)
+
+				var ids []string
+				for _, p := range *res.(*Policies) {
+					ids = append(ids, p.ID)
+				}
+				assert.Equal(t, expected, ids)
+			})
+		}
+
+		_, err := filterPolicies(&policies, map[string][]string{"active_only": {"yes"}}, 0, 100)
+		require.Error(t, err)
+	})
+
+	t.Run("case=sweep", func(t *testing.T) {
+		ctx := context.Background()
+		m := NewMemoryManager()
+		long, recent := start.Add(-48*time.Hour), start.Add(-time.Hour)
+		require.NoError(t, m.UpsertMany(ctx, "sweep", map[string]interface{}{
+			"long-expired":   &Policy{ID: "long-expired", NotAfter: &long},
+			"recent-expired": &Policy{ID: "recent-expired", NotAfter: &recent},
+			"expires-now":    &Policy{ID: "expires-now", NotAfter: &start},
+			"permanent":      &Policy{ID: "permanent"},
+			"guard-expired":  &Policy{ID: "guard-expired", NotAfter: &long},
+		}))
+
+		sink, notifier := new(recordingAuditSink), new(recordingNotifier)
+		h := NewHandler(m, herodot.NewJSONWriter(nil), WithProtectedKeys("<guard-.*>"), WithAuditSink(sink), WithChangeNotifier(notifier))
+		s := NewExpiredPolicySweeper(h, []string{"sweep"}, 24*time.Hour, nil)
+		s.now = func() time.Time { return start }
+		n, err := s.Sweep(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"sweep": 1}, n)
+		assert.Equal(t, []AuditEvent{{Operation: "sweep_expired_policies", Collection: "sweep", Keys: []string{"long-expired"}}}, sink.reset(t))
+		require.Len(t, *notifier, 1)
+		assert.Equal(t, "long-expired", (*notifier)[0].Key)
+		assert.Equal(t, "sweep_expired_policies", (*notifier)[0].Op)
+
+		s.retention = 0
+		n, err = s.Sweep(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"sweep": 2}, n)
+
+		var remaining Policies
+		require.NoError(t, m.ListAll(ctx, "sweep", &remaining))
+		require.Len(t, remaining, 2)
+		assert.Equal(t, "guard-expired", remaining[0].ID)
+		assert.Equal(t, "permanent", remaining[1].ID)
+
+		n, err = s.Sweep(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, n)
+	})
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	yamlv2 "gopkg.in/yaml.v2"
+
+	"github.com/ory/herodot"
+)
+
+const yamlContentType = "application/x-yaml"
+
+// acceptsYAML checks if the Accept header of the request prefers YAML to JSON. YAML has to be requested explicitly: it
+// is preferred if its weight is at least the weight of JSON, which includes wildcards such as "*/*". Otherwise the
+// response is JSON.
+func acceptsYAML(r *http.Request) bool {
+	var yamlWeight, jsonWeight float64
+	for _, v := range r.Header.Values("Accept") {
+		for _, accepted := range strings.Split(v, ",") {
+			parts := strings.Split(accepted, ";")
+			weight := 1.0
+			for _, p := range parts[1:] {
+				if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+					var err error
+					if weight, err = strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64); err != nil {
+						weight = 0
+					}
+				}
+			}
+
+			switch strings.ToLower(strings.TrimSpace(parts[0])) {
+			case yamlContentType:
+				if weight > yamlWeight {
+					yamlWeight = weight
+				}
+			case "application/json", "application/*", "*/*":
+				if weight > jsonWeight {
+					jsonWeight = weight
+				}
+			}
+		}
+	}
+	return yamlWeight > 0 && yamlWeight >= jsonWeight
+}
+
+// write writes the value as YAML if the client prefers it, see acceptsYAML, and as JSON otherwise. Errors are always
+// written as JSON. The value is normalized and projected to the requested fields first, see canonicalize and
+// projectFields.
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, e interface{}) {
+	e, err := prepare(r, e)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	}
+	h.writeValue(w, r, e)
+}
+
+// prepare normalizes the value, counts the members of roles if requested, and projects it to the requested fields,
+// see canonicalize, countMembers, and projectFields.
+func prepare(r *http.Request, e interface{}) (interface{}, error) {
+	e, err := canonicalize(r, e)
+	if err != nil {
+		return nil, err
+	}
+	if e, err = countMembers(r, e); err != nil {
+		return nil, err
+	}
+	return projectFields(r, e)
+}
+
+// writeValue writes the value as is, as YAML if the client prefers it and as JSON otherwise.
+func (h *Handler) writeValue(w http.ResponseWriter, r *http.Request, e interface{}) {
+	w.Header().Add("Vary", "Accept")
+	if !acceptsYAML(r) {
+		h.h.Write(w, r, e)
+		return
+	}
+
+	if h.naming == NamingCamelCase {
+		var err error
+		if e, err = toCamelCase(e); err != nil {
+			h.h.WriteError(w, r, err)
+			return
+		}
+	}
+
+	b, err := marshalYAML(e)
+	if err != nil {
+		h.h.WriteError(w, r, err)
+		return
+	}
+
+	cw, done := compress(w, r, h.compressionThreshold)
+	defer done()
+	cw.Header().Set("Content-Type", yamlContentType)
+	cw.WriteHeader(http.StatusOK)
+	_, _ = cw.Write(b)
+}
+
+// marshalYAML encodes the value as YAML. The value is encoded as JSON first, so the YAML document has the same fields
+// in the same order as the JSON response, including the omission of empty fields.
+func marshalYAML(e interface{}) ([]byte, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return jsonToYAML(b)
+}
+
+func jsonToYAML(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	v, err := orderedValue(d)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := yamlv2.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// orderedValue decodes the next JSON value of the decoder. Objects are decoded to yaml.MapSlice, which keeps the
+// order of their keys, rather than to maps, which the YAML encoder would sort.
+func orderedValue(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := yamlv2.MapSlice{}
+			for d.More() {
+				k, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := orderedValue(d)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, yamlv2.MapItem{Key: k, Value: v})
+			}
+			_, err := d.Token()
+			return m, err
+		case '[':
+			s := []interface{}{}
+			for d.More() {
+				v, err := orderedValue(d)
+				if err != nil {
+					return nil, err
+				}
+				s = append(s, v)
+			}
+			_, err := d.Token()
+			return s, err
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return t, nil
+}
+
+// isYAML checks if the Content-Type header of the request is YAML.
+func isYAML(r *http.Request) bool {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && t == yamlContentType
+}
+
+// decodeYAMLBody replaces a YAML request body by the equivalent JSON body, so that factories only ever decode JSON.
+func decodeYAMLBody(r *http.Request) error {
+	if !isYAML(r) || r.Body == nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(bytes.TrimSpace(b)) > 0 {
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the YAML body: %s", err))
+		}
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	r.Header.Set("Content-Type", "application/json")
+	return nil
+}
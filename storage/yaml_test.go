@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/herodot"
+)
+
+func TestYAML(t *testing.T) {
+	m := NewMemoryManager()
+	h := NewHandler(m, herodot.NewJSONWriter(nil))
+	r := httprouter.New()
+	r.GET("/list", h.List(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ListRequest, error) {
+		p := make(Roles, 0)
+		return &ListRequest{Collection: "/tests/yaml", Value: &p, FilterFunc: ListByQuery}, nil
+	}))
+	r.GET("/get/:id", h.Get(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*GetRequest, error) {
+		return &GetRequest{Collection: "/tests/yaml", Key: ps.ByName("id"), Value: new(Role)}, nil
+	}))
+	r.GET("/export", h.Export(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*ExportRequest, error) {
+		return &ExportRequest{Collection: "/tests/yaml", Filename: "roles.jsonl"}, nil
+	}))
+	r.PUT("/upsert", h.Upsert(func(ctx context.Context, r *http.Request, ps httprouter.Params) (*UpsertRequest, error) {
+		var role Role
+		if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+			return nil, err
+		}
+		return &UpsertRequest{Collection: "/tests/yaml", Key: role.ID, Value: &role}, nil
+	}))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, header, value, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+
+	t.Run("case=upsert", func(t *testing.T) {
+		res, body := do(t, "PUT", "/upsert", "Content-Type", "application/x-yaml", "id: yaml-b\ndescription: b\nmembers:\n- alice\n- bob\n")
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+		assert.JSONEq(t, `{"id":"yaml-b","description":"b","members":["alice","bob"]}`, body)
+
+		res, body = do(t, "PUT", "/upsert", "Content-Type", "application/json", `{"id":"yaml-a","members":[]}`)
+		require.Equal(t, http.StatusOK, res.StatusCode, body)
+
+		res, _ = do(t, "PUT", "/upsert", "Content-Type", "application/x-yaml", "id: [yaml-c")
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("case=get", func(t *testing.T) {
+		res, body := do(t, "GET", "/get/yaml-b", "Accept", "application/x-yaml", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/x-yaml", res.Header.Get("Content-Type"))
+		assert.Equal(t, "id: yaml-b\ndescription: b\nmembers:\n- alice\n- bob\n", body)
+
+		for _, accept := range []string{"", "application/json", "application/x-yaml;q=0.5, application/json", "application/x-yaml;q=0"} {
+			res, body = do(t, "GET", "/get/yaml-b", "Accept", accept, "")
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Contains(t, res.Header.Get("Content-Type"), "application/json", accept)
+			assert.JSONEq(t, `{"id":"yaml-b","description":"b","members":["alice","bob"]}`, body, accept)
+		}
+
+		res, body = do(t, "GET", "/get/yaml-unknown", "Accept", "application/x-yaml", "")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+	})
+
+	t.Run("case=list", func(t *testing.T) {
+		res, body := do(t, "GET", "/list", "Accept", "application/x-yaml, */*", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/x-yaml", res.Header.Get("Content-Type"))
+		assert.Equal(t, "2", res.Header.Get("X-Total-Count"))
+		assert.Equal(t, "- id: yaml-a\n  description: \"\"\n  members: []\n- id: yaml-b\n  description: b\n  members:\n  - alice\n  - bob\n", body)
+	})
+
+	t.Run("case=export", func(t *testing.T) {
+		res, body := do(t, "GET", "/export", "Accept", "application/x-yaml", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/x-yaml", res.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=roles.yaml`, res.Header.Get("Content-Disposition"))
+		// the export keeps the order of the backend.
+		assert.ElementsMatch(t, []string{"", "id: yaml-a\ndescription: \"\"\nmembers: []\n", "id: yaml-b\ndescription: b\nmembers:\n- alice\n- bob\n"}, strings.Split(body, "---\n"))
+	})
+}